@@ -146,6 +146,18 @@ func TestLogoutCmd_RemoveTokens(t *testing.T) {
 	}
 }
 
+// Login and logout cannot change a token from the environment
+func TestAuthCommands_EnvStorageReadOnly(t *testing.T) {
+	t.Setenv("CLAUDE_GATE_AUTH_STORAGE_TYPE", "env")
+	t.Setenv(auth.EnvOAuthRefreshToken, "env-refresh")
+	
+	err := (&LoginCmd{}).Run(nil)
+	assert.ErrorIs(t, err, errEnvStorageReadOnly)
+	
+	err = (&LogoutCmd{}).Run(nil)
+	assert.ErrorIs(t, err, errEnvStorageReadOnly)
+}
+
 // Test auth subcommands parsing
 func TestAuthCommands_Parsing(t *testing.T) {
 	// Test that auth subcommands are properly structured
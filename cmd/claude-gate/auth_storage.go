@@ -16,14 +16,16 @@ type AuthStorageCmd struct {
 	Test    AuthStorageTestCmd    `cmd:"" help:"Test storage backend operations"`
 	Backup  AuthStorageBackupCmd  `cmd:"" help:"Create manual backup of tokens"`
 	Reset   AuthStorageResetCmd   `cmd:"" help:"Reset keychain items with proper trust settings"`
+	Rekey   AuthStorageRekeyCmd   `cmd:"" help:"Re-encrypt encrypted file storage with a new passphrase"`
 }
 
 // AuthStorageStatusCmd shows storage backend status
 type AuthStorageStatusCmd struct{}
 
-func (cmd *AuthStorageStatusCmd) Run(ctx *kong.Context) error {
+func (cmd *AuthStorageStatusCmd) Run(ctx *kong.Context, globals *Globals) error {
 	cfg := config.DefaultConfig()
 	cfg.LoadFromEnv()
+	globals.apply(cfg)
 	
 	// Create storage factory
 	factory := auth.NewStorageFactory(createStorageFactoryConfig(cfg))
@@ -75,7 +77,11 @@ func (cmd *AuthStorageStatusCmd) Run(ctx *kong.Context) error {
 	// Show configuration
 	fmt.Println("\nConfiguration:")
 	fmt.Printf("  Storage Path: %s\n", cfg.AuthStoragePath)
+	fmt.Printf("  Encrypted Storage Path: %s\n", cfg.EncryptedStoragePath)
 	fmt.Printf("  Keyring Service: %s\n", cfg.KeyringService)
+	if cfg.StorageHelper != "" {
+		fmt.Printf("  Credential Helper: %s (timeout %s)\n", cfg.StorageHelper, cfg.StorageHelperTimeout)
+	}
 	fmt.Printf("  Auto-Migrate: %v\n", cfg.AutoMigrateTokens)
 	
 	return nil
@@ -83,14 +89,15 @@ func (cmd *AuthStorageStatusCmd) Run(ctx *kong.Context) error {
 
 // AuthStorageMigrateCmd migrates tokens between storage backends
 type AuthStorageMigrateCmd struct {
-	From   string `help:"Source storage type (file/keyring)" default:"file"`
-	To     string `help:"Destination storage type (file/keyring)" default:"keyring"`
+	From   string `help:"Source storage type (file/keyring/encrypted-file/exec)" default:"file"`
+	To     string `help:"Destination storage type (file/keyring/encrypted-file/exec)" default:"keyring"`
 	DryRun bool   `help:"Show what would be migrated without making changes"`
 }
 
-func (cmd *AuthStorageMigrateCmd) Run(ctx *kong.Context) error {
+func (cmd *AuthStorageMigrateCmd) Run(ctx *kong.Context, globals *Globals) error {
 	cfg := config.DefaultConfig()
 	cfg.LoadFromEnv()
+	globals.apply(cfg)
 	
 	// Create source storage
 	sourceCfg := createStorageFactoryConfig(cfg)
@@ -162,9 +169,10 @@ func (cmd *AuthStorageMigrateCmd) Run(ctx *kong.Context) error {
 // AuthStorageTestCmd tests storage backend operations
 type AuthStorageTestCmd struct{}
 
-func (cmd *AuthStorageTestCmd) Run(ctx *kong.Context) error {
+func (cmd *AuthStorageTestCmd) Run(ctx *kong.Context, globals *Globals) error {
 	cfg := config.DefaultConfig()
 	cfg.LoadFromEnv()
+	globals.apply(cfg)
 	
 	// Create storage
 	factory := auth.NewStorageFactory(createStorageFactoryConfig(cfg))
@@ -260,15 +268,20 @@ func (cmd *AuthStorageBackupCmd) Run(ctx *kong.Context) error {
 	cfg := config.DefaultConfig()
 	cfg.LoadFromEnv()
 	
-	// Only backup file storage
-	if cfg.AuthStorageType != "file" {
+	// Only backup file storage; encrypted files are copied as they are
+	authPath := cfg.AuthStoragePath
+	switch cfg.AuthStorageType {
+	case "file":
+	case "encrypted-file":
+		authPath = cfg.EncryptedStoragePath
+	default:
 		fmt.Println("Backup is only supported for file storage")
 		fmt.Println("Keyring storage is backed up by the operating system")
 		return nil
 	}
 	
 	// Check if auth file exists
-	if _, err := os.Stat(cfg.AuthStoragePath); os.IsNotExist(err) {
+	if _, err := os.Stat(authPath); os.IsNotExist(err) {
 		fmt.Println("No auth file to backup")
 		return nil
 	}
@@ -277,8 +290,8 @@ func (cmd *AuthStorageBackupCmd) Run(ctx *kong.Context) error {
 	fmt.Println("Creating backup...")
 	
 	// For now, use a simple copy
-	backupPath := cfg.AuthStoragePath + ".backup"
-	data, err := os.ReadFile(cfg.AuthStoragePath)
+	backupPath := authPath + ".backup"
+	data, err := os.ReadFile(authPath)
 	if err != nil {
 		return fmt.Errorf("failed to read auth file: %w", err)
 	}
@@ -296,14 +309,15 @@ type AuthStorageResetCmd struct {
 	Force bool `help:"Skip confirmation prompt" short:"f"`
 }
 
-func (cmd *AuthStorageResetCmd) Run(ctx *kong.Context) error {
+func (cmd *AuthStorageResetCmd) Run(ctx *kong.Context, globals *Globals) error {
 	cfg := config.DefaultConfig()
 	cfg.LoadFromEnv()
+	globals.apply(cfg)
 	
 	// Only applicable for keyring storage
-	if cfg.AuthStorageType == "file" {
+	if cfg.AuthStorageType == "file" || cfg.AuthStorageType == "encrypted-file" || cfg.AuthStorageType == "env" {
 		fmt.Println("Reset is only applicable for keyring storage")
-		fmt.Println("Current storage type is 'file'")
+		fmt.Printf("Current storage type is '%s'\n", cfg.AuthStorageType)
 		return nil
 	}
 	
@@ -380,4 +394,49 @@ func (cmd *AuthStorageResetCmd) Run(ctx *kong.Context) error {
 	}
 	
 	return nil
-}
\ No newline at end of file
+}
+
+// AuthStorageRekeyCmd re-encrypts encrypted file storage with a new passphrase
+type AuthStorageRekeyCmd struct {
+	NewPasswordFile    string `help:"File containing the new passphrase" type:"path"`
+	NewPasswordCommand string `help:"Command that prints the new passphrase"`
+}
+
+func (cmd *AuthStorageRekeyCmd) Run(ctx *kong.Context, globals *Globals) error {
+	cfg := config.DefaultConfig()
+	cfg.LoadFromEnv()
+	globals.apply(cfg)
+	
+	// The current passphrase opens the storage as usual
+	factoryCfg := createStorageFactoryConfig(cfg)
+	factoryCfg.Type = auth.StorageTypeEncryptedFile
+	storage, err := auth.NewStorageFactory(factoryCfg).Create()
+	if err != nil {
+		return fmt.Errorf("failed to open current storage: %w", err)
+	}
+	encrypted, ok := storage.(*auth.EncryptedFileStorage)
+	if !ok {
+		return fmt.Errorf("rekey requires encrypted file storage")
+	}
+	
+	// Flags take precedence over the environment
+	newPassphrase := auth.PassphraseConfig{File: cmd.NewPasswordFile, Command: cmd.NewPasswordCommand}
+	if !newPassphrase.IsSet() {
+		newPassphrase.Passphrase = os.Getenv("CLAUDE_GATE_STORAGE_NEW_PASSPHRASE")
+	}
+	if !newPassphrase.IsSet() {
+		return fmt.Errorf("no new passphrase: use --new-password-file, --new-password-command or CLAUDE_GATE_STORAGE_NEW_PASSPHRASE")
+	}
+	passphrase, err := newPassphrase.Resolve()
+	if err != nil {
+		return fmt.Errorf("failed to read new passphrase: %w", err)
+	}
+	
+	if err := encrypted.Rekey(passphrase); err != nil {
+		return fmt.Errorf("failed to rekey storage: %w", err)
+	}
+	
+	fmt.Printf("Re-encrypted %s with the new passphrase\n", cfg.EncryptedStoragePath)
+	fmt.Println("Update CLAUDE_GATE_STORAGE_PASSPHRASE, the password file or --password-command, and restart any running server")
+	return nil
+}
@@ -3,10 +3,13 @@ package main
 import (
 	"io"
 	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/alecthomas/kong"
+	"github.com/ml0-1337/claude-gate/internal/auth"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 // captureAuthOutput captures stdout during test execution for auth commands
@@ -33,7 +36,7 @@ func TestAuthStorageStatusCmd_Run(t *testing.T) {
 		
 		output := captureAuthOutput(func() {
 			// Don't check error as it depends on storage availability
-			_ = cmd.Run(&kong.Context{})
+			_ = cmd.Run(&kong.Context{}, nil)
 		})
 		
 		// Check output contains expected sections
@@ -73,7 +76,7 @@ func TestAuthStorageMigrateCmd_Validation(t *testing.T) {
 		}
 		
 		output := captureAuthOutput(func() {
-			err := cmd.Run(&kong.Context{})
+			err := cmd.Run(&kong.Context{}, nil)
 			assert.NoError(t, err)
 		})
 		
@@ -123,7 +126,7 @@ func TestAuthStorageResetCmd_Run(t *testing.T) {
 		
 		output := captureAuthOutput(func() {
 			// Just run without checking error
-			_ = cmd.Run(&kong.Context{})
+			_ = cmd.Run(&kong.Context{}, nil)
 		})
 		
 		// Should either show "no tokens" or "reset only for keyring"
@@ -155,7 +158,7 @@ func TestAuthStorageTestCmd_Run(t *testing.T) {
 		cmd := &AuthStorageTestCmd{}
 		
 		output := captureAuthOutput(func() {
-			err := cmd.Run(&kong.Context{})
+			err := cmd.Run(&kong.Context{}, nil)
 			assert.NoError(t, err)
 		})
 		
@@ -168,4 +171,45 @@ func TestAuthStorageTestCmd_Run(t *testing.T) {
 		assert.Contains(t, output, "Testing remove operation...")
 		assert.Contains(t, output, "All tests passed!")
 	})
-}
\ No newline at end of file
+}
+
+// AuthStorageRekeyCmd should re-encrypt encrypted file storage
+func TestAuthStorageRekeyCmd_Run(t *testing.T) {
+	tmpDir := t.TempDir()
+	encPath := filepath.Join(tmpDir, "auth.enc")
+	newPasswordFile := filepath.Join(tmpDir, "new-password")
+	require.NoError(t, os.WriteFile(newPasswordFile, []byte("new-secret\n"), 0600))
+	
+	storage, err := auth.NewEncryptedFileStorage(encPath, "old-secret")
+	require.NoError(t, err)
+	require.NoError(t, storage.Set("anthropic", &auth.TokenInfo{Type: "oauth", RefreshToken: "test-refresh"}))
+	
+	t.Setenv("CLAUDE_GATE_ENCRYPTED_STORAGE_PATH", encPath)
+	t.Setenv("CLAUDE_GATE_STORAGE_PASSPHRASE", "old-secret")
+	
+	t.Run("requires a new passphrase", func(t *testing.T) {
+		err := (&AuthStorageRekeyCmd{}).Run(&kong.Context{}, nil)
+		assert.ErrorContains(t, err, "no new passphrase")
+	})
+	
+	t.Run("rekeys with the password file", func(t *testing.T) {
+		output := captureAuthOutput(func() {
+			err := (&AuthStorageRekeyCmd{NewPasswordFile: newPasswordFile}).Run(&kong.Context{}, nil)
+			assert.NoError(t, err)
+		})
+		assert.Contains(t, output, "Re-encrypted "+encPath)
+		
+		_, err := auth.NewEncryptedFileStorage(encPath, "old-secret")
+		assert.ErrorIs(t, err, auth.ErrWrongPassphrase)
+		rekeyed, err := auth.NewEncryptedFileStorage(encPath, "new-secret")
+		require.NoError(t, err)
+		token, err := rekeyed.Get("anthropic")
+		require.NoError(t, err)
+		assert.Equal(t, "test-refresh", token.RefreshToken)
+	})
+	
+	t.Run("wrong current passphrase", func(t *testing.T) {
+		err := (&AuthStorageRekeyCmd{NewPasswordFile: newPasswordFile}).Run(&kong.Context{}, nil)
+		assert.ErrorIs(t, err, auth.ErrWrongPassphrase)
+	})
+}
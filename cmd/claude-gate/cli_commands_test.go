@@ -116,6 +116,8 @@ func TestCreateStorageFactoryConfig(t *testing.T) {
 	cfg.KeychainAccessibleWhenUnlocked = false
 	cfg.KeychainSynchronizable = true
 	cfg.KeyringService = "custom-service"
+	cfg.EncryptedStoragePath = "/custom/path/auth.enc"
+	cfg.StoragePasswordFile = "/custom/path/password"
 	
 	result := createStorageFactoryConfig(cfg)
 	
@@ -125,6 +127,12 @@ func TestCreateStorageFactoryConfig(t *testing.T) {
 	assert.True(t, result.KeychainTrustApp)
 	assert.False(t, result.KeychainAccessibleWhenUnlocked)
 	assert.True(t, result.KeychainSynchronizable)
+	assert.Equal(t, "/custom/path/auth.enc", result.EncryptedFilePath)
+	assert.Equal(t, auth.PassphraseConfig{File: "/custom/path/password"}, result.Passphrase)
+	
+	// --password-command replaces the configured sources
+	(&Globals{PasswordCommand: "pass show claude-gate"}).apply(cfg)
+	assert.Equal(t, auth.PassphraseConfig{Command: "pass show claude-gate"}, createStorageFactoryConfig(cfg).Passphrase)
 }
 
 // Test 9: version command should display version information
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/alecthomas/kong"
+	"github.com/ml0-1337/claude-gate/internal/auth"
+	"github.com/ml0-1337/claude-gate/internal/config"
+)
+
+// KeysCmd manages per-client virtual API keys
+type KeysCmd struct {
+	Create KeysCreateCmd `cmd:"" help:"Create a new proxy key for a client"`
+	List   KeysListCmd   `cmd:"" help:"List proxy keys"`
+	Revoke KeysRevokeCmd `cmd:"" help:"Revoke a proxy key"`
+	Rotate KeysRotateCmd `cmd:"" help:"Replace the secret of a proxy key"`
+}
+
+// KeysCreateCmd creates a new proxy key
+type KeysCreateCmd struct {
+	Name          string   `arg:"" help:"Name identifying the client (e.g. laptop-alice)"`
+	Models        []string `help:"Allowed models, comma separated (trailing * matches a prefix)"`
+	Endpoints     []string `help:"Allowed endpoints, comma separated (e.g. /v1/messages)"`
+	Expires       string   `help:"Expiry as a duration (720h) or date (2006-01-02)"`
+	DailyTokens   int64    `help:"Daily token quota (0 = unlimited)"`
+	DailyRequests int64    `help:"Daily request quota (0 = unlimited)"`
+}
+
+func (cmd *KeysCreateCmd) Run(ctx *kong.Context) error {
+	cfg := config.DefaultConfig()
+	cfg.LoadFromEnv()
+
+	expiresAt, err := parseKeyExpiry(cmd.Expires, time.Now())
+	if err != nil {
+		return err
+	}
+
+	registry := auth.NewKeyRegistry(cfg.ProxyKeysPath)
+	secret, key, err := registry.Create(cmd.Name, auth.ProxyKeyOptions{
+		AllowedModels:     cmd.Models,
+		AllowedEndpoints:  cmd.Endpoints,
+		ExpiresAt:         expiresAt,
+		DailyTokenQuota:   cmd.DailyTokens,
+		DailyRequestQuota: cmd.DailyRequests,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create key: %w", err)
+	}
+
+	fmt.Printf("Created key %s (%s)\n", key.Name, key.ID)
+	fmt.Printf("\n  %s\n\n", secret)
+	fmt.Println("Store this secret now - it cannot be shown again.")
+	fmt.Println("Clients send it as 'Authorization: Bearer <key>' or 'x-api-key: <key>'.")
+	return nil
+}
+
+// KeysListCmd lists proxy keys
+type KeysListCmd struct {
+	All bool `help:"Include revoked keys"`
+}
+
+func (cmd *KeysListCmd) Run(ctx *kong.Context) error {
+	cfg := config.DefaultConfig()
+	cfg.LoadFromEnv()
+
+	registry := auth.NewKeyRegistry(cfg.ProxyKeysPath)
+	keys, err := registry.List()
+	if err != nil {
+		return fmt.Errorf("failed to list keys: %w", err)
+	}
+
+	shown := 0
+	for _, key := range keys {
+		if key.IsRevoked() && !cmd.All {
+			continue
+		}
+		if shown == 0 {
+			fmt.Println("Proxy Keys")
+			fmt.Println("==========")
+		}
+		shown++
+
+		fmt.Printf("\n%s (%s) - %s\n", key.Name, key.ID, keyStatus(key))
+		fmt.Printf("  Prefix:    %s...\n", key.Prefix)
+		fmt.Printf("  Created:   %s\n", time.Unix(key.CreatedAt, 0).Format("2006-01-02 15:04:05"))
+		if key.ExpiresAt != 0 {
+			fmt.Printf("  Expires:   %s\n", time.Unix(key.ExpiresAt, 0).Format("2006-01-02 15:04:05"))
+		}
+		fmt.Printf("  Models:    %s\n", formatScope(key.AllowedModels))
+		fmt.Printf("  Endpoints: %s\n", formatScope(key.AllowedEndpoints))
+		fmt.Printf("  Quotas:    %s tokens/day, %s requests/day\n",
+			formatQuota(key.DailyTokenQuota), formatQuota(key.DailyRequestQuota))
+	}
+
+	if shown == 0 {
+		fmt.Println("No proxy keys found")
+		fmt.Println("Run 'claude-gate keys create <name>' to issue one")
+	}
+	return nil
+}
+
+// KeysRevokeCmd revokes a proxy key
+type KeysRevokeCmd struct {
+	Key string `arg:"" help:"Name or ID of the key to revoke"`
+}
+
+func (cmd *KeysRevokeCmd) Run(ctx *kong.Context) error {
+	cfg := config.DefaultConfig()
+	cfg.LoadFromEnv()
+
+	registry := auth.NewKeyRegistry(cfg.ProxyKeysPath)
+	if err := registry.Revoke(cmd.Key); err != nil {
+		return fmt.Errorf("failed to revoke key: %w", err)
+	}
+
+	fmt.Printf("Revoked key %s\n", cmd.Key)
+	return nil
+}
+
+// KeysRotateCmd replaces the secret of a proxy key
+type KeysRotateCmd struct {
+	Key string `arg:"" help:"Name or ID of the key to rotate"`
+}
+
+func (cmd *KeysRotateCmd) Run(ctx *kong.Context) error {
+	cfg := config.DefaultConfig()
+	cfg.LoadFromEnv()
+
+	registry := auth.NewKeyRegistry(cfg.ProxyKeysPath)
+	secret, key, err := registry.Rotate(cmd.Key)
+	if err != nil {
+		return fmt.Errorf("failed to rotate key: %w", err)
+	}
+
+	fmt.Printf("Rotated key %s (%s)\n", key.Name, key.ID)
+	fmt.Printf("\n  %s\n\n", secret)
+	fmt.Println("The previous secret no longer works. Store this one now - it cannot be shown again.")
+	return nil
+}
+
+// parseKeyExpiry parses an expiry given as a duration or a date
+func parseKeyExpiry(value string, now time.Time) (int64, error) {
+	if value == "" {
+		return 0, nil
+	}
+	if d, err := time.ParseDuration(value); err == nil {
+		if d <= 0 {
+			return 0, fmt.Errorf("expiry duration must be positive")
+		}
+		return now.Add(d).Unix(), nil
+	}
+	if t, err := time.ParseInLocation("2006-01-02", value, time.Local); err == nil {
+		return t.Unix(), nil
+	}
+	return 0, fmt.Errorf("invalid expiry %q: use a duration like 720h or a date like 2006-01-02", value)
+}
+
+// keyStatus describes whether a key can currently be used
+func keyStatus(key *auth.ProxyKey) string {
+	switch {
+	case key.IsRevoked():
+		return "Revoked"
+	case key.IsExpired():
+		return "Expired"
+	default:
+		return "Active"
+	}
+}
+
+// formatScope formats an allow list for display
+func formatScope(values []string) string {
+	if len(values) == 0 {
+		return "all"
+	}
+	return strings.Join(values, ", ")
+}
+
+// formatQuota formats a quota for display
+func formatQuota(quota int64) string {
+	if quota == 0 {
+		return "unlimited"
+	}
+	return fmt.Sprintf("%d", quota)
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/alecthomas/kong"
+	"github.com/ml0-1337/claude-gate/internal/auth"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestKeysCommands_Lifecycle(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keys.json")
+	os.Setenv("CLAUDE_GATE_PROXY_KEYS_PATH", path)
+	defer os.Unsetenv("CLAUDE_GATE_PROXY_KEYS_PATH")
+
+	secretPattern := regexp.MustCompile(`cgk_[A-Za-z0-9_-]+`)
+	registry := auth.NewKeyRegistry(path)
+
+	stdout, _, err := captureOutput(func() error {
+		cmd := &KeysListCmd{}
+		return cmd.Run(&kong.Context{})
+	})
+	require.NoError(t, err)
+	assert.Contains(t, stdout, "No proxy keys found")
+
+	stdout, _, err = captureOutput(func() error {
+		cmd := &KeysCreateCmd{Name: "laptop", Models: []string{"claude-3-5-haiku*"}, DailyTokens: 5000}
+		return cmd.Run(&kong.Context{})
+	})
+	require.NoError(t, err)
+	secret := secretPattern.FindString(stdout)
+	require.NotEmpty(t, secret)
+
+	_, err = registry.Lookup(secret)
+	require.NoError(t, err)
+
+	stdout, _, err = captureOutput(func() error {
+		cmd := &KeysListCmd{}
+		return cmd.Run(&kong.Context{})
+	})
+	require.NoError(t, err)
+	assert.Contains(t, stdout, "laptop")
+	assert.Contains(t, stdout, "claude-3-5-haiku*")
+	assert.Contains(t, stdout, "5000 tokens/day")
+	assert.NotContains(t, stdout, secret)
+
+	stdout, _, err = captureOutput(func() error {
+		cmd := &KeysRotateCmd{Key: "laptop"}
+		return cmd.Run(&kong.Context{})
+	})
+	require.NoError(t, err)
+	rotated := secretPattern.FindString(stdout)
+	require.NotEmpty(t, rotated)
+	assert.NotEqual(t, secret, rotated)
+
+	_, _, err = captureOutput(func() error {
+		cmd := &KeysRevokeCmd{Key: "laptop"}
+		return cmd.Run(&kong.Context{})
+	})
+	require.NoError(t, err)
+
+	_, err = registry.Lookup(rotated)
+	assert.ErrorIs(t, err, auth.ErrProxyKeyRevoked)
+
+	stdout, _, err = captureOutput(func() error {
+		cmd := &KeysListCmd{All: true}
+		return cmd.Run(&kong.Context{})
+	})
+	require.NoError(t, err)
+	assert.Contains(t, stdout, "Revoked")
+}
+
+func TestParseKeyExpiry(t *testing.T) {
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.Local)
+
+	expiry, err := parseKeyExpiry("", now)
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), expiry)
+
+	expiry, err = parseKeyExpiry("48h", now)
+	require.NoError(t, err)
+	assert.Equal(t, now.Add(48*time.Hour).Unix(), expiry)
+
+	expiry, err = parseKeyExpiry("2025-02-01", now)
+	require.NoError(t, err)
+	assert.Equal(t, time.Date(2025, 2, 1, 0, 0, 0, 0, time.Local).Unix(), expiry)
+
+	_, err = parseKeyExpiry("-1h", now)
+	assert.Error(t, err)
+
+	_, err = parseKeyExpiry("next week", now)
+	assert.Error(t, err)
+}
@@ -1,11 +1,14 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
+	"log/slog"
 	"net/http"
 	"os"
 	"os/signal"
+	"sort"
 	"strings"
 	"syscall"
 	"time"
@@ -28,16 +31,130 @@ func createStorageFactoryConfig(cfg *config.Config) auth.StorageFactoryConfig {
 		Type:                           auth.StorageType(cfg.AuthStorageType),
 		FilePath:                       cfg.AuthStoragePath,
 		ServiceName:                    cfg.KeyringService,
+		EncryptedFilePath:              cfg.EncryptedStoragePath,
+		Passphrase:                     createPassphraseConfig(cfg),
+		HelperCommand:                  cfg.StorageHelper,
+		HelperTimeout:                  cfg.StorageHelperTimeout,
 		KeychainTrustApp:               cfg.KeychainTrustApp,
 		KeychainAccessibleWhenUnlocked: cfg.KeychainAccessibleWhenUnlocked,
 		KeychainSynchronizable:         cfg.KeychainSynchronizable,
 	}
 }
 
+// createPassphraseConfig returns the passphrase sources of encrypted token storage
+func createPassphraseConfig(cfg *config.Config) auth.PassphraseConfig {
+	return auth.PassphraseConfig{
+		Passphrase: cfg.StoragePassphrase,
+		File:       cfg.StoragePasswordFile,
+		Command:    cfg.StoragePasswordCommand,
+	}
+}
+
+// createRateLimitConfig creates the proxy rate limit settings, or nil when rate limiting is disabled
+func createRateLimitConfig(cfg *config.Config) *proxy.RateLimitConfig {
+	if !cfg.EnableRateLimit {
+		return nil
+	}
+	return &proxy.RateLimitConfig{
+		RequestsPerMinute:     cfg.RateLimitPerMinute,
+		InputTokensPerMinute:  cfg.RateLimitInputTokensPerMinute,
+		OutputTokensPerMinute: cfg.RateLimitOutputTokensPerMinute,
+	}
+}
+
+// createRetryConfig creates the upstream retry policies, or nil when no request is retried
+func createRetryConfig(cfg *config.Config) *proxy.RetryConfig {
+	policy := func(attempts int) proxy.RetryPolicy {
+		return proxy.RetryPolicy{
+			MaxAttempts:    attempts,
+			InitialBackoff: cfg.RetryInitialBackoff,
+			MaxBackoff:     cfg.RetryMaxBackoff,
+			MaxElapsed:     cfg.RetryMaxElapsed,
+		}
+	}
+	retry := &proxy.RetryConfig{
+		Default: policy(cfg.RetryMaxAttempts),
+		Routes:  make(map[string]proxy.RetryPolicy),
+	}
+	enabled := cfg.RetryMaxAttempts > 1
+	for path, attempts := range cfg.RetryRouteAttempts {
+		retry.Routes[path] = policy(attempts)
+		enabled = enabled || attempts > 1
+	}
+	if !enabled {
+		return nil
+	}
+	return retry
+}
+
+// describeRetries summarizes the upstream retry policies for the startup banner
+func describeRetries(cfg *config.Config) string {
+	if cfg.RetryMaxAttempts > 1 {
+		return fmt.Sprintf("Up to %d attempts within %s", cfg.RetryMaxAttempts, cfg.RetryMaxElapsed)
+	}
+	// Only some routes are retried
+	var routes []string
+	for path, attempts := range cfg.RetryRouteAttempts {
+		if attempts > 1 {
+			routes = append(routes, fmt.Sprintf("%s (%d attempts)", path, attempts))
+		}
+	}
+	if len(routes) == 0 {
+		return "Disabled"
+	}
+	sort.Strings(routes)
+	return fmt.Sprintf("%s within %s", strings.Join(routes, ", "), cfg.RetryMaxElapsed)
+}
+
+// startTokenRefresher renews OAuth tokens in the background until the returned function is called
+func startTokenRefresher(cfg *config.Config, provider *auth.OAuthTokenProvider, log *slog.Logger) context.CancelFunc {
+	ctx, cancel := context.WithCancel(context.Background())
+	if cfg.TokenRefreshBefore <= 0 {
+		return cancel
+	}
+	refresher := auth.NewTokenRefresher(provider, auth.RefresherConfig{
+		Before:     cfg.TokenRefreshBefore,
+		Jitter:     cfg.TokenRefreshJitter,
+		StatusPath: cfg.TokenRefreshStatusPath,
+		Logger:     log,
+	})
+	go refresher.Run(ctx)
+	return cancel
+}
+
+// createCORS creates the cross-origin policy for browser clients from the config
+func createCORS(cfg *config.Config) (*proxy.CORS, error) {
+	return proxy.NewCORS(proxy.CORSConfig{
+		AllowOrigins:  cfg.CORSAllowOrigins,
+		AllowHeaders:  cfg.CORSAllowHeaders,
+		ExposeHeaders: cfg.CORSExposeHeaders,
+		MaxAge:        cfg.CORSMaxAge,
+	})
+}
+
+// Globals are the flags shared by every command. Kong passes them to the commands that use them.
+type Globals struct {
+	PasswordCommand string `help:"Command that prints the passphrase of encrypted token storage" placeholder:"CMD"`
+}
+
+// apply overrides the configuration loaded from the environment with the global flags
+func (g *Globals) apply(cfg *config.Config) {
+	if g == nil || g.PasswordCommand == "" {
+		return
+	}
+	// --password-command replaces every passphrase source from the environment
+	cfg.StoragePassphrase = ""
+	cfg.StoragePasswordFile = ""
+	cfg.StoragePasswordCommand = g.PasswordCommand
+}
+
 type CLI struct {
+	Globals
+	
 	Start     StartCmd     `cmd:"" help:"Start the Claude OAuth proxy server"`
 	Dashboard DashboardCmd `cmd:"" help:"Start server with interactive dashboard"`
 	Auth      AuthCmd      `cmd:"" help:"Authentication management commands"`
+	Keys      KeysCmd      `cmd:"" help:"Manage per-client proxy API keys"`
 	Test      TestCmd      `cmd:"" help:"Test the proxy connection"`
 	Version   VersionCmd   `cmd:"" help:"Show version information"`
 }
@@ -47,7 +164,7 @@ type StartCmd struct {
 	Port          int    `help:"Port to bind the proxy server" default:"5789"`
 	AuthToken     string `help:"Enable proxy authentication with this token" env:"CLAUDE_GATE_PROXY_AUTH_TOKEN"`
 	LogLevel      string `help:"Logging level (DEBUG, INFO, WARNING, ERROR)" default:"INFO"`
-	StorageBackend string `help:"Storage backend (auto, keyring, file, claude-code)" default:"auto" enum:"auto,keyring,file,claude-code"`
+	StorageBackend string `help:"Storage backend (auto, keyring, file, encrypted-file, exec, env, claude-code)" default:"auto" enum:"auto,keyring,file,encrypted-file,exec,env,claude-code"`
 	SkipAuthCheck bool   `help:"Skip OAuth authentication check"`
 }
 
@@ -56,7 +173,7 @@ type DashboardCmd struct {
 	Port          int    `help:"Port to bind the proxy server" default:"5789"`
 	AuthToken     string `help:"Enable proxy authentication with this token" env:"CLAUDE_GATE_PROXY_AUTH_TOKEN"`
 	LogLevel      string `help:"Logging level (DEBUG, INFO, WARNING, ERROR)" default:"INFO"`
-	StorageBackend string `help:"Storage backend (auto, keyring, file, claude-code)" default:"auto" enum:"auto,keyring,file,claude-code"`
+	StorageBackend string `help:"Storage backend (auto, keyring, file, encrypted-file, exec, env, claude-code)" default:"auto" enum:"auto,keyring,file,encrypted-file,exec,env,claude-code"`
 	SkipAuthCheck bool   `help:"Skip OAuth authentication check"`
 }
 
@@ -77,7 +194,7 @@ type TestCmd struct {
 
 type VersionCmd struct{}
 
-func (s *StartCmd) Run() error {
+func (s *StartCmd) Run(globals *Globals) error {
 	cfg := config.DefaultConfig()
 	cfg.Host = s.Host
 	cfg.Port = s.Port
@@ -85,6 +202,7 @@ func (s *StartCmd) Run() error {
 	cfg.LogLevel = s.LogLevel
 	cfg.AuthStorageType = s.StorageBackend
 	cfg.LoadFromEnv()
+	globals.apply(cfg)
 	
 	out := ui.NewOutput()
 	
@@ -107,6 +225,15 @@ func (s *StartCmd) Run() error {
 		out.Success("OAuth authentication configured and ready")
 	}
 	
+	// Per-client keys are accepted alongside the shared token
+	keys := auth.NewKeyRegistry(cfg.ProxyKeysPath)
+	proxyAuthEnabled := proxy.NewProxyAuthWithKeys(cfg.ProxyAuthToken, keys).Enabled()
+	
+	cors, err := createCORS(cfg)
+	if err != nil {
+		return fmt.Errorf("invalid CORS configuration: %w", err)
+	}
+	
 	// Print startup banner
 	out.Title("🚀 Claude OAuth Proxy")
 	
@@ -115,16 +242,35 @@ func (s *StartCmd) Run() error {
 		{"Server URL", fmt.Sprintf("http://%s", cfg.GetBindAddress())},
 		{"Anthropic API", cfg.AnthropicBaseURL},
 		{"Proxy Auth", func() string {
-			if cfg.ProxyAuthToken != "" {
+			if proxyAuthEnabled {
 				return "Enabled"
 			}
 			return "Disabled"
 		}()},
+		{"Rate Limit", func() string {
+			if !cfg.EnableRateLimit {
+				return "Disabled"
+			}
+			return fmt.Sprintf("%d requests/min per client", cfg.RateLimitPerMinute)
+		}()},
+		{"Upstream Retries", describeRetries(cfg)},
+		{"Token Refresh", func() string {
+			if cfg.TokenRefreshBefore <= 0 {
+				return "On demand"
+			}
+			return fmt.Sprintf("%s before expiry", cfg.TokenRefreshBefore)
+		}()},
+		{"CORS Origins", func() string {
+			if !cors.Enabled() {
+				return "Blocked"
+			}
+			return strings.Join(cfg.CORSAllowOrigins, ", ")
+		}()},
 		{"OpenAI Compatible", fmt.Sprintf("http://%s/v1", cfg.GetBindAddress())},
 	}
 	out.Table(headers, rows)
 	
-	if cfg.ProxyAuthToken == "" {
+	if !proxyAuthEnabled {
 		out.Warning("Proxy authentication disabled - anyone can use this proxy")
 	}
 	
@@ -139,20 +285,31 @@ func (s *StartCmd) Run() error {
 	}
 	
 	tokenProvider := auth.NewOAuthTokenProvider(storage)
-	transformer := proxy.NewRequestTransformer()
+	transformer := proxy.NewRequestTransformerWithConfig(proxy.TransformerConfig{
+		StrictOpenAIParams: cfg.OpenAIStrictParams,
+		HideReasoning:      cfg.OpenAIHideReasoning,
+	})
 	
 	// Create logger
 	log := logger.New(logger.ParseLevel(cfg.LogLevel))
 	
 	proxyConfig := &proxy.ProxyConfig{
-		UpstreamURL:   cfg.AnthropicBaseURL,
-		TokenProvider: tokenProvider,
-		Transformer:   transformer,
-		Timeout:       cfg.RequestTimeout,
-		Logger:        log,
+		UpstreamURL:    cfg.AnthropicBaseURL,
+		TokenProvider:  tokenProvider,
+		Transformer:    transformer,
+		Timeout:        cfg.RequestTimeout,
+		MaxRequestSize: int64(cfg.MaxRequestSize),
+		Logger:         log,
+		AuthToken:      cfg.ProxyAuthToken,
+		Keys:           keys,
+		RateLimit:      createRateLimitConfig(cfg),
+		Retry:          createRetryConfig(cfg),
+		CORS:           cors,
 	}
 	
 	server := proxy.NewProxyServer(proxyConfig, cfg.GetBindAddress(), storage)
+	stopRefresher := startTokenRefresher(cfg, tokenProvider, log)
+	defer stopRefresher()
 	
 	// Handle graceful shutdown
 	sigChan := make(chan os.Signal, 1)
@@ -175,7 +332,7 @@ func (s *StartCmd) Run() error {
 	return nil
 }
 
-func (d *DashboardCmd) Run() error {
+func (d *DashboardCmd) Run(globals *Globals) error {
 	cfg := config.DefaultConfig()
 	cfg.Host = d.Host
 	cfg.Port = d.Port
@@ -183,9 +340,15 @@ func (d *DashboardCmd) Run() error {
 	cfg.LogLevel = d.LogLevel
 	cfg.AuthStorageType = d.StorageBackend
 	cfg.LoadFromEnv()
+	globals.apply(cfg)
 	
 	out := ui.NewOutput()
 	
+	cors, err := createCORS(cfg)
+	if err != nil {
+		return fmt.Errorf("invalid CORS configuration: %w", err)
+	}
+	
 	// Check authentication unless skipped
 	if !d.SkipAuthCheck {
 		// Create storage using factory
@@ -213,20 +376,31 @@ func (d *DashboardCmd) Run() error {
 	}
 	
 	tokenProvider := auth.NewOAuthTokenProvider(storage)
-	transformer := proxy.NewRequestTransformer()
+	transformer := proxy.NewRequestTransformerWithConfig(proxy.TransformerConfig{
+		StrictOpenAIParams: cfg.OpenAIStrictParams,
+		HideReasoning:      cfg.OpenAIHideReasoning,
+	})
 	
 	// Create logger
 	log := logger.New(logger.ParseLevel(cfg.LogLevel))
 	
 	proxyConfig := &proxy.ProxyConfig{
-		UpstreamURL:   cfg.AnthropicBaseURL,
-		TokenProvider: tokenProvider,
-		Transformer:   transformer,
-		Timeout:       cfg.RequestTimeout,
-		Logger:        log,
+		UpstreamURL:    cfg.AnthropicBaseURL,
+		TokenProvider:  tokenProvider,
+		Transformer:    transformer,
+		Timeout:        cfg.RequestTimeout,
+		MaxRequestSize: int64(cfg.MaxRequestSize),
+		Logger:         log,
+		AuthToken:      cfg.ProxyAuthToken,
+		Keys:           auth.NewKeyRegistry(cfg.ProxyKeysPath),
+		RateLimit:      createRateLimitConfig(cfg),
+		Retry:          createRetryConfig(cfg),
+		CORS:           cors,
 	}
 	
 	server := proxy.NewEnhancedProxyServer(proxyConfig, cfg.GetBindAddress(), storage)
+	stopRefresher := startTokenRefresher(cfg, tokenProvider, log)
+	defer stopRefresher()
 	
 	// Get dashboard model
 	dashboardModel := server.GetDashboard()
@@ -276,9 +450,14 @@ func (d *DashboardCmd) Run() error {
 	return nil
 }
 
-func (l *LoginCmd) Run() error {
+// errEnvStorageReadOnly is returned by commands that would change an environment token
+var errEnvStorageReadOnly = fmt.Errorf("env storage is read-only: set %s (or %s and %s) instead, or log in with another storage backend",
+	auth.EnvOAuthToken, auth.EnvOAuthAccessToken, auth.EnvOAuthRefreshToken)
+
+func (l *LoginCmd) Run(globals *Globals) error {
 	cfg := config.DefaultConfig()
 	cfg.LoadFromEnv()
+	globals.apply(cfg)
 	
 	// Create storage using factory
 	factory := auth.NewStorageFactory(createStorageFactoryConfig(cfg))
@@ -287,6 +466,9 @@ func (l *LoginCmd) Run() error {
 	if err != nil {
 		return fmt.Errorf("failed to create storage: %w", err)
 	}
+	if _, ok := storage.(*auth.EnvStorage); ok {
+		return errEnvStorageReadOnly
+	}
 	
 	client := auth.NewOAuthClient()
 	out := ui.NewOutput()
@@ -356,9 +538,10 @@ func (l *LoginCmd) Run() error {
 	return nil
 }
 
-func (l *LogoutCmd) Run() error {
+func (l *LogoutCmd) Run(globals *Globals) error {
 	cfg := config.DefaultConfig()
 	cfg.LoadFromEnv()
+	globals.apply(cfg)
 	
 	// Create storage using factory
 	factory := auth.NewStorageFactory(createStorageFactoryConfig(cfg))
@@ -367,6 +550,9 @@ func (l *LogoutCmd) Run() error {
 	if err != nil {
 		return fmt.Errorf("failed to create storage: %w", err)
 	}
+	if _, ok := storage.(*auth.EnvStorage); ok {
+		return errEnvStorageReadOnly
+	}
 	
 	out := ui.NewOutput()
 	
@@ -385,9 +571,10 @@ func (l *LogoutCmd) Run() error {
 	return nil
 }
 
-func (s *StatusCmd) Run() error {
+func (s *StatusCmd) Run(globals *Globals) error {
 	cfg := config.DefaultConfig()
 	cfg.LoadFromEnv()
+	globals.apply(cfg)
 	
 	// Create storage using factory
 	factory := auth.NewStorageFactory(createStorageFactoryConfig(cfg))
@@ -419,6 +606,19 @@ func (s *StatusCmd) Run() error {
 		} else {
 			out.Info("Token expires: %s", expires.Format("2006-01-02 15:04:05"))
 		}
+		
+		// Refreshes done by a running proxy server
+		if status, err := auth.LoadRefreshStatus(cfg.TokenRefreshStatusPath); err == nil {
+			if !status.LastRefresh.IsZero() {
+				out.Info("Last refresh: %s", status.LastRefresh.Format("2006-01-02 15:04:05"))
+			}
+			if status.NextRefresh.After(time.Now()) {
+				out.Info("Next background refresh: %s", status.NextRefresh.Format("2006-01-02 15:04:05"))
+			}
+			if status.Failures > 0 {
+				out.Warning("%d refresh attempt(s) failed: %s", status.Failures, status.LastError)
+			}
+		}
 	} else {
 		out.Warning("API Key Authentication: Configured")
 		out.Info("Consider using OAuth for free usage")
@@ -431,7 +631,7 @@ func (s *StatusCmd) Run() error {
 		{"Default host", cfg.Host},
 		{"Default port", fmt.Sprintf("%d", cfg.Port)},
 		{"Auth required", func() string {
-			if cfg.ProxyAuthToken != "" {
+			if proxy.NewProxyAuthWithKeys(cfg.ProxyAuthToken, auth.NewKeyRegistry(cfg.ProxyKeysPath)).Enabled() {
 				return "Yes"
 			}
 			return "No"
@@ -505,7 +705,7 @@ func main() {
 		kong.UsageOnError(),
 	)
 	
-	if err := ctx.Run(); err != nil {
+	if err := ctx.Run(&cli.Globals); err != nil {
 		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 		os.Exit(1)
 	}
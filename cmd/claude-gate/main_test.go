@@ -12,6 +12,7 @@ import (
 
 	"github.com/alecthomas/kong"
 	"github.com/ml0-1337/claude-gate/internal/auth"
+	"github.com/ml0-1337/claude-gate/internal/config"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -115,7 +116,7 @@ func TestStartCmd_MissingAuthentication(t *testing.T) {
 	
 	// Run the command and expect it to fail
 	stdout, stderr, err := captureOutput(func() error {
-		return cmd.Run()
+		return cmd.Run(nil)
 	})
 	
 	// Should return an error about missing authentication
@@ -279,7 +280,7 @@ func TestStatusCmd_DisplayStatus(t *testing.T) {
 			
 			// Run command
 			stdout, stderr, err := captureOutput(func() error {
-				return cmd.Run()
+				return cmd.Run(nil)
 			})
 			
 			// Check error
@@ -461,4 +462,19 @@ func TestMain_CLIParsing(t *testing.T) {
 			}
 		})
 	}
-}
\ No newline at end of file
+}
+
+// The startup banner reports retries enabled for single routes
+func TestDescribeRetries(t *testing.T) {
+	cfg := config.DefaultConfig()
+	cfg.RetryMaxAttempts = 1
+	cfg.RetryMaxElapsed = time.Minute
+	assert.Equal(t, "Disabled", describeRetries(cfg))
+	
+	cfg.RetryRouteAttempts = map[string]int{"/v1/messages": 5, "/v1/chat/completions": 1}
+	assert.Equal(t, "/v1/messages (5 attempts) within 1m0s", describeRetries(cfg))
+	assert.NotNil(t, createRetryConfig(cfg))
+	
+	cfg.RetryMaxAttempts = 3
+	assert.Equal(t, "Up to 3 attempts within 1m0s", describeRetries(cfg))
+}
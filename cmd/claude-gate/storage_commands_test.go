@@ -64,7 +64,7 @@ func TestStorageStatusCmd_ShowDetails(t *testing.T) {
 	
 	// Run command
 	stdout, stderr, err := captureOutput(func() error {
-		return cmd.Run(&kong.Context{})
+		return cmd.Run(&kong.Context{}, nil)
 	})
 	
 	// Should not error
@@ -98,7 +98,7 @@ func TestStorageTestCmd_Operations(t *testing.T) {
 	
 	// Run command
 	stdout, stderr, err := captureOutput(func() error {
-		return cmd.Run(&kong.Context{})
+		return cmd.Run(&kong.Context{}, nil)
 	})
 	
 	// Should not error
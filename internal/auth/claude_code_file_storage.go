@@ -0,0 +1,177 @@
+package auth
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// ClaudeCodeFileStorage implements StorageBackend with the credentials file Claude Code keeps
+// on Linux, ~/.claude/.credentials.json. Refreshed tokens are written back in Claude Code's
+// format, so that both keep working after the shared refresh token has been rotated.
+type ClaudeCodeFileStorage struct {
+	mu   sync.Mutex
+	path string
+}
+
+// DefaultClaudeCodeCredentialsPath returns the credentials file of Claude Code, which follows
+// CLAUDE_CONFIG_DIR when it is set
+func DefaultClaudeCodeCredentialsPath() string {
+	dir := os.Getenv("CLAUDE_CONFIG_DIR")
+	if dir == "" {
+		homeDir, _ := os.UserHomeDir()
+		dir = filepath.Join(homeDir, ".claude")
+	}
+	return filepath.Join(dir, ".credentials.json")
+}
+
+// NewClaudeCodeFileStorage creates a storage adapter for Claude Code's credentials file
+func NewClaudeCodeFileStorage(path string) *ClaudeCodeFileStorage {
+	return &ClaudeCodeFileStorage{path: path}
+}
+
+// Get retrieves and transforms Claude Code credentials
+func (s *ClaudeCodeFileStorage) Get(provider string) (*TokenInfo, error) {
+	// Claude Code only supports anthropic
+	if provider != "anthropic" {
+		return nil, nil
+	}
+
+	// The file is replaced atomically, so it is read without the lock
+	data, err := s.read()
+	if err != nil || data == nil {
+		return nil, err
+	}
+	token, err := claudeCodeToken(data)
+	if err != nil {
+		return nil, err
+	}
+	if token.AccessToken == "" && token.RefreshToken == "" {
+		// Claude Code is not logged in with an OAuth account
+		return nil, nil
+	}
+	return token, nil
+}
+
+// Set writes a refreshed token back to the file, keeping the rest of it intact
+func (s *ClaudeCodeFileStorage) Set(provider string, token *TokenInfo) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	lock, err := s.lock()
+	if err != nil {
+		return err
+	}
+	defer lock.unlock()
+	return s.set(provider, token)
+}
+
+// Remove is not supported, as it would log Claude Code out
+func (s *ClaudeCodeFileStorage) Remove(provider string) error {
+	return errClaudeCodeLogout
+}
+
+// List returns available providers
+func (s *ClaudeCodeFileStorage) List() ([]string, error) {
+	token, err := s.Get("anthropic")
+	if err != nil {
+		return nil, err
+	}
+	if token == nil {
+		return []string{}, nil
+	}
+	return []string{"anthropic"}, nil
+}
+
+// WithLock runs fn while holding the lock file, so that Claude Gate processes sharing the
+// login refresh it one at a time. Claude Code itself does not take this lock.
+func (s *ClaudeCodeFileStorage) WithLock(fn func(storage StorageBackend) error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	lock, err := s.lock()
+	if err != nil {
+		return err
+	}
+	defer lock.unlock()
+	return fn(&lockedClaudeCodeFileStorage{s})
+}
+
+// lockedClaudeCodeFileStorage accesses a ClaudeCodeFileStorage whose locks are held by WithLock
+type lockedClaudeCodeFileStorage struct {
+	*ClaudeCodeFileStorage
+}
+
+func (l *lockedClaudeCodeFileStorage) Set(provider string, token *TokenInfo) error {
+	return l.set(provider, token)
+}
+
+// IsAvailable checks if the backend is available
+func (s *ClaudeCodeFileStorage) IsAvailable() bool {
+	return true
+}
+
+// RequiresUnlock checks if the backend needs to be unlocked
+func (s *ClaudeCodeFileStorage) RequiresUnlock() bool {
+	return false
+}
+
+// Unlock is a no-op for Claude Code storage
+func (s *ClaudeCodeFileStorage) Unlock() error {
+	return nil
+}
+
+// Lock is a no-op for Claude Code storage
+func (s *ClaudeCodeFileStorage) Lock() error {
+	return nil
+}
+
+// Name returns the backend name
+func (s *ClaudeCodeFileStorage) Name() string {
+	return "claude-code-file:" + s.path
+}
+
+// read returns the contents of the file, or nil when Claude Code has not logged in yet
+func (s *ClaudeCodeFileStorage) read() ([]byte, error) {
+	data, err := os.ReadFile(s.path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read Claude Code credentials: %w", err)
+	}
+	return data, nil
+}
+
+// set merges the token into the file. The caller must hold the locks.
+func (s *ClaudeCodeFileStorage) set(provider string, token *TokenInfo) error {
+	if provider != "anthropic" {
+		return fmt.Errorf("Claude Code storage only holds the anthropic token")
+	}
+
+	existing, err := s.read()
+	if err != nil {
+		return err
+	}
+	data, err := mergeClaudeCodeCredentials(existing, token)
+	if err != nil {
+		return err
+	}
+	if err := writeFileAtomic(s.path, data); err != nil {
+		return fmt.Errorf("failed to write Claude Code credentials: %w", err)
+	}
+	return nil
+}
+
+// lock takes the lock file next to the credentials file
+func (s *ClaudeCodeFileStorage) lock() (*fileLock, error) {
+	if err := os.MkdirAll(filepath.Dir(s.path), 0700); err != nil {
+		return nil, fmt.Errorf("failed to create Claude Code directory: %w", err)
+	}
+	lock, err := lockFile(s.path+".lock", true)
+	if err != nil {
+		return nil, fmt.Errorf("failed to lock Claude Code credentials: %w", err)
+	}
+	return lock, nil
+}
@@ -0,0 +1,143 @@
+package auth
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClaudeCodeFileStorage(t *testing.T) {
+	path := filepath.Join(t.TempDir(), ".claude", ".credentials.json")
+	storage := NewClaudeCodeFileStorage(path)
+	assert.Equal(t, "claude-code-file:"+path, storage.Name())
+
+	// Nothing is stored before Claude Code logs in
+	token, err := storage.Get("anthropic")
+	require.NoError(t, err)
+	assert.Nil(t, token)
+	providers, err := storage.List()
+	require.NoError(t, err)
+	assert.Empty(t, providers)
+
+	require.NoError(t, os.MkdirAll(filepath.Dir(path), 0700))
+	require.NoError(t, os.WriteFile(path, []byte(`{
+		"claudeAiOauth": {
+			"accessToken": "sk-ant-oat01-access",
+			"refreshToken": "sk-ant-ort01-refresh",
+			"expiresAt": 1751458199105,
+			"scopes": ["user:inference", "user:profile"],
+			"subscriptionType": "pro"
+		}
+	}`), 0600))
+
+	token, err = storage.Get("anthropic")
+	require.NoError(t, err)
+	assert.Equal(t, &TokenInfo{
+		Type:         "oauth",
+		AccessToken:  "sk-ant-oat01-access",
+		RefreshToken: "sk-ant-ort01-refresh",
+		ExpiresAt:    1751458199,
+	}, token)
+	providers, err = storage.List()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"anthropic"}, providers)
+
+	t.Run("writes back in Claude Code's format", func(t *testing.T) {
+		require.NoError(t, storage.Set("anthropic", &TokenInfo{
+			Type:         "oauth",
+			AccessToken:  "new-access",
+			RefreshToken: "new-refresh",
+			ExpiresAt:    1800000000,
+		}))
+
+		data, err := os.ReadFile(path)
+		require.NoError(t, err)
+		assert.JSONEq(t, `{
+			"claudeAiOauth": {
+				"accessToken": "new-access",
+				"refreshToken": "new-refresh",
+				"expiresAt": 1800000000000,
+				"scopes": ["user:inference", "user:profile"],
+				"subscriptionType": "pro"
+			}
+		}`, string(data))
+		info, err := os.Stat(path)
+		require.NoError(t, err)
+		assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+	})
+
+	t.Run("remove", func(t *testing.T) {
+		assert.ErrorContains(t, storage.Remove("anthropic"), "log out with Claude Code")
+	})
+}
+
+func TestStorageFactory_ClaudeCodeCredentialsFile(t *testing.T) {
+	if runtime.GOOS == "darwin" {
+		t.Skip("Claude Code uses the keychain on macOS")
+	}
+	t.Setenv("CLAUDE_CONFIG_DIR", "/tmp/claude-config")
+	assert.Equal(t, "/tmp/claude-config/.credentials.json", DefaultClaudeCodeCredentialsPath())
+
+	path := filepath.Join(t.TempDir(), ".credentials.json")
+	require.NoError(t, os.WriteFile(path, []byte(`{"claudeAiOauth": {}}`), 0600))
+
+	storage, err := NewStorageFactory(StorageFactoryConfig{
+		Type:                      StorageTypeClaudeCode,
+		ClaudeCodeCredentialsPath: path,
+	}).Create()
+	require.NoError(t, err)
+	assert.Equal(t, "claude-code-file:"+path, storage.Name())
+}
+
+func TestOAuthTokenProvider_ClaudeCodeRotatedRefreshToken(t *testing.T) {
+	path := filepath.Join(t.TempDir(), ".credentials.json")
+	storage := NewClaudeCodeFileStorage(path)
+	require.NoError(t, storage.Set("anthropic", &TokenInfo{
+		Type:         "oauth",
+		AccessToken:  "old-access",
+		RefreshToken: "old-refresh",
+		ExpiresAt:    time.Now().Add(-time.Minute).Unix(),
+	}))
+
+	// Claude Code refreshes with the same refresh token while the gate's request is in flight
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		var req struct {
+			RefreshToken string `json:"refresh_token"`
+		}
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		w.Header().Set("Content-Type", "application/json")
+		if req.RefreshToken == "old-refresh" {
+			assert.NoError(t, writeFileAtomic(path, []byte(`{"claudeAiOauth": {"accessToken": "claude-code-access",
+				"refreshToken": "claude-code-refresh", "expiresAt": 1000}}`)))
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"error": "invalid_grant"}`))
+			return
+		}
+		assert.Equal(t, "claude-code-refresh", req.RefreshToken)
+		w.Write([]byte(`{"access_token": "gate-access", "refresh_token": "gate-refresh", "expires_in": 3600}`))
+	}))
+	t.Cleanup(server.Close)
+	provider := NewOAuthTokenProvider(storage)
+	provider.client.TokenURL = server.URL
+
+	token, err := provider.GetAccessToken()
+	require.NoError(t, err)
+	assert.Equal(t, "gate-access", token)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&calls))
+
+	// The new refresh token is written back for Claude Code
+	stored, err := NewClaudeCodeFileStorage(path).Get("anthropic")
+	require.NoError(t, err)
+	assert.Equal(t, "gate-refresh", stored.RefreshToken)
+}
@@ -1,8 +1,12 @@
 package auth
 
 import (
+	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"os"
+	"os/user"
 	"runtime"
 
 	"github.com/99designs/keyring"
@@ -19,7 +23,13 @@ type ClaudeCodeCredentials struct {
 	} `json:"claudeAiOauth"`
 }
 
-// ClaudeCodeStorage implements StorageBackend by reading from Claude Code's keychain
+// errClaudeCodeLogout is returned when removing Claude Code's credentials, which would log
+// Claude Code out as well
+var errClaudeCodeLogout = errors.New("Claude Code credentials cannot be removed: log out with Claude Code instead")
+
+// ClaudeCodeStorage implements StorageBackend with Claude Code's keychain entry. Refreshed
+// tokens are written back, as Claude Code and Claude Gate share the login and its refresh
+// token is single use.
 type ClaudeCodeStorage struct {
 	keyring keyring.Keyring
 }
@@ -70,60 +80,41 @@ func (s *ClaudeCodeStorage) Get(provider string) (*TokenInfo, error) {
 		return nil, nil
 	}
 
-	// Claude Code stores credentials under the username, not a fixed key
-	// First try to list all keys to find the right one
-	keys, err := s.keyring.Keys()
-	if err != nil {
-		// If we can't list keys, assume no credentials
+	item, ok := s.item()
+	if !ok {
 		return nil, nil
 	}
+	return claudeCodeToken(item.Data)
+}
 
-	// If no keys, no credentials
-	if len(keys) == 0 {
-		return nil, nil
+// Set writes a refreshed token back to Claude Code's entry, keeping the rest of it intact
+func (s *ClaudeCodeStorage) Set(provider string, token *TokenInfo) error {
+	if provider != "anthropic" {
+		return fmt.Errorf("Claude Code storage only holds the anthropic token")
 	}
-
-	// Try each key (should typically only be one - the username)
-	var item keyring.Item
-	var foundItem bool
-	for _, key := range keys {
-		item, err = s.keyring.Get(key)
-		if err == nil {
-			foundItem = true
-			break
+	
+	item, ok := s.item()
+	if !ok {
+		account, err := claudeCodeAccount()
+		if err != nil {
+			return err
 		}
+		item = keyring.Item{Key: account}
 	}
-
-	if !foundItem {
-		// Couldn't get any items
-		return nil, nil
-	}
-
-	// Parse Claude Code format
-	var creds ClaudeCodeCredentials
-	if err := json.Unmarshal(item.Data, &creds); err != nil {
-		return nil, fmt.Errorf("failed to parse Claude Code credentials: %w", err)
+	data, err := mergeClaudeCodeCredentials(item.Data, token)
+	if err != nil {
+		return err
 	}
-
-	// Transform to our format
-	token := &TokenInfo{
-		Type:         "oauth",
-		AccessToken:  creds.ClaudeAiOauth.AccessToken,
-		RefreshToken: creds.ClaudeAiOauth.RefreshToken,
-		ExpiresAt:    creds.ClaudeAiOauth.ExpiresAt / 1000, // Convert milliseconds to seconds
+	item.Data = data
+	if err := s.keyring.Set(item); err != nil {
+		return fmt.Errorf("failed to write Claude Code credentials: %w", err)
 	}
-
-	return token, nil
-}
-
-// Set is not supported for read-only adapter
-func (s *ClaudeCodeStorage) Set(provider string, token *TokenInfo) error {
-	return fmt.Errorf("Claude Code storage is read-only")
+	return nil
 }
 
-// Remove is not supported for read-only adapter
+// Remove is not supported, as it would log Claude Code out
 func (s *ClaudeCodeStorage) Remove(provider string) error {
-	return fmt.Errorf("Claude Code storage is read-only")
+	return errClaudeCodeLogout
 }
 
 // List returns available providers
@@ -166,4 +157,90 @@ func (s *ClaudeCodeStorage) Lock() error {
 // Name returns the backend name
 func (s *ClaudeCodeStorage) Name() string {
 	return "claude-code-adapter"
+}
+
+// item returns Claude Code's entry. Claude Code stores it under the user name rather than
+// a fixed key, so the first readable key is used (there should typically only be one).
+func (s *ClaudeCodeStorage) item() (keyring.Item, bool) {
+	keys, err := s.keyring.Keys()
+	if err != nil {
+		// If we can't list keys, assume no credentials
+		return keyring.Item{}, false
+	}
+	for _, key := range keys {
+		item, err := s.keyring.Get(key)
+		if err == nil {
+			return item, true
+		}
+	}
+	return keyring.Item{}, false
+}
+
+// claudeCodeToken transforms Claude Code credentials to our format
+func claudeCodeToken(data []byte) (*TokenInfo, error) {
+	var creds ClaudeCodeCredentials
+	if err := json.Unmarshal(data, &creds); err != nil {
+		return nil, fmt.Errorf("failed to parse Claude Code credentials: %w", err)
+	}
+	return &TokenInfo{
+		Type:         "oauth",
+		AccessToken:  creds.ClaudeAiOauth.AccessToken,
+		RefreshToken: creds.ClaudeAiOauth.RefreshToken,
+		ExpiresAt:    creds.ClaudeAiOauth.ExpiresAt / 1000, // Convert milliseconds to seconds
+	}, nil
+}
+
+// mergeClaudeCodeCredentials writes a token into Claude Code credentials. Only the tokens and
+// expiry are replaced; the scopes, subscription type and any fields unknown to Claude Gate
+// are kept as Claude Code wrote them.
+func mergeClaudeCodeCredentials(data []byte, token *TokenInfo) ([]byte, error) {
+	if token == nil || token.Type != "oauth" {
+		return nil, fmt.Errorf("Claude Code storage only holds OAuth tokens")
+	}
+	
+	creds := map[string]json.RawMessage{}
+	if len(bytes.TrimSpace(data)) > 0 {
+		if err := json.Unmarshal(data, &creds); err != nil {
+			return nil, fmt.Errorf("failed to parse Claude Code credentials: %w", err)
+		}
+	}
+	oauth := map[string]json.RawMessage{}
+	if raw, ok := creds["claudeAiOauth"]; ok {
+		if err := json.Unmarshal(raw, &oauth); err != nil {
+			return nil, fmt.Errorf("failed to parse Claude Code credentials: %w", err)
+		}
+		if oauth == nil {
+			oauth = map[string]json.RawMessage{}
+		}
+	}
+	
+	fields := map[string]interface{}{
+		"accessToken":  token.AccessToken,
+		"refreshToken": token.RefreshToken,
+		"expiresAt":    token.ExpiresAt * 1000, // Claude Code stores milliseconds
+	}
+	for name, value := range fields {
+		raw, err := json.Marshal(value)
+		if err != nil {
+			return nil, err
+		}
+		oauth[name] = raw
+	}
+	raw, err := json.Marshal(oauth)
+	if err != nil {
+		return nil, err
+	}
+	creds["claudeAiOauth"] = raw
+	return json.Marshal(creds)
+}
+
+// claudeCodeAccount returns the account Claude Code stores its keychain entry under
+func claudeCodeAccount() (string, error) {
+	if username := os.Getenv("USER"); username != "" {
+		return username, nil
+	}
+	if u, err := user.Current(); err == nil && u.Username != "" {
+		return u.Username, nil
+	}
+	return "", fmt.Errorf("could not determine username")
 }
\ No newline at end of file
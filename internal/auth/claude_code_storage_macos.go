@@ -3,12 +3,16 @@
 package auth
 
 import (
-	"encoding/json"
+	"encoding/hex"
 	"fmt"
 	"os"
 	"os/exec"
+	"strings"
 )
 
+// claudeCodeService is the keychain service of Claude Code's credentials
+const claudeCodeService = "Claude Code-credentials"
+
 // ClaudeCodeStorageMacOS implements StorageBackend using direct macOS security command
 type ClaudeCodeStorageMacOS struct{}
 
@@ -23,54 +27,57 @@ func (s *ClaudeCodeStorageMacOS) Get(provider string) (*TokenInfo, error) {
 		return nil, nil
 	}
 
-	// Try to get the password using the security command
-	username := os.Getenv("USER")
-	if username == "" {
-		return nil, fmt.Errorf("could not determine username")
-	}
-
-	// Use the security command to find the password
-	cmd := exec.Command("security", "find-generic-password",
-		"-s", "Claude Code-credentials",
-		"-a", username,
-		"-w") // -w returns just the password
-
-	output, err := cmd.Output()
-	if err != nil {
-		// No credentials found
-		return nil, nil
+	output, err := s.read()
+	if err != nil || output == nil {
+		return nil, err
 	}
 
 	// Parse the password data
-	var creds ClaudeCodeCredentials
-	if err := json.Unmarshal(output, &creds); err != nil {
-		return nil, fmt.Errorf("failed to parse Claude Code credentials: %w", err)
+	token, err := claudeCodeToken(output)
+	if err != nil {
+		return nil, err
 	}
 
 	// Check if it has the expected structure
-	if creds.ClaudeAiOauth.AccessToken == "" || creds.ClaudeAiOauth.RefreshToken == "" {
+	if token.AccessToken == "" || token.RefreshToken == "" {
 		return nil, nil
 	}
-
-	// Transform to our format
-	token := &TokenInfo{
-		Type:         "oauth",
-		AccessToken:  creds.ClaudeAiOauth.AccessToken,
-		RefreshToken: creds.ClaudeAiOauth.RefreshToken,
-		ExpiresAt:    creds.ClaudeAiOauth.ExpiresAt / 1000, // Convert milliseconds to seconds
-	}
-
 	return token, nil
 }
 
-// Set is not supported for read-only adapter
+// Set writes a refreshed token back to Claude Code's keychain item, keeping the rest of it intact
 func (s *ClaudeCodeStorageMacOS) Set(provider string, token *TokenInfo) error {
-	return fmt.Errorf("Claude Code storage is read-only")
+	if provider != "anthropic" {
+		return fmt.Errorf("Claude Code storage only holds the anthropic token")
+	}
+
+	existing, err := s.read()
+	if err != nil {
+		return err
+	}
+	data, err := mergeClaudeCodeCredentials(existing, token)
+	if err != nil {
+		return err
+	}
+	username, err := claudeCodeAccount()
+	if err != nil {
+		return err
+	}
+
+	// The command is read from stdin in interactive mode so that the credentials do not
+	// show up in the process list. -X takes the password hex encoded, -U updates the item.
+	cmd := exec.Command("security", "-i")
+	cmd.Stdin = strings.NewReader(fmt.Sprintf("add-generic-password -U -a %q -s %q -X %s\n",
+		username, claudeCodeService, hex.EncodeToString(data)))
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("failed to write Claude Code credentials: %v: %s", err, strings.TrimSpace(string(output)))
+	}
+	return nil
 }
 
-// Remove is not supported for read-only adapter
+// Remove is not supported, as it would log Claude Code out
 func (s *ClaudeCodeStorageMacOS) Remove(provider string) error {
-	return fmt.Errorf("Claude Code storage is read-only")
+	return errClaudeCodeLogout
 }
 
 // List returns available providers
@@ -82,7 +89,7 @@ func (s *ClaudeCodeStorageMacOS) List() ([]string, error) {
 	}
 
 	cmd := exec.Command("security", "find-generic-password",
-		"-s", "Claude Code-credentials",
+		"-s", claudeCodeService,
 		"-a", username)
 
 	if err := cmd.Run(); err != nil {
@@ -118,4 +125,25 @@ func (s *ClaudeCodeStorageMacOS) Lock() error {
 // Name returns the backend name
 func (s *ClaudeCodeStorageMacOS) Name() string {
 	return "claude-code-macos"
+}
+
+// read returns Claude Code's keychain item, or nil when there is none
+func (s *ClaudeCodeStorageMacOS) read() ([]byte, error) {
+	username, err := claudeCodeAccount()
+	if err != nil {
+		return nil, err
+	}
+
+	// Use the security command to find the password
+	cmd := exec.Command("security", "find-generic-password",
+		"-s", claudeCodeService,
+		"-a", username,
+		"-w") // -w returns just the password
+
+	output, err := cmd.Output()
+	if err != nil {
+		// No credentials found
+		return nil, nil
+	}
+	return output, nil
 }
\ No newline at end of file
@@ -63,6 +63,13 @@ func (m *mockKeyringForClaudeCode) Get(key string) (keyring.Item, error) {
 }
 
 func (m *mockKeyringForClaudeCode) Set(item keyring.Item) error {
+	if m.err != nil {
+		return m.err
+	}
+	if m.items == nil {
+		m.items = map[string]keyring.Item{}
+	}
+	m.items[item.Key] = item
 	return nil
 }
 
@@ -163,23 +170,59 @@ func TestClaudeCodeStorage_Get_ConvertsMillisecondsToSeconds(t *testing.T) {
 	assert.Equal(t, int64(1234567890), token.ExpiresAt) // 1234567890123 / 1000
 }
 
-// Test 5: Set returns error (read-only adapter)
-func TestClaudeCodeStorage_Set_ReturnsError(t *testing.T) {
+// Test 5: Set writes the token back in Claude Code's format
+func TestClaudeCodeStorage_Set_WritesBack(t *testing.T) {
+	mockKeyring := &mockKeyringForClaudeCode{
+		items: map[string]keyring.Item{
+			"testuser": {
+				Key: "testuser",
+				Data: []byte(`{
+					"claudeAiOauth": {
+						"accessToken": "old-access",
+						"refreshToken": "old-refresh",
+						"expiresAt": 1751458199105,
+						"scopes": ["user:inference", "user:profile"],
+						"subscriptionType": "max"
+					},
+					"mcpOAuth": {"server": {"accessToken": "mcp"}}
+				}`),
+			},
+		},
+	}
 	adapter := &ClaudeCodeStorage{
-		keyring: &mockKeyringForClaudeCode{},
+		keyring: mockKeyring,
 	}
 
 	token := &TokenInfo{
-		Type:        "oauth",
-		AccessToken: "test",
+		Type:         "oauth",
+		AccessToken:  "new-access",
+		RefreshToken: "new-refresh",
+		ExpiresAt:    1800000000,
 	}
+	require.NoError(t, adapter.Set("anthropic", token))
+
+	// Scopes, subscription type and other entries are kept, and the expiry is in milliseconds
+	assert.JSONEq(t, `{
+		"claudeAiOauth": {
+			"accessToken": "new-access",
+			"refreshToken": "new-refresh",
+			"expiresAt": 1800000000000,
+			"scopes": ["user:inference", "user:profile"],
+			"subscriptionType": "max"
+		},
+		"mcpOAuth": {"server": {"accessToken": "mcp"}}
+	}`, string(mockKeyring.items["testuser"].Data))
 
-	err := adapter.Set("anthropic", token)
-	require.Error(t, err)
-	assert.Contains(t, err.Error(), "read-only")
+	stored, err := adapter.Get("anthropic")
+	require.NoError(t, err)
+	assert.Equal(t, token, stored)
+
+	// Only the Anthropic OAuth token can be stored
+	assert.Error(t, adapter.Set("other", token))
+	assert.Error(t, adapter.Set("anthropic", &TokenInfo{Type: "api", APIKey: "key"}))
 }
 
-// Test 6: Remove returns error (read-only adapter)
+// Test 6: Remove returns error, as it would log Claude Code out
 func TestClaudeCodeStorage_Remove_ReturnsError(t *testing.T) {
 	adapter := &ClaudeCodeStorage{
 		keyring: &mockKeyringForClaudeCode{},
@@ -187,7 +230,7 @@ func TestClaudeCodeStorage_Remove_ReturnsError(t *testing.T) {
 
 	err := adapter.Remove("anthropic")
 	require.Error(t, err)
-	assert.Contains(t, err.Error(), "read-only")
+	assert.Contains(t, err.Error(), "log out with Claude Code")
 }
 
 // Test 7: List returns ["anthropic"] when credentials exist
@@ -53,56 +53,43 @@ func (s *ClaudeCodeStorageV2) Get(provider string) (*TokenInfo, error) {
 		return nil, nil
 	}
 
-	// Try each keyring
-	for _, kr := range s.keyrings {
-		// List all keys in this keyring
-		keys, err := kr.Keys()
-		if err != nil {
-			continue // Try next keyring
-		}
-
-		// Try each key
-		for _, key := range keys {
-			item, err := kr.Get(key)
-			if err != nil {
-				continue
-			}
-
-			// Try to parse as Claude Code format
-			var creds ClaudeCodeCredentials
-			if err := json.Unmarshal(item.Data, &creds); err != nil {
-				continue
-			}
-
-			// Check if it has the expected structure
-			if creds.ClaudeAiOauth.AccessToken == "" || creds.ClaudeAiOauth.RefreshToken == "" {
-				continue
-			}
-
-			// Found valid credentials!
-			token := &TokenInfo{
-				Type:         "oauth",
-				AccessToken:  creds.ClaudeAiOauth.AccessToken,
-				RefreshToken: creds.ClaudeAiOauth.RefreshToken,
-				ExpiresAt:    creds.ClaudeAiOauth.ExpiresAt / 1000, // Convert milliseconds to seconds
-			}
-
-			return token, nil
-		}
+	_, item, ok := s.find()
+	if !ok {
+		// No valid credentials found in any keyring
+		return nil, nil
 	}
-
-	// No valid credentials found in any keyring
-	return nil, nil
+	return claudeCodeToken(item.Data)
 }
 
-// Set is not supported for read-only adapter
+// Set writes a refreshed token back to the entry it was read from, or to the original
+// Claude Code service when there is none yet
 func (s *ClaudeCodeStorageV2) Set(provider string, token *TokenInfo) error {
-	return fmt.Errorf("Claude Code storage is read-only")
+	if provider != "anthropic" {
+		return fmt.Errorf("Claude Code storage only holds the anthropic token")
+	}
+	
+	kr, item, ok := s.find()
+	if !ok {
+		account, err := claudeCodeAccount()
+		if err != nil {
+			return err
+		}
+		kr, item = s.keyrings[0], keyring.Item{Key: account}
+	}
+	data, err := mergeClaudeCodeCredentials(item.Data, token)
+	if err != nil {
+		return err
+	}
+	item.Data = data
+	if err := kr.Set(item); err != nil {
+		return fmt.Errorf("failed to write Claude Code credentials: %w", err)
+	}
+	return nil
 }
 
-// Remove is not supported for read-only adapter
+// Remove is not supported, as it would log Claude Code out
 func (s *ClaudeCodeStorageV2) Remove(provider string) error {
-	return fmt.Errorf("Claude Code storage is read-only")
+	return errClaudeCodeLogout
 }
 
 // List returns available providers
@@ -163,4 +150,33 @@ func (s *ClaudeCodeStorageV2) Lock() error {
 // Name returns the backend name
 func (s *ClaudeCodeStorageV2) Name() string {
 	return "claude-code-adapter-v2"
+}
+
+// find returns the first entry holding valid Claude Code credentials and its keyring
+func (s *ClaudeCodeStorageV2) find() (keyring.Keyring, keyring.Item, bool) {
+	for _, kr := range s.keyrings {
+		// List all keys in this keyring
+		keys, err := kr.Keys()
+		if err != nil {
+			continue // Try next keyring
+		}
+
+		for _, key := range keys {
+			item, err := kr.Get(key)
+			if err != nil {
+				continue
+			}
+
+			// Check if it has the expected structure
+			var creds ClaudeCodeCredentials
+			if err := json.Unmarshal(item.Data, &creds); err != nil {
+				continue
+			}
+			if creds.ClaudeAiOauth.AccessToken == "" || creds.ClaudeAiOauth.RefreshToken == "" {
+				continue
+			}
+			return kr, item, true
+		}
+	}
+	return nil, keyring.Item{}, false
 }
\ No newline at end of file
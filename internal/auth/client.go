@@ -3,6 +3,7 @@ package auth
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"strings"
@@ -10,12 +11,42 @@ import (
 	"time"
 )
 
+// forcedRefreshWindow is how long a token from a forced refresh counts as just issued.
+// If the upstream rejects it within this window, refreshing again will not help.
+const forcedRefreshWindow = time.Minute
+
+// failedRefreshBackoff is how long requests keep using a still-valid token after a failed
+// refresh before they try to refresh it again
+const failedRefreshBackoff = 30 * time.Second
+
+// ErrReloginRequired is returned once the stored login can no longer be refreshed
+var ErrReloginRequired = errors.New("re-login required: run 'claude-gate auth login'")
+
 // OAuthTokenProvider implements TokenProvider interface for the proxy
 type OAuthTokenProvider struct {
 	client      *OAuthClient
 	storage     StorageBackend
 	cachedToken *TokenInfo
 	cacheMutex  sync.RWMutex
+	// rejectedToken is the access token the upstream last rejected
+	rejectedToken string
+	// forcedToken and forcedAt record the last token obtained by a forced refresh
+	forcedToken string
+	forcedAt    time.Time
+	// reloginErr is set while the stored login is revoked, until a new login is stored
+	reloginErr error
+	// inflight is the refresh in progress; concurrent callers wait for it instead of starting their own
+	inflight *refreshCall
+	// status and listeners report refreshes to health checks, the CLI and the dashboard
+	status    RefreshStatus
+	listeners []func(RefreshEvent)
+}
+
+// refreshCall is a refresh shared by every caller that needs it
+type refreshCall struct {
+	done  chan struct{}
+	token *TokenInfo
+	err   error
 }
 
 // NewOAuthTokenProvider creates a new OAuth token provider
@@ -26,7 +57,8 @@ func NewOAuthTokenProvider(storage StorageBackend) *OAuthTokenProvider {
 	}
 }
 
-// GetAccessToken returns a valid access token, refreshing if necessary
+// GetAccessToken returns a valid access token, refreshing if necessary.
+// If the refresh fails while the current token is still valid, the current token is returned.
 func (p *OAuthTokenProvider) GetAccessToken() (string, error) {
 	// First, check if we have a valid cached token
 	p.cacheMutex.RLock()
@@ -37,46 +69,281 @@ func (p *OAuthTokenProvider) GetAccessToken() (string, error) {
 	}
 	p.cacheMutex.RUnlock()
 	
-	// Need to fetch or refresh token - use write lock
+	token, rejected, err := p.loadToken()
+	if err != nil {
+		return "", err
+	}
+	if rejected {
+		if p.refreshFailedRecently() {
+			return "", fmt.Errorf("the stored token was rejected and could not be refreshed; retrying shortly")
+		}
+		return p.forceRefresh(token)
+	}
+	if !token.NeedsRefresh() {
+		return token.AccessToken, nil
+	}
+	
+	// Keep using a valid token while it is being refreshed, and for a while after a failed
+	// refresh rather than retrying on every request
+	if !token.IsExpired() && (p.refreshInFlight() || p.refreshFailedRecently()) {
+		return token.AccessToken, nil
+	}
+	
+	refreshed, err := p.refresh(token, RefreshOnDemand)
+	if err != nil {
+		if !token.IsExpired() {
+			return token.AccessToken, nil
+		}
+		return "", err
+	}
+	return refreshed.AccessToken, nil
+}
+
+// ForceRefresh discards an access token the upstream rejected and returns a new one,
+// even if the rejected token has not expired yet. Tokens can be revoked early, or
+// rotated by another client sharing the login such as Claude Code. When several
+// requests report the same token, only the first one refreshes it.
+func (p *OAuthTokenProvider) ForceRefresh(rejected string) (string, error) {
+	p.cacheMutex.Lock()
+	
+	// Another request already replaced the rejected token
+	if p.cachedToken != nil && p.cachedToken.AccessToken != rejected && !p.cachedToken.NeedsRefresh() {
+		token := p.cachedToken.AccessToken
+		p.cacheMutex.Unlock()
+		return token, nil
+	}
+	p.cachedToken = nil
+	
+	// A token that was just refreshed and is still rejected means the login was revoked
+	if rejected == p.forcedToken && time.Since(p.forcedAt) < forcedRefreshWindow {
+		p.rejectedToken = rejected
+		p.reloginErr = errors.New("the upstream rejected a freshly refreshed token")
+		p.cacheMutex.Unlock()
+		return "", fmt.Errorf("%w (%v)", ErrReloginRequired, p.reloginErr)
+	}
+	
+	p.rejectedToken = rejected
+	p.cacheMutex.Unlock()
+	
+	token, stillRejected, err := p.loadToken()
+	if err != nil {
+		return "", err
+	}
+	if !stillRejected {
+		// Another client stored a new token since
+		return p.GetAccessToken()
+	}
+	return p.forceRefresh(token)
+}
+
+// ReportRejected records that the upstream rejected a token obtained by ForceRefresh. The
+// login is marked as revoked until another token is stored, without refreshing again: the
+// request has already failed, and a refresh would only rotate the refresh token.
+func (p *OAuthTokenProvider) ReportRejected(token string) {
 	p.cacheMutex.Lock()
 	defer p.cacheMutex.Unlock()
 	
-	// Double-check after acquiring write lock (another goroutine might have refreshed)
+	if p.cachedToken != nil && p.cachedToken.AccessToken == token {
+		p.cachedToken = nil
+	}
+	p.rejectedToken = token
+	p.reloginErr = errors.New("the upstream rejected a freshly refreshed token")
+}
+
+// forceRefresh refreshes a rejected token. A refresh token the server refuses means the
+// user has to log in again.
+func (p *OAuthTokenProvider) forceRefresh(token *TokenInfo) (string, error) {
+	refreshed, err := p.refresh(token, RefreshForced)
+	
+	p.cacheMutex.Lock()
+	defer p.cacheMutex.Unlock()
+	if err != nil {
+		var refused *TokenRequestError
+		if errors.As(err, &refused) && refused.refusesGrant() {
+			p.reloginErr = err
+			return "", fmt.Errorf("%w (%v)", ErrReloginRequired, err)
+		}
+		return "", err
+	}
+	p.forcedToken = refreshed.AccessToken
+	p.forcedAt = time.Now()
+	return refreshed.AccessToken, nil
+}
+
+// ReloginRequired returns the reason the stored login must be renewed, or nil
+func (p *OAuthTokenProvider) ReloginRequired() error {
+	p.cacheMutex.RLock()
+	defer p.cacheMutex.RUnlock()
+	if p.reloginErr == nil {
+		return nil
+	}
+	return fmt.Errorf("%w (%v)", ErrReloginRequired, p.reloginErr)
+}
+
+// loadToken returns the cached token, or the stored one when the cache is stale,
+// and whether it is the token the upstream rejected
+func (p *OAuthTokenProvider) loadToken() (*TokenInfo, bool, error) {
+	// Double-check, another goroutine might have refreshed
+	p.cacheMutex.RLock()
 	if p.cachedToken != nil && p.cachedToken.Type == "oauth" && !p.cachedToken.NeedsRefresh() {
-		return p.cachedToken.AccessToken, nil
+		token := p.cachedToken
+		p.cacheMutex.RUnlock()
+		return token, false, nil
 	}
+	p.cacheMutex.RUnlock()
+	return p.storedToken()
+}
+
+// currentToken returns the stored token, which may have been replaced by another client
+func (p *OAuthTokenProvider) currentToken() (*TokenInfo, error) {
+	token, rejected, err := p.storedToken()
+	if err == nil && rejected {
+		return nil, fmt.Errorf("the stored token was rejected by the upstream")
+	}
+	return token, err
+}
+
+// storedToken reads the token from storage and caches it unless the upstream rejected it.
+// The cache lock is not held while the storage is read, which may wait on other processes.
+func (p *OAuthTokenProvider) storedToken() (*TokenInfo, bool, error) {
+	p.cacheMutex.RLock()
+	cached := p.cachedToken
+	p.cacheMutex.RUnlock()
 	
 	// Fetch token from storage
 	token, err := p.storage.Get("anthropic")
 	if err != nil {
-		return "", fmt.Errorf("failed to get token from storage: %w", err)
+		return nil, false, fmt.Errorf("failed to get token from storage: %w", err)
 	}
 	
 	if token == nil || token.Type != "oauth" {
-		return "", fmt.Errorf("no OAuth token found - please authenticate first")
+		return nil, false, fmt.Errorf("no OAuth token found - please authenticate first")
 	}
 	
-	// Check if token needs refresh
-	if token.NeedsRefresh() {
-		// Refresh the token
-		newToken, err := p.client.RefreshToken(token.RefreshToken)
-		if err != nil {
-			return "", fmt.Errorf("failed to refresh token: %w", err)
+	p.cacheMutex.Lock()
+	defer p.cacheMutex.Unlock()
+	
+	// A different stored token means a new login, or a refresh by another client
+	if p.rejectedToken != "" && token.AccessToken != p.rejectedToken {
+		p.rejectedToken = ""
+		p.reloginErr = nil
+	}
+	if p.reloginErr != nil {
+		return nil, false, fmt.Errorf("%w (%v)", ErrReloginRequired, p.reloginErr)
+	}
+	if p.rejectedToken != "" {
+		return token, true, nil
+	}
+	
+	// Update cache with the token from storage, unless a refresh replaced it meanwhile
+	if p.cachedToken == cached {
+		p.cachedToken = token
+	}
+	return token, false, nil
+}
+
+// refresh exchanges the refresh token of current for a new token and stores it.
+// Concurrent callers share a single request. Only the writer lock of the storage is held
+// during the round trip, so that requests can keep reading the cache and the storage.
+func (p *OAuthTokenProvider) refresh(current *TokenInfo, reason RefreshReason) (*TokenInfo, error) {
+	p.cacheMutex.Lock()
+	if call := p.inflight; call != nil {
+		p.cacheMutex.Unlock()
+		<-call.done
+		return call.token, call.err
+	}
+	call := &refreshCall{done: make(chan struct{})}
+	p.inflight = call
+	p.cacheMutex.Unlock()
+	
+	var token *TokenInfo
+	err := p.withStorageLock(func(storage StorageBackend) error {
+		// Another process may have refreshed the token while this one waited for the lock.
+		// Refresh tokens are single use, so its token is adopted rather than refreshed again.
+		stored, err := storage.Get("anthropic")
+		if err == nil && stored != nil && stored.Type == "oauth" {
+			if stored.AccessToken != current.AccessToken && !stored.NeedsRefresh() {
+				token = stored
+				return nil
+			}
+			current = stored
 		}
 		
-		// Update storage
-		if err := p.storage.Set("anthropic", newToken); err != nil {
-			return "", fmt.Errorf("failed to save refreshed token: %w", err)
+		refreshed, err := p.client.RefreshToken(current.RefreshToken)
+		var refused *TokenRequestError
+		if errors.As(err, &refused) && refused.refusesGrant() {
+			// Clients that do not take the storage lock, such as Claude Code, may have rotated
+			// the refresh token during the request. Their token is used instead of giving up.
+			stored, getErr := storage.Get("anthropic")
+			if getErr == nil && stored != nil && stored.Type == "oauth" && stored.RefreshToken != current.RefreshToken {
+				if !stored.NeedsRefresh() {
+					token = stored
+					return nil
+				}
+				refreshed, err = p.client.RefreshToken(stored.RefreshToken)
+			}
 		}
-		
-		// Update cache
-		p.cachedToken = newToken
-		return newToken.AccessToken, nil
+		if err != nil {
+			return fmt.Errorf("failed to refresh token: %w", err)
+		}
+		if err := storage.Set("anthropic", refreshed); err != nil {
+			return fmt.Errorf("failed to save refreshed token: %w", err)
+		}
+		token = refreshed
+		return nil
+	})
+	if err != nil {
+		token = nil
+	}
+	
+	p.cacheMutex.Lock()
+	p.inflight = nil
+	event := RefreshEvent{Type: RefreshSucceeded, Reason: reason, Time: time.Now(), Err: err}
+	if err != nil {
+		event.Type = RefreshFailed
+		p.status.Failures++
+		p.status.LastFailure = event.Time
+		p.status.LastError = err.Error()
+	} else {
+		p.cachedToken = token
+		p.rejectedToken = ""
+		p.reloginErr = nil
+		p.status.Refreshes++
+		p.status.Failures = 0
+		p.status.LastRefresh = event.Time
+		p.status.LastError = ""
+		p.status.ExpiresAt = time.Unix(token.ExpiresAt, 0)
 	}
+	event.Status = p.status
+	listeners := p.listeners
+	p.cacheMutex.Unlock()
 	
-	// Update cache with the token from storage
-	p.cachedToken = token
-	return token.AccessToken, nil
+	call.token, call.err = token, err
+	close(call.done)
+	notify(listeners, event)
+	return token, err
+}
+
+// withStorageLock runs fn under the cross-process lock of the storage, if it has one
+func (p *OAuthTokenProvider) withStorageLock(fn func(storage StorageBackend) error) error {
+	if locking, ok := p.storage.(LockingStorage); ok {
+		return locking.WithLock(fn)
+	}
+	return fn(p.storage)
+}
+
+// refreshInFlight reports whether a refresh is in progress
+func (p *OAuthTokenProvider) refreshInFlight() bool {
+	p.cacheMutex.RLock()
+	defer p.cacheMutex.RUnlock()
+	return p.inflight != nil
+}
+
+// refreshFailedRecently reports whether the last refresh failed within the backoff period
+func (p *OAuthTokenProvider) refreshFailedRecently() bool {
+	p.cacheMutex.RLock()
+	defer p.cacheMutex.RUnlock()
+	return p.status.Failures > 0 && time.Since(p.status.LastFailure) < failedRefreshBackoff
 }
 
 // ExchangeCode exchanges an authorization code for tokens
@@ -136,10 +403,8 @@ func (c *OAuthClient) makeTokenRequest(body map[string]interface{}) (*TokenInfo,
 	
 	if resp.StatusCode != http.StatusOK {
 		var errorResp map[string]interface{}
-		if err := json.NewDecoder(resp.Body).Decode(&errorResp); err == nil {
-			return nil, fmt.Errorf("token request failed: %v", errorResp)
-		}
-		return nil, fmt.Errorf("token request failed with status %d", resp.StatusCode)
+		json.NewDecoder(resp.Body).Decode(&errorResp)
+		return nil, &TokenRequestError{StatusCode: resp.StatusCode, Response: errorResp}
 	}
 	
 	var tokenResp struct {
@@ -159,4 +424,23 @@ func (c *OAuthClient) makeTokenRequest(body map[string]interface{}) (*TokenInfo,
 		RefreshToken: tokenResp.RefreshToken,
 		ExpiresAt:    time.Now().Unix() + int64(tokenResp.ExpiresIn),
 	}, nil
-}
\ No newline at end of file
+}
+
+// TokenRequestError is returned when the OAuth server answers a token request with an error
+type TokenRequestError struct {
+	StatusCode int
+	Response   map[string]interface{}
+}
+
+func (e *TokenRequestError) Error() string {
+	if e.Response != nil {
+		return fmt.Sprintf("token request failed: %v", e.Response)
+	}
+	return fmt.Sprintf("token request failed with status %d", e.StatusCode)
+}
+
+// refusesGrant reports whether the server refused the grant itself, such as a revoked
+// refresh token, rather than failing for a reason that may pass
+func (e *TokenRequestError) refusesGrant() bool {
+	return e.StatusCode == http.StatusBadRequest || e.StatusCode == http.StatusUnauthorized
+}
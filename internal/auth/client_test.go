@@ -2,8 +2,12 @@ package auth
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -349,4 +353,242 @@ type mockStorageCounter struct {
 func (m *mockStorageCounter) Get(provider string) (*TokenInfo, error) {
 	m.getCalls++
 	return m.StorageBackend.Get(provider)
-}
\ No newline at end of file
+}
+
+// refreshServer issues numbered access tokens, or refuses every grant when revoked
+func refreshServer(t *testing.T, revoked bool) (*httptest.Server, *int32) {
+	t.Helper()
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		call := atomic.AddInt32(&calls, 1)
+		w.Header().Set("Content-Type", "application/json")
+		if revoked {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"error": "invalid_grant"}`))
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"access_token":  fmt.Sprintf("refreshed-%d", call),
+			"refresh_token": "new-refresh-token",
+			"expires_in":    3600,
+		})
+	}))
+	t.Cleanup(server.Close)
+	return server, &calls
+}
+
+// providerWithToken stores an unexpired token and returns a provider using the given OAuth server
+func providerWithToken(t *testing.T, server *httptest.Server, accessToken string) (*OAuthTokenProvider, StorageBackend) {
+	t.Helper()
+	storage := NewFileStorage(t.TempDir() + "/auth.json")
+	require.NoError(t, storage.Set("anthropic", &TokenInfo{
+		Type:         "oauth",
+		AccessToken:  accessToken,
+		RefreshToken: "refresh-token",
+		ExpiresAt:    time.Now().Add(time.Hour).Unix(),
+	}))
+	provider := NewOAuthTokenProvider(storage)
+	provider.client.TokenURL = server.URL
+	return provider, storage
+}
+
+func TestOAuthTokenProvider_ForceRefresh(t *testing.T) {
+	t.Run("refreshes a rejected token before it expires", func(t *testing.T) {
+		server, calls := refreshServer(t, false)
+		provider, storage := providerWithToken(t, server, "revoked-token")
+
+		token, err := provider.GetAccessToken()
+		require.NoError(t, err)
+		token, err = provider.ForceRefresh(token)
+		require.NoError(t, err)
+		assert.Equal(t, "refreshed-1", token)
+		assert.Equal(t, int32(1), atomic.LoadInt32(calls))
+
+		saved, err := storage.Get("anthropic")
+		require.NoError(t, err)
+		assert.Equal(t, "refreshed-1", saved.AccessToken)
+
+		token, err = provider.GetAccessToken()
+		require.NoError(t, err)
+		assert.Equal(t, "refreshed-1", token)
+		assert.NoError(t, provider.ReloginRequired())
+	})
+
+	t.Run("concurrent rejections refresh once", func(t *testing.T) {
+		server, calls := refreshServer(t, false)
+		provider, _ := providerWithToken(t, server, "revoked-token")
+
+		var wg sync.WaitGroup
+		for i := 0; i < 10; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				token, err := provider.ForceRefresh("revoked-token")
+				assert.NoError(t, err)
+				assert.Equal(t, "refreshed-1", token)
+			}()
+		}
+		wg.Wait()
+		assert.Equal(t, int32(1), atomic.LoadInt32(calls))
+	})
+
+	t.Run("uses a token rotated by another client", func(t *testing.T) {
+		server, calls := refreshServer(t, false)
+		provider, storage := providerWithToken(t, server, "old-token")
+		_, err := provider.GetAccessToken()
+		require.NoError(t, err)
+
+		require.NoError(t, storage.Set("anthropic", &TokenInfo{
+			Type:         "oauth",
+			AccessToken:  "rotated-token",
+			RefreshToken: "rotated-refresh-token",
+			ExpiresAt:    time.Now().Add(time.Hour).Unix(),
+		}))
+
+		token, err := provider.ForceRefresh("old-token")
+		require.NoError(t, err)
+		assert.Equal(t, "rotated-token", token)
+		assert.Zero(t, atomic.LoadInt32(calls))
+	})
+
+	t.Run("a refused refresh requires a new login", func(t *testing.T) {
+		server, calls := refreshServer(t, true)
+		provider, storage := providerWithToken(t, server, "revoked-token")
+
+		_, err := provider.ForceRefresh("revoked-token")
+		assert.True(t, errors.Is(err, ErrReloginRequired), "got %v", err)
+		assert.True(t, errors.Is(provider.ReloginRequired(), ErrReloginRequired))
+
+		// Requests fail fast instead of refreshing again
+		_, err = provider.GetAccessToken()
+		assert.True(t, errors.Is(err, ErrReloginRequired))
+		assert.Equal(t, int32(1), atomic.LoadInt32(calls))
+
+		// Logging in again clears the state
+		require.NoError(t, storage.Set("anthropic", &TokenInfo{
+			Type:         "oauth",
+			AccessToken:  "new-login",
+			RefreshToken: "refresh-token",
+			ExpiresAt:    time.Now().Add(time.Hour).Unix(),
+		}))
+		token, err := provider.GetAccessToken()
+		require.NoError(t, err)
+		assert.Equal(t, "new-login", token)
+		assert.NoError(t, provider.ReloginRequired())
+	})
+
+	t.Run("a refreshed token rejected again requires a new login", func(t *testing.T) {
+		server, calls := refreshServer(t, false)
+		provider, _ := providerWithToken(t, server, "revoked-token")
+
+		token, err := provider.ForceRefresh("revoked-token")
+		require.NoError(t, err)
+		_, err = provider.ForceRefresh(token)
+		assert.True(t, errors.Is(err, ErrReloginRequired), "got %v", err)
+		assert.Error(t, provider.ReloginRequired())
+		assert.Equal(t, int32(1), atomic.LoadInt32(calls))
+	})
+
+	t.Run("reporting a rejected refreshed token does not refresh again", func(t *testing.T) {
+		server, calls := refreshServer(t, false)
+		provider, _ := providerWithToken(t, server, "revoked-token")
+
+		token, err := provider.ForceRefresh("revoked-token")
+		require.NoError(t, err)
+		provider.ReportRejected(token)
+		assert.True(t, errors.Is(provider.ReloginRequired(), ErrReloginRequired))
+
+		_, err = provider.GetAccessToken()
+		assert.True(t, errors.Is(err, ErrReloginRequired), "got %v", err)
+		assert.Equal(t, int32(1), atomic.LoadInt32(calls))
+	})
+
+	t.Run("a failing token endpoint does not require a new login", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}))
+		defer server.Close()
+		provider, _ := providerWithToken(t, server, "revoked-token")
+
+		_, err := provider.ForceRefresh("revoked-token")
+		assert.Error(t, err)
+		assert.False(t, errors.Is(err, ErrReloginRequired))
+		assert.NoError(t, provider.ReloginRequired())
+	})
+}
+
+func TestOAuthTokenProvider_RefreshAdoptsSharedToken(t *testing.T) {
+	server, calls := refreshServer(t, false)
+	path := t.TempDir() + "/auth.json"
+	expired := &TokenInfo{
+		Type:         "oauth",
+		AccessToken:  "old-token",
+		RefreshToken: "refresh-token",
+		ExpiresAt:    time.Now().Add(-time.Minute).Unix(),
+	}
+	require.NoError(t, NewFileStorage(path).Set("anthropic", expired))
+	provider := NewOAuthTokenProvider(NewFileStorage(path))
+	provider.client.TokenURL = server.URL
+	
+	// Another process refreshes the token after this one found it expired
+	require.NoError(t, NewFileStorage(path).Set("anthropic", &TokenInfo{
+		Type:         "oauth",
+		AccessToken:  "other-process-token",
+		RefreshToken: "other-refresh-token",
+		ExpiresAt:    time.Now().Add(time.Hour).Unix(),
+	}))
+	token, err := provider.refresh(expired, RefreshOnDemand)
+	require.NoError(t, err)
+	
+	// The refresh token was already used up by the other process and must not be sent again
+	assert.Equal(t, "other-process-token", token.AccessToken)
+	assert.Equal(t, int32(0), atomic.LoadInt32(calls))
+}
+
+func TestOAuthTokenProvider_RequestsDuringRefresh(t *testing.T) {
+	started, release := make(chan bool), make(chan bool)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		started <- true
+		<-release
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"access_token": "refreshed", "refresh_token": "new-refresh-token", "expires_in": 3600}`))
+	}))
+	t.Cleanup(server.Close)
+	storage := NewFileStorage(t.TempDir() + "/auth.json")
+	require.NoError(t, storage.Set("anthropic", &TokenInfo{
+		Type:         "oauth",
+		AccessToken:  "expiring-token",
+		RefreshToken: "refresh-token",
+		ExpiresAt:    time.Now().Add(2 * time.Minute).Unix(),
+	}))
+	provider := NewOAuthTokenProvider(storage)
+	provider.client.TokenURL = server.URL
+	
+	refreshed := make(chan string)
+	go func() {
+		token, err := provider.GetAccessToken()
+		assert.NoError(t, err)
+		refreshed <- token
+	}()
+	<-started
+	
+	// Neither the storage nor the still valid token wait for the round trip
+	done := make(chan bool, 1)
+	go func() {
+		token, err := storage.Get("anthropic")
+		assert.NoError(t, err)
+		assert.Equal(t, "expiring-token", token.AccessToken)
+		current, err := provider.GetAccessToken()
+		assert.NoError(t, err)
+		assert.Equal(t, "expiring-token", current)
+		done <- true
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Error("requests waited for the refresh to finish")
+	}
+	
+	close(release)
+	assert.Equal(t, "refreshed", <-refreshed)
+}
@@ -0,0 +1,278 @@
+package auth
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/pbkdf2"
+)
+
+// Encrypted storage errors
+var (
+	ErrWrongPassphrase = errors.New("wrong passphrase for encrypted token storage")
+	ErrNoPassphrase    = errors.New("encrypted token storage needs a passphrase: set CLAUDE_GATE_STORAGE_PASSPHRASE, CLAUDE_GATE_STORAGE_PASSWORD_FILE or --password-command")
+)
+
+const (
+	encryptedFileVersion = 1
+	encryptedFileKDF     = "pbkdf2-sha256"
+)
+
+// encryptionIterations is the PBKDF2 work factor for new keys. Files record their own
+// iteration count, so raising it only affects files written or rekeyed afterwards.
+var encryptionIterations = 600000
+
+// PassphraseConfig tells where the passphrase of encrypted file storage comes from.
+// The first source that is set is used.
+type PassphraseConfig struct {
+	Passphrase string // The passphrase itself, such as from CLAUDE_GATE_STORAGE_PASSPHRASE
+	File       string // File whose contents are the passphrase; a trailing newline is ignored
+	Command    string // Shell command that prints the passphrase, such as 'pass show claude-gate'
+	// Timeout limits Command (default 1m), so that a prompt nobody can answer, such as under
+	// systemd or in a container without a terminal, does not hang startup
+	Timeout time.Duration
+}
+
+// IsSet reports whether any passphrase source is configured
+func (c PassphraseConfig) IsSet() bool {
+	return c.Passphrase != "" || c.File != "" || c.Command != ""
+}
+
+// Resolve returns the passphrase from the configured source
+func (c PassphraseConfig) Resolve() (string, error) {
+	var passphrase string
+	switch {
+	case c.Passphrase != "":
+		passphrase = c.Passphrase
+	case c.File != "":
+		data, err := os.ReadFile(c.File)
+		if err != nil {
+			return "", fmt.Errorf("failed to read password file: %w", err)
+		}
+		passphrase = strings.TrimRight(string(data), "\r\n")
+	case c.Command != "":
+		timeout := c.Timeout
+		if timeout <= 0 {
+			timeout = time.Minute
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		defer cancel()
+
+		cmd := exec.CommandContext(ctx, "sh", "-c", c.Command)
+		// The command may ask for input, such as a GPG pinentry
+		cmd.Stdin = os.Stdin
+		cmd.Stderr = os.Stderr
+		// Do not wait for children that keep the output pipe open after a timeout
+		cmd.WaitDelay = time.Second
+		output, err := cmd.Output()
+		if ctx.Err() == context.DeadlineExceeded {
+			return "", fmt.Errorf("password command did not finish within %s", timeout)
+		}
+		if err != nil {
+			return "", fmt.Errorf("password command failed: %w", err)
+		}
+		passphrase = strings.TrimRight(string(output), "\r\n")
+	default:
+		return "", ErrNoPassphrase
+	}
+
+	if passphrase == "" {
+		return "", fmt.Errorf("%w (the configured source is empty)", ErrNoPassphrase)
+	}
+	return passphrase, nil
+}
+
+// EncryptedFileStorage implements StorageBackend as a file encrypted with AES-256-GCM under a
+// key derived from a passphrase. It is meant for servers without a keyring, where the plain
+// file would keep refresh tokens readable by anyone who can read the disk or its backups.
+// Locking and atomic writes are the same as for FileStorage.
+type EncryptedFileStorage struct {
+	*FileStorage
+	cipher *passphraseCipher
+}
+
+// NewEncryptedFileStorage creates an encrypted file storage. An existing file is decrypted
+// right away, so that a wrong passphrase is reported before the storage is used.
+func NewEncryptedFileStorage(path string, passphrase string) (*EncryptedFileStorage, error) {
+	if passphrase == "" {
+		return nil, ErrNoPassphrase
+	}
+	s := &EncryptedFileStorage{
+		FileStorage: NewFileStorage(path),
+		cipher:      &passphraseCipher{passphrase: passphrase},
+	}
+	s.codec = s.cipher
+
+	if _, err := s.List(); err != nil {
+		if errors.Is(err, ErrWrongPassphrase) {
+			return nil, fmt.Errorf("%w: %s cannot be decrypted with it", ErrWrongPassphrase, path)
+		}
+		return nil, err
+	}
+	return s, nil
+}
+
+// Rekey re-encrypts the stored tokens under a new passphrase and a new salt
+func (s *EncryptedFileStorage) Rekey(passphrase string) error {
+	if passphrase == "" {
+		return ErrNoPassphrase
+	}
+
+	unlock, err := s.lockWriters("rekey")
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.recordOperation("rekey")
+	data, err := s.loadData()
+	if err != nil {
+		s.recordError("rekey_load", err)
+		return err
+	}
+
+	// The new cipher is only used once the file is written with it, so that a failed write
+	// leaves the storage working under the old passphrase
+	next := &passphraseCipher{passphrase: passphrase}
+	if len(data) > 0 {
+		jsonData, err := json.MarshalIndent(data, "", "  ")
+		if err != nil {
+			s.recordError("rekey_marshal", err)
+			return fmt.Errorf("failed to marshal data: %w", err)
+		}
+		encoded, err := next.encode(jsonData)
+		if err != nil {
+			s.recordError("rekey_encrypt", err)
+			return fmt.Errorf("failed to encrypt data: %w", err)
+		}
+		if err := writeFileAtomic(s.path, encoded); err != nil {
+			s.recordError("rekey_write", err)
+			return fmt.Errorf("failed to write file: %w", err)
+		}
+	}
+	s.cipher = next
+	s.codec = next
+	return nil
+}
+
+// Name returns the backend name for identification
+func (s *EncryptedFileStorage) Name() string {
+	return "encrypted-file:" + s.path
+}
+
+// encryptedFile is the on-disk format of encrypted storage. The header fields are
+// authenticated along with the ciphertext.
+type encryptedFile struct {
+	Version    int    `json:"version"`
+	KDF        string `json:"kdf"`
+	Iterations int    `json:"iterations"`
+	Salt       []byte `json:"salt"`
+	Nonce      []byte `json:"nonce"`
+	Ciphertext []byte `json:"ciphertext"`
+}
+
+// additionalData binds the header to the ciphertext
+func (f *encryptedFile) additionalData() []byte {
+	return []byte(fmt.Sprintf("claude-gate:v%d:%s:%d", f.Version, f.KDF, f.Iterations))
+}
+
+// passphraseCipher encrypts storage files. The derived key is cached for the salt of the
+// file, which only changes when the storage is rekeyed.
+type passphraseCipher struct {
+	mu         sync.Mutex
+	passphrase string
+	salt       []byte
+	iterations int
+	aead       cipher.AEAD
+}
+
+func (c *passphraseCipher) encode(plaintext []byte) ([]byte, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.aead == nil {
+		salt := make([]byte, 16)
+		if _, err := rand.Read(salt); err != nil {
+			return nil, err
+		}
+		if err := c.deriveKey(salt, encryptionIterations); err != nil {
+			return nil, err
+		}
+	}
+
+	file := &encryptedFile{
+		Version:    encryptedFileVersion,
+		KDF:        encryptedFileKDF,
+		Iterations: c.iterations,
+		Salt:       c.salt,
+		Nonce:      make([]byte, c.aead.NonceSize()),
+	}
+	if _, err := rand.Read(file.Nonce); err != nil {
+		return nil, err
+	}
+	file.Ciphertext = c.aead.Seal(nil, file.Nonce, plaintext, file.additionalData())
+	return json.MarshalIndent(file, "", "  ")
+}
+
+func (c *passphraseCipher) decode(stored []byte) ([]byte, error) {
+	var file encryptedFile
+	if err := json.Unmarshal(stored, &file); err != nil || file.Version == 0 {
+		return nil, fmt.Errorf("not an encrypted token file")
+	}
+	if file.Version != encryptedFileVersion || file.KDF != encryptedFileKDF {
+		return nil, fmt.Errorf("unsupported encrypted token file (version %d, %s)", file.Version, file.KDF)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// Another process may have rekeyed the file with the same passphrase
+	if c.aead == nil || !bytes.Equal(file.Salt, c.salt) || file.Iterations != c.iterations {
+		if err := c.deriveKey(file.Salt, file.Iterations); err != nil {
+			return nil, err
+		}
+	}
+	if len(file.Nonce) != c.aead.NonceSize() {
+		return nil, fmt.Errorf("corrupted encrypted token file")
+	}
+	plaintext, err := c.aead.Open(nil, file.Nonce, file.Ciphertext, file.additionalData())
+	if err != nil {
+		// GCM cannot tell a wrong key from tampering; a wrong passphrase is far more likely
+		return nil, ErrWrongPassphrase
+	}
+	return plaintext, nil
+}
+
+// deriveKey derives the AES-256 key for a salt; the caller holds mu
+func (c *passphraseCipher) deriveKey(salt []byte, iterations int) error {
+	// The iteration count comes from the file; bound it so a corrupted file cannot stall startup
+	if len(salt) < 16 || iterations < 1 || iterations > 10*encryptionIterations {
+		return fmt.Errorf("invalid key derivation parameters in encrypted token file")
+	}
+	// One block of SHA-256 output is exactly the AES-256 key size
+	block, err := aes.NewCipher(pbkdf2.Key([]byte(c.passphrase), salt, iterations, 32, sha256.New))
+	if err != nil {
+		return err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return err
+	}
+	c.salt, c.iterations, c.aead = salt, iterations, aead
+	return nil
+}
@@ -0,0 +1,138 @@
+package auth
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fastKeyDerivation lowers the PBKDF2 work factor for the duration of a test
+func fastKeyDerivation(t *testing.T) {
+	t.Helper()
+	iterations := encryptionIterations
+	encryptionIterations = 1000
+	t.Cleanup(func() { encryptionIterations = iterations })
+}
+
+func TestEncryptedFileStorage(t *testing.T) {
+	fastKeyDerivation(t)
+	path := filepath.Join(t.TempDir(), "auth.enc")
+	token := &TokenInfo{
+		Type:         "oauth",
+		AccessToken:  "secret-access",
+		RefreshToken: "secret-refresh",
+		ExpiresAt:    time.Now().Add(time.Hour).Unix(),
+	}
+
+	storage, err := NewEncryptedFileStorage(path, "correct horse")
+	require.NoError(t, err)
+	require.NoError(t, storage.Set("anthropic", token))
+	assert.Equal(t, "encrypted-file:"+path, storage.Name())
+
+	// Nothing readable is written to disk
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.NotContains(t, string(data), "secret-refresh")
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+
+	t.Run("reopened with the passphrase", func(t *testing.T) {
+		reopened, err := NewEncryptedFileStorage(path, "correct horse")
+		require.NoError(t, err)
+		stored, err := reopened.Get("anthropic")
+		require.NoError(t, err)
+		assert.Equal(t, token, stored)
+	})
+
+	t.Run("wrong passphrase", func(t *testing.T) {
+		_, err := NewEncryptedFileStorage(path, "wrong")
+		assert.ErrorIs(t, err, ErrWrongPassphrase)
+		assert.ErrorContains(t, err, path)
+	})
+
+	t.Run("plaintext file", func(t *testing.T) {
+		plainPath := filepath.Join(t.TempDir(), "auth.json")
+		require.NoError(t, NewFileStorage(plainPath).Set("anthropic", token))
+		_, err := NewEncryptedFileStorage(plainPath, "correct horse")
+		assert.ErrorContains(t, err, "not an encrypted token file")
+	})
+
+	t.Run("rekey", func(t *testing.T) {
+		require.NoError(t, storage.Rekey("battery staple"))
+
+		// The storage keeps working under the new passphrase
+		stored, err := storage.Get("anthropic")
+		require.NoError(t, err)
+		assert.Equal(t, token, stored)
+
+		_, err = NewEncryptedFileStorage(path, "correct horse")
+		assert.ErrorIs(t, err, ErrWrongPassphrase)
+		reopened, err := NewEncryptedFileStorage(path, "battery staple")
+		require.NoError(t, err)
+		stored, err = reopened.Get("anthropic")
+		require.NoError(t, err)
+		assert.Equal(t, token, stored)
+	})
+}
+
+func TestEncryptedFileStorage_FailedRekey(t *testing.T) {
+	fastKeyDerivation(t)
+	// A file name at the length limit leaves no room for the temporary file, so writes fail
+	path := filepath.Join(t.TempDir(), strings.Repeat("a", 250))
+	storage, err := NewEncryptedFileStorage(path, "correct horse")
+	require.NoError(t, err)
+	token := &TokenInfo{Type: "oauth", AccessToken: "secret-access", RefreshToken: "secret-refresh"}
+
+	// Store a token directly, as regular writes fail the same way
+	data, err := storage.cipher.encode([]byte(`{"anthropic": {"type": "oauth", "access": "secret-access", "refresh": "secret-refresh"}}`))
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(path, data, 0600))
+
+	assert.Error(t, storage.Rekey("battery staple"))
+
+	// The storage and the file are still under the old passphrase
+	stored, err := storage.Get("anthropic")
+	require.NoError(t, err)
+	assert.Equal(t, token, stored)
+	_, err = NewEncryptedFileStorage(path, "correct horse")
+	assert.NoError(t, err)
+}
+
+func TestPassphraseConfig_Resolve(t *testing.T) {
+	passwordFile := filepath.Join(t.TempDir(), "password")
+	require.NoError(t, os.WriteFile(passwordFile, []byte("from-file\n"), 0600))
+
+	tests := []struct {
+		name     string
+		config   PassphraseConfig
+		expected string
+		err      string
+	}{
+		{name: "passphrase", config: PassphraseConfig{Passphrase: "direct", File: passwordFile}, expected: "direct"},
+		{name: "file", config: PassphraseConfig{File: passwordFile, Command: "echo ignored"}, expected: "from-file"},
+		{name: "command", config: PassphraseConfig{Command: "echo from-command"}, expected: "from-command"},
+		{name: "failing command", config: PassphraseConfig{Command: "exit 3"}, err: "password command failed"},
+		{name: "hanging command", config: PassphraseConfig{Command: "exec sleep 10", Timeout: 100 * time.Millisecond}, err: "did not finish within 100ms"},
+		{name: "empty output", config: PassphraseConfig{Command: "true"}, err: "needs a passphrase"},
+		{name: "missing file", config: PassphraseConfig{File: passwordFile + ".missing"}, err: "failed to read password file"},
+		{name: "not configured", err: "CLAUDE_GATE_STORAGE_PASSPHRASE"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			passphrase, err := tt.config.Resolve()
+			if tt.err != "" {
+				assert.ErrorContains(t, err, tt.err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, passphrase)
+		})
+	}
+}
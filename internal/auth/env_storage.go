@@ -0,0 +1,223 @@
+package auth
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Environment variables read by EnvStorage. Each one can also be given as a file path in a
+// variable with a _FILE suffix, such as a Docker secret in CLAUDE_GATE_OAUTH_TOKEN_FILE.
+const (
+	EnvOAuthToken        = "CLAUDE_GATE_OAUTH_TOKEN"         // JSON token, as stored in auth.json
+	EnvOAuthAccessToken  = "CLAUDE_GATE_OAUTH_ACCESS_TOKEN"  // Access token
+	EnvOAuthRefreshToken = "CLAUDE_GATE_OAUTH_REFRESH_TOKEN" // Refresh token
+	EnvOAuthExpiresAt    = "CLAUDE_GATE_OAUTH_EXPIRES_AT"    // Expiry as Unix seconds, milliseconds or RFC 3339
+)
+
+// EnvStorage implements StorageBackend by reading the OAuth token from environment variables,
+// for CI jobs and containers where 'auth login' cannot run and no token file should be baked
+// into the image. The environment cannot be written, so refreshed tokens are kept in memory
+// for the lifetime of the process.
+type EnvStorage struct {
+	mu      sync.Mutex
+	overlay map[string]*envOverlay
+}
+
+// envOverlay is a token written at runtime on top of the token from the environment
+type envOverlay struct {
+	token *TokenInfo // nil after Remove
+	base  string     // Fingerprint of the environment token the overlay replaces
+}
+
+// NewEnvStorage creates an environment variable storage backend
+func NewEnvStorage() *EnvStorage {
+	return &EnvStorage{overlay: make(map[string]*envOverlay)}
+}
+
+// Get retrieves token information for a provider. A token written at runtime is returned
+// until the environment token changes, such as when a mounted secret is rotated.
+func (s *EnvStorage) Get(provider string) (*TokenInfo, error) {
+	token, err := s.envToken(provider)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if overlay, ok := s.overlay[provider]; ok {
+		if overlay.base == fingerprint(token) {
+			return overlay.token, nil
+		}
+		delete(s.overlay, provider)
+	}
+	return token, nil
+}
+
+// Set keeps token information in memory; it is lost when the process exits
+func (s *EnvStorage) Set(provider string, token *TokenInfo) error {
+	return s.write(provider, token)
+}
+
+// Remove hides the token of a provider for the rest of the process
+func (s *EnvStorage) Remove(provider string) error {
+	return s.write(provider, nil)
+}
+
+// List returns all stored provider names
+func (s *EnvStorage) List() ([]string, error) {
+	token, err := s.Get("anthropic")
+	if err != nil {
+		return nil, err
+	}
+	providers := []string{}
+	if token != nil {
+		providers = append(providers, "anthropic")
+	}
+	for provider, overlay := range s.overlays() {
+		if provider != "anthropic" && overlay.token != nil {
+			providers = append(providers, provider)
+		}
+	}
+	return providers, nil
+}
+
+// IsAvailable checks if the backend is available on this system
+func (s *EnvStorage) IsAvailable() bool {
+	return true
+}
+
+// RequiresUnlock checks if the backend needs to be unlocked
+func (s *EnvStorage) RequiresUnlock() bool {
+	return false
+}
+
+// Unlock attempts to unlock the backend
+func (s *EnvStorage) Unlock() error {
+	return nil
+}
+
+// Lock locks the backend
+func (s *EnvStorage) Lock() error {
+	return nil
+}
+
+// Name returns the backend name for identification
+func (s *EnvStorage) Name() string {
+	return "env"
+}
+
+// write records a runtime token on top of the current environment token
+func (s *EnvStorage) write(provider string, token *TokenInfo) error {
+	base, err := s.envToken(provider)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.overlay[provider] = &envOverlay{token: token, base: fingerprint(base)}
+	return nil
+}
+
+// overlays returns a copy of the runtime tokens
+func (s *EnvStorage) overlays() map[string]*envOverlay {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	overlays := make(map[string]*envOverlay, len(s.overlay))
+	for provider, overlay := range s.overlay {
+		overlays[provider] = overlay
+	}
+	return overlays
+}
+
+// envToken builds the token of a provider from the environment. Only the Anthropic OAuth
+// token can be configured this way.
+func (s *EnvStorage) envToken(provider string) (*TokenInfo, error) {
+	if provider != "anthropic" {
+		return nil, nil
+	}
+
+	blob, err := lookupEnv(EnvOAuthToken)
+	if err != nil {
+		return nil, err
+	}
+	if blob != "" {
+		var token TokenInfo
+		if err := json.Unmarshal([]byte(blob), &token); err != nil {
+			return nil, fmt.Errorf("%w: invalid %s: %v", ErrKeyringCorrupted, EnvOAuthToken, err)
+		}
+		if token.Type == "" {
+			token.Type = "oauth"
+		}
+		return &token, nil
+	}
+
+	token := &TokenInfo{Type: "oauth"}
+	if token.AccessToken, err = lookupEnv(EnvOAuthAccessToken); err != nil {
+		return nil, err
+	}
+	if token.RefreshToken, err = lookupEnv(EnvOAuthRefreshToken); err != nil {
+		return nil, err
+	}
+	if token.AccessToken == "" && token.RefreshToken == "" {
+		return nil, nil
+	}
+
+	expiresAt, err := lookupEnv(EnvOAuthExpiresAt)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case expiresAt != "":
+		if token.ExpiresAt, err = parseExpiresAt(expiresAt); err != nil {
+			return nil, fmt.Errorf("invalid %s: %w", EnvOAuthExpiresAt, err)
+		}
+	case token.AccessToken == "":
+		// Only a refresh token: mark the token expired so the first request refreshes it
+		token.ExpiresAt = 1
+	}
+	return token, nil
+}
+
+// lookupEnv returns a variable, or the trimmed contents of the file named by its _FILE variant
+func lookupEnv(name string) (string, error) {
+	if value := os.Getenv(name); value != "" {
+		return value, nil
+	}
+	path := os.Getenv(name + "_FILE")
+	if path == "" {
+		return "", nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read %s_FILE: %w", name, err)
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
+// parseExpiresAt parses Unix seconds, Unix milliseconds (as Claude Code stores them) or RFC 3339
+func parseExpiresAt(value string) (int64, error) {
+	if n, err := strconv.ParseInt(value, 10, 64); err == nil {
+		if n > 1e12 {
+			n /= 1000
+		}
+		return n, nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return 0, fmt.Errorf("expected Unix seconds or an RFC 3339 time: %q", value)
+	}
+	return t.Unix(), nil
+}
+
+// fingerprint identifies a token from the environment
+func fingerprint(token *TokenInfo) string {
+	if token == nil {
+		return ""
+	}
+	return token.AccessToken + "\x00" + token.RefreshToken + "\x00" + token.APIKey
+}
@@ -0,0 +1,151 @@
+package auth
+
+import (
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEnvStorage_Get(t *testing.T) {
+	expires := time.Date(2030, 1, 2, 3, 4, 5, 0, time.UTC)
+	secretFile := filepath.Join(t.TempDir(), "token.json")
+	require.NoError(t, os.WriteFile(secretFile, []byte(`{"type": "oauth", "access": "file-access", "refresh": "file-refresh", "expires": 1893553445}`+"\n"), 0600))
+
+	tests := []struct {
+		name     string
+		env      map[string]string
+		expected *TokenInfo
+		err      string
+	}{
+		{
+			name:     "nothing set",
+			expected: nil,
+		},
+		{
+			name: "separate variables",
+			env: map[string]string{
+				EnvOAuthAccessToken:  "env-access",
+				EnvOAuthRefreshToken: "env-refresh",
+				EnvOAuthExpiresAt:    expires.Format(time.RFC3339),
+			},
+			expected: &TokenInfo{Type: "oauth", AccessToken: "env-access", RefreshToken: "env-refresh", ExpiresAt: expires.Unix()},
+		},
+		{
+			name: "expiry in milliseconds",
+			env: map[string]string{
+				EnvOAuthAccessToken: "env-access",
+				EnvOAuthExpiresAt:   "1893553445000",
+			},
+			expected: &TokenInfo{Type: "oauth", AccessToken: "env-access", ExpiresAt: 1893553445},
+		},
+		{
+			name:     "refresh token only is refreshed right away",
+			env:      map[string]string{EnvOAuthRefreshToken: "env-refresh"},
+			expected: &TokenInfo{Type: "oauth", RefreshToken: "env-refresh", ExpiresAt: 1},
+		},
+		{
+			name: "JSON token takes precedence",
+			env: map[string]string{
+				EnvOAuthToken:       `{"access": "json-access", "refresh": "json-refresh", "expires": 1893553445}`,
+				EnvOAuthAccessToken: "env-access",
+			},
+			expected: &TokenInfo{Type: "oauth", AccessToken: "json-access", RefreshToken: "json-refresh", ExpiresAt: 1893553445},
+		},
+		{
+			name:     "Docker secret file",
+			env:      map[string]string{EnvOAuthToken + "_FILE": secretFile},
+			expected: &TokenInfo{Type: "oauth", AccessToken: "file-access", RefreshToken: "file-refresh", ExpiresAt: 1893553445},
+		},
+		{
+			name: "invalid JSON",
+			env:  map[string]string{EnvOAuthToken: `{"access": `},
+			err:  "invalid " + EnvOAuthToken,
+		},
+		{
+			name: "invalid expiry",
+			env:  map[string]string{EnvOAuthAccessToken: "env-access", EnvOAuthExpiresAt: "tomorrow"},
+			err:  "invalid " + EnvOAuthExpiresAt,
+		},
+		{
+			name: "missing secret file",
+			env:  map[string]string{EnvOAuthRefreshToken + "_FILE": secretFile + ".missing"},
+			err:  "failed to read " + EnvOAuthRefreshToken + "_FILE",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, name := range []string{EnvOAuthToken, EnvOAuthAccessToken, EnvOAuthRefreshToken, EnvOAuthExpiresAt} {
+				t.Setenv(name, "")
+				t.Setenv(name+"_FILE", "")
+			}
+			for name, value := range tt.env {
+				t.Setenv(name, value)
+			}
+
+			token, err := NewEnvStorage().Get("anthropic")
+			if tt.err != "" {
+				assert.ErrorContains(t, err, tt.err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, token)
+		})
+	}
+}
+
+func TestEnvStorage_Overlay(t *testing.T) {
+	t.Setenv(EnvOAuthToken, "")
+	t.Setenv(EnvOAuthAccessToken, "env-access")
+	t.Setenv(EnvOAuthRefreshToken, "env-refresh")
+	storage := NewEnvStorage()
+
+	refreshed := &TokenInfo{Type: "oauth", AccessToken: "refreshed-access", RefreshToken: "refreshed-refresh"}
+	require.NoError(t, storage.Set("anthropic", refreshed))
+	token, err := storage.Get("anthropic")
+	require.NoError(t, err)
+	assert.Equal(t, refreshed, token)
+
+	providers, err := storage.List()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"anthropic"}, providers)
+
+	// A rotated secret replaces the token kept in memory
+	t.Setenv(EnvOAuthAccessToken, "rotated-access")
+	token, err = storage.Get("anthropic")
+	require.NoError(t, err)
+	assert.Equal(t, "rotated-access", token.AccessToken)
+
+	require.NoError(t, storage.Remove("anthropic"))
+	token, err = storage.Get("anthropic")
+	require.NoError(t, err)
+	assert.Nil(t, token)
+}
+
+func TestOAuthTokenProvider_EnvStorage(t *testing.T) {
+	server, calls := refreshServer(t, false)
+	t.Setenv(EnvOAuthToken, "")
+	t.Setenv(EnvOAuthAccessToken, "")
+	t.Setenv(EnvOAuthRefreshToken, "env-refresh")
+
+	provider := NewOAuthTokenProvider(NewEnvStorage())
+	provider.client.TokenURL = server.URL
+
+	token, err := provider.GetAccessToken()
+	require.NoError(t, err)
+	assert.Equal(t, "refreshed-1", token)
+
+	// The refreshed token is used from memory, and refreshed again when it is rejected
+	token, err = provider.ForceRefresh("refreshed-1")
+	require.NoError(t, err)
+	assert.Equal(t, "refreshed-2", token)
+	token, err = provider.GetAccessToken()
+	require.NoError(t, err)
+	assert.Equal(t, "refreshed-2", token)
+	assert.Equal(t, int32(2), atomic.LoadInt32(calls))
+}
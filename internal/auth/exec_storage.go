@@ -0,0 +1,241 @@
+package auth
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// Credential helper protocol
+//
+// The helper is a command run through sh with the operation as its last argument, much
+// like a git credential helper: "<helper> get", "<helper> store", "<helper> erase" or
+// "<helper> list". It reads one JSON request from stdin:
+//
+//	{"version": 1, "operation": "store", "service": "claude-gate", "provider": "anthropic",
+//	 "token": {"type": "oauth", "access": "...", "refresh": "...", "expires": 1735689600}}
+//
+// "provider" is omitted for list and "token" is only sent to store. On success the helper
+// exits with status 0 and writes one JSON response to stdout:
+//
+//	get:          {"token": {...}}, or {} when nothing is stored for the provider
+//	store, erase: {} or no output
+//	list:         {"providers": ["anthropic"]}
+//
+// On failure it exits with a non-zero status, optionally writing an error response:
+//
+//	{"error": {"code": "locked", "message": "vault is sealed"}}
+//
+// Error codes are "not_found" (get and erase then succeed), "locked", "access_denied",
+// "unavailable" and "corrupted". Anything on stderr is included in error messages.
+
+const execHelperProtocolVersion = 1
+
+// execRequest is the request written to the helper's stdin
+type execRequest struct {
+	Version   int        `json:"version"`
+	Operation string     `json:"operation"`
+	Service   string     `json:"service"`
+	Provider  string     `json:"provider,omitempty"`
+	Token     *TokenInfo `json:"token,omitempty"`
+}
+
+// execResponse is the response read from the helper's stdout
+type execResponse struct {
+	Token     *TokenInfo `json:"token"`
+	Providers []string   `json:"providers"`
+	Error     *struct {
+		Code    string `json:"code"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+// ExecStorageConfig configures credential helper storage
+type ExecStorageConfig struct {
+	Command     string        // Helper command, such as "claude-gate-credential-pass" or "/usr/local/bin/vault-helper --mount kv"
+	ServiceName string        // Sent to the helper to namespace its entries (default claude-gate)
+	Timeout     time.Duration // Limit for a single helper call (default 10s)
+}
+
+// ExecStorage implements StorageBackend by calling an external credential helper, so that
+// tokens can live in 1Password, Vault, pass or any other secret manager without linking
+// against it. The helper protocol is described at the top of this file.
+type ExecStorage struct {
+	config ExecStorageConfig
+}
+
+// NewExecStorage creates a credential helper storage backend
+func NewExecStorage(config ExecStorageConfig) (*ExecStorage, error) {
+	if strings.TrimSpace(config.Command) == "" {
+		return nil, fmt.Errorf("%w: no credential helper command configured", ErrKeyringUnavailable)
+	}
+	if config.ServiceName == "" {
+		config.ServiceName = "claude-gate"
+	}
+	if config.Timeout <= 0 {
+		config.Timeout = 10 * time.Second
+	}
+	return &ExecStorage{config: config}, nil
+}
+
+// Get retrieves token information for a provider
+func (s *ExecStorage) Get(provider string) (*TokenInfo, error) {
+	resp, err := s.call(execRequest{Operation: "get", Provider: provider})
+	if err != nil {
+		if errors.Is(err, errHelperNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return resp.Token, nil
+}
+
+// Set stores token information for a provider
+func (s *ExecStorage) Set(provider string, token *TokenInfo) error {
+	_, err := s.call(execRequest{Operation: "store", Provider: provider, Token: token})
+	return err
+}
+
+// Remove deletes token information for a provider
+func (s *ExecStorage) Remove(provider string) error {
+	_, err := s.call(execRequest{Operation: "erase", Provider: provider})
+	if errors.Is(err, errHelperNotFound) {
+		return nil
+	}
+	return err
+}
+
+// List returns all stored provider names
+func (s *ExecStorage) List() ([]string, error) {
+	resp, err := s.call(execRequest{Operation: "list"})
+	if err != nil {
+		return nil, err
+	}
+	if resp.Providers == nil {
+		return []string{}, nil
+	}
+	return resp.Providers, nil
+}
+
+// IsAvailable checks if the backend is available on this system
+func (s *ExecStorage) IsAvailable() bool {
+	return s.config.Command != ""
+}
+
+// RequiresUnlock checks if the backend needs to be unlocked
+func (s *ExecStorage) RequiresUnlock() bool {
+	// Unlocking is up to the helper's secret manager
+	return false
+}
+
+// Unlock attempts to unlock the backend
+func (s *ExecStorage) Unlock() error {
+	return nil
+}
+
+// Lock locks the backend
+func (s *ExecStorage) Lock() error {
+	return nil
+}
+
+// Name returns the backend name for identification
+func (s *ExecStorage) Name() string {
+	return "exec:" + strings.Fields(s.config.Command)[0]
+}
+
+// errHelperNotFound is reported by a helper that has no entry for the provider
+var errHelperNotFound = errors.New("credential helper has no entry")
+
+// call runs the helper for one operation
+func (s *ExecStorage) call(req execRequest) (*execResponse, error) {
+	req.Version = execHelperProtocolVersion
+	req.Service = s.config.ServiceName
+	input, err := json.Marshal(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal helper request: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), s.config.Timeout)
+	defer cancel()
+
+	// The operation is passed as "$@" so that the command may carry its own arguments
+	cmd := exec.CommandContext(ctx, "sh", "-c", s.config.Command+` "$@"`, "credential-helper", req.Operation)
+	cmd.Stdin = bytes.NewReader(input)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	// Do not wait for children that keep the output pipes open after a timeout
+	cmd.WaitDelay = time.Second
+
+	runErr := cmd.Run()
+	if ctx.Err() == context.DeadlineExceeded {
+		return nil, fmt.Errorf("%w: credential helper %s did not finish within %s", ErrKeyringTimeout, req.Operation, s.config.Timeout)
+	}
+
+	var resp execResponse
+	output := bytes.TrimSpace(stdout.Bytes())
+	var decodeErr error
+	if len(output) > 0 {
+		decodeErr = json.Unmarshal(output, &resp)
+	}
+
+	if runErr != nil {
+		if resp.Error != nil {
+			return nil, helperError(req.Operation, resp.Error.Code, resp.Error.Message)
+		}
+		var exitErr *exec.ExitError
+		if errors.As(runErr, &exitErr) && exitErr.ExitCode() == 127 {
+			// sh reports a command that does not exist with status 127
+			return nil, fmt.Errorf("%w: credential helper not found%s", ErrKeyringUnavailable, describeStderr(stderr.String()))
+		}
+		return nil, fmt.Errorf("credential helper %s failed: %v%s", req.Operation, runErr, describeStderr(stderr.String()))
+	}
+
+	if decodeErr != nil {
+		return nil, fmt.Errorf("%w: invalid credential helper response to %s: %v", ErrKeyringCorrupted, req.Operation, decodeErr)
+	}
+	if resp.Error != nil {
+		return nil, helperError(req.Operation, resp.Error.Code, resp.Error.Message)
+	}
+	return &resp, nil
+}
+
+// helperError maps a helper error code onto the storage errors
+func helperError(operation, code, message string) error {
+	var base error
+	switch code {
+	case "not_found":
+		return errHelperNotFound
+	case "locked":
+		base = ErrKeyringLocked
+	case "access_denied":
+		base = ErrKeyringAccessDenied
+	case "unavailable":
+		base = ErrKeyringUnavailable
+	case "corrupted":
+		base = ErrKeyringCorrupted
+	default:
+		return fmt.Errorf("credential helper %s failed: %s (%s)", operation, message, code)
+	}
+	if message == "" {
+		return base
+	}
+	return fmt.Errorf("%w: %s", base, message)
+}
+
+// describeStderr formats helper stderr for an error message
+func describeStderr(stderr string) string {
+	stderr = strings.TrimSpace(stderr)
+	if stderr == "" {
+		return ""
+	}
+	if len(stderr) > 512 {
+		stderr = stderr[:512] + "..."
+	}
+	return ": " + stderr
+}
@@ -0,0 +1,160 @@
+package auth
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// directoryHelper is a credential helper keeping each provider's last store request in a
+// file of the directory given as its first argument. A get returns the stored request,
+// whose "token" field is the response.
+const directoryHelper = `#!/bin/sh
+dir=$1
+request=$(cat)
+provider=$(printf '%s' "$request" | sed -n 's/.*"provider":"\([^"]*\)".*/\1/p')
+case "$2" in
+get)
+	if [ -f "$dir/$provider" ]; then cat "$dir/$provider"; else echo '{}'; fi ;;
+store)
+	printf '%s' "$request" > "$dir/$provider" ;;
+erase)
+	if [ ! -f "$dir/$provider" ]; then
+		echo '{"error": {"code": "not_found"}}'
+		exit 1
+	fi
+	rm "$dir/$provider" ;;
+list)
+	printf '{"providers": ['
+	sep=
+	for f in "$dir"/*; do
+		[ -f "$f" ] || continue
+		printf '%s"%s"' "$sep" "$(basename "$f")"
+		sep=,
+	done
+	printf ']}' ;;
+*)
+	exit 2 ;;
+esac
+`
+
+// writeHelper writes an executable helper script and returns its path
+func writeHelper(t *testing.T, script string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "helper.sh")
+	require.NoError(t, os.WriteFile(path, []byte(script), 0700))
+	return path
+}
+
+func TestExecStorage(t *testing.T) {
+	dir := t.TempDir()
+	storage, err := NewExecStorage(ExecStorageConfig{Command: writeHelper(t, directoryHelper) + " " + dir})
+	require.NoError(t, err)
+	assert.True(t, storage.IsAvailable())
+	assert.Contains(t, storage.Name(), "exec:")
+
+	token := &TokenInfo{
+		Type:         "oauth",
+		AccessToken:  "test-access",
+		RefreshToken: "test-refresh",
+		ExpiresAt:    time.Now().Add(time.Hour).Unix(),
+	}
+	require.NoError(t, storage.Set("anthropic", token))
+	require.NoError(t, storage.Set("other", &TokenInfo{Type: "api", APIKey: "test-key"}))
+
+	stored, err := storage.Get("anthropic")
+	require.NoError(t, err)
+	assert.Equal(t, token, stored)
+
+	// The helper sees the protocol version and service along with the token
+	data, err := os.ReadFile(filepath.Join(dir, "anthropic"))
+	require.NoError(t, err)
+	assert.JSONEq(t, fmt.Sprintf(`{"version": 1, "operation": "store", "service": "claude-gate", "provider": "anthropic",
+		"token": {"type": "oauth", "access": "test-access", "refresh": "test-refresh", "expires": %d}}`, token.ExpiresAt), string(data))
+
+	providers, err := storage.List()
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{"anthropic", "other"}, providers)
+
+	require.NoError(t, storage.Remove("anthropic"))
+	stored, err = storage.Get("anthropic")
+	require.NoError(t, err)
+	assert.Nil(t, stored)
+
+	// Erasing a missing entry succeeds
+	assert.NoError(t, storage.Remove("anthropic"))
+}
+
+func TestExecStorage_Errors(t *testing.T) {
+	tests := []struct {
+		name    string
+		script  string
+		timeout time.Duration
+		err     error
+		message string
+	}{
+		{
+			name:    "locked",
+			script:  "#!/bin/sh\necho '{\"error\": {\"code\": \"locked\", \"message\": \"vault is sealed\"}}'\nexit 1\n",
+			err:     ErrKeyringLocked,
+			message: "vault is sealed",
+		},
+		{
+			name:   "access denied",
+			script: "#!/bin/sh\necho '{\"error\": {\"code\": \"access_denied\"}}'\nexit 1\n",
+			err:    ErrKeyringAccessDenied,
+		},
+		{
+			name:    "invalid response",
+			script:  "#!/bin/sh\necho 'not json'\n",
+			err:     ErrKeyringCorrupted,
+			message: "invalid credential helper response",
+		},
+		{
+			name:    "timeout",
+			script:  "#!/bin/sh\nsleep 5\n",
+			timeout: 100 * time.Millisecond,
+			err:     ErrKeyringTimeout,
+		},
+		{
+			name:    "failure with stderr",
+			script:  "#!/bin/sh\necho 'op: not signed in' >&2\nexit 1\n",
+			message: "op: not signed in",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			storage, err := NewExecStorage(ExecStorageConfig{Command: writeHelper(t, tt.script), Timeout: tt.timeout})
+			require.NoError(t, err)
+
+			start := time.Now()
+			_, err = storage.Get("anthropic")
+			require.Error(t, err)
+			if tt.err != nil {
+				assert.ErrorIs(t, err, tt.err)
+			}
+			if tt.message != "" {
+				assert.ErrorContains(t, err, tt.message)
+			}
+			assert.Less(t, time.Since(start), 3*time.Second)
+		})
+	}
+
+	t.Run("missing helper", func(t *testing.T) {
+		storage, err := NewExecStorage(ExecStorageConfig{Command: filepath.Join(t.TempDir(), "missing-helper")})
+		require.NoError(t, err)
+		_, err = storage.List()
+		assert.ErrorIs(t, err, ErrKeyringUnavailable)
+	})
+
+	t.Run("no command", func(t *testing.T) {
+		_, err := NewExecStorage(ExecStorageConfig{})
+		assert.ErrorIs(t, err, ErrKeyringUnavailable)
+	})
+}
@@ -0,0 +1,24 @@
+//go:build !unix
+
+package auth
+
+import "os"
+
+// fileLock only creates the sidecar lock file on systems without flock(2);
+// writes are still atomic, but concurrent processes are not serialized
+type fileLock struct{}
+
+// lockFile creates the lock file so that its absence does not hide a configuration error
+func lockFile(path string, exclusive bool) (*fileLock, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0600)
+	if err != nil {
+		return nil, err
+	}
+	file.Close()
+	return &fileLock{}, nil
+}
+
+// unlock releases the lock
+func (l *fileLock) unlock() error {
+	return nil
+}
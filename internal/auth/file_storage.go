@@ -34,11 +34,29 @@ func (t *TokenInfo) NeedsRefresh() bool {
 	return time.Now().Unix() >= (t.ExpiresAt - 300) // 5 minutes buffer
 }
 
-// FileStorage implements StorageBackend using JSON file storage
+// FileStorage implements StorageBackend using JSON file storage.
+// Several processes, such as a running server and 'auth status', can share the file:
+// writers hold an advisory lock on a sidecar lock file, and replace the file atomically
+// so that readers, which take no file lock, never see a partial update.
 type FileStorage struct {
-	path    string
-	mu      sync.RWMutex
-	metrics StorageMetrics
+	path      string
+	mu        sync.RWMutex // Guards the file and codec within the process, for one operation at a time
+	writeMu   sync.Mutex   // Serializes writers within the process; taken before the file lock
+	metricsMu sync.Mutex   // Separate mutex for metrics, as concurrent reads record them too
+	metrics   StorageMetrics
+	codec     fileCodec // Transforms the file contents, such as encryption (nil stores plain JSON)
+}
+
+// fileBackedStorage is implemented by backends that keep their tokens in a single file
+type fileBackedStorage interface {
+	StorageBackend
+	storagePath() string
+}
+
+// fileCodec converts the JSON token map to and from the bytes stored on disk
+type fileCodec interface {
+	encode(plaintext []byte) ([]byte, error)
+	decode(stored []byte) ([]byte, error)
 }
 
 // NewFileStorage creates a new file-based storage backend
@@ -57,7 +75,120 @@ func NewFileStorage(path string) *FileStorage {
 func (s *FileStorage) Get(provider string) (*TokenInfo, error) {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
+	return s.get(provider)
+}
+
+// Set stores token information for a provider
+func (s *FileStorage) Set(provider string, token *TokenInfo) error {
+	unlock, err := s.lockWriters("set")
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.set(provider, token)
+}
+
+// Remove deletes token information for a provider
+func (s *FileStorage) Remove(provider string) error {
+	unlock, err := s.lockWriters("remove")
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.remove(provider)
+}
+
+// List returns all stored provider names
+func (s *FileStorage) List() ([]string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.list()
+}
+
+// WithLock runs fn while holding the exclusive lock of the file, so that a read-modify-write
+// such as a token refresh cannot interleave with another writer. Readers are not blocked,
+// even when fn makes a network call. fn must use the storage it is given; calling Set or
+// Remove of s from fn would deadlock.
+func (s *FileStorage) WithLock(fn func(storage StorageBackend) error) error {
+	unlock, err := s.lockWriters("lock")
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	return fn(&lockedFileStorage{s})
+}
+
+// lockedFileStorage accesses a FileStorage whose writer locks are held by WithLock
+type lockedFileStorage struct {
+	*FileStorage
+}
+
+func (l *lockedFileStorage) Get(provider string) (*TokenInfo, error) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return l.get(provider)
+}
+
+func (l *lockedFileStorage) Set(provider string, token *TokenInfo) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.set(provider, token)
+}
+
+func (l *lockedFileStorage) Remove(provider string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.remove(provider)
+}
+
+func (l *lockedFileStorage) List() ([]string, error) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return l.list()
+}
+
+// lockWriters serializes writers of the file within the process and, through the lock
+// file, across processes. The returned function releases both locks.
+func (s *FileStorage) lockWriters(op string) (func(), error) {
+	s.writeMu.Lock()
+	lock, err := s.exclusiveLock(op)
+	if err != nil {
+		s.writeMu.Unlock()
+		return nil, err
+	}
+	return func() {
+		lock.unlock()
+		s.writeMu.Unlock()
+	}, nil
+}
+
+// exclusiveLock creates the storage directory and locks the file for writing
+func (s *FileStorage) exclusiveLock(op string) (*fileLock, error) {
+	// Ensure directory exists
+	dir := filepath.Dir(s.path)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		s.recordOperation(op)
+		s.recordError(op+"_mkdir", err)
+		return nil, fmt.Errorf("failed to create directory: %w", err)
+	}
 	
+	lock, err := lockFile(s.path+".lock", true)
+	if err != nil {
+		s.recordOperation(op)
+		s.recordError(op+"_lock", err)
+		return nil, fmt.Errorf("failed to lock %s: %w", s.path, err)
+	}
+	return lock, nil
+}
+
+// get reads a token; the caller holds the locks
+func (s *FileStorage) get(provider string) (*TokenInfo, error) {
 	start := time.Now()
 	s.recordOperation("get")
 	
@@ -87,21 +218,11 @@ func (s *FileStorage) Get(provider string) (*TokenInfo, error) {
 	return nil, nil
 }
 
-// Set stores token information for a provider
-func (s *FileStorage) Set(provider string, token *TokenInfo) error {
-	s.mu.Lock()
-	defer s.mu.Unlock()
-	
+// set writes a token; the caller holds the locks
+func (s *FileStorage) set(provider string, token *TokenInfo) error {
 	start := time.Now()
 	s.recordOperation("set")
 	
-	// Ensure directory exists
-	dir := filepath.Dir(s.path)
-	if err := os.MkdirAll(dir, 0700); err != nil {
-		s.recordError("set_mkdir", err)
-		return fmt.Errorf("failed to create directory: %w", err)
-	}
-	
 	data, err := s.loadData()
 	if err != nil {
 		s.recordError("set_load", err)
@@ -117,7 +238,7 @@ func (s *FileStorage) Set(provider string, token *TokenInfo) error {
 		return fmt.Errorf("failed to marshal data: %w", err)
 	}
 	
-	if err := os.WriteFile(s.path, jsonData, 0600); err != nil {
+	if err := s.writeFile(jsonData); err != nil {
 		s.recordError("set_write", err)
 		return fmt.Errorf("failed to write file: %w", err)
 	}
@@ -126,11 +247,8 @@ func (s *FileStorage) Set(provider string, token *TokenInfo) error {
 	return nil
 }
 
-// Remove deletes token information for a provider
-func (s *FileStorage) Remove(provider string) error {
-	s.mu.Lock()
-	defer s.mu.Unlock()
-	
+// remove deletes a token; the caller holds the locks
+func (s *FileStorage) remove(provider string) error {
 	start := time.Now()
 	s.recordOperation("remove")
 	
@@ -143,7 +261,7 @@ func (s *FileStorage) Remove(provider string) error {
 	delete(data, provider)
 	
 	if len(data) == 0 {
-		// Remove file if no data left
+		// Remove file if no data left; the lock file stays, as other processes may hold it
 		err := os.Remove(s.path)
 		if err != nil && !os.IsNotExist(err) {
 			s.recordError("remove_file", err)
@@ -160,7 +278,7 @@ func (s *FileStorage) Remove(provider string) error {
 		return fmt.Errorf("failed to marshal data: %w", err)
 	}
 	
-	if err := os.WriteFile(s.path, jsonData, 0600); err != nil {
+	if err := s.writeFile(jsonData); err != nil {
 		s.recordError("remove_write", err)
 		return fmt.Errorf("failed to write file: %w", err)
 	}
@@ -169,11 +287,8 @@ func (s *FileStorage) Remove(provider string) error {
 	return nil
 }
 
-// List returns all stored provider names
-func (s *FileStorage) List() ([]string, error) {
-	s.mu.RLock()
-	defer s.mu.RUnlock()
-	
+// list returns the stored provider names; the caller holds the locks
+func (s *FileStorage) list() ([]string, error) {
 	start := time.Now()
 	s.recordOperation("list")
 	
@@ -192,6 +307,58 @@ func (s *FileStorage) List() ([]string, error) {
 	return providers, nil
 }
 
+// writeFile replaces the file atomically: the data is written to a temporary file in the
+// same directory, synced to disk and renamed over the old file
+func (s *FileStorage) writeFile(data []byte) error {
+	if s.codec != nil {
+		encoded, err := s.codec.encode(data)
+		if err != nil {
+			return err
+		}
+		data = encoded
+	}
+	
+	return writeFileAtomic(s.path, data)
+}
+
+// writeFileAtomic replaces the file at path with data, readable by the owner only, so that
+// readers never see a partially written file
+func writeFileAtomic(path string, data []byte) error {
+	dir := filepath.Dir(path)
+	tmp, err := os.CreateTemp(dir, "."+filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	tmpPath := tmp.Name()
+	defer os.Remove(tmpPath) // No-op once renamed
+	
+	if err := tmp.Chmod(0600); err != nil {
+		tmp.Close()
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		return err
+	}
+	
+	// Sync the directory so the rename survives a crash; not every system supports it
+	if d, err := os.Open(dir); err == nil {
+		d.Sync()
+		d.Close()
+	}
+	return nil
+}
+
 // IsAvailable checks if the backend is available on this system
 func (s *FileStorage) IsAvailable() bool {
 	// File storage is always available
@@ -216,6 +383,11 @@ func (s *FileStorage) Lock() error {
 	return nil
 }
 
+// storagePath returns the path of the token file
+func (s *FileStorage) storagePath() string {
+	return s.path
+}
+
 // Name returns the backend name for identification
 func (s *FileStorage) Name() string {
 	return "file:" + s.path
@@ -233,6 +405,12 @@ func (s *FileStorage) loadData() (map[string]interface{}, error) {
 		return nil, fmt.Errorf("failed to read file: %w", err)
 	}
 	
+	if len(fileData) > 0 && s.codec != nil {
+		if fileData, err = s.codec.decode(fileData); err != nil {
+			return nil, err
+		}
+	}
+	
 	if len(fileData) > 0 {
 		if err := json.Unmarshal(fileData, &data); err != nil {
 			return nil, fmt.Errorf("failed to unmarshal data: %w", err)
@@ -244,16 +422,22 @@ func (s *FileStorage) loadData() (map[string]interface{}, error) {
 
 // Metrics tracking methods
 func (s *FileStorage) recordOperation(op string) {
+	s.metricsMu.Lock()
+	defer s.metricsMu.Unlock()
 	s.metrics.Operations[op]++
 	s.metrics.LastAccess = time.Now()
 }
 
 func (s *FileStorage) recordError(op string, err error) {
+	s.metricsMu.Lock()
+	defer s.metricsMu.Unlock()
 	s.metrics.Errors[op]++
 	s.metrics.LastError = err
 }
 
 func (s *FileStorage) recordLatency(op string, duration time.Duration) {
+	s.metricsMu.Lock()
+	defer s.metricsMu.Unlock()
 	s.metrics.Latencies[op] = duration
 }
 
@@ -481,4 +481,79 @@ func TestFileStorage_MalformedTokenData(t *testing.T) {
 	assert.NoError(t, err)
 	assert.NotNil(t, token2)
 	assert.Equal(t, "oauth", token2.Type)
-}
\ No newline at end of file
+}
+
+// Test atomic writes leave no temporary files behind
+func TestFileStorage_AtomicWrite(t *testing.T) {
+	tmpDir := t.TempDir()
+	path := filepath.Join(tmpDir, "tokens.json")
+	storage := NewFileStorage(path)
+	
+	for i := 0; i < 3; i++ {
+		require.NoError(t, storage.Set(fmt.Sprintf("provider-%d", i), &TokenInfo{Type: "oauth", AccessToken: "token"}))
+	}
+	require.NoError(t, storage.Remove("provider-0"))
+	
+	entries, err := os.ReadDir(tmpDir)
+	require.NoError(t, err)
+	names := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	assert.ElementsMatch(t, []string{"tokens.json", "tokens.json.lock"}, names)
+	
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+}
+
+// Test storages sharing a file do not lose each other's updates
+func TestFileStorage_SharedFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tokens.json")
+	
+	t.Run("concurrent writers", func(t *testing.T) {
+		storages := []*FileStorage{NewFileStorage(path), NewFileStorage(path)}
+		done := make(chan bool)
+		for i, storage := range storages {
+			go func(i int, storage *FileStorage) {
+				for j := 0; j < 10; j++ {
+					assert.NoError(t, storage.Set(fmt.Sprintf("provider-%d-%d", i, j), &TokenInfo{Type: "oauth"}))
+				}
+				done <- true
+			}(i, storage)
+		}
+		<-done
+		<-done
+		
+		providers, err := NewFileStorage(path).List()
+		require.NoError(t, err)
+		assert.Len(t, providers, 20)
+	})
+	
+	t.Run("WithLock excludes other storages", func(t *testing.T) {
+		storage, other := NewFileStorage(path), NewFileStorage(path)
+		written := make(chan bool)
+		
+		err := storage.WithLock(func(locked StorageBackend) error {
+			go func() {
+				assert.NoError(t, other.Set("other", &TokenInfo{Type: "oauth", AccessToken: "other"}))
+				written <- true
+			}()
+			select {
+			case <-written:
+				t.Error("another storage wrote while the lock was held")
+			case <-time.After(50 * time.Millisecond):
+			}
+			return locked.Set("locked", &TokenInfo{Type: "oauth", AccessToken: "locked"})
+		})
+		require.NoError(t, err)
+		<-written
+		
+		for _, provider := range []string{"locked", "other"} {
+			token, err := storage.Get(provider)
+			require.NoError(t, err)
+			require.NotNil(t, token)
+			assert.Equal(t, provider, token.AccessToken)
+		}
+	})
+}
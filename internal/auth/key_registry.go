@@ -0,0 +1,412 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Proxy key errors
+var (
+	ErrProxyKeyNotFound = errors.New("proxy key not found")
+	ErrProxyKeyRevoked  = errors.New("proxy key has been revoked")
+	ErrProxyKeyExpired  = errors.New("proxy key has expired")
+	ErrProxyKeyExists   = errors.New("an active proxy key with this name already exists")
+)
+
+// proxyKeyPrefix marks secrets issued by the key registry
+const proxyKeyPrefix = "cgk_"
+
+// ProxyKey is a virtual API key issued to a single proxy client.
+// Only a hash of the secret is persisted; the secret itself is shown once on creation.
+type ProxyKey struct {
+	ID                string   `json:"id"`
+	Name              string   `json:"name"`
+	Hash              string   `json:"hash"`
+	Prefix            string   `json:"prefix"`
+	AllowedModels     []string `json:"allowed_models,omitempty"`
+	AllowedEndpoints  []string `json:"allowed_endpoints,omitempty"`
+	ExpiresAt         int64    `json:"expires_at,omitempty"`
+	DailyTokenQuota   int64    `json:"daily_token_quota,omitempty"`
+	DailyRequestQuota int64    `json:"daily_request_quota,omitempty"`
+	CreatedAt         int64    `json:"created_at"`
+	RevokedAt         int64    `json:"revoked_at,omitempty"`
+}
+
+// ProxyKeyOptions controls the scopes and quotas of a new proxy key
+type ProxyKeyOptions struct {
+	AllowedModels     []string
+	AllowedEndpoints  []string
+	ExpiresAt         int64
+	DailyTokenQuota   int64
+	DailyRequestQuota int64
+}
+
+// IsExpired checks if the key is past its expiry date
+func (k *ProxyKey) IsExpired() bool {
+	return k.ExpiresAt != 0 && time.Now().Unix() >= k.ExpiresAt
+}
+
+// IsRevoked checks if the key has been revoked
+func (k *ProxyKey) IsRevoked() bool {
+	return k.RevokedAt != 0
+}
+
+// AllowsModel checks if the key may use a model. Patterns ending in "*" match by prefix.
+func (k *ProxyKey) AllowsModel(model string) bool {
+	return matchesScope(k.AllowedModels, model)
+}
+
+// AllowsEndpoint checks if the key may call an endpoint. Patterns ending in "*" match by prefix.
+func (k *ProxyKey) AllowsEndpoint(path string) bool {
+	return matchesScope(k.AllowedEndpoints, path)
+}
+
+// matchesScope checks a value against an allow list; an empty list allows everything
+func matchesScope(patterns []string, value string) bool {
+	if len(patterns) == 0 {
+		return true
+	}
+	for _, pattern := range patterns {
+		if pattern == "*" || pattern == value {
+			return true
+		}
+		if strings.HasSuffix(pattern, "*") && strings.HasPrefix(value, strings.TrimSuffix(pattern, "*")) {
+			return true
+		}
+	}
+	return false
+}
+
+// KeyRegistry persists proxy keys as JSON next to the token storage.
+// The file is re-read when it changes on disk, so keys revoked by the CLI
+// take effect in a running proxy without a restart.
+type KeyRegistry struct {
+	path    string
+	mu      sync.Mutex
+	keys    []*ProxyKey
+	modTime time.Time
+	size    int64
+}
+
+// NewKeyRegistry creates a key registry backed by the given file
+func NewKeyRegistry(path string) *KeyRegistry {
+	return &KeyRegistry{path: path}
+}
+
+// Path returns the registry file location
+func (r *KeyRegistry) Path() string {
+	return r.path
+}
+
+// Create issues a new key and returns its secret
+func (r *KeyRegistry) Create(name string, opts ProxyKeyOptions) (string, *ProxyKey, error) {
+	if name == "" {
+		return "", nil, fmt.Errorf("key name is required")
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	lock, err := r.lock()
+	if err != nil {
+		return "", nil, err
+	}
+	defer lock.unlock()
+
+	keys, err := r.load()
+	if err != nil {
+		return "", nil, err
+	}
+
+	for _, existing := range keys {
+		if existing.Name == name && !existing.IsRevoked() {
+			return "", nil, ErrProxyKeyExists
+		}
+	}
+
+	id, err := randomString(8)
+	if err != nil {
+		return "", nil, err
+	}
+	secret, err := generateKeySecret()
+	if err != nil {
+		return "", nil, err
+	}
+
+	key := &ProxyKey{
+		ID:                "key_" + id,
+		Name:              name,
+		Hash:              hashKeySecret(secret),
+		Prefix:            secret[:len(proxyKeyPrefix)+6],
+		AllowedModels:     opts.AllowedModels,
+		AllowedEndpoints:  opts.AllowedEndpoints,
+		ExpiresAt:         opts.ExpiresAt,
+		DailyTokenQuota:   opts.DailyTokenQuota,
+		DailyRequestQuota: opts.DailyRequestQuota,
+		CreatedAt:         time.Now().Unix(),
+	}
+
+	if err := r.save(append(keys, key)); err != nil {
+		return "", nil, err
+	}
+
+	return secret, key, nil
+}
+
+// List returns all keys, including revoked ones, ordered by creation time
+func (r *KeyRegistry) List() ([]*ProxyKey, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	keys, err := r.load()
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]*ProxyKey, len(keys))
+	copy(result, keys)
+	sort.SliceStable(result, func(i, j int) bool {
+		return result[i].CreatedAt < result[j].CreatedAt
+	})
+	return result, nil
+}
+
+// Get finds an active key by ID or name
+func (r *KeyRegistry) Get(nameOrID string) (*ProxyKey, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	keys, err := r.load()
+	if err != nil {
+		return nil, err
+	}
+
+	key := findKey(keys, nameOrID)
+	if key == nil {
+		return nil, ErrProxyKeyNotFound
+	}
+	copied := *key
+	return &copied, nil
+}
+
+// Revoke marks a key as revoked; revoked keys stay in the registry for auditing
+func (r *KeyRegistry) Revoke(nameOrID string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	lock, err := r.lock()
+	if err != nil {
+		return err
+	}
+	defer lock.unlock()
+
+	keys, err := r.load()
+	if err != nil {
+		return err
+	}
+
+	key := findKey(keys, nameOrID)
+	if key == nil {
+		return ErrProxyKeyNotFound
+	}
+	key.RevokedAt = time.Now().Unix()
+
+	return r.save(keys)
+}
+
+// Rotate replaces the secret of a key while keeping its ID, scopes and quotas
+func (r *KeyRegistry) Rotate(nameOrID string) (string, *ProxyKey, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	lock, err := r.lock()
+	if err != nil {
+		return "", nil, err
+	}
+	defer lock.unlock()
+
+	keys, err := r.load()
+	if err != nil {
+		return "", nil, err
+	}
+
+	key := findKey(keys, nameOrID)
+	if key == nil {
+		return "", nil, ErrProxyKeyNotFound
+	}
+
+	secret, err := generateKeySecret()
+	if err != nil {
+		return "", nil, err
+	}
+	key.Hash = hashKeySecret(secret)
+	key.Prefix = secret[:len(proxyKeyPrefix)+6]
+
+	if err := r.save(keys); err != nil {
+		return "", nil, err
+	}
+	return secret, key, nil
+}
+
+// Lookup resolves a presented secret to its key
+func (r *KeyRegistry) Lookup(secret string) (*ProxyKey, error) {
+	if !strings.HasPrefix(secret, proxyKeyPrefix) {
+		return nil, ErrProxyKeyNotFound
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	keys, err := r.load()
+	if err != nil {
+		return nil, err
+	}
+
+	// Secrets are high-entropy, so comparing their digests leaks nothing useful
+	hash := hashKeySecret(secret)
+	for _, key := range keys {
+		if key.Hash != hash {
+			continue
+		}
+		if key.IsRevoked() {
+			return nil, ErrProxyKeyRevoked
+		}
+		if key.IsExpired() {
+			return nil, ErrProxyKeyExpired
+		}
+		copied := *key
+		return &copied, nil
+	}
+	return nil, ErrProxyKeyNotFound
+}
+
+// Count returns the number of keys ever issued, including revoked ones
+func (r *KeyRegistry) Count() (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	keys, err := r.load()
+	if err != nil {
+		return 0, err
+	}
+	return len(keys), nil
+}
+
+// load returns the cached keys, re-reading the file if it changed on disk
+func (r *KeyRegistry) load() ([]*ProxyKey, error) {
+	info, err := os.Stat(r.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			r.keys = nil
+			r.modTime = time.Time{}
+			r.size = 0
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to stat key registry: %w", err)
+	}
+
+	if r.keys != nil && info.ModTime().Equal(r.modTime) && info.Size() == r.size {
+		return r.keys, nil
+	}
+
+	data, err := os.ReadFile(r.path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read key registry: %w", err)
+	}
+
+	var file struct {
+		Keys []*ProxyKey `json:"keys"`
+	}
+	if len(data) > 0 {
+		if err := json.Unmarshal(data, &file); err != nil {
+			return nil, fmt.Errorf("failed to parse key registry: %w", err)
+		}
+	}
+
+	r.keys = file.Keys
+	if r.keys == nil {
+		r.keys = []*ProxyKey{}
+	}
+	r.modTime = info.ModTime()
+	r.size = info.Size()
+	return r.keys, nil
+}
+
+// lock takes the lock file of the registry before its keys are modified, so that the CLI
+// and running proxies do not overwrite each other's changes. The cache is dropped, as the
+// file may have been replaced within the resolution of its modification time.
+func (r *KeyRegistry) lock() (*fileLock, error) {
+	if err := os.MkdirAll(filepath.Dir(r.path), 0700); err != nil {
+		return nil, fmt.Errorf("failed to create directory: %w", err)
+	}
+	lock, err := lockFile(r.path+".lock", true)
+	if err != nil {
+		return nil, fmt.Errorf("failed to lock key registry: %w", err)
+	}
+	r.keys = nil
+	return lock, nil
+}
+
+// save replaces the file with the keys and refreshes the cache. The caller holds the lock.
+func (r *KeyRegistry) save(keys []*ProxyKey) error {
+	data, err := json.MarshalIndent(map[string]interface{}{"keys": keys}, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal key registry: %w", err)
+	}
+
+	if err := writeFileAtomic(r.path, data); err != nil {
+		return fmt.Errorf("failed to write key registry: %w", err)
+	}
+
+	// Force a reload on next access so the cache tracks the new file metadata
+	r.keys = nil
+	return nil
+}
+
+// findKey finds a non-revoked key by ID or name
+func findKey(keys []*ProxyKey, nameOrID string) *ProxyKey {
+	for _, key := range keys {
+		if key.IsRevoked() {
+			continue
+		}
+		if key.ID == nameOrID || key.Name == nameOrID {
+			return key
+		}
+	}
+	return nil
+}
+
+// generateKeySecret creates a new random key secret
+func generateKeySecret() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate key secret: %w", err)
+	}
+	return proxyKeyPrefix + base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// hashKeySecret returns the hex SHA-256 digest stored for a secret
+func hashKeySecret(secret string) string {
+	h := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(h[:])
+}
+
+// randomString returns n random bytes as lowercase hex
+func randomString(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate random bytes: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,184 @@
+package auth
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestKeyRegistry_CreateAndLookup(t *testing.T) {
+	registry := NewKeyRegistry(filepath.Join(t.TempDir(), "keys.json"))
+
+	secret, key, err := registry.Create("laptop", ProxyKeyOptions{
+		AllowedModels:   []string{"claude-3-5-haiku*"},
+		DailyTokenQuota: 1000,
+	})
+	require.NoError(t, err)
+
+	assert.True(t, strings.HasPrefix(secret, proxyKeyPrefix))
+	assert.True(t, strings.HasPrefix(secret, key.Prefix))
+	assert.Equal(t, "laptop", key.Name)
+	assert.NotEqual(t, secret, key.Hash)
+
+	found, err := registry.Lookup(secret)
+	require.NoError(t, err)
+	assert.Equal(t, key.ID, found.ID)
+	assert.Equal(t, int64(1000), found.DailyTokenQuota)
+
+	_, err = registry.Lookup(proxyKeyPrefix + "unknown")
+	assert.ErrorIs(t, err, ErrProxyKeyNotFound)
+
+	_, err = registry.Lookup("not-a-proxy-key")
+	assert.ErrorIs(t, err, ErrProxyKeyNotFound)
+}
+
+func TestKeyRegistry_SecretIsNotPersisted(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keys.json")
+	registry := NewKeyRegistry(path)
+
+	secret, _, err := registry.Create("ci", ProxyKeyOptions{})
+	require.NoError(t, err)
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.NotContains(t, string(data), secret)
+
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+}
+
+func TestKeyRegistry_DuplicateName(t *testing.T) {
+	registry := NewKeyRegistry(filepath.Join(t.TempDir(), "keys.json"))
+
+	_, _, err := registry.Create("laptop", ProxyKeyOptions{})
+	require.NoError(t, err)
+
+	_, _, err = registry.Create("laptop", ProxyKeyOptions{})
+	assert.ErrorIs(t, err, ErrProxyKeyExists)
+
+	// A revoked name can be reused
+	require.NoError(t, registry.Revoke("laptop"))
+	_, _, err = registry.Create("laptop", ProxyKeyOptions{})
+	assert.NoError(t, err)
+}
+
+func TestKeyRegistry_Revoke(t *testing.T) {
+	registry := NewKeyRegistry(filepath.Join(t.TempDir(), "keys.json"))
+
+	secret, key, err := registry.Create("laptop", ProxyKeyOptions{})
+	require.NoError(t, err)
+
+	require.NoError(t, registry.Revoke(key.ID))
+
+	_, err = registry.Lookup(secret)
+	assert.ErrorIs(t, err, ErrProxyKeyRevoked)
+
+	assert.ErrorIs(t, registry.Revoke(key.ID), ErrProxyKeyNotFound)
+
+	// Revoked keys are kept for auditing
+	keys, err := registry.List()
+	require.NoError(t, err)
+	require.Len(t, keys, 1)
+	assert.True(t, keys[0].IsRevoked())
+
+	count, err := registry.Count()
+	require.NoError(t, err)
+	assert.Equal(t, 1, count)
+}
+
+func TestKeyRegistry_Rotate(t *testing.T) {
+	registry := NewKeyRegistry(filepath.Join(t.TempDir(), "keys.json"))
+
+	oldSecret, key, err := registry.Create("laptop", ProxyKeyOptions{DailyRequestQuota: 5})
+	require.NoError(t, err)
+
+	newSecret, rotated, err := registry.Rotate("laptop")
+	require.NoError(t, err)
+	assert.NotEqual(t, oldSecret, newSecret)
+	assert.Equal(t, key.ID, rotated.ID)
+
+	_, err = registry.Lookup(oldSecret)
+	assert.ErrorIs(t, err, ErrProxyKeyNotFound)
+
+	found, err := registry.Lookup(newSecret)
+	require.NoError(t, err)
+	assert.Equal(t, int64(5), found.DailyRequestQuota)
+}
+
+func TestKeyRegistry_Expiry(t *testing.T) {
+	registry := NewKeyRegistry(filepath.Join(t.TempDir(), "keys.json"))
+
+	secret, _, err := registry.Create("temp", ProxyKeyOptions{
+		ExpiresAt: time.Now().Add(-time.Minute).Unix(),
+	})
+	require.NoError(t, err)
+
+	_, err = registry.Lookup(secret)
+	assert.ErrorIs(t, err, ErrProxyKeyExpired)
+}
+
+func TestKeyRegistry_SeesChangesFromOtherInstances(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keys.json")
+	proxyView := NewKeyRegistry(path)
+	cliView := NewKeyRegistry(path)
+
+	secret, _, err := cliView.Create("laptop", ProxyKeyOptions{})
+	require.NoError(t, err)
+
+	_, err = proxyView.Lookup(secret)
+	require.NoError(t, err)
+
+	require.NoError(t, cliView.Revoke("laptop"))
+	// Ensure the modification time changes even on coarse-grained filesystems
+	future := time.Now().Add(time.Second)
+	require.NoError(t, os.Chtimes(path, future, future))
+
+	_, err = proxyView.Lookup(secret)
+	assert.ErrorIs(t, err, ErrProxyKeyRevoked)
+}
+
+func TestKeyRegistry_ConcurrentInstancesKeepEachOthersKeys(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keys.json")
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			// Each instance stands for a separate CLI or proxy process
+			_, _, err := NewKeyRegistry(path).Create(fmt.Sprintf("key-%d", i), ProxyKeyOptions{})
+			assert.NoError(t, err)
+		}(i)
+	}
+	wg.Wait()
+
+	count, err := NewKeyRegistry(path).Count()
+	require.NoError(t, err)
+	assert.Equal(t, 10, count)
+}
+
+func TestProxyKey_Scopes(t *testing.T) {
+	key := &ProxyKey{
+		AllowedModels:    []string{"claude-3-5-haiku-20241022", "claude-sonnet-4*"},
+		AllowedEndpoints: []string{"/v1/messages"},
+	}
+
+	assert.True(t, key.AllowsModel("claude-3-5-haiku-20241022"))
+	assert.True(t, key.AllowsModel("claude-sonnet-4-20250514"))
+	assert.False(t, key.AllowsModel("claude-opus-4-20250514"))
+
+	assert.True(t, key.AllowsEndpoint("/v1/messages"))
+	assert.False(t, key.AllowsEndpoint("/v1/chat/completions"))
+
+	unrestricted := &ProxyKey{}
+	assert.True(t, unrestricted.AllowsModel("anything"))
+	assert.True(t, unrestricted.AllowsEndpoint("/v1/anything"))
+}
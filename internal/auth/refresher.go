@@ -0,0 +1,240 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// RefreshReason tells what triggered a token refresh
+type RefreshReason string
+
+const (
+	RefreshScheduled RefreshReason = "scheduled" // Background refresh ahead of expiry
+	RefreshOnDemand  RefreshReason = "on_demand" // A request found the token about to expire
+	RefreshForced    RefreshReason = "forced"    // The upstream rejected the token
+)
+
+// RefreshEventType is the kind of a refresh event
+type RefreshEventType string
+
+const (
+	RefreshSucceeded   RefreshEventType = "refreshed"
+	RefreshFailed      RefreshEventType = "failed"
+	RefreshRescheduled RefreshEventType = "scheduled"
+)
+
+// RefreshStatus summarizes the token refreshes of a provider
+type RefreshStatus struct {
+	LastRefresh time.Time `json:"last_refresh"`
+	NextRefresh time.Time `json:"next_refresh"`
+	ExpiresAt   time.Time `json:"expires_at"`
+	LastFailure time.Time `json:"last_failure"`
+	LastError   string    `json:"last_error,omitempty"`
+	Failures    int       `json:"consecutive_failures"`
+	Refreshes   int64     `json:"refreshes"`
+}
+
+// RefreshEvent reports a refresh attempt or a newly scheduled refresh
+type RefreshEvent struct {
+	Type   RefreshEventType
+	Reason RefreshReason
+	Time   time.Time
+	Err    error
+	Status RefreshStatus // Status after the event
+}
+
+// Subscribe registers a listener for refresh events. Listeners are called synchronously
+// and must not block.
+func (p *OAuthTokenProvider) Subscribe(listener func(RefreshEvent)) {
+	p.cacheMutex.Lock()
+	defer p.cacheMutex.Unlock()
+	p.listeners = append(p.listeners, listener)
+}
+
+// RefreshStatus returns the current refresh status
+func (p *OAuthTokenProvider) RefreshStatus() RefreshStatus {
+	p.cacheMutex.RLock()
+	defer p.cacheMutex.RUnlock()
+	return p.status
+}
+
+// scheduleRefresh records when the next background refresh will run
+func (p *OAuthTokenProvider) scheduleRefresh(next time.Time, expiresAt time.Time) {
+	p.cacheMutex.Lock()
+	p.status.NextRefresh = next
+	if !expiresAt.IsZero() {
+		p.status.ExpiresAt = expiresAt
+	}
+	event := RefreshEvent{Type: RefreshRescheduled, Reason: RefreshScheduled, Time: time.Now(), Status: p.status}
+	listeners := p.listeners
+	p.cacheMutex.Unlock()
+	notify(listeners, event)
+}
+
+// renew refreshes the stored token ahead of expiry, unless another caller or client has
+// replaced it since the refresh was scheduled
+func (p *OAuthTokenProvider) renew(scheduled string) error {
+	token, err := p.currentToken()
+	if err != nil {
+		return err
+	}
+	if token.AccessToken != scheduled {
+		return nil
+	}
+	_, err = p.refresh(token, RefreshScheduled)
+	return err
+}
+
+// notify passes an event to every listener
+func notify(listeners []func(RefreshEvent), event RefreshEvent) {
+	for _, listener := range listeners {
+		listener(event)
+	}
+}
+
+// RefresherConfig configures background token refresh
+type RefresherConfig struct {
+	Before        time.Duration // Refresh this long before the token expires (default 30m)
+	Jitter        time.Duration // Random extra lead, so instances sharing a login do not refresh together (0 disables)
+	RetryDelay    time.Duration // Delay before retrying a failed refresh, doubled for each further failure (default 30s)
+	MaxRetryDelay time.Duration // Upper bound of the retry delay (default 5m)
+	StatusPath    string        // File the refresh status is written to for 'auth status' (empty disables)
+	Logger        *slog.Logger
+}
+
+// TokenRefresher renews OAuth tokens in the background well before they expire, so that
+// requests do not wait for the OAuth round trip and a failed refresh is retried while
+// the current token is still valid
+type TokenRefresher struct {
+	provider *OAuthTokenProvider
+	config   RefresherConfig
+}
+
+// NewTokenRefresher creates a background refresher for a token provider
+func NewTokenRefresher(provider *OAuthTokenProvider, config RefresherConfig) *TokenRefresher {
+	if config.Before <= 0 {
+		config.Before = 30 * time.Minute
+	}
+	if config.Jitter < 0 {
+		config.Jitter = 0
+	}
+	if config.RetryDelay <= 0 {
+		config.RetryDelay = 30 * time.Second
+	}
+	if config.MaxRetryDelay <= 0 {
+		config.MaxRetryDelay = 5 * time.Minute
+	}
+	if config.MaxRetryDelay < config.RetryDelay {
+		config.MaxRetryDelay = config.RetryDelay
+	}
+	if config.Logger == nil {
+		config.Logger = slog.Default()
+	}
+	return &TokenRefresher{provider: provider, config: config}
+}
+
+// Run refreshes tokens until the context is cancelled
+func (r *TokenRefresher) Run(ctx context.Context) {
+	if r.config.StatusPath != "" {
+		r.provider.Subscribe(func(event RefreshEvent) {
+			if err := SaveRefreshStatus(r.config.StatusPath, event.Status); err != nil {
+				r.config.Logger.Warn("failed to save token refresh status", "path", r.config.StatusPath, "error", err)
+			}
+		})
+	}
+
+	failures := 0
+	for {
+		delay := r.config.MaxRetryDelay
+		var expiresAt time.Time
+		token, err := r.provider.currentToken()
+		if err == nil {
+			expiresAt = time.Unix(token.ExpiresAt, 0)
+			delay = r.refreshDelay(token, time.Now())
+		}
+		if failures > 0 {
+			delay = r.retryDelay(failures)
+		}
+		r.provider.scheduleRefresh(time.Now().Add(delay), expiresAt)
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+		if err != nil {
+			// Not logged in, or the login was revoked; check again later
+			continue
+		}
+
+		if err := r.provider.renew(token.AccessToken); err != nil {
+			failures++
+			r.config.Logger.Warn("background token refresh failed", "failures", failures, "error", err)
+			continue
+		}
+		failures = 0
+	}
+}
+
+// refreshDelay returns how long to wait before renewing a token: Before plus a random
+// share of Jitter ahead of expiry, and at least half of the remaining lifetime so that
+// short-lived tokens are not refreshed in a loop
+func (r *TokenRefresher) refreshDelay(token *TokenInfo, now time.Time) time.Duration {
+	remaining := time.Unix(token.ExpiresAt, 0).Sub(now)
+	if remaining <= 0 {
+		return 0
+	}
+	lead := r.config.Before
+	if r.config.Jitter > 0 {
+		lead += time.Duration(rand.Int63n(int64(r.config.Jitter)))
+	}
+	if delay := remaining - lead; delay > remaining/2 {
+		return delay
+	}
+	return remaining / 2
+}
+
+// retryDelay returns the delay before retrying after the given number of failures
+func (r *TokenRefresher) retryDelay(failures int) time.Duration {
+	delay := r.config.RetryDelay
+	for i := 1; i < failures && delay < r.config.MaxRetryDelay; i++ {
+		delay *= 2
+	}
+	if delay > r.config.MaxRetryDelay {
+		delay = r.config.MaxRetryDelay
+	}
+	return delay
+}
+
+// SaveRefreshStatus writes a refresh status file
+func SaveRefreshStatus(path string, status RefreshStatus) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return fmt.Errorf("failed to create directory: %w", err)
+	}
+	data, err := json.MarshalIndent(status, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0600)
+}
+
+// LoadRefreshStatus reads the status file written by a running refresher
+func LoadRefreshStatus(path string) (*RefreshStatus, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var status RefreshStatus
+	if err := json.Unmarshal(data, &status); err != nil {
+		return nil, fmt.Errorf("failed to parse refresh status: %w", err)
+	}
+	return &status, nil
+}
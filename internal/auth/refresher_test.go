@@ -0,0 +1,163 @@
+package auth
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// expiringProvider stores a token that expires after the given duration
+func expiringProvider(t *testing.T, server *httptest.Server, expiresIn time.Duration) *OAuthTokenProvider {
+	t.Helper()
+	storage := NewFileStorage(t.TempDir() + "/auth.json")
+	require.NoError(t, storage.Set("anthropic", &TokenInfo{
+		Type:         "oauth",
+		AccessToken:  "old-token",
+		RefreshToken: "refresh-token",
+		ExpiresAt:    time.Now().Add(expiresIn).Unix(),
+	}))
+	provider := NewOAuthTokenProvider(storage)
+	provider.client.TokenURL = server.URL
+	return provider
+}
+
+func TestOAuthTokenProvider_SingleFlight(t *testing.T) {
+	var calls int32
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		<-release
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"access_token": "new-token", "refresh_token": "new-refresh", "expires_in": 3600}`))
+	}))
+	defer server.Close()
+	provider := expiringProvider(t, server, -time.Minute)
+
+	var wg sync.WaitGroup
+	tokens := make([]string, 20)
+	for i := range tokens {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			tokens[i], _ = provider.GetAccessToken()
+		}(i)
+	}
+	// Let every caller reach the refresh before it completes
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	assert.Equal(t, int32(1), atomic.LoadInt32(&calls))
+	for _, token := range tokens {
+		assert.Equal(t, "new-token", token)
+	}
+	assert.Equal(t, int64(1), provider.RefreshStatus().Refreshes)
+}
+
+func TestOAuthTokenProvider_RefreshFallback(t *testing.T) {
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	t.Run("a valid token is kept when the refresh fails", func(t *testing.T) {
+		atomic.StoreInt32(&calls, 0)
+		provider := expiringProvider(t, server, 2*time.Minute)
+		var events []RefreshEvent
+		provider.Subscribe(func(event RefreshEvent) { events = append(events, event) })
+
+		token, err := provider.GetAccessToken()
+		require.NoError(t, err)
+		assert.Equal(t, "old-token", token)
+
+		require.Len(t, events, 1)
+		assert.Equal(t, RefreshFailed, events[0].Type)
+		assert.Equal(t, RefreshOnDemand, events[0].Reason)
+		status := provider.RefreshStatus()
+		assert.Equal(t, 1, status.Failures)
+		assert.Contains(t, status.LastError, "503")
+
+		// Further requests do not retry the refresh right away
+		token, err = provider.GetAccessToken()
+		require.NoError(t, err)
+		assert.Equal(t, "old-token", token)
+		assert.Equal(t, int32(1), atomic.LoadInt32(&calls))
+	})
+
+	t.Run("an expired token fails", func(t *testing.T) {
+		provider := expiringProvider(t, server, -time.Minute)
+		_, err := provider.GetAccessToken()
+		assert.ErrorContains(t, err, "failed to refresh token")
+	})
+}
+
+func TestTokenRefresher_Run(t *testing.T) {
+	server, calls := refreshServer(t, false)
+	// A short-lived token is renewed halfway through its remaining lifetime
+	provider := expiringProvider(t, server, 2*time.Second)
+	statusPath := filepath.Join(t.TempDir(), "refresh-status.json")
+
+	refreshed := make(chan RefreshEvent, 1)
+	provider.Subscribe(func(event RefreshEvent) {
+		if event.Type == RefreshSucceeded {
+			refreshed <- event
+		}
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	done := make(chan struct{})
+	go func() {
+		NewTokenRefresher(provider, RefresherConfig{StatusPath: statusPath}).Run(ctx)
+		close(done)
+	}()
+
+	select {
+	case event := <-refreshed:
+		assert.Equal(t, RefreshScheduled, event.Reason)
+	case <-time.After(5 * time.Second):
+		t.Fatal("token was not refreshed in the background")
+	}
+	assert.Equal(t, int32(1), atomic.LoadInt32(calls))
+
+	token, err := provider.GetAccessToken()
+	require.NoError(t, err)
+	assert.Equal(t, "refreshed-1", token)
+
+	// The next refresh is scheduled ahead of the new expiry and written for 'auth status'
+	require.Eventually(t, func() bool {
+		status, err := LoadRefreshStatus(statusPath)
+		return err == nil && status.Refreshes == 1 && status.NextRefresh.After(time.Now().Add(20*time.Minute))
+	}, time.Second, 10*time.Millisecond)
+
+	cancel()
+	<-done
+}
+
+func TestTokenRefresher_Delays(t *testing.T) {
+	refresher := NewTokenRefresher(nil, RefresherConfig{Before: 30 * time.Minute, Jitter: 10 * time.Minute})
+	// Expiry times are stored in whole seconds
+	now := time.Unix(time.Now().Unix(), 0)
+
+	for i := 0; i < 20; i++ {
+		delay := refresher.refreshDelay(&TokenInfo{ExpiresAt: now.Add(8 * time.Hour).Unix()}, now)
+		assert.GreaterOrEqual(t, delay, 8*time.Hour-40*time.Minute)
+		assert.LessOrEqual(t, delay, 8*time.Hour-30*time.Minute)
+	}
+	assert.Equal(t, 10*time.Minute, refresher.refreshDelay(&TokenInfo{ExpiresAt: now.Add(20 * time.Minute).Unix()}, now))
+	assert.Zero(t, refresher.refreshDelay(&TokenInfo{ExpiresAt: now.Add(-time.Minute).Unix()}, now))
+
+	assert.Equal(t, 30*time.Second, refresher.retryDelay(1))
+	assert.Equal(t, time.Minute, refresher.retryDelay(2))
+	assert.Equal(t, 5*time.Minute, refresher.retryDelay(10))
+}
@@ -44,6 +44,14 @@ type StorageBackend interface {
 	Name() string
 }
 
+// LockingStorage is implemented by backends that several processes can share. WithLock runs
+// fn while no other process can access the storage, passing a backend that fn uses instead
+// of the locked one.
+type LockingStorage interface {
+	StorageBackend
+	WithLock(fn func(storage StorageBackend) error) error
+}
+
 // StorageMetrics tracks storage operation metrics
 type StorageMetrics struct {
 	Operations map[string]int64
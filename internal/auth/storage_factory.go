@@ -5,6 +5,7 @@ import (
 	"os"
 	"runtime"
 	"strings"
+	"time"
 
 	"github.com/99designs/keyring"
 )
@@ -13,18 +14,25 @@ import (
 type StorageType string
 
 const (
-	StorageTypeAuto       StorageType = "auto"        // Automatically select best available
-	StorageTypeKeyring    StorageType = "keyring"     // Force keyring storage
-	StorageTypeFile       StorageType = "file"        // Force file storage
-	StorageTypeClaudeCode StorageType = "claude-code" // Read from Claude Code's keychain
+	StorageTypeAuto          StorageType = "auto"           // Automatically select best available
+	StorageTypeKeyring       StorageType = "keyring"        // Force keyring storage
+	StorageTypeFile          StorageType = "file"           // Force file storage
+	StorageTypeClaudeCode    StorageType = "claude-code"    // Share Claude Code's login (keychain, or credentials file on Linux)
+	StorageTypeEncryptedFile StorageType = "encrypted-file" // Passphrase-encrypted file storage
+	StorageTypeExec          StorageType = "exec"           // External credential helper
+	StorageTypeEnv           StorageType = "env"            // Read-only token from environment variables
 )
 
 // StorageFactory creates storage backends based on configuration
 type StorageFactory struct {
-	storageType    StorageType
-	filePath       string
-	keyringConfig  KeyringConfig
-	passwordPrompt keyring.PromptFunc
+	storageType       StorageType
+	filePath          string
+	encryptedFilePath string
+	passphrase        PassphraseConfig
+	execConfig        ExecStorageConfig
+	claudeCodePath    string
+	keyringConfig     KeyringConfig
+	passwordPrompt    keyring.PromptFunc
 }
 
 // StorageFactoryConfig holds configuration for the storage factory
@@ -34,6 +42,17 @@ type StorageFactoryConfig struct {
 	ServiceName    string
 	PasswordPrompt keyring.PromptFunc
 	
+	// Encrypted file settings
+	EncryptedFilePath string           // Defaults to ~/.claude-gate/auth.enc
+	Passphrase        PassphraseConfig // Also selects encrypted file storage in auto mode when no keyring is available
+	
+	// Credential helper settings
+	HelperCommand string
+	HelperTimeout time.Duration
+	
+	// Claude Code settings
+	ClaudeCodeCredentialsPath string // Defaults to ~/.claude/.credentials.json, or under CLAUDE_CONFIG_DIR
+	
 	// macOS-specific settings
 	KeychainTrustApp               bool
 	KeychainAccessibleWhenUnlocked bool
@@ -56,6 +75,15 @@ func NewStorageFactory(config StorageFactoryConfig) *StorageFactory {
 		config.FilePath = homeDir + "/.claude-gate/auth.json"
 	}
 	
+	if config.EncryptedFilePath == "" {
+		homeDir, _ := os.UserHomeDir()
+		config.EncryptedFilePath = homeDir + "/.claude-gate/auth.enc"
+	}
+	
+	if config.ClaudeCodeCredentialsPath == "" {
+		config.ClaudeCodeCredentialsPath = DefaultClaudeCodeCredentialsPath()
+	}
+	
 	// Default password prompt if not provided
 	if config.PasswordPrompt == nil {
 		config.PasswordPrompt = defaultPasswordPrompt
@@ -85,8 +113,16 @@ func NewStorageFactory(config StorageFactoryConfig) *StorageFactory {
 	}
 	
 	return &StorageFactory{
-		storageType:    config.Type,
-		filePath:       config.FilePath,
+		storageType:       config.Type,
+		filePath:          config.FilePath,
+		encryptedFilePath: config.EncryptedFilePath,
+		passphrase:        config.Passphrase,
+		execConfig: ExecStorageConfig{
+			Command:     config.HelperCommand,
+			ServiceName: config.ServiceName,
+			Timeout:     config.HelperTimeout,
+		},
+		claudeCodePath: config.ClaudeCodeCredentialsPath,
 		keyringConfig:  keyringCfg,
 		passwordPrompt: config.PasswordPrompt,
 	}
@@ -98,6 +134,19 @@ func (f *StorageFactory) Create() (StorageBackend, error) {
 	case StorageTypeFile:
 		return NewFileStorage(f.filePath), nil
 		
+	case StorageTypeEncryptedFile:
+		return f.createEncryptedFile()
+		
+	case StorageTypeEnv:
+		return NewEnvStorage(), nil
+		
+	case StorageTypeExec:
+		es, err := NewExecStorage(f.execConfig)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create credential helper storage: %w", err)
+		}
+		return es, nil
+		
 	case StorageTypeKeyring:
 		ks, err := NewKeyringStorage(f.keyringConfig)
 		if err != nil {
@@ -106,6 +155,12 @@ func (f *StorageFactory) Create() (StorageBackend, error) {
 		return ks, nil
 		
 	case StorageTypeClaudeCode:
+		// Claude Code keeps its login in a credentials file where it has no keychain
+		if runtime.GOOS != "darwin" {
+			if _, err := os.Stat(f.claudeCodePath); err == nil {
+				return NewClaudeCodeFileStorage(f.claudeCodePath), nil
+			}
+		}
 		ccs, err := NewClaudeCodeStorage()
 		if err != nil {
 			// On macOS, if keyring fails, try the direct macOS implementation
@@ -126,6 +181,10 @@ func (f *StorageFactory) Create() (StorageBackend, error) {
 			// Log warning and fall back
 			fmt.Fprintf(os.Stderr, "Warning: Keyring storage unavailable, falling back to file storage: %v\n", err)
 		}
+		// Without a keyring, tokens are encrypted when a passphrase is configured
+		if f.passphrase.IsSet() {
+			return f.createEncryptedFile()
+		}
 		return NewFileStorage(f.filePath), nil
 		
 	default:
@@ -141,7 +200,15 @@ func (f *StorageFactory) CreateWithMigration() (StorageBackend, error) {
 		return nil, err
 	}
 	
-	// Check if we need to migrate from file storage
+	// Check if we need to migrate from file storage, unless it is the file in use.
+	// Environment storage only keeps tokens in memory, and Claude Code's login must not be
+	// replaced by ours, so the file is left alone.
+	if fileStorage, ok := storage.(fileBackedStorage); ok && fileStorage.storagePath() == f.filePath {
+		return storage, nil
+	}
+	if f.storageType == StorageTypeEnv || f.storageType == StorageTypeClaudeCode {
+		return storage, nil
+	}
 	if f.storageType != StorageTypeFile {
 		fileStorage := NewFileStorage(f.filePath)
 		
@@ -161,6 +228,19 @@ func (f *StorageFactory) CreateWithMigration() (StorageBackend, error) {
 	return storage, nil
 }
 
+// createEncryptedFile creates encrypted file storage with the configured passphrase
+func (f *StorageFactory) createEncryptedFile() (StorageBackend, error) {
+	passphrase, err := f.passphrase.Resolve()
+	if err != nil {
+		return nil, err
+	}
+	es, err := NewEncryptedFileStorage(f.encryptedFilePath, passphrase)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open encrypted file storage: %w", err)
+	}
+	return es, nil
+}
+
 // isKeyringAvailable checks if keyring functionality is available on this system
 func isKeyringAvailable() bool {
 	switch runtime.GOOS {
@@ -11,7 +11,8 @@ func TestStorageFactory_CreateClaudeCodeStorage(t *testing.T) {
 	// Test that storage factory can create Claude Code storage adapter
 	
 	factory := NewStorageFactory(StorageFactoryConfig{
-		Type: StorageTypeClaudeCode,
+		Type:                      StorageTypeClaudeCode,
+		ClaudeCodeCredentialsPath: t.TempDir() + "/.credentials.json", // No credentials file
 	})
 	
 	// Create storage
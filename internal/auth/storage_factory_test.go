@@ -6,6 +6,7 @@ import (
 	"path/filepath"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -60,6 +61,31 @@ func TestStorageFactory_Create(t *testing.T) {
 		assert.Equal(t, "claude-code-adapter", storage.Name())
 	})
 	
+	// Test credential helper storage creation
+	t.Run("exec storage", func(t *testing.T) {
+		factory := NewStorageFactory(StorageFactoryConfig{
+			Type:          StorageTypeExec,
+			HelperCommand: "/usr/local/bin/vault-helper --mount kv",
+			HelperTimeout: time.Second,
+		})
+		
+		storage, err := factory.Create()
+		require.NoError(t, err)
+		assert.IsType(t, &ExecStorage{}, storage)
+		assert.Equal(t, "exec:/usr/local/bin/vault-helper", storage.Name())
+		
+		_, err = NewStorageFactory(StorageFactoryConfig{Type: StorageTypeExec}).Create()
+		assert.ErrorIs(t, err, ErrKeyringUnavailable)
+	})
+	
+	// Test environment storage creation
+	t.Run("env storage", func(t *testing.T) {
+		storage, err := NewStorageFactory(StorageFactoryConfig{Type: StorageTypeEnv}).Create()
+		require.NoError(t, err)
+		assert.IsType(t, &EnvStorage{}, storage)
+		assert.Equal(t, "env", storage.Name())
+	})
+	
 	// Test unknown storage type
 	t.Run("unknown storage type", func(t *testing.T) {
 		factory := &StorageFactory{
@@ -106,6 +132,74 @@ func TestStorageFactory_CreateWithMigration(t *testing.T) {
 	assert.NoError(t, err)
 }
 
+func TestStorageFactory_EncryptedFile(t *testing.T) {
+	fastKeyDerivation(t)
+	tempDir := t.TempDir()
+	jsonPath := filepath.Join(tempDir, "auth.json")
+	encPath := filepath.Join(tempDir, "auth.enc")
+	require.NoError(t, NewFileStorage(jsonPath).Set("anthropic", &TokenInfo{Type: "oauth", RefreshToken: "test-refresh"}))
+	
+	config := StorageFactoryConfig{
+		Type:              StorageTypeEncryptedFile,
+		FilePath:          jsonPath,
+		EncryptedFilePath: encPath,
+		Passphrase:        PassphraseConfig{Passphrase: "secret"},
+	}
+	
+	// Plaintext tokens are migrated into the encrypted file
+	storage, err := NewStorageFactory(config).CreateWithMigration()
+	require.NoError(t, err)
+	assert.IsType(t, &EncryptedFileStorage{}, storage)
+	token, err := storage.Get("anthropic")
+	require.NoError(t, err)
+	require.NotNil(t, token)
+	assert.Equal(t, "test-refresh", token.RefreshToken)
+	_, err = os.Stat(jsonPath)
+	assert.True(t, os.IsNotExist(err))
+	
+	t.Run("wrong passphrase", func(t *testing.T) {
+		config := config
+		config.Passphrase = PassphraseConfig{Passphrase: "wrong"}
+		_, err := NewStorageFactory(config).Create()
+		assert.ErrorIs(t, err, ErrWrongPassphrase)
+	})
+	
+	t.Run("no passphrase", func(t *testing.T) {
+		config := config
+		config.Passphrase = PassphraseConfig{}
+		_, err := NewStorageFactory(config).Create()
+		assert.ErrorIs(t, err, ErrNoPassphrase)
+	})
+	
+	t.Run("auto without keyring", func(t *testing.T) {
+		if isKeyringAvailable() {
+			t.Skip("a keyring is available")
+		}
+		config := config
+		config.Type = StorageTypeAuto
+		storage, err := NewStorageFactory(config).Create()
+		require.NoError(t, err)
+		assert.IsType(t, &EncryptedFileStorage{}, storage)
+		
+		config.Passphrase = PassphraseConfig{}
+		storage, err = NewStorageFactory(config).Create()
+		require.NoError(t, err)
+		assert.IsType(t, &FileStorage{}, storage)
+	})
+}
+
+func TestStorageFactory_CreateWithMigration_Env(t *testing.T) {
+	// Tokens in the file stay there, as environment storage cannot keep them
+	jsonPath := filepath.Join(t.TempDir(), "auth.json")
+	require.NoError(t, NewFileStorage(jsonPath).Set("anthropic", &TokenInfo{Type: "oauth", RefreshToken: "test-refresh"}))
+	
+	storage, err := NewStorageFactory(StorageFactoryConfig{Type: StorageTypeEnv, FilePath: jsonPath}).CreateWithMigration()
+	require.NoError(t, err)
+	assert.IsType(t, &EnvStorage{}, storage)
+	_, err = os.Stat(jsonPath)
+	assert.NoError(t, err)
+}
+
 func TestStorageFactory_Defaults(t *testing.T) {
 	// Test with empty config
 	factory := NewStorageFactory(StorageFactoryConfig{})
@@ -113,6 +207,7 @@ func TestStorageFactory_Defaults(t *testing.T) {
 	assert.Equal(t, StorageTypeAuto, factory.storageType)
 	assert.Equal(t, "claude-gate", factory.keyringConfig.ServiceName)
 	assert.Contains(t, factory.filePath, ".claude-gate/auth.json")
+	assert.Contains(t, factory.encryptedFilePath, ".claude-gate/auth.enc")
 	assert.NotNil(t, factory.passwordPrompt)
 }
 
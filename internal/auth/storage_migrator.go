@@ -119,8 +119,8 @@ func (m *StorageMigrator) Rollback() error {
 
 // createBackup creates a backup of the source storage
 func (m *StorageMigrator) createBackup() error {
-	// Only backup file storage
-	fileStorage, ok := m.source.(*FileStorage)
+	// Only backup file storage; encrypted files are copied as they are
+	fileStorage, ok := m.source.(fileBackedStorage)
 	if !ok {
 		return nil // Can't backup non-file storage
 	}
@@ -134,10 +134,14 @@ func (m *StorageMigrator) createBackup() error {
 	
 	// Generate backup filename with timestamp
 	timestamp := time.Now().Format("20060102-150405")
-	backupPath := filepath.Join(backupDir, fmt.Sprintf("auth-%s.json", timestamp))
+	ext := filepath.Ext(fileStorage.storagePath())
+	if ext == "" {
+		ext = ".json"
+	}
+	backupPath := filepath.Join(backupDir, fmt.Sprintf("auth-%s%s", timestamp, ext))
 	
 	// Copy file
-	sourceData, err := os.ReadFile(fileStorage.path)
+	sourceData, err := os.ReadFile(fileStorage.storagePath())
 	if err != nil {
 		return fmt.Errorf("failed to read source file: %w", err)
 	}
@@ -153,13 +157,13 @@ func (m *StorageMigrator) createBackup() error {
 // markSourceMigrated marks the source as migrated
 func (m *StorageMigrator) markSourceMigrated() error {
 	// Only mark file storage
-	fileStorage, ok := m.source.(*FileStorage)
+	fileStorage, ok := m.source.(fileBackedStorage)
 	if !ok {
 		return nil
 	}
 	
 	// Rename file to indicate migration
-	migratedPath := fileStorage.path + ".migrated"
+	migratedPath := fileStorage.storagePath() + ".migrated"
 	
 	// Check if already exists
 	if _, err := os.Stat(migratedPath); err == nil {
@@ -167,7 +171,7 @@ func (m *StorageMigrator) markSourceMigrated() error {
 		os.Remove(migratedPath)
 	}
 	
-	return os.Rename(fileStorage.path, migratedPath)
+	return os.Rename(fileStorage.storagePath(), migratedPath)
 }
 
 // VerifyMigration verifies that all data was migrated correctly
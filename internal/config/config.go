@@ -4,6 +4,7 @@ import (
 	"os"
 	"path/filepath"
 	"strconv"
+	"strings"
 	"time"
 )
 
@@ -18,6 +19,7 @@ type Config struct {
 	
 	// Proxy authentication
 	ProxyAuthToken string
+	ProxyKeysPath  string // Registry of per-client virtual API keys
 	
 	// Request settings
 	RequestTimeout time.Duration
@@ -30,16 +32,47 @@ type Config struct {
 	// Rate limiting
 	EnableRateLimit     bool
 	RateLimitPerMinute  int
+	RateLimitInputTokensPerMinute  int // Input token budget per client (0 = unlimited)
+	RateLimitOutputTokensPerMinute int // Output token budget per client (0 = unlimited)
 	
-	// CORS settings
-	CORSAllowOrigins []string
+	// Upstream retries (before anything is sent to the client)
+	RetryMaxAttempts    int            // Attempts per upstream request, including the first (1 disables retries)
+	RetryInitialBackoff time.Duration  // Delay before the first retry, doubled for each further retry
+	RetryMaxBackoff     time.Duration  // Upper bound of a single delay
+	RetryMaxElapsed     time.Duration  // Time budget for all attempts of a request
+	RetryRouteAttempts  map[string]int // Attempts for specific client paths, overriding RetryMaxAttempts
+	
+	// Background OAuth token refresh
+	TokenRefreshBefore     time.Duration // Refresh this long before the token expires (0 disables background refresh)
+	TokenRefreshJitter     time.Duration // Random extra lead so instances sharing a login do not refresh together
+	TokenRefreshStatusPath string        // Refresh status written by the server for 'auth status'
+	
+	// OpenAI compatibility
+	OpenAIStrictParams  bool // Reject OpenAI parameters without an Anthropic equivalent instead of dropping them
+	OpenAIHideReasoning bool // Leave thinking out of OpenAI responses instead of returning it as reasoning_content
+	
+	// CORS settings (browsers are blocked unless their origin is allowed)
+	CORSAllowOrigins  []string
+	CORSAllowHeaders  []string      // Empty uses the proxy defaults
+	CORSExposeHeaders []string      // Empty uses the proxy defaults
+	CORSMaxAge        time.Duration // Preflight cache duration
 	
 	// Storage settings
 	AuthStoragePath   string
-	AuthStorageType   string  // "auto", "keyring", or "file"
+	AuthStorageType   string  // "auto", "keyring", "file", "encrypted-file", "exec" or "claude-code"
 	KeyringService    string  // Service name for keyring
 	AutoMigrateTokens bool    // Automatically migrate tokens to keyring
 	
+	// Encrypted file storage; in auto mode a configured passphrase selects it when no keyring is available
+	EncryptedStoragePath   string
+	StoragePassphrase      string // Passphrase itself (CLAUDE_GATE_STORAGE_PASSPHRASE)
+	StoragePasswordFile    string // File containing the passphrase
+	StoragePasswordCommand string // Shell command printing the passphrase
+	
+	// Credential helper storage ("exec"): an external command that keeps tokens in a secret manager
+	StorageHelper        string
+	StorageHelperTimeout time.Duration
+	
 	// macOS Keychain settings
 	KeychainTrustApp               bool // Trust the app by default (macOS only)
 	KeychainAccessibleWhenUnlocked bool // Items accessible when unlocked (macOS only)
@@ -60,9 +93,19 @@ func DefaultConfig() *Config {
 		LogRequests:         true,
 		EnableRateLimit:     false,
 		RateLimitPerMinute:  60,
-		CORSAllowOrigins:    []string{"*"},
+		CORSMaxAge:          time.Hour,
+		RetryMaxAttempts:    3,
+		RetryInitialBackoff: 500 * time.Millisecond,
+		RetryMaxBackoff:     10 * time.Second,
+		RetryMaxElapsed:     time.Minute,
+		TokenRefreshBefore:  30 * time.Minute,
+		TokenRefreshJitter:  10 * time.Minute,
+		TokenRefreshStatusPath: filepath.Join(homeDir, ".claude-gate", "refresh-status.json"),
+		ProxyKeysPath:       filepath.Join(homeDir, ".claude-gate", "keys.json"),
 		AuthStoragePath:     filepath.Join(homeDir, ".claude-gate", "auth.json"),
 		AuthStorageType:     "auto",
+		EncryptedStoragePath: filepath.Join(homeDir, ".claude-gate", "auth.enc"),
+		StorageHelperTimeout: 10 * time.Second,
 		KeyringService:      "claude-gate",
 		AutoMigrateTokens:   true,
 		KeychainTrustApp:               true,  // Trust by default on macOS
@@ -92,6 +135,9 @@ func (c *Config) LoadFromEnv() {
 	if token := os.Getenv("CLAUDE_GATE_PROXY_AUTH_TOKEN"); token != "" {
 		c.ProxyAuthToken = token
 	}
+	if path := os.Getenv("CLAUDE_GATE_PROXY_KEYS_PATH"); path != "" {
+		c.ProxyKeysPath = path
+	}
 	
 	// Request settings
 	if timeout := os.Getenv("CLAUDE_GATE_REQUEST_TIMEOUT"); timeout != "" {
@@ -122,6 +168,80 @@ func (c *Config) LoadFromEnv() {
 			c.RateLimitPerMinute = l
 		}
 	}
+	if limit := os.Getenv("CLAUDE_GATE_RATE_LIMIT_INPUT_TOKENS_PER_MINUTE"); limit != "" {
+		if l, err := strconv.Atoi(limit); err == nil {
+			c.RateLimitInputTokensPerMinute = l
+		}
+	}
+	if limit := os.Getenv("CLAUDE_GATE_RATE_LIMIT_OUTPUT_TOKENS_PER_MINUTE"); limit != "" {
+		if l, err := strconv.Atoi(limit); err == nil {
+			c.RateLimitOutputTokensPerMinute = l
+		}
+	}
+	
+	// Upstream retries
+	if attempts := os.Getenv("CLAUDE_GATE_RETRY_MAX_ATTEMPTS"); attempts != "" {
+		if a, err := strconv.Atoi(attempts); err == nil {
+			c.RetryMaxAttempts = a
+		}
+	}
+	if backoff := os.Getenv("CLAUDE_GATE_RETRY_INITIAL_BACKOFF"); backoff != "" {
+		if d, err := time.ParseDuration(backoff); err == nil && d > 0 {
+			c.RetryInitialBackoff = d
+		}
+	}
+	if backoff := os.Getenv("CLAUDE_GATE_RETRY_MAX_BACKOFF"); backoff != "" {
+		if d, err := time.ParseDuration(backoff); err == nil && d > 0 {
+			c.RetryMaxBackoff = d
+		}
+	}
+	if elapsed := os.Getenv("CLAUDE_GATE_RETRY_MAX_ELAPSED"); elapsed != "" {
+		if d, err := time.ParseDuration(elapsed); err == nil {
+			c.RetryMaxElapsed = d
+		}
+	}
+	if routes := os.Getenv("CLAUDE_GATE_RETRY_ROUTES"); routes != "" {
+		c.RetryRouteAttempts = parseRouteAttempts(routes)
+	}
+	
+	// Background OAuth token refresh
+	if before := os.Getenv("CLAUDE_GATE_TOKEN_REFRESH_BEFORE"); before != "" {
+		if d, err := time.ParseDuration(before); err == nil {
+			c.TokenRefreshBefore = d
+		}
+	}
+	if jitter := os.Getenv("CLAUDE_GATE_TOKEN_REFRESH_JITTER"); jitter != "" {
+		if d, err := time.ParseDuration(jitter); err == nil {
+			c.TokenRefreshJitter = d
+		}
+	}
+	if path := os.Getenv("CLAUDE_GATE_TOKEN_REFRESH_STATUS_PATH"); path != "" {
+		c.TokenRefreshStatusPath = path
+	}
+	
+	// OpenAI compatibility
+	if strict := os.Getenv("CLAUDE_GATE_OPENAI_STRICT_PARAMS"); strict != "" {
+		c.OpenAIStrictParams = strict == "true" || strict == "1"
+	}
+	if hide := os.Getenv("CLAUDE_GATE_OPENAI_HIDE_REASONING"); hide != "" {
+		c.OpenAIHideReasoning = hide == "true" || hide == "1"
+	}
+	
+	// CORS
+	if origins := os.Getenv("CLAUDE_GATE_CORS_ALLOW_ORIGINS"); origins != "" {
+		c.CORSAllowOrigins = splitList(origins)
+	}
+	if headers := os.Getenv("CLAUDE_GATE_CORS_ALLOW_HEADERS"); headers != "" {
+		c.CORSAllowHeaders = splitList(headers)
+	}
+	if headers := os.Getenv("CLAUDE_GATE_CORS_EXPOSE_HEADERS"); headers != "" {
+		c.CORSExposeHeaders = splitList(headers)
+	}
+	if maxAge := os.Getenv("CLAUDE_GATE_CORS_MAX_AGE"); maxAge != "" {
+		if d, err := time.ParseDuration(maxAge); err == nil {
+			c.CORSMaxAge = d
+		}
+	}
 	
 	// Storage settings
 	if path := os.Getenv("CLAUDE_GATE_AUTH_STORAGE_PATH"); path != "" {
@@ -136,6 +256,26 @@ func (c *Config) LoadFromEnv() {
 	if autoMigrate := os.Getenv("CLAUDE_GATE_AUTO_MIGRATE_TOKENS"); autoMigrate != "" {
 		c.AutoMigrateTokens = autoMigrate == "true" || autoMigrate == "1"
 	}
+	if path := os.Getenv("CLAUDE_GATE_ENCRYPTED_STORAGE_PATH"); path != "" {
+		c.EncryptedStoragePath = path
+	}
+	if passphrase := os.Getenv("CLAUDE_GATE_STORAGE_PASSPHRASE"); passphrase != "" {
+		c.StoragePassphrase = passphrase
+	}
+	if file := os.Getenv("CLAUDE_GATE_STORAGE_PASSWORD_FILE"); file != "" {
+		c.StoragePasswordFile = file
+	}
+	if command := os.Getenv("CLAUDE_GATE_STORAGE_PASSWORD_COMMAND"); command != "" {
+		c.StoragePasswordCommand = command
+	}
+	if helper := os.Getenv("CLAUDE_GATE_STORAGE_HELPER"); helper != "" {
+		c.StorageHelper = helper
+	}
+	if timeout := os.Getenv("CLAUDE_GATE_STORAGE_HELPER_TIMEOUT"); timeout != "" {
+		if d, err := time.ParseDuration(timeout); err == nil && d > 0 {
+			c.StorageHelperTimeout = d
+		}
+	}
 	
 	// macOS Keychain settings
 	if trustApp := os.Getenv("CLAUDE_GATE_KEYCHAIN_TRUST_APP"); trustApp != "" {
@@ -149,6 +289,33 @@ func (c *Config) LoadFromEnv() {
 	}
 }
 
+// splitList splits a comma separated environment value, dropping empty entries
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// parseRouteAttempts parses a comma separated list of path=attempts pairs, such as
+// "/v1/messages=5,/v1/chat/completions=1". Malformed pairs are skipped.
+func parseRouteAttempts(value string) map[string]int {
+	routes := make(map[string]int)
+	for _, item := range splitList(value) {
+		path, attempts, ok := strings.Cut(item, "=")
+		if !ok {
+			continue
+		}
+		if a, err := strconv.Atoi(strings.TrimSpace(attempts)); err == nil {
+			routes[strings.TrimSpace(path)] = a
+		}
+	}
+	return routes
+}
+
 // GetBindAddress returns the server bind address
 func (c *Config) GetBindAddress() string {
 	return c.Host + ":" + strconv.Itoa(c.Port)
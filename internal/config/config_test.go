@@ -164,6 +164,15 @@ func TestConfig_LoadFromEnv_AllVariables(t *testing.T) {
 				assert.Equal(t, "secret-token", cfg.ProxyAuthToken)
 			},
 		},
+		{
+			name: "proxy keys path",
+			envVars: map[string]string{
+				"CLAUDE_GATE_PROXY_KEYS_PATH": "/custom/keys.json",
+			},
+			validate: func(t *testing.T, cfg *Config) {
+				assert.Equal(t, "/custom/keys.json", cfg.ProxyKeysPath)
+			},
+		},
 		{
 			name: "request settings",
 			envVars: map[string]string{
@@ -189,12 +198,84 @@ func TestConfig_LoadFromEnv_AllVariables(t *testing.T) {
 		{
 			name: "rate limiting",
 			envVars: map[string]string{
-				"CLAUDE_GATE_ENABLE_RATE_LIMIT":     "true",
-				"CLAUDE_GATE_RATE_LIMIT_PER_MINUTE": "30",
+				"CLAUDE_GATE_ENABLE_RATE_LIMIT":                   "true",
+				"CLAUDE_GATE_RATE_LIMIT_PER_MINUTE":               "30",
+				"CLAUDE_GATE_RATE_LIMIT_INPUT_TOKENS_PER_MINUTE":  "40000",
+				"CLAUDE_GATE_RATE_LIMIT_OUTPUT_TOKENS_PER_MINUTE": "8000",
 			},
 			validate: func(t *testing.T, cfg *Config) {
 				assert.True(t, cfg.EnableRateLimit)
 				assert.Equal(t, 30, cfg.RateLimitPerMinute)
+				assert.Equal(t, 40000, cfg.RateLimitInputTokensPerMinute)
+				assert.Equal(t, 8000, cfg.RateLimitOutputTokensPerMinute)
+			},
+		},
+		{
+			name: "upstream retries",
+			envVars: map[string]string{
+				"CLAUDE_GATE_RETRY_MAX_ATTEMPTS":    "5",
+				"CLAUDE_GATE_RETRY_INITIAL_BACKOFF": "250ms",
+				"CLAUDE_GATE_RETRY_MAX_BACKOFF":     "4s",
+				"CLAUDE_GATE_RETRY_MAX_ELAPSED":     "30s",
+				"CLAUDE_GATE_RETRY_ROUTES":          "/v1/messages=2, /v1/chat/completions = 1, bad, /v1/models=x",
+			},
+			validate: func(t *testing.T, cfg *Config) {
+				assert.Equal(t, 5, cfg.RetryMaxAttempts)
+				assert.Equal(t, 250*time.Millisecond, cfg.RetryInitialBackoff)
+				assert.Equal(t, 4*time.Second, cfg.RetryMaxBackoff)
+				assert.Equal(t, 30*time.Second, cfg.RetryMaxElapsed)
+				assert.Equal(t, map[string]int{"/v1/messages": 2, "/v1/chat/completions": 1}, cfg.RetryRouteAttempts)
+			},
+		},
+		{
+			name: "non-positive retry backoff is ignored",
+			envVars: map[string]string{
+				"CLAUDE_GATE_RETRY_INITIAL_BACKOFF": "-1s",
+				"CLAUDE_GATE_RETRY_MAX_BACKOFF":     "0s",
+			},
+			validate: func(t *testing.T, cfg *Config) {
+				defaults := DefaultConfig()
+				assert.Equal(t, defaults.RetryInitialBackoff, cfg.RetryInitialBackoff)
+				assert.Equal(t, defaults.RetryMaxBackoff, cfg.RetryMaxBackoff)
+			},
+		},
+		{
+			name: "token refresh",
+			envVars: map[string]string{
+				"CLAUDE_GATE_TOKEN_REFRESH_BEFORE":      "1h",
+				"CLAUDE_GATE_TOKEN_REFRESH_JITTER":      "0s",
+				"CLAUDE_GATE_TOKEN_REFRESH_STATUS_PATH": "/tmp/refresh.json",
+			},
+			validate: func(t *testing.T, cfg *Config) {
+				assert.Equal(t, time.Hour, cfg.TokenRefreshBefore)
+				assert.Zero(t, cfg.TokenRefreshJitter)
+				assert.Equal(t, "/tmp/refresh.json", cfg.TokenRefreshStatusPath)
+			},
+		},
+		{
+			name: "openai strict params",
+			envVars: map[string]string{
+				"CLAUDE_GATE_OPENAI_STRICT_PARAMS":  "true",
+				"CLAUDE_GATE_OPENAI_HIDE_REASONING": "1",
+			},
+			validate: func(t *testing.T, cfg *Config) {
+				assert.True(t, cfg.OpenAIStrictParams)
+				assert.True(t, cfg.OpenAIHideReasoning)
+			},
+		},
+		{
+			name: "cors settings",
+			envVars: map[string]string{
+				"CLAUDE_GATE_CORS_ALLOW_ORIGINS":  "https://app.example.com, https://*.example.org,",
+				"CLAUDE_GATE_CORS_ALLOW_HEADERS":  "Content-Type,X-Api-Key",
+				"CLAUDE_GATE_CORS_EXPOSE_HEADERS": "Request-Id",
+				"CLAUDE_GATE_CORS_MAX_AGE":        "10m",
+			},
+			validate: func(t *testing.T, cfg *Config) {
+				assert.Equal(t, []string{"https://app.example.com", "https://*.example.org"}, cfg.CORSAllowOrigins)
+				assert.Equal(t, []string{"Content-Type", "X-Api-Key"}, cfg.CORSAllowHeaders)
+				assert.Equal(t, []string{"Request-Id"}, cfg.CORSExposeHeaders)
+				assert.Equal(t, 10*time.Minute, cfg.CORSMaxAge)
 			},
 		},
 		{
@@ -212,6 +293,32 @@ func TestConfig_LoadFromEnv_AllVariables(t *testing.T) {
 				assert.False(t, cfg.AutoMigrateTokens)
 			},
 		},
+		{
+			name: "encrypted storage settings",
+			envVars: map[string]string{
+				"CLAUDE_GATE_ENCRYPTED_STORAGE_PATH":   "/custom/auth.enc",
+				"CLAUDE_GATE_STORAGE_PASSPHRASE":       "secret",
+				"CLAUDE_GATE_STORAGE_PASSWORD_FILE":    "/run/secrets/claude-gate",
+				"CLAUDE_GATE_STORAGE_PASSWORD_COMMAND": "pass show claude-gate",
+			},
+			validate: func(t *testing.T, cfg *Config) {
+				assert.Equal(t, "/custom/auth.enc", cfg.EncryptedStoragePath)
+				assert.Equal(t, "secret", cfg.StoragePassphrase)
+				assert.Equal(t, "/run/secrets/claude-gate", cfg.StoragePasswordFile)
+				assert.Equal(t, "pass show claude-gate", cfg.StoragePasswordCommand)
+			},
+		},
+		{
+			name: "credential helper settings",
+			envVars: map[string]string{
+				"CLAUDE_GATE_STORAGE_HELPER":         "vault-credential-helper --mount kv",
+				"CLAUDE_GATE_STORAGE_HELPER_TIMEOUT": "30s",
+			},
+			validate: func(t *testing.T, cfg *Config) {
+				assert.Equal(t, "vault-credential-helper --mount kv", cfg.StorageHelper)
+				assert.Equal(t, 30*time.Second, cfg.StorageHelperTimeout)
+			},
+		},
 		{
 			name: "invalid values are ignored",
 			envVars: map[string]string{
@@ -291,7 +398,11 @@ func TestDefaultConfig(t *testing.T) {
 	assert.True(t, cfg.LogRequests)
 	assert.False(t, cfg.EnableRateLimit)
 	assert.Equal(t, 60, cfg.RateLimitPerMinute)
-	assert.Equal(t, []string{"*"}, cfg.CORSAllowOrigins)
+	assert.Empty(t, cfg.CORSAllowOrigins, "browsers must be blocked by default")
+	assert.Equal(t, time.Hour, cfg.CORSMaxAge)
+	assert.Equal(t, 3, cfg.RetryMaxAttempts)
+	assert.Equal(t, time.Minute, cfg.RetryMaxElapsed)
+	assert.Equal(t, 30*time.Minute, cfg.TokenRefreshBefore)
 	assert.Equal(t, "auto", cfg.AuthStorageType)
 	assert.Equal(t, "claude-gate", cfg.KeyringService)
 	assert.True(t, cfg.AutoMigrateTokens)
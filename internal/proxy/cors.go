@@ -0,0 +1,233 @@
+package proxy
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultCORSAllowHeaders are the request headers browser clients may send
+var DefaultCORSAllowHeaders = []string{
+	"Content-Type",
+	"Authorization",
+	"X-Api-Key",
+	"Api-Key",
+	"Anthropic-Version",
+	"Anthropic-Beta",
+	"Anthropic-Dangerous-Direct-Browser-Access",
+	"X-Requested-With",
+}
+
+// DefaultCORSExposeHeaders are the response headers browser clients may read
+var DefaultCORSExposeHeaders = []string{
+	"Request-Id",
+	"Retry-After",
+	"Anthropic-Ratelimit-Requests-Limit",
+	"Anthropic-Ratelimit-Requests-Remaining",
+	"Anthropic-Ratelimit-Requests-Reset",
+	"Anthropic-Ratelimit-Input-Tokens-Limit",
+	"Anthropic-Ratelimit-Input-Tokens-Remaining",
+	"Anthropic-Ratelimit-Input-Tokens-Reset",
+	"Anthropic-Ratelimit-Output-Tokens-Limit",
+	"Anthropic-Ratelimit-Output-Tokens-Remaining",
+	"Anthropic-Ratelimit-Output-Tokens-Reset",
+	"X-Claude-Gate-Attempts",
+}
+
+// corsAllowMethods are the methods allowed in cross-origin requests
+const corsAllowMethods = "GET, POST, PUT, DELETE, OPTIONS"
+
+// CORSConfig configures which browser origins may call the proxy.
+// The zero value blocks every cross-origin request.
+type CORSConfig struct {
+	// AllowOrigins lists allowed origins: exact ("https://app.example.com"),
+	// wildcard subdomains ("https://*.example.com"), any port ("http://localhost:*") or "*" for all
+	AllowOrigins  []string
+	AllowHeaders  []string      // Request headers allowed in preflight ("*" echoes the requested ones); defaults to DefaultCORSAllowHeaders
+	ExposeHeaders []string      // Response headers readable by browsers; defaults to DefaultCORSExposeHeaders
+	MaxAge        time.Duration // How long browsers may cache a preflight response; defaults to one hour
+}
+
+// CORS enforces a cross-origin policy for browser clients.
+// Credentials are never allowed: clients authenticate with headers, not cookies.
+type CORS struct {
+	allowAll      bool
+	origins       []originPattern
+	allowHeaders  string
+	echoHeaders   bool
+	exposeHeaders string
+	maxAge        string
+}
+
+// originPattern is a parsed entry of CORSConfig.AllowOrigins
+type originPattern struct {
+	scheme    string
+	host      string // without the leading "*." for wildcard subdomains
+	subdomain bool   // host matches subdomains only
+	port      string // "*" matches any port
+}
+
+// NewCORS creates a CORS policy. Invalid origin patterns are rejected.
+func NewCORS(config CORSConfig) (*CORS, error) {
+	c := &CORS{}
+
+	for _, origin := range config.AllowOrigins {
+		origin = strings.TrimSpace(origin)
+		if origin == "" {
+			continue
+		}
+		if origin == "*" {
+			c.allowAll = true
+			continue
+		}
+		pattern, err := parseOriginPattern(origin)
+		if err != nil {
+			return nil, err
+		}
+		c.origins = append(c.origins, pattern)
+	}
+
+	allowHeaders := config.AllowHeaders
+	if len(allowHeaders) == 0 {
+		allowHeaders = DefaultCORSAllowHeaders
+	}
+	for _, header := range allowHeaders {
+		if header == "*" {
+			c.echoHeaders = true
+		}
+	}
+	c.allowHeaders = strings.Join(allowHeaders, ", ")
+
+	exposeHeaders := config.ExposeHeaders
+	if len(exposeHeaders) == 0 {
+		exposeHeaders = DefaultCORSExposeHeaders
+	}
+	c.exposeHeaders = strings.Join(exposeHeaders, ", ")
+
+	maxAge := config.MaxAge
+	if maxAge <= 0 {
+		maxAge = time.Hour
+	}
+	c.maxAge = strconv.Itoa(int(maxAge.Seconds()))
+
+	return c, nil
+}
+
+// Enabled reports whether any origin is allowed
+func (c *CORS) Enabled() bool {
+	return c != nil && (c.allowAll || len(c.origins) > 0)
+}
+
+// AllowsOrigin reports whether an Origin header value is allowed
+func (c *CORS) AllowsOrigin(origin string) bool {
+	if c == nil || origin == "" {
+		return false
+	}
+	if c.allowAll {
+		return true
+	}
+
+	u, err := url.Parse(strings.ToLower(origin))
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		return false
+	}
+	for _, pattern := range c.origins {
+		if pattern.matches(u) {
+			return true
+		}
+	}
+	return false
+}
+
+// Middleware answers preflight requests and applies the policy to every response.
+// Requests without an Origin header do not come from a browser and pass through untouched.
+// Requests from other origins are rejected before they reach the upstream API.
+// A nil policy blocks every cross-origin request.
+func (c *CORS) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		origin := r.Header.Get("Origin")
+		if origin == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		w.Header().Add("Vary", "Origin")
+		preflight := r.Method == "OPTIONS" && r.Header.Get("Access-Control-Request-Method") != ""
+
+		if !c.AllowsOrigin(origin) {
+			writeAPIError(w, r.URL.Path, http.StatusForbidden, "permission_error",
+				fmt.Sprintf("origin %s is not allowed to call this proxy", origin))
+			return
+		}
+
+		if c.allowAll {
+			w.Header().Set("Access-Control-Allow-Origin", "*")
+		} else {
+			w.Header().Set("Access-Control-Allow-Origin", origin)
+		}
+
+		if preflight {
+			w.Header().Add("Vary", "Access-Control-Request-Method")
+			w.Header().Add("Vary", "Access-Control-Request-Headers")
+			w.Header().Set("Access-Control-Allow-Methods", corsAllowMethods)
+			allowHeaders := c.allowHeaders
+			if c.echoHeaders {
+				allowHeaders = r.Header.Get("Access-Control-Request-Headers")
+			}
+			if allowHeaders != "" {
+				w.Header().Set("Access-Control-Allow-Headers", allowHeaders)
+			}
+			w.Header().Set("Access-Control-Max-Age", c.maxAge)
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		w.Header().Set("Access-Control-Expose-Headers", c.exposeHeaders)
+		next.ServeHTTP(w, r)
+	})
+}
+
+// parseOriginPattern parses an allowed origin such as https://*.example.com or http://localhost:*
+func parseOriginPattern(origin string) (originPattern, error) {
+	scheme, rest, ok := strings.Cut(strings.ToLower(origin), "://")
+	if !ok || scheme == "" || rest == "" || strings.ContainsAny(rest, "/?#") {
+		return originPattern{}, fmt.Errorf("invalid CORS origin %q: expected scheme://host[:port]", origin)
+	}
+
+	pattern := originPattern{scheme: scheme, host: rest}
+	if i := strings.LastIndex(rest, ":"); i >= 0 && !strings.HasSuffix(rest, "]") {
+		pattern.host, pattern.port = rest[:i], rest[i+1:]
+		if pattern.port == "" {
+			return originPattern{}, fmt.Errorf("invalid CORS origin %q: empty port", origin)
+		}
+	}
+	if strings.HasPrefix(pattern.host, "*.") {
+		pattern.host = pattern.host[2:]
+		pattern.subdomain = true
+	}
+	if pattern.host == "" || strings.Contains(pattern.host, "*") {
+		return originPattern{}, fmt.Errorf("invalid CORS origin %q: wildcards are only allowed as the first label or the port", origin)
+	}
+	return pattern, nil
+}
+
+// matches reports whether a parsed, lower-cased origin matches the pattern
+func (p originPattern) matches(u *url.URL) bool {
+	if u.Scheme != p.scheme {
+		return false
+	}
+	if p.port != "*" && u.Port() != p.port {
+		return false
+	}
+	host := u.Hostname()
+	if strings.HasPrefix(p.host, "[") {
+		host = "[" + host + "]"
+	}
+	if p.subdomain {
+		return strings.HasSuffix(host, "."+p.host)
+	}
+	return host == p.host
+}
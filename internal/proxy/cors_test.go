@@ -0,0 +1,168 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCORS_AllowsOrigin(t *testing.T) {
+	cors, err := NewCORS(CORSConfig{AllowOrigins: []string{
+		"https://app.example.com",
+		"https://*.example.org",
+		"http://localhost:*",
+		"http://127.0.0.1:3000",
+	}})
+	require.NoError(t, err)
+
+	tests := []struct {
+		origin  string
+		allowed bool
+	}{
+		{"https://app.example.com", true},
+		{"https://APP.example.com", true},
+		{"http://app.example.com", false},
+		{"https://evil.example.com", false},
+		{"https://app.example.com.evil.net", false},
+		{"https://a.example.org", true},
+		{"https://a.b.example.org", true},
+		{"https://example.org", false},
+		{"https://badexample.org", false},
+		{"http://localhost:5173", true},
+		{"http://localhost", true},
+		{"http://127.0.0.1:3000", true},
+		{"http://127.0.0.1:4000", false},
+		{"null", false},
+		{"", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.origin, func(t *testing.T) {
+			assert.Equal(t, tt.allowed, cors.AllowsOrigin(tt.origin))
+		})
+	}
+}
+
+func TestNewCORS_InvalidOrigins(t *testing.T) {
+	for _, origin := range []string{"example.com", "https://", "https://ex*ample.com", "https://example.com/path", "https://*.*.example.com"} {
+		_, err := NewCORS(CORSConfig{AllowOrigins: []string{origin}})
+		assert.Error(t, err, origin)
+	}
+}
+
+func TestCORS_Middleware(t *testing.T) {
+	nextCalled := false
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		nextCalled = true
+		w.WriteHeader(http.StatusOK)
+	})
+
+	cors, err := NewCORS(CORSConfig{
+		AllowOrigins: []string{"https://app.example.com"},
+		MaxAge:       10 * time.Minute,
+	})
+	require.NoError(t, err)
+	handler := cors.Middleware(next)
+
+	t.Run("requests without origin pass through", func(t *testing.T) {
+		nextCalled = false
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest("POST", "/v1/messages", nil))
+
+		assert.True(t, nextCalled)
+		assert.Empty(t, w.Header().Get("Access-Control-Allow-Origin"))
+	})
+
+	t.Run("preflight from allowed origin", func(t *testing.T) {
+		nextCalled = false
+		req := httptest.NewRequest("OPTIONS", "/v1/messages", nil)
+		req.Header.Set("Origin", "https://app.example.com")
+		req.Header.Set("Access-Control-Request-Method", "POST")
+		req.Header.Set("Access-Control-Request-Headers", "x-api-key, anthropic-version")
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+
+		assert.False(t, nextCalled)
+		assert.Equal(t, http.StatusNoContent, w.Code)
+		assert.Equal(t, "https://app.example.com", w.Header().Get("Access-Control-Allow-Origin"))
+		assert.Contains(t, w.Header().Get("Access-Control-Allow-Headers"), "X-Api-Key")
+		assert.Contains(t, w.Header().Get("Access-Control-Allow-Headers"), "Anthropic-Version")
+		assert.Contains(t, w.Header().Get("Access-Control-Allow-Headers"), "Anthropic-Beta")
+		assert.Equal(t, "600", w.Header().Get("Access-Control-Max-Age"))
+		assert.Empty(t, w.Header().Get("Access-Control-Allow-Credentials"))
+		assert.Contains(t, w.Header().Values("Vary"), "Origin")
+	})
+
+	t.Run("request from allowed origin exposes headers", func(t *testing.T) {
+		nextCalled = false
+		req := httptest.NewRequest("POST", "/v1/messages", nil)
+		req.Header.Set("Origin", "https://app.example.com")
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+
+		assert.True(t, nextCalled)
+		assert.Equal(t, "https://app.example.com", w.Header().Get("Access-Control-Allow-Origin"))
+		assert.Contains(t, w.Header().Get("Access-Control-Expose-Headers"), "Retry-After")
+		assert.Contains(t, w.Header().Get("Access-Control-Expose-Headers"), "Anthropic-Ratelimit-Requests-Remaining")
+	})
+
+	t.Run("disallowed origin is rejected before the handler", func(t *testing.T) {
+		for _, method := range []string{"OPTIONS", "POST"} {
+			nextCalled = false
+			req := httptest.NewRequest(method, "/v1/chat/completions", nil)
+			req.Header.Set("Origin", "https://evil.example.com")
+			req.Header.Set("Access-Control-Request-Method", "POST")
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, req)
+
+			assert.False(t, nextCalled, method)
+			assert.Equal(t, http.StatusForbidden, w.Code, method)
+			assert.Empty(t, w.Header().Get("Access-Control-Allow-Origin"), method)
+			assert.Contains(t, w.Body.String(), "permission_denied", method)
+		}
+	})
+}
+
+func TestCORS_AllowAllAndEchoHeaders(t *testing.T) {
+	cors, err := NewCORS(CORSConfig{
+		AllowOrigins: []string{"*"},
+		AllowHeaders: []string{"*"},
+	})
+	require.NoError(t, err)
+
+	req := httptest.NewRequest("OPTIONS", "/v1/chat/completions", nil)
+	req.Header.Set("Origin", "https://anything.test")
+	req.Header.Set("Access-Control-Request-Method", "POST")
+	req.Header.Set("Access-Control-Request-Headers", "x-stainless-os, authorization")
+	w := httptest.NewRecorder()
+	cors.Middleware(http.NotFoundHandler()).ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	assert.Equal(t, "*", w.Header().Get("Access-Control-Allow-Origin"))
+	assert.Equal(t, "x-stainless-os, authorization", w.Header().Get("Access-Control-Allow-Headers"))
+	assert.Equal(t, "3600", w.Header().Get("Access-Control-Max-Age"))
+}
+
+func TestCreateMux_BlocksBrowsersByDefault(t *testing.T) {
+	mockStorage := new(mockStorage)
+	mockStorage.On("Get", "anthropic").Return(nil, nil)
+
+	mux := CreateMux(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}), NewHealthHandler(mockStorage))
+
+	req := httptest.NewRequest("POST", "/v1/messages", nil)
+	req.Header.Set("Origin", "https://some-website.test")
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	// Non-browser clients are unaffected
+	w = httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest("POST", "/v1/messages", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+}
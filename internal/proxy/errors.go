@@ -0,0 +1,100 @@
+package proxy
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// isOpenAIPath reports whether a route speaks the OpenAI wire format
+func isOpenAIPath(path string) bool {
+	switch path {
+	case "/v1/chat/completions", "/v1/completions", "/v1/models", "/v1/responses":
+		return true
+	}
+	return strings.HasPrefix(path, "/v1/responses/")
+}
+
+// openAIErrorType maps an Anthropic error type to its OpenAI equivalent
+func openAIErrorType(errorType string) string {
+	switch errorType {
+	case "permission_error":
+		return "permission_denied"
+	case "api_error", "overloaded_error":
+		return "server_error"
+	case "request_too_large":
+		return "invalid_request_error"
+	default:
+		return errorType
+	}
+}
+
+// errorTypeStatus returns the HTTP status the Messages API uses for an error type
+func errorTypeStatus(errorType string) int {
+	switch errorType {
+	case "invalid_request_error":
+		return http.StatusBadRequest
+	case "authentication_error":
+		return http.StatusUnauthorized
+	case "permission_error":
+		return http.StatusForbidden
+	case "not_found_error":
+		return http.StatusNotFound
+	case "request_too_large":
+		return http.StatusRequestEntityTooLarge
+	case "rate_limit_error":
+		return http.StatusTooManyRequests
+	case "api_error":
+		return http.StatusInternalServerError
+	case "timeout_error":
+		return http.StatusGatewayTimeout
+	case "overloaded_error":
+		return 529 // Anthropic's non-standard "overloaded" status
+	default:
+		return http.StatusBadGateway
+	}
+}
+
+// writeAPIError writes an error response in the format expected by clients of the given path.
+// OpenAI-compatible routes get an OpenAI error object, everything else gets Anthropic's format.
+func writeAPIError(w http.ResponseWriter, path string, statusCode int, errorType, message string) {
+	var errorResp map[string]interface{}
+	if isOpenAIPath(path) {
+		errorResp = map[string]interface{}{
+			"error": map[string]interface{}{
+				"message": message,
+				"type":    openAIErrorType(errorType),
+				"param":   nil,
+				"code":    nil,
+			},
+		}
+	} else {
+		errorResp = map[string]interface{}{
+			"type": "error",
+			"error": map[string]interface{}{
+				"type":    errorType,
+				"message": message,
+			},
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	json.NewEncoder(w).Encode(errorResp)
+}
+
+// invalidRequestError is a client error found while translating a request.
+// It is reported as a 400 invalid_request_error instead of an internal error.
+type invalidRequestError struct {
+	message string
+}
+
+func (e *invalidRequestError) Error() string {
+	return e.message
+}
+
+// newInvalidRequestError creates an invalidRequestError with a formatted message
+func newInvalidRequestError(format string, args ...interface{}) error {
+	return &invalidRequestError{message: fmt.Sprintf(format, args...)}
+}
@@ -0,0 +1,310 @@
+package proxy
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxChoices caps n on /v1/chat/completions, since every choice is a separate upstream call
+const maxChoices = 16
+
+// requestedChoices returns the number of choices an OpenAI request asks for with n.
+// It returns 0 for other routes and when n is not set.
+func requestedChoices(req *requestBody, path string) int {
+	if path != "/v1/chat/completions" {
+		return 0
+	}
+	// Decoded as a number so that 2.0 counts like 2; the value was validated with the other params
+	var n float64
+	req.decode("n", &n)
+	return int(n)
+}
+
+// choiceRequest is an upstream request repeated once for every requested choice
+type choiceRequest struct {
+	url          string
+	header       http.Header
+	body         []byte
+	choices      int
+	stream       bool
+	includeUsage bool
+	model        string
+	format       *responseFormat
+	identity     *ClientIdentity
+	clientName   string
+}
+
+// serveChoices answers an OpenAI request with n > 1. The Messages API returns a single
+// message per call, so the request is sent upstream once per choice in parallel and the
+// replies are merged into one response. A client disconnect cancels every upstream call.
+func (h *ProxyHandler) serveChoices(w http.ResponseWriter, r *http.Request, req choiceRequest) {
+	const path = "/v1/chat/completions"
+
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+
+	h.logger.Info("fanning out request for several choices", "choices", req.choices, "streaming", req.stream)
+
+	responses := make([]*http.Response, req.choices)
+	errs := make([]error, req.choices)
+	attempts := make([]int, req.choices)
+	var wg sync.WaitGroup
+	for i := range responses {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			resp, n, err := h.sendUpstream(ctx, path, upstreamRequest{
+				method: http.MethodPost,
+				url:    req.url,
+				header: req.header,
+				body:   req.body,
+			})
+			attempts[i] = n
+			if err != nil {
+				errs[i] = err
+				return
+			}
+			h.observeUsage(r, resp, req.identity, req.clientName)
+			responses[i] = resp
+		}(i)
+	}
+	wg.Wait()
+	// Every choice is a separate upstream request, so the header reports the attempts of all of them
+	var totalAttempts int
+	for _, n := range attempts {
+		totalAttempts += n
+	}
+	h.setAttemptsHeader(w, path, totalAttempts)
+	defer func() {
+		for _, resp := range responses {
+			if resp != nil {
+				resp.Body.Close()
+			}
+		}
+	}()
+
+	for i, err := range errs {
+		if err != nil {
+			h.logger.Error("upstream request failed", "choice", i, "error", err)
+			writeAPIError(w, path, http.StatusBadGateway, "api_error", "Upstream request failed: "+err.Error())
+			return
+		}
+	}
+	// One failed choice fails the request, as a partial set of choices would be misleading
+	for _, resp := range responses {
+		if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+			h.writeUpstreamError(w, resp)
+			return
+		}
+	}
+
+	if req.stream {
+		h.streamChoices(ctx, cancel, w, responses, req)
+		return
+	}
+	h.mergeChoices(w, responses, req)
+}
+
+// writeUpstreamError relays an upstream error response in OpenAI format
+func (h *ProxyHandler) writeUpstreamError(w http.ResponseWriter, resp *http.Response) {
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		writeAPIError(w, "/v1/chat/completions", http.StatusBadGateway, "api_error", "Failed to read upstream error: "+err.Error())
+		return
+	}
+	var anthropicError struct {
+		Error interface{} `json:"error"`
+	}
+	if json.Unmarshal(body, &anthropicError) == nil && anthropicError.Error != nil {
+		if converted, err := convertAnthropicErrorToOpenAI(anthropicError.Error); err == nil {
+			body = converted
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(resp.StatusCode)
+	w.Write(body)
+}
+
+// mergeChoices converts every upstream reply and combines them into a single chat
+// completion, with one choice per reply and the usage of all of them
+func (h *ProxyHandler) mergeChoices(w http.ResponseWriter, responses []*http.Response, req choiceRequest) {
+	const path = "/v1/chat/completions"
+
+	converted := make([][]byte, len(responses))
+	errs := make([]error, len(responses))
+	var total Usage
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for i, resp := range responses {
+		wg.Add(1)
+		go func(i int, resp *http.Response) {
+			defer wg.Done()
+			var body []byte
+			var err error
+			if strings.Contains(resp.Header.Get("Content-Type"), "text/event-stream") {
+				body, err = h.convertSSEToJSON(resp)
+			} else {
+				body, err = io.ReadAll(resp.Body)
+			}
+			if err != nil {
+				errs[i] = err
+				return
+			}
+			var parsed struct {
+				Usage Usage `json:"usage"`
+			}
+			if json.Unmarshal(body, &parsed) == nil {
+				mu.Lock()
+				total.add(parsed.Usage)
+				mu.Unlock()
+			}
+			converted[i], errs[i] = h.config.Transformer.transformResponse(body, path, responseOptions{format: req.format})
+		}(i, resp)
+	}
+	wg.Wait()
+
+	for _, err := range errs {
+		if h.writeStructuredOutputError(w, path, err) || h.writeStreamError(w, path, err) {
+			return
+		}
+		if err != nil {
+			h.logger.Error("failed to convert upstream response", "error", err)
+			writeAPIError(w, path, http.StatusBadGateway, "api_error", "Failed to convert upstream response: "+err.Error())
+			return
+		}
+	}
+
+	var merged map[string]interface{}
+	choices := make([]interface{}, 0, len(converted))
+	for i, body := range converted {
+		var completion struct {
+			Choices []map[string]interface{} `json:"choices"`
+		}
+		if err := json.Unmarshal(body, &completion); err != nil || len(completion.Choices) == 0 {
+			writeAPIError(w, path, http.StatusBadGateway, "api_error", "Upstream response has no choices")
+			return
+		}
+		if merged == nil {
+			json.Unmarshal(body, &merged)
+		}
+		choice := completion.Choices[0]
+		choice["index"] = i
+		choices = append(choices, choice)
+	}
+	merged["choices"] = choices
+	merged["usage"] = openAIUsage(total)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(merged)
+}
+
+// streamChoices converts every upstream stream with its own converter and interleaves
+// the chunks into one OpenAI stream, each tagged with the index of its choice
+func (h *ProxyHandler) streamChoices(ctx context.Context, cancel context.CancelFunc, w http.ResponseWriter, responses []*http.Response, req choiceRequest) {
+	flusher, _ := w.(http.Flusher)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("X-Accel-Buffering", "no") // Disable nginx buffering
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "close") // Close connection after SSE stream
+	w.WriteHeader(http.StatusOK)
+
+	messageID := "chatcmpl-" + generateRandomID()
+	created := time.Now().Unix()
+	model := req.model
+	if model == "" {
+		model = "claude-3-5-sonnet-20241022" // Default model
+	}
+
+	chunks := make(chan string)
+	converters := make([]*StreamConverter, len(responses))
+	var wg sync.WaitGroup
+	for i, resp := range responses {
+		converter := NewStreamConverter(messageID, model, created, h.logger)
+		converter.IncludeUsage = req.includeUsage
+		converter.StructuredOutput = req.format != nil && req.format.Type == "json_schema"
+		converter.ChoiceIndex = i
+		converter.HideReasoning = h.config.Transformer.config.HideReasoning
+		converters[i] = converter
+
+		wg.Add(1)
+		go func(resp *http.Response) {
+			defer wg.Done()
+			scanner := bufio.NewScanner(resp.Body)
+			scanner.Buffer(make([]byte, 0, 64*1024), maxSSEEventSize)
+			var currentEvent string
+			for scanner.Scan() {
+				line := scanner.Text()
+				if strings.HasPrefix(line, "event: ") {
+					currentEvent = strings.TrimPrefix(line, "event: ")
+					continue
+				}
+				if !strings.HasPrefix(line, "data: ") {
+					continue
+				}
+				converted, err := converter.Convert(currentEvent, strings.TrimPrefix(line, "data: "))
+				if err != nil {
+					h.logger.Error("failed to convert SSE event", "event", currentEvent, "error", err)
+					continue
+				}
+				if converted == "" {
+					continue
+				}
+				select {
+				case chunks <- converted:
+				case <-ctx.Done():
+					return
+				}
+			}
+			if err := scanner.Err(); err != nil {
+				h.logger.Error("scanner error during SSE streaming", "error", err)
+			}
+		}(resp)
+	}
+	go func() {
+		wg.Wait()
+		close(chunks)
+	}()
+
+	for chunk := range chunks {
+		if _, err := w.Write([]byte(chunk)); err != nil {
+			h.logger.Error("failed to write converted event", "error", err)
+			// Stop the remaining upstream streams; the deferred cancel is too late for them
+			cancel()
+			for range chunks {
+			}
+			return
+		}
+		if flusher != nil {
+			flusher.Flush()
+		}
+	}
+	if ctx.Err() != nil {
+		return
+	}
+
+	if req.includeUsage {
+		var total Usage
+		for _, converter := range converters {
+			total.add(converter.Usage())
+		}
+		if _, err := w.Write([]byte(converters[0].usageChunk(total))); err != nil {
+			h.logger.Error("failed to write usage chunk", "error", err)
+			return
+		}
+	}
+	if _, err := fmt.Fprint(w, "data: [DONE]\n\n"); err != nil {
+		h.logger.Error("failed to write [DONE] marker", "error", err)
+		return
+	}
+	if flusher != nil {
+		flusher.Flush()
+	}
+}
@@ -0,0 +1,217 @@
+package proxy
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// choicesHandler returns a proxy handler for an upstream that answers every call
+// with the next numbered stream from toolStreamEvents
+func choicesHandler(t *testing.T, calls *int32) *ProxyHandler {
+	t.Helper()
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]interface{}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+		// n is served by the proxy and never reaches the Anthropic API
+		assert.NotContains(t, body, "n")
+
+		stream := atomic.AddInt32(calls, 1)
+		w.Header().Set("Content-Type", "text/event-stream")
+		for _, event := range toolStreamEvents(int(stream), 0) {
+			fmt.Fprintf(w, "data: %s\n\n", event)
+		}
+	}))
+	t.Cleanup(upstream.Close)
+
+	return NewProxyHandler(&ProxyConfig{
+		UpstreamURL:   upstream.URL,
+		TokenProvider: &mockTokenProvider{token: "test-token"},
+		Transformer:   NewRequestTransformer(),
+	})
+}
+
+func TestProxyHandler_Choices(t *testing.T) {
+	var calls int32
+	handler := choicesHandler(t, &calls)
+
+	body := `{"model":"claude-sonnet-4-20250514","n":3,"messages":[{"role":"user","content":"Hi"}]}`
+	req := httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(body))
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Equal(t, int32(3), calls)
+
+	var response struct {
+		Object  string `json:"object"`
+		Choices []struct {
+			Index   int `json:"index"`
+			Message struct {
+				Content string `json:"content"`
+			} `json:"message"`
+		} `json:"choices"`
+		Usage map[string]interface{} `json:"usage"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Equal(t, "chat.completion", response.Object)
+	require.Len(t, response.Choices, 3)
+	contents := map[string]bool{}
+	for i, choice := range response.Choices {
+		assert.Equal(t, i, choice.Index)
+		contents[choice.Message.Content] = true
+	}
+	assert.Equal(t, map[string]bool{"stream 1": true, "stream 2": true, "stream 3": true}, contents)
+
+	// Usage covers every upstream call: input 11+12+13, output 25 each
+	assert.Equal(t, float64(36), response.Usage["prompt_tokens"])
+	assert.Equal(t, float64(75), response.Usage["completion_tokens"])
+	assert.Equal(t, float64(111), response.Usage["total_tokens"])
+}
+
+func TestProxyHandler_StreamChoices(t *testing.T) {
+	var calls int32
+	handler := choicesHandler(t, &calls)
+
+	body := `{"model":"claude-sonnet-4-20250514","n":2,"stream":true,"stream_options":{"include_usage":true},"messages":[{"role":"user","content":"Hi"}]}`
+	req := httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(body))
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "text/event-stream", w.Header().Get("Content-Type"))
+
+	lines := strings.Split(strings.TrimSpace(w.Body.String()), "\n\n")
+	require.GreaterOrEqual(t, len(lines), 2)
+	assert.Equal(t, "data: [DONE]", lines[len(lines)-1])
+
+	ids := map[string]bool{}
+	finishes := map[int]int{}
+	text := map[int]string{}
+	for _, line := range lines[:len(lines)-2] {
+		var chunk struct {
+			ID      string `json:"id"`
+			Choices []struct {
+				Index int `json:"index"`
+				Delta struct {
+					Content string `json:"content"`
+				} `json:"delta"`
+				FinishReason *string `json:"finish_reason"`
+			} `json:"choices"`
+		}
+		require.NoError(t, json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &chunk))
+		require.Len(t, chunk.Choices, 1)
+		ids[chunk.ID] = true
+		choice := chunk.Choices[0]
+		text[choice.Index] += choice.Delta.Content
+		if choice.FinishReason != nil {
+			finishes[choice.Index]++
+		}
+	}
+	// Every choice belongs to the same completion and finishes exactly once
+	assert.Len(t, ids, 1)
+	assert.Equal(t, map[int]int{0: 1, 1: 1}, finishes)
+	assert.ElementsMatch(t, []string{"stream 1", "stream 2"}, []string{text[0], text[1]})
+
+	var usageChunk map[string]interface{}
+	require.NoError(t, json.Unmarshal([]byte(strings.TrimPrefix(lines[len(lines)-2], "data: ")), &usageChunk))
+	assert.Empty(t, usageChunk["choices"])
+	usage := usageChunk["usage"].(map[string]interface{})
+	assert.Equal(t, float64(23), usage["prompt_tokens"])
+	assert.Equal(t, float64(50), usage["completion_tokens"])
+}
+
+func TestProxyHandler_StreamLargeEvent(t *testing.T) {
+	large := strings.Repeat("a", 128*1024)
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		events := toolStreamEvents(1, 0)
+		events[2] = `{"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"` + large + `"}}`
+		for _, event := range events {
+			fmt.Fprintf(w, "data: %s\n\n", event)
+		}
+	}))
+	t.Cleanup(upstream.Close)
+	handler := NewProxyHandler(&ProxyConfig{
+		UpstreamURL:   upstream.URL,
+		TokenProvider: &mockTokenProvider{token: "test-token"},
+		Transformer:   NewRequestTransformer(),
+	})
+
+	tests := []struct {
+		name, path, body, field string
+		chunks                  int
+	}{
+		{"single choice", "/v1/chat/completions", `{"model":"claude-sonnet-4-20250514","stream":true,"messages":[{"role":"user","content":"Hi"}]}`, "content", 1},
+		{"several choices", "/v1/chat/completions", `{"model":"claude-sonnet-4-20250514","n":2,"stream":true,"messages":[{"role":"user","content":"Hi"}]}`, "content", 2},
+		{"legacy completion", "/v1/completions", `{"model":"claude-sonnet-4-20250514","prompt":"Hi","stream":true}`, "text", 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", tt.path, strings.NewReader(tt.body))
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, req)
+
+			require.Equal(t, http.StatusOK, w.Code)
+			assert.Equal(t, tt.chunks, strings.Count(w.Body.String(), `"`+tt.field+`":"`+large+`"`))
+			assert.True(t, strings.HasSuffix(strings.TrimSpace(w.Body.String()), "data: [DONE]"))
+		})
+	}
+}
+
+func TestProxyHandler_ChoicesUpstreamError(t *testing.T) {
+	var calls int32
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) == 2 {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusTooManyRequests)
+			w.Write([]byte(`{"type":"error","error":{"type":"rate_limit_error","message":"slow down"}}`))
+			return
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		for _, event := range toolStreamEvents(1, 0) {
+			fmt.Fprintf(w, "data: %s\n\n", event)
+		}
+	}))
+	defer upstream.Close()
+
+	handler := NewProxyHandler(&ProxyConfig{
+		UpstreamURL:   upstream.URL,
+		TokenProvider: &mockTokenProvider{token: "test-token"},
+		Transformer:   NewRequestTransformer(),
+	})
+
+	body := `{"model":"claude-sonnet-4-20250514","n":2,"messages":[{"role":"user","content":"Hi"}]}`
+	req := httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(body))
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	var response map[string]map[string]interface{}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Equal(t, "rate_limit_error", response["error"]["type"])
+	assert.Equal(t, "slow down", response["error"]["message"])
+}
+
+func TestProxyHandler_InvalidChoices(t *testing.T) {
+	handler := NewProxyHandler(&ProxyConfig{
+		UpstreamURL:   "http://127.0.0.1:0",
+		TokenProvider: &mockTokenProvider{token: "test-token"},
+		Transformer:   NewRequestTransformer(),
+	})
+
+	for _, n := range []string{"0", "17", "1.5", `"2"`} {
+		body := `{"model":"claude-sonnet-4-20250514","n":` + n + `,"messages":[{"role":"user","content":"Hi"}]}`
+		req := httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(body))
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusBadRequest, w.Code, n)
+	}
+}
@@ -2,9 +2,9 @@ package proxy
 
 import (
 	"bufio"
-	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log/slog"
@@ -20,15 +20,26 @@ import (
 // TokenProvider interface for OAuth token management
 type TokenProvider interface {
 	GetAccessToken() (string, error)
+	// ForceRefresh discards an access token the upstream rejected and returns a new one
+	ForceRefresh(rejected string) (string, error)
+	// ReportRejected records that the upstream also rejected a refreshed token, without refreshing again
+	ReportRejected(token string)
 }
 
 // ProxyConfig holds configuration for the proxy handler
 type ProxyConfig struct {
-	UpstreamURL   string
-	TokenProvider TokenProvider
-	Transformer   *RequestTransformer
-	Timeout       time.Duration
-	Logger        *slog.Logger
+	UpstreamURL    string
+	TokenProvider  TokenProvider
+	Transformer    *RequestTransformer
+	Timeout        time.Duration
+	Logger         *slog.Logger
+	AuthToken      string           // Token clients must present to use the proxy (empty disables auth)
+	Keys           KeyLookup        // Registry of per-client virtual keys (optional)
+	RateLimit      *RateLimitConfig // Per-client rate limits (nil disables)
+	MaxRequestSize int64            // Maximum request body size in bytes (default 10MB)
+	CORS           *CORS            // Cross-origin policy for browser clients (nil blocks all origins)
+	ResponseStore  *ResponseStore   // Conversations of stored /v1/responses results (default in-memory)
+	Retry          *RetryConfig     // Retry policies for failed upstream requests (nil sends every request once)
 }
 
 // ProxyHandler handles HTTP requests and proxies them to Anthropic API
@@ -43,6 +54,12 @@ func NewProxyHandler(config *ProxyConfig) *ProxyHandler {
 	if config.Timeout == 0 {
 		config.Timeout = 600 * time.Second // 10 minutes default
 	}
+	if config.MaxRequestSize <= 0 {
+		config.MaxRequestSize = defaultMaxRequestSize
+	}
+	if config.ResponseStore == nil {
+		config.ResponseStore = NewResponseStore(defaultMaxStoredResponses, defaultStoredResponseTTL)
+	}
 
 	// Use default logger if none provided
 	logger := config.Logger
@@ -70,22 +87,33 @@ func NewProxyHandler(config *ProxyConfig) *ProxyHandler {
 
 // ServeHTTP implements http.Handler interface
 func (h *ProxyHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// Identity attached by the proxy authentication middleware, if any
+	identity := ClientIdentityFromContext(r.Context())
+	clientName := "anonymous"
+	if identity != nil {
+		clientName = identity.Name
+	}
+
 	// Log request details
 	h.logger.Info("incoming request",
 		"method", r.Method,
 		"path", r.URL.Path,
 		"remote_addr", r.RemoteAddr,
 		"user_agent", r.Header.Get("User-Agent"),
+		"client", clientName,
 	)
 
-	// Handle CORS preflight requests
+	// Browser preflight requests are answered by the CORS middleware; never forward OPTIONS upstream
 	if r.Method == "OPTIONS" {
-		h.handleCORS(w, r)
+		w.WriteHeader(http.StatusNoContent)
 		return
 	}
 
-	// Set CORS headers for all requests
-	h.setCORSHeaders(w, r)
+	// Stored Responses API results are served locally
+	if strings.HasPrefix(r.URL.Path, "/v1/responses/") {
+		h.serveStoredResponse(w, r, identity)
+		return
+	}
 
 	// Get OAuth token
 	token, err := h.config.TokenProvider.GetAccessToken()
@@ -96,37 +124,77 @@ func (h *ProxyHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	}
 	h.logger.Debug("OAuth token retrieved successfully")
 
-	// Read request body
-	body, err := io.ReadAll(r.Body)
+	// Read request body up to the configured size limit
+	body, err := readRequestBody(r, h.config.MaxRequestSize)
 	if err != nil {
+		var tooLarge *errRequestTooLarge
+		if errors.As(err, &tooLarge) {
+			h.logger.Warn("request body too large", "limit", tooLarge.limit, "content_length", r.ContentLength)
+			writeAPIError(w, r.URL.Path, http.StatusRequestEntityTooLarge, "request_too_large", err.Error())
+			return
+		}
 		h.writeError(w, http.StatusBadRequest, "Failed to read request body", err.Error())
 		return
 	}
-	defer r.Body.Close()
 
-	// Check if this is a streaming request
-	isStreamingRequest := false
+	// Parse the body once; detection, scope checks and transformation all share it
+	var parsedBody *requestBody
 	if len(body) > 0 {
-		var reqData map[string]interface{}
-		if err := json.Unmarshal(body, &reqData); err == nil {
-			if stream, ok := reqData["stream"].(bool); ok && stream {
-				isStreamingRequest = true
-			}
-		}
+		parsedBody, _ = parseRequestBody(body)
+	}
+	isStreamingRequest := parsedBody.boolField("stream")
+	requestModel := parsedBody.stringField("model")
+	var streamOptions struct {
+		IncludeUsage bool `json:"include_usage"`
+	}
+	parsedBody.decode("stream_options", &streamOptions)
+	// Invalid formats are rejected when the request is transformed below
+	format, _ := parseResponseFormat(parsedBody)
+	options := responseOptions{
+		format:       format,
+		includeUsage: streamOptions.IncludeUsage,
+		echo:         completionEcho(parsedBody, r.URL.Path),
 	}
 	h.logger.Debug("streaming detection", "is_streaming", isStreamingRequest, "body_length", len(body))
 
-	// Transform request body if needed
 	path := r.URL.Path
-	transformedBody, err := h.config.Transformer.TransformRequestBody(body, path)
+
+	// Enforce the model scope of per-client keys
+	if requestModel != "" {
+		model := strings.TrimPrefix(requestModel, "anthropic/")
+		if !identity.AllowsModel(model) && !identity.AllowsModel(h.config.Transformer.MapModelAlias(model)) {
+			writeAPIError(w, path, http.StatusForbidden, "permission_error",
+				fmt.Sprintf("key %q is not allowed to use model %s", clientName, requestModel))
+			return
+		}
+	}
+
+	// The Responses API is translated separately, as it continues stored conversations
+	if path == "/v1/responses" {
+		h.serveResponses(w, r, parsedBody, token, identity, clientName)
+		return
+	}
+
+	// Transform request body if needed
+	var transformedBody []byte
+	if parsedBody != nil {
+		transformedBody, err = h.config.Transformer.transformRequest(parsedBody, path)
+	} else {
+		transformedBody, err = h.config.Transformer.TransformRequestBody(body, path)
+	}
 	if err != nil {
+		var invalid *invalidRequestError
+		if errors.As(err, &invalid) {
+			writeAPIError(w, path, http.StatusBadRequest, "invalid_request_error", invalid.Error())
+			return
+		}
 		h.writeError(w, http.StatusInternalServerError, "Failed to transform request", err.Error())
 		return
 	}
 
 	// Transform path for OpenAI endpoints
 	upstreamPath := path
-	if path == "/v1/chat/completions" {
+	if convertsToMessages(path) {
 		upstreamPath = "/v1/messages"
 	}
 
@@ -139,13 +207,6 @@ func (h *ProxyHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	upstreamURL.Path = upstreamPath
 	upstreamURL.RawQuery = r.URL.RawQuery
 
-	// Create upstream request
-	upstreamReq, err := http.NewRequest(r.Method, upstreamURL.String(), bytes.NewReader(transformedBody))
-	if err != nil {
-		h.writeError(w, http.StatusInternalServerError, "Failed to create upstream request", err.Error())
-		return
-	}
-
 	// For streaming requests, ensure proper connection handling
 	if isStreamingRequest {
 		// Set headers to prevent connection reuse for SSE
@@ -153,22 +214,46 @@ func (h *ProxyHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		r.Header.Set("Cache-Control", "no-cache")
 	}
 
-	// Inject OAuth headers
-	upstreamReq.Header = h.config.Transformer.InjectHeaders(r.Header, token)
+	// Inject OAuth headers; the request is kept so it can be sent again on retries
+	upstreamReq := upstreamRequest{
+		method: r.Method,
+		url:    upstreamURL.String(),
+		header: h.config.Transformer.InjectHeaders(r.Header, token),
+		body:   transformedBody,
+	}
+
+	// OpenAI requests for several choices are fanned out, one upstream call per choice
+	if choices := requestedChoices(parsedBody, path); choices > 1 {
+		h.serveChoices(w, r, choiceRequest{
+			url:          upstreamReq.url,
+			header:       upstreamReq.header,
+			body:         transformedBody,
+			choices:      choices,
+			stream:       isStreamingRequest,
+			includeUsage: streamOptions.IncludeUsage,
+			model:        requestModel,
+			format:       format,
+			identity:     identity,
+			clientName:   clientName,
+		})
+		return
+	}
 
 	// Make upstream request
 	h.logger.Debug("sending request to upstream",
-		"url", upstreamReq.URL.String(),
-		"method", upstreamReq.Method,
-		"has_connection_header", upstreamReq.Header.Get("Connection") != "",
+		"url", upstreamReq.url,
+		"method", upstreamReq.method,
+		"has_connection_header", upstreamReq.header.Get("Connection") != "",
 	)
 
-	resp, err := h.httpClient.Do(upstreamReq)
+	resp, attempts, err := h.sendUpstream(r.Context(), path, upstreamReq)
+	h.setAttemptsHeader(w, path, attempts)
 	if err != nil {
-		h.logger.Error("upstream request failed", "error", err)
+		h.logger.Error("upstream request failed", "error", err, "attempts", attempts)
 		h.writeError(w, http.StatusBadGateway, "Upstream request failed", err.Error())
 		return
 	}
+	h.observeUsage(r, resp, identity, clientName)
 	defer resp.Body.Close()
 
 	h.logger.Debug("received upstream response",
@@ -184,6 +269,7 @@ func (h *ProxyHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		"upstream_content_type", resp.Header.Get("Content-Type"),
 		"path", path,
 		"status", resp.StatusCode,
+		"attempts", attempts,
 	)
 
 	// Handle response body based on what the client requested
@@ -204,9 +290,9 @@ func (h *ProxyHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(resp.StatusCode)
 
 		// For OpenAI endpoints, convert SSE format
-		if path == "/v1/chat/completions" {
+		if convertsToMessages(path) {
 			h.logger.Info("streaming OpenAI-compatible response", "path", path)
-			h.streamOpenAIResponse(w, resp, path)
+			h.streamOpenAIResponse(w, resp, path, options)
 		} else {
 			// For SSE, we need to flush after each write
 			h.logger.Info("streaming native Anthropic response", "path", path)
@@ -223,14 +309,20 @@ func (h *ProxyHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 			h.logger.Info("converting SSE to JSON response", "path", path)
 
 			jsonResp, err := h.convertSSEToJSON(resp)
+			if h.writeStreamError(w, path, err) {
+				return
+			}
 			if err != nil {
 				h.writeError(w, http.StatusInternalServerError, "Failed to convert SSE response", err.Error())
 				return
 			}
 
 			// For OpenAI endpoints, transform the response
-			if path == "/v1/chat/completions" {
-				transformedResp, err := h.config.Transformer.TransformResponseBody(jsonResp, path)
+			if convertsToMessages(path) {
+				transformedResp, err := h.config.Transformer.transformResponse(jsonResp, path, options)
+				if h.writeStructuredOutputError(w, path, err) {
+					return
+				}
 				if err != nil {
 					// If transformation fails, return original
 					w.Header().Set("Content-Type", "application/json")
@@ -247,7 +339,7 @@ func (h *ProxyHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 			w.Write(jsonResp)
 		} else {
 			// Regular JSON response handling
-			if path == "/v1/chat/completions" {
+			if convertsToMessages(path) {
 				respBody, err := io.ReadAll(resp.Body)
 				if err != nil {
 					h.writeError(w, http.StatusInternalServerError, "Failed to read response", err.Error())
@@ -255,7 +347,10 @@ func (h *ProxyHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 				}
 
 				// Transform Anthropic response to OpenAI format
-				transformedResp, err := h.config.Transformer.TransformResponseBody(respBody, path)
+				transformedResp, err := h.config.Transformer.transformResponse(respBody, path, options)
+				if h.writeStructuredOutputError(w, path, err) {
+					return
+				}
 				if err != nil {
 					// If transformation fails, return original
 					// Copy headers excluding Content-Length
@@ -341,7 +436,7 @@ func (h *ProxyHandler) streamResponse(w http.ResponseWriter, resp *http.Response
 }
 
 // streamOpenAIResponse converts Anthropic SSE to OpenAI SSE format
-func (h *ProxyHandler) streamOpenAIResponse(w http.ResponseWriter, resp *http.Response, path string) {
+func (h *ProxyHandler) streamOpenAIResponse(w http.ResponseWriter, resp *http.Response, path string, options responseOptions) {
 	flusher, ok := w.(http.Flusher)
 	if !ok {
 		h.logger.Warn("response writer does not support flushing for OpenAI streaming")
@@ -354,6 +449,9 @@ func (h *ProxyHandler) streamOpenAIResponse(w http.ResponseWriter, resp *http.Re
 
 	// Generate message ID and timestamp for consistency
 	messageID := "chatcmpl-" + generateRandomID()
+	if path == "/v1/completions" {
+		messageID = "cmpl-" + generateRandomID()
+	}
 	created := time.Now().Unix()
 	model := "claude-3-5-sonnet-20241022" // Default model
 
@@ -363,7 +461,16 @@ func (h *ProxyHandler) streamOpenAIResponse(w http.ResponseWriter, resp *http.Re
 		"default_model", model,
 	)
 
+	// Each stream gets its own converter so concurrent streams never share tool state
+	converter := NewStreamConverter(messageID, model, created, h.logger)
+	converter.IncludeUsage = options.includeUsage
+	converter.StructuredOutput = options.format != nil && options.format.Type == "json_schema"
+	converter.TextCompletion = path == "/v1/completions"
+	converter.Echo = options.echo
+	converter.HideReasoning = h.config.Transformer.config.HideReasoning
+
 	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxSSEEventSize)
 	var currentEvent string
 	eventCount := 0
 
@@ -376,21 +483,8 @@ func (h *ProxyHandler) streamOpenAIResponse(w http.ResponseWriter, resp *http.Re
 		} else if strings.HasPrefix(line, "data: ") {
 			data := strings.TrimPrefix(line, "data: ")
 
-			// Extract model from message_start if available
-			if currentEvent == "message_start" {
-				var msgData map[string]interface{}
-				if err := json.Unmarshal([]byte(data), &msgData); err == nil {
-					if msg, ok := msgData["message"].(map[string]interface{}); ok {
-						if m, ok := msg["model"].(string); ok {
-							model = m
-							h.logger.Debug("extracted model from message_start", "model", model)
-						}
-					}
-				}
-			}
-
 			// Convert the SSE event
-			converted, err := ConvertAnthropicSSEToOpenAIWithLogger(currentEvent, data, messageID, model, created, h.logger)
+			converted, err := converter.Convert(currentEvent, data)
 			if err == nil && converted != "" {
 				eventCount++
 				h.logger.Debug("converted SSE event",
@@ -421,6 +515,14 @@ func (h *ProxyHandler) streamOpenAIResponse(w http.ResponseWriter, resp *http.Re
 
 	h.logger.Info("SSE streaming completed, sending [DONE] marker", "total_events", eventCount)
 
+	// Send the usage chunk requested with stream_options.include_usage
+	if usageChunk := converter.UsageChunk(); usageChunk != "" {
+		if _, err := w.Write([]byte(usageChunk)); err != nil {
+			h.logger.Error("failed to write usage chunk", "error", err)
+			return
+		}
+	}
+
 	// Send the [DONE] marker to properly close the OpenAI SSE stream
 	n, err := w.Write([]byte("data: [DONE]\n\n"))
 	if err != nil {
@@ -456,123 +558,94 @@ func (h *ProxyHandler) writeError(w http.ResponseWriter, statusCode int, errorTy
 	json.NewEncoder(w).Encode(errorResp)
 }
 
-// convertSSEToJSON reads an SSE response and converts it to a JSON response
+// observeUsage counts the tokens of an upstream response against the daily quota of
+// per-client keys and any usage observers, such as rate limit budgets
+func (h *ProxyHandler) observeUsage(r *http.Request, resp *http.Response, identity *ClientIdentity, clientName string) {
+	observers := usageObserversFromContext(r.Context())
+	if (identity == nil || identity.Key == nil) && len(observers) == 0 {
+		return
+	}
+	isSSE := strings.Contains(resp.Header.Get("Content-Type"), "text/event-stream")
+	resp.Body = newUsageReader(resp.Body, isSSE, func(usage Usage) {
+		for _, observe := range observers {
+			observe(usage)
+		}
+		if identity == nil || identity.Key == nil {
+			return
+		}
+		identity.RecordUsage(usage)
+		h.logger.Info("client usage recorded",
+			"client", clientName,
+			"key_id", identity.Key.ID,
+			"input_tokens", usage.InputTokens,
+			"output_tokens", usage.OutputTokens,
+		)
+	})
+}
+
+// writeStructuredOutputError reports structured output that failed schema validation.
+// It returns false for any other error, which is handled by the caller.
+func (h *ProxyHandler) writeStructuredOutputError(w http.ResponseWriter, path string, err error) bool {
+	var invalid *structuredOutputError
+	if !errors.As(err, &invalid) {
+		return false
+	}
+	h.logger.Warn("structured output failed schema validation", "error", err)
+	writeAPIError(w, path, http.StatusBadGateway, "api_error", invalid.Error())
+	return true
+}
+
+// maxSSEEventSize bounds a single line of an upstream stream, such as a large server tool result
+const maxSSEEventSize = 16 << 20
+
+// writeStreamError reports an error event the upstream sent instead of completing a stream,
+// with the status of its error type. It returns false for any other error.
+func (h *ProxyHandler) writeStreamError(w http.ResponseWriter, path string, err error) bool {
+	var streamErr *upstreamStreamError
+	if !errors.As(err, &streamErr) {
+		return false
+	}
+	h.logger.Warn("upstream stream failed", "type", streamErr.Type, "message", streamErr.Message)
+	writeAPIError(w, path, streamErr.statusCode(), streamErr.Type, streamErr.Message)
+	return true
+}
+
+// convertSSEToJSON reads an SSE response and reassembles the Messages API response it streams.
+// An error event in the stream is returned as an *upstreamStreamError.
 func (h *ProxyHandler) convertSSEToJSON(resp *http.Response) ([]byte, error) {
-	// Buffer to accumulate the complete message
-	var message map[string]interface{}
-	var contentBlocks []map[string]interface{}
-	var currentText strings.Builder
+	accumulator := newMessageAccumulator()
+
+	// An event's data may span several lines; the event ends at a blank line
+	var data []string
+	dispatch := func() {
+		if len(data) == 0 {
+			return
+		}
+		event := strings.Join(data, "\n")
+		data = data[:0]
+		if err := accumulator.add([]byte(event)); err != nil {
+			h.logger.Warn("failed to parse SSE event", "data", event, "error", err)
+		}
+	}
 
-	// Read the SSE stream
 	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxSSEEventSize)
 	for scanner.Scan() {
 		line := scanner.Text()
-
-		// Skip empty lines
 		if line == "" {
+			dispatch()
 			continue
 		}
-
-		// Parse SSE event
-		if strings.HasPrefix(line, "data: ") {
-			data := strings.TrimPrefix(line, "data: ")
-
-			var event map[string]interface{}
-			if err := json.Unmarshal([]byte(data), &event); err != nil {
-				h.logger.Warn("failed to parse SSE event", "data", data, "error", err)
-				continue
-			}
-
-			eventType, _ := event["type"].(string)
-
-			switch eventType {
-			case "message_start":
-				// Extract the message structure
-				if msg, ok := event["message"].(map[string]interface{}); ok {
-					message = msg
-					// Initialize content array if not present
-					if message["content"] == nil {
-						message["content"] = []interface{}{}
-					}
-				}
-
-			case "content_block_start":
-				// Initialize a new content block
-				if block, ok := event["content_block"].(map[string]interface{}); ok {
-					contentBlocks = append(contentBlocks, block)
-				}
-
-			case "content_block_delta":
-				// Accumulate text from deltas
-				if delta, ok := event["delta"].(map[string]interface{}); ok {
-					if text, ok := delta["text"].(string); ok {
-						currentText.WriteString(text)
-					}
-				}
-
-			case "content_block_stop":
-				// Finalize the current content block
-				if len(contentBlocks) > 0 && currentText.Len() > 0 {
-					// Update the last content block with accumulated text
-					lastBlock := contentBlocks[len(contentBlocks)-1]
-					lastBlock["text"] = currentText.String()
-					currentText.Reset()
-				}
-
-			case "message_delta":
-				// Update message metadata (stop_reason, usage, etc.)
-				if delta, ok := event["delta"].(map[string]interface{}); ok {
-					for k, v := range delta {
-						message[k] = v
-					}
-				}
-				if usage, ok := event["usage"].(map[string]interface{}); ok {
-					message["usage"] = usage
-				}
-
-			case "message_stop":
-				// Message is complete
-				break
-			}
+		if strings.HasPrefix(line, "data:") {
+			data = append(data, strings.TrimPrefix(strings.TrimPrefix(line, "data:"), " "))
 		}
 	}
-
 	if err := scanner.Err(); err != nil {
 		return nil, fmt.Errorf("error reading SSE stream: %w", err)
 	}
+	dispatch()
 
-	// Ensure we have a valid message
-	if message == nil {
-		return nil, fmt.Errorf("no message found in SSE stream")
-	}
-
-	// Set the content blocks
-	if len(contentBlocks) > 0 {
-		message["content"] = contentBlocks
-	}
-
-	// Marshal the complete message to JSON
-	return json.Marshal(message)
-}
-
-// setCORSHeaders sets CORS headers for all responses
-func (h *ProxyHandler) setCORSHeaders(w http.ResponseWriter, r *http.Request) {
-	origin := r.Header.Get("Origin")
-	if origin == "" {
-		origin = "*"
-	}
-
-	w.Header().Set("Access-Control-Allow-Origin", origin)
-	w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, X-Requested-With")
-	w.Header().Set("Access-Control-Allow-Credentials", "true")
-	w.Header().Set("Access-Control-Max-Age", "3600")
-}
-
-// handleCORS handles CORS preflight requests
-func (h *ProxyHandler) handleCORS(w http.ResponseWriter, r *http.Request) {
-	h.setCORSHeaders(w, r)
-	w.WriteHeader(http.StatusNoContent)
+	return accumulator.result()
 }
 
 // ProxyServer wraps the handler with additional server functionality
@@ -584,8 +657,13 @@ type ProxyServer struct {
 // NewProxyServer creates a new proxy server with health endpoints
 func NewProxyServer(config *ProxyConfig, addr string, storage auth.StorageBackend) *ProxyServer {
 	proxyHandler := NewProxyHandler(config)
-	healthHandler := NewHealthHandler(storage)
-	mux := CreateMux(proxyHandler, healthHandler)
+	proxyAuth := NewProxyAuthWithKeys(config.AuthToken, config.Keys)
+	healthHandler := NewHealthHandlerWithTokens(storage, proxyAuth, config.TokenProvider)
+	mux := CreateMuxWithConfig(proxyHandler, healthHandler, MuxConfig{
+		ProxyAuth:   proxyAuth,
+		RateLimiter: NewRateLimiter(config.RateLimit),
+		CORS:        config.CORS,
+	})
 
 	return &ProxyServer{
 		handler: proxyHandler,
@@ -6,10 +6,12 @@ import (
 	"io"
 	"net/http"
 	"net/http/httptest"
+	"path/filepath"
 	"strings"
 	"testing"
 	"time"
 
+	"github.com/ml0-1337/claude-gate/internal/auth"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -23,6 +25,12 @@ func (m *mockTokenProvider) GetAccessToken() (string, error) {
 	return m.token, m.err
 }
 
+func (m *mockTokenProvider) ForceRefresh(rejected string) (string, error) {
+	return m.token, m.err
+}
+
+func (m *mockTokenProvider) ReportRejected(token string) {}
+
 func TestProxyHandler(t *testing.T) {
 	t.Run("proxies request with transformed body and headers", func(t *testing.T) {
 		// Create test server to act as Anthropic API
@@ -699,4 +707,104 @@ data: {"type":"message_stop"}
 		
 		assert.Equal(t, "stop", choice["finish_reason"])
 	})
-}
\ No newline at end of file
+}
+
+func TestProxyHandler_ClientKeys(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"id":"msg_1","content":[{"type":"text","text":"hi"}],"usage":{"input_tokens":60,"output_tokens":50}}`))
+	}))
+	defer upstream.Close()
+
+	registry := auth.NewKeyRegistry(filepath.Join(t.TempDir(), "keys.json"))
+	secret, _, err := registry.Create("laptop", auth.ProxyKeyOptions{
+		AllowedModels:   []string{"claude-3-5-haiku*"},
+		DailyTokenQuota: 100,
+	})
+	require.NoError(t, err)
+
+	proxyAuth := NewProxyAuthWithKeys("", registry)
+	handler := proxyAuth.Middleware(NewProxyHandler(&ProxyConfig{
+		UpstreamURL:   upstream.URL,
+		TokenProvider: &mockTokenProvider{token: "test-token"},
+		Transformer:   NewRequestTransformer(),
+	}))
+
+	send := func(model string) *httptest.ResponseRecorder {
+		body := `{"model":"` + model + `","messages":[{"role":"user","content":"Hello"}]}`
+		req := httptest.NewRequest("POST", "/v1/messages", strings.NewReader(body))
+		req.Header.Set("x-api-key", secret)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w
+	}
+
+	t.Run("rejects models outside the key scope", func(t *testing.T) {
+		w := send("claude-3-opus-20240229")
+		assert.Equal(t, http.StatusForbidden, w.Code)
+		assert.Contains(t, w.Body.String(), "permission_error")
+	})
+
+	t.Run("allows aliases of scoped models", func(t *testing.T) {
+		w := send("claude-3-5-haiku-latest")
+		assert.Equal(t, http.StatusOK, w.Code)
+	})
+
+	t.Run("counts response tokens against the daily quota", func(t *testing.T) {
+		// The previous request used 110 tokens, exceeding the quota of 100
+		w := send("claude-3-5-haiku-20241022")
+		assert.Equal(t, http.StatusTooManyRequests, w.Code)
+		assert.Contains(t, w.Body.String(), "daily token quota")
+	})
+}
+
+func TestProxyHandler_MaxRequestSize(t *testing.T) {
+	upstreamCalled := false
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		upstreamCalled = true
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"id":"msg_1"}`))
+	}))
+	defer upstream.Close()
+
+	handler := NewProxyHandler(&ProxyConfig{
+		UpstreamURL:    upstream.URL,
+		TokenProvider:  &mockTokenProvider{token: "test-token"},
+		Transformer:    NewRequestTransformer(),
+		MaxRequestSize: 128,
+	})
+
+	largeBody := `{"model":"claude-3-5-haiku-20241022","messages":[{"role":"user","content":"` + strings.Repeat("a", 200) + `"}]}`
+
+	t.Run("rejects Anthropic request with request_too_large", func(t *testing.T) {
+		req := httptest.NewRequest("POST", "/v1/messages", strings.NewReader(largeBody))
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+		var response map[string]interface{}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		assert.Equal(t, "request_too_large", response["error"].(map[string]interface{})["type"])
+		assert.False(t, upstreamCalled)
+	})
+
+	t.Run("rejects OpenAI request with OpenAI error", func(t *testing.T) {
+		req := httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(largeBody))
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+		var response map[string]interface{}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		assert.Equal(t, "invalid_request_error", response["error"].(map[string]interface{})["type"])
+	})
+
+	t.Run("accepts request within limit", func(t *testing.T) {
+		req := httptest.NewRequest("POST", "/v1/messages", strings.NewReader(`{"model":"claude-3-5-haiku-latest"}`))
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.True(t, upstreamCalled)
+	})
+}
@@ -0,0 +1,268 @@
+package proxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// upstreamStreamError is an error event sent by the upstream in the middle of a stream
+type upstreamStreamError struct {
+	Type    string
+	Message string
+}
+
+func (e *upstreamStreamError) Error() string {
+	return fmt.Sprintf("upstream stream error (%s): %s", e.Type, e.Message)
+}
+
+// statusCode returns the HTTP status the Messages API uses for the error type
+func (e *upstreamStreamError) statusCode() int {
+	return errorTypeStatus(e.Type)
+}
+
+// messageAccumulator rebuilds a complete Messages API response from the events of a stream.
+// Content blocks are assembled by index: text, thinking, signatures and citations are
+// concatenated, and tool inputs are parsed once the block stops. Blocks that arrive
+// complete, such as server tool results and redacted thinking, are kept as sent.
+// Fields are held as raw JSON so that nothing the upstream sent is reformatted.
+type messageAccumulator struct {
+	message map[string]json.RawMessage
+	usage   map[string]json.RawMessage
+	blocks  map[int]*accumulatedBlock
+	// lastIndex is the index of the latest block, for events that carry no index
+	lastIndex int
+	err       error
+}
+
+// accumulatedBlock is a content block and the deltas received for it
+type accumulatedBlock struct {
+	fields      map[string]json.RawMessage
+	strings     map[string]*strings.Builder
+	partialJSON strings.Builder
+	hasJSON     bool
+	citations   []json.RawMessage
+	stopped     bool
+}
+
+// streamEvent is the envelope of a Messages API stream event
+type streamEvent struct {
+	Type         string          `json:"type"`
+	Index        *int            `json:"index"`
+	Message      json.RawMessage `json:"message"`
+	ContentBlock json.RawMessage `json:"content_block"`
+	Delta        json.RawMessage `json:"delta"`
+	Usage        json.RawMessage `json:"usage"`
+	Error        *struct {
+		Type    string `json:"type"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+// contentDelta is the delta of a content_block_delta event
+type contentDelta struct {
+	Type        string          `json:"type"`
+	Text        string          `json:"text"`
+	Thinking    string          `json:"thinking"`
+	Signature   string          `json:"signature"`
+	PartialJSON string          `json:"partial_json"`
+	Citation    json.RawMessage `json:"citation"`
+}
+
+// newMessageAccumulator creates an empty accumulator
+func newMessageAccumulator() *messageAccumulator {
+	return &messageAccumulator{
+		usage:     make(map[string]json.RawMessage),
+		blocks:    make(map[int]*accumulatedBlock),
+		lastIndex: -1,
+	}
+}
+
+// add applies one event. It returns an error only if the event is not valid JSON;
+// errors in the reassembled message are reported by result.
+func (a *messageAccumulator) add(data []byte) error {
+	var event streamEvent
+	if err := json.Unmarshal(data, &event); err != nil {
+		return err
+	}
+
+	index := a.lastIndex
+	if event.Index != nil {
+		index = *event.Index
+	}
+
+	switch event.Type {
+	case "message_start":
+		var message map[string]json.RawMessage
+		if err := json.Unmarshal(event.Message, &message); err != nil {
+			return err
+		}
+		a.message = message
+		a.mergeUsage(message["usage"])
+
+	case "content_block_start":
+		var fields map[string]json.RawMessage
+		if err := json.Unmarshal(event.ContentBlock, &fields); err != nil {
+			return err
+		}
+		if event.Index == nil {
+			index = a.lastIndex + 1
+		}
+		a.blocks[index] = &accumulatedBlock{fields: fields, strings: make(map[string]*strings.Builder)}
+		a.lastIndex = index
+
+	case "content_block_delta":
+		block, ok := a.blocks[index]
+		if !ok {
+			return nil
+		}
+		var delta contentDelta
+		if err := json.Unmarshal(event.Delta, &delta); err != nil {
+			return err
+		}
+		switch delta.Type {
+		case "text_delta":
+			block.appendString("text", delta.Text)
+		case "thinking_delta":
+			block.appendString("thinking", delta.Thinking)
+		case "signature_delta":
+			block.appendString("signature", delta.Signature)
+		case "input_json_delta":
+			block.partialJSON.WriteString(delta.PartialJSON)
+			block.hasJSON = true
+		case "citations_delta":
+			if len(delta.Citation) > 0 {
+				block.citations = append(block.citations, delta.Citation)
+			}
+		}
+
+	case "content_block_stop":
+		if block, ok := a.blocks[index]; ok {
+			a.finish(index, block)
+		}
+
+	case "message_delta":
+		// Only the fields that changed are sent, such as stop_reason and stop_sequence
+		var delta map[string]json.RawMessage
+		if len(event.Delta) > 0 {
+			if err := json.Unmarshal(event.Delta, &delta); err != nil {
+				return err
+			}
+		}
+		if a.message == nil {
+			a.message = make(map[string]json.RawMessage)
+		}
+		for key, value := range delta {
+			a.message[key] = value
+		}
+		a.mergeUsage(event.Usage)
+
+	case "error":
+		if event.Error != nil && a.err == nil {
+			a.err = &upstreamStreamError{Type: event.Error.Type, Message: event.Error.Message}
+		}
+	}
+	return nil
+}
+
+// appendString appends a delta to a string field, after the value the block started with
+func (b *accumulatedBlock) appendString(key, value string) {
+	builder, ok := b.strings[key]
+	if !ok {
+		builder = &strings.Builder{}
+		var initial string
+		json.Unmarshal(b.fields[key], &initial)
+		builder.WriteString(initial)
+		b.strings[key] = builder
+	}
+	builder.WriteString(value)
+}
+
+// finish writes the accumulated deltas into the block fields
+func (a *messageAccumulator) finish(index int, block *accumulatedBlock) {
+	if block.stopped {
+		return
+	}
+	block.stopped = true
+
+	for key, builder := range block.strings {
+		encoded, _ := json.Marshal(builder.String())
+		block.fields[key] = encoded
+	}
+
+	if len(block.citations) > 0 {
+		var citations []json.RawMessage
+		json.Unmarshal(block.fields["citations"], &citations)
+		encoded, _ := json.Marshal(append(citations, block.citations...))
+		block.fields["citations"] = encoded
+	}
+
+	// Tool use blocks start with an empty input that is streamed as partial JSON
+	if block.hasJSON {
+		input := bytes.TrimSpace([]byte(block.partialJSON.String()))
+		if len(input) == 0 {
+			input = []byte("{}")
+		}
+		if !json.Valid(input) {
+			if a.err == nil {
+				a.err = fmt.Errorf("invalid tool input in SSE stream for block %d", index)
+			}
+			return
+		}
+		block.fields["input"] = input
+	}
+}
+
+// mergeUsage overlays usage counts; message_delta only carries the counts that changed
+func (a *messageAccumulator) mergeUsage(raw json.RawMessage) {
+	var usage map[string]json.RawMessage
+	if json.Unmarshal(raw, &usage) != nil {
+		return
+	}
+	for key, value := range usage {
+		a.usage[key] = value
+	}
+}
+
+// result returns the reassembled message. It fails if the stream held no message,
+// reported an error event or carried invalid tool input.
+func (a *messageAccumulator) result() ([]byte, error) {
+	// Blocks of a stream cut short are kept with what was received
+	indexes := make([]int, 0, len(a.blocks))
+	for index, block := range a.blocks {
+		a.finish(index, block)
+		indexes = append(indexes, index)
+	}
+	if a.err != nil {
+		return nil, a.err
+	}
+	if a.message == nil {
+		return nil, errors.New("no message found in SSE stream")
+	}
+
+	sort.Ints(indexes)
+	content := make([]map[string]json.RawMessage, 0, len(indexes))
+	for _, index := range indexes {
+		content = append(content, a.blocks[index].fields)
+	}
+
+	message := make(map[string]json.RawMessage, len(a.message)+2)
+	for key, value := range a.message {
+		message[key] = value
+	}
+	encoded, err := json.Marshal(content)
+	if err != nil {
+		return nil, err
+	}
+	message["content"] = encoded
+	if len(a.usage) > 0 {
+		if encoded, err = json.Marshal(a.usage); err != nil {
+			return nil, err
+		}
+		message["usage"] = encoded
+	}
+	return json.Marshal(message)
+}
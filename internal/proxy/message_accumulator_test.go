@@ -0,0 +1,188 @@
+package proxy
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// accumulate feeds events to a new accumulator and returns the reassembled message
+func accumulate(t *testing.T, events ...string) ([]byte, error) {
+	t.Helper()
+	accumulator := newMessageAccumulator()
+	for _, event := range events {
+		require.NoError(t, accumulator.add([]byte(event)))
+	}
+	return accumulator.result()
+}
+
+func TestMessageAccumulator(t *testing.T) {
+	result, err := accumulate(t,
+		`{"type":"message_start","message":{"id":"msg_1","type":"message","role":"assistant","model":"claude-sonnet-4-20250514","content":[],"stop_reason":null,"stop_sequence":null,"usage":{"input_tokens":120,"cache_read_input_tokens":30,"output_tokens":1}}}`,
+		`{"type":"ping"}`,
+		`{"type":"content_block_start","index":0,"content_block":{"type":"thinking","thinking":"","signature":""}}`,
+		`{"type":"content_block_delta","index":0,"delta":{"type":"thinking_delta","thinking":"Search "}}`,
+		`{"type":"content_block_delta","index":0,"delta":{"type":"thinking_delta","thinking":"first."}}`,
+		`{"type":"content_block_delta","index":0,"delta":{"type":"signature_delta","signature":"sig"}}`,
+		`{"type":"content_block_stop","index":0}`,
+		`{"type":"content_block_start","index":1,"content_block":{"type":"server_tool_use","id":"srvtoolu_1","name":"web_search","input":{}}}`,
+		`{"type":"content_block_delta","index":1,"delta":{"type":"input_json_delta","partial_json":"{\"query\":"}}`,
+		`{"type":"content_block_delta","index":1,"delta":{"type":"input_json_delta","partial_json":"\"go\"}"}}`,
+		`{"type":"content_block_stop","index":1}`,
+		`{"type":"content_block_start","index":2,"content_block":{"type":"web_search_tool_result","tool_use_id":"srvtoolu_1","content":[{"type":"web_search_result","url":"https://go.dev","title":"Go","page_age":null}]}}`,
+		`{"type":"content_block_stop","index":2}`,
+		`{"type":"content_block_start","index":3,"content_block":{"type":"text","text":"","citations":null}}`,
+		`{"type":"content_block_delta","index":3,"delta":{"type":"citations_delta","citation":{"type":"web_search_result_location","url":"https://go.dev","cited_text":"Go"}}}`,
+		`{"type":"content_block_delta","index":3,"delta":{"type":"text_delta","text":"Go is "}}`,
+		`{"type":"content_block_delta","index":3,"delta":{"type":"text_delta","text":"a language."}}`,
+		`{"type":"content_block_stop","index":3}`,
+		`{"type":"content_block_start","index":4,"content_block":{"type":"tool_use","id":"toolu_1","name":"save","input":{}}}`,
+		`{"type":"content_block_delta","index":4,"delta":{"type":"input_json_delta","partial_json":"{\"id\": 12345678901234567890}"}}`,
+		`{"type":"content_block_stop","index":4}`,
+		`{"type":"message_delta","delta":{"stop_reason":"tool_use","stop_sequence":null},"usage":{"output_tokens":88,"server_tool_use":{"web_search_requests":1}}}`,
+		`{"type":"message_stop"}`,
+	)
+	require.NoError(t, err)
+
+	assert.JSONEq(t, `{
+		"id": "msg_1", "type": "message", "role": "assistant", "model": "claude-sonnet-4-20250514",
+		"content": [
+			{"type": "thinking", "thinking": "Search first.", "signature": "sig"},
+			{"type": "server_tool_use", "id": "srvtoolu_1", "name": "web_search", "input": {"query": "go"}},
+			{"type": "web_search_tool_result", "tool_use_id": "srvtoolu_1", "content": [{"type": "web_search_result", "url": "https://go.dev", "title": "Go", "page_age": null}]},
+			{"type": "text", "text": "Go is a language.", "citations": [{"type": "web_search_result_location", "url": "https://go.dev", "cited_text": "Go"}]},
+			{"type": "tool_use", "id": "toolu_1", "name": "save", "input": {"id": 12345678901234567890}}
+		],
+		"stop_reason": "tool_use", "stop_sequence": null,
+		"usage": {"input_tokens": 120, "cache_read_input_tokens": 30, "output_tokens": 88, "server_tool_use": {"web_search_requests": 1}}
+	}`, string(result))
+	// Numbers are copied as sent, without a round trip through float64
+	assert.Contains(t, string(result), "12345678901234567890")
+}
+
+func TestMessageAccumulator_InterleavedBlocks(t *testing.T) {
+	result, err := accumulate(t,
+		`{"type":"message_start","message":{"id":"msg_1","content":[]}}`,
+		`{"type":"content_block_start","index":1,"content_block":{"type":"tool_use","id":"toolu_1","name":"a","input":{}}}`,
+		`{"type":"content_block_start","index":0,"content_block":{"type":"text","text":""}}`,
+		`{"type":"content_block_delta","index":1,"delta":{"type":"input_json_delta","partial_json":"{\"x\""}}`,
+		`{"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"one"}}`,
+		`{"type":"content_block_delta","index":1,"delta":{"type":"input_json_delta","partial_json":":1}"}}`,
+		`{"type":"content_block_start","index":2,"content_block":{"type":"tool_use","id":"toolu_2","name":"b","input":{}}}`,
+		`{"type":"content_block_stop","index":0}`,
+		`{"type":"content_block_stop","index":1}`,
+	)
+	require.NoError(t, err)
+
+	var message struct {
+		Content []map[string]interface{} `json:"content"`
+	}
+	require.NoError(t, json.Unmarshal(result, &message))
+	assert.Equal(t, []map[string]interface{}{
+		{"type": "text", "text": "one"},
+		{"type": "tool_use", "id": "toolu_1", "name": "a", "input": map[string]interface{}{"x": float64(1)}},
+		// The stream was cut short; the block is kept as started
+		{"type": "tool_use", "id": "toolu_2", "name": "b", "input": map[string]interface{}{}},
+	}, message.Content)
+}
+
+func TestMessageAccumulator_Errors(t *testing.T) {
+	t.Run("error event", func(t *testing.T) {
+		_, err := accumulate(t,
+			`{"type":"message_start","message":{"id":"msg_1","content":[]}}`,
+			`{"type":"error","error":{"type":"overloaded_error","message":"Overloaded"}}`,
+		)
+		var streamErr *upstreamStreamError
+		require.True(t, errors.As(err, &streamErr))
+		assert.Equal(t, "overloaded_error", streamErr.Type)
+		assert.Equal(t, 529, streamErr.statusCode())
+	})
+
+	t.Run("invalid tool input", func(t *testing.T) {
+		_, err := accumulate(t,
+			`{"type":"message_start","message":{"id":"msg_1","content":[]}}`,
+			`{"type":"content_block_start","index":0,"content_block":{"type":"tool_use","id":"toolu_1","name":"a","input":{}}}`,
+			`{"type":"content_block_delta","index":0,"delta":{"type":"input_json_delta","partial_json":"{\"x\":"}}`,
+			`{"type":"content_block_stop","index":0}`,
+		)
+		assert.ErrorContains(t, err, "invalid tool input")
+	})
+
+	t.Run("no message", func(t *testing.T) {
+		_, err := accumulate(t, `{"type":"ping"}`)
+		assert.Error(t, err)
+	})
+
+	t.Run("malformed event", func(t *testing.T) {
+		assert.Error(t, newMessageAccumulator().add([]byte(`{"type":`)))
+	})
+}
+
+func TestProxyHandler_NonStreamingFromSSE(t *testing.T) {
+	var events []string
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		for _, event := range events {
+			var envelope struct {
+				Type string `json:"type"`
+			}
+			json.Unmarshal([]byte(event), &envelope)
+			fmt.Fprintf(w, "event: %s\ndata: %s\n\n", envelope.Type, event)
+		}
+	}))
+	defer upstream.Close()
+
+	handler := NewProxyHandler(&ProxyConfig{
+		UpstreamURL:   upstream.URL,
+		TokenProvider: &mockTokenProvider{token: "test-token"},
+		Transformer:   NewRequestTransformer(),
+	})
+	serve := func(path string) *httptest.ResponseRecorder {
+		body := `{"model": "claude-sonnet-4-20250514", "max_tokens": 100, "messages": [{"role": "user", "content": "Hi"}]}`
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest("POST", path, strings.NewReader(body)))
+		return w
+	}
+
+	t.Run("tool use input is rebuilt", func(t *testing.T) {
+		events = toolStreamEvents(1, 2)
+		w := serve("/v1/messages")
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+		var message struct {
+			Content []struct {
+				Type  string          `json:"type"`
+				Text  string          `json:"text"`
+				Input json.RawMessage `json:"input"`
+			} `json:"content"`
+			Usage Usage `json:"usage"`
+		}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &message))
+		require.Len(t, message.Content, 3)
+		assert.Equal(t, "stream 1", message.Content[0].Text)
+		assert.JSONEq(t, `{"stream":1}`, string(message.Content[1].Input))
+		assert.JSONEq(t, `{"stream":1}`, string(message.Content[2].Input))
+		assert.Equal(t, Usage{InputTokens: 11, OutputTokens: 25}, message.Usage)
+	})
+
+	t.Run("error event keeps its status", func(t *testing.T) {
+		events = []string{
+			`{"type":"message_start","message":{"id":"msg_1","content":[],"usage":{"input_tokens":5}}}`,
+			`{"type":"error","error":{"type":"overloaded_error","message":"Overloaded"}}`,
+		}
+		w := serve("/v1/messages")
+		assert.Equal(t, 529, w.Code)
+		assert.JSONEq(t, `{"type": "error", "error": {"type": "overloaded_error", "message": "Overloaded"}}`, w.Body.String())
+
+		w = serve("/v1/chat/completions")
+		assert.Equal(t, 529, w.Code)
+		assert.Contains(t, w.Body.String(), `"server_error"`)
+	})
+}
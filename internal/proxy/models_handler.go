@@ -16,15 +16,12 @@ func NewModelsHandler() *ModelsHandler {
 
 // ServeHTTP handles the models endpoint
 func (h *ModelsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	// Handle CORS
+	// Browser preflight requests are answered by the CORS middleware
 	if r.Method == "OPTIONS" {
-		setCORSHeadersStandalone(w, r)
 		w.WriteHeader(http.StatusNoContent)
 		return
 	}
 	
-	setCORSHeadersStandalone(w, r)
-	
 	// Return available models in OpenAI format
 	models := map[string]interface{}{
 		"object": "list",
@@ -123,17 +120,3 @@ func (h *ModelsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(models)
 }
-
-// setCORSHeadersStandalone is a standalone CORS header setter
-func setCORSHeadersStandalone(w http.ResponseWriter, r *http.Request) {
-	origin := r.Header.Get("Origin")
-	if origin == "" {
-		origin = "*"
-	}
-	
-	w.Header().Set("Access-Control-Allow-Origin", origin)
-	w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, X-Requested-With")
-	w.Header().Set("Access-Control-Allow-Credentials", "true")
-	w.Header().Set("Access-Control-Max-Age", "3600")
-}
\ No newline at end of file
@@ -68,55 +68,6 @@ func TestModelsHandler_SetsContentTypeHeader(t *testing.T) {
 	assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
 }
 
-// Test 4: ModelsHandler should handle CORS headers correctly
-func TestModelsHandler_SetsCORSHeaders(t *testing.T) {
-	// Prediction: This test will pass - CORS headers should be set
-	
-	handler := NewModelsHandler()
-	req := httptest.NewRequest("GET", "/v1/models", nil)
-	req.Header.Set("Origin", "https://example.com")
-	w := httptest.NewRecorder()
-	
-	handler.ServeHTTP(w, req)
-	
-	// Check CORS headers
-	assert.Equal(t, "https://example.com", w.Header().Get("Access-Control-Allow-Origin"))
-	assert.Equal(t, "GET, POST, PUT, DELETE, OPTIONS", w.Header().Get("Access-Control-Allow-Methods"))
-	assert.Equal(t, "Content-Type, Authorization, X-Requested-With", w.Header().Get("Access-Control-Allow-Headers"))
-	assert.Equal(t, "true", w.Header().Get("Access-Control-Allow-Credentials"))
-	assert.Equal(t, "3600", w.Header().Get("Access-Control-Max-Age"))
-}
-
-// Test 5: setCORSHeadersStandalone should set all required CORS headers
-func TestSetCORSHeadersStandalone(t *testing.T) {
-	// Prediction: This test will pass - testing CORS function directly
-	
-	t.Run("with origin header", func(t *testing.T) {
-		req := httptest.NewRequest("OPTIONS", "/v1/models", nil)
-		req.Header.Set("Origin", "https://app.example.com")
-		w := httptest.NewRecorder()
-		
-		setCORSHeadersStandalone(w, req)
-		
-		assert.Equal(t, "https://app.example.com", w.Header().Get("Access-Control-Allow-Origin"))
-		assert.Equal(t, "GET, POST, PUT, DELETE, OPTIONS", w.Header().Get("Access-Control-Allow-Methods"))
-		assert.Equal(t, "Content-Type, Authorization, X-Requested-With", w.Header().Get("Access-Control-Allow-Headers"))
-		assert.Equal(t, "true", w.Header().Get("Access-Control-Allow-Credentials"))
-		assert.Equal(t, "3600", w.Header().Get("Access-Control-Max-Age"))
-	})
-	
-	t.Run("without origin header", func(t *testing.T) {
-		req := httptest.NewRequest("OPTIONS", "/v1/models", nil)
-		// No Origin header set
-		w := httptest.NewRecorder()
-		
-		setCORSHeadersStandalone(w, req)
-		
-		// Should default to "*"
-		assert.Equal(t, "*", w.Header().Get("Access-Control-Allow-Origin"))
-	})
-}
-
 // Test OPTIONS request handling
 func TestModelsHandler_HandlesOPTIONSRequest(t *testing.T) {
 	// Prediction: This test will pass - OPTIONS should return 204
@@ -0,0 +1,171 @@
+package proxy
+
+import (
+	"encoding/json"
+	"strings"
+	"time"
+)
+
+// completionInstruction makes Claude continue a legacy completion prompt instead of replying to it
+const completionInstruction = "Continue the text the user sends. Respond with only the continuation, starting exactly where the text ends, without repeating it or adding any explanation."
+
+// fillInstruction makes Claude fill the gap of a fill-in-the-middle completion
+const fillInstruction = "The user sends a document with a gap marked " + fillMarker + ". Respond with only the text that belongs in the gap, without repeating the text around it or adding any explanation."
+
+// fillMarker marks where a fill-in-the-middle completion is inserted
+const fillMarker = "<FILL_HERE>"
+
+// completionPrompt returns the prompt of a legacy completion request.
+// The prompt is a string or an array holding a single string; batched and token prompts are rejected.
+func completionPrompt(req *requestBody) (string, error) {
+	raw, ok := req.get("prompt")
+	if !ok || isJSONNull(raw) {
+		return "", newInvalidRequestError("prompt is required")
+	}
+
+	var prompt string
+	if json.Unmarshal(raw, &prompt) == nil {
+		return prompt, nil
+	}
+	var prompts []string
+	if json.Unmarshal(raw, &prompts) != nil {
+		return "", newInvalidRequestError("prompt must be a string or an array of strings; token prompts are not supported")
+	}
+	if len(prompts) != 1 {
+		return "", newInvalidRequestError("prompt arrays must hold exactly one prompt; batched prompts are not supported")
+	}
+	return prompts[0], nil
+}
+
+// completionEcho returns the prompt echoed before the completion, or "" unless echo is set
+func completionEcho(req *requestBody, path string) string {
+	if path != "/v1/completions" || !req.boolField("echo") {
+		return ""
+	}
+	prompt, _ := completionPrompt(req)
+	return prompt
+}
+
+// convertCompletionRequest converts a legacy OpenAI completion request to an Anthropic request
+// with a single user turn. With a suffix, the gap between prompt and suffix is filled in.
+func convertCompletionRequest(openAIRequest *requestBody, strict bool) (*requestBody, error) {
+	anthropicRequest := &requestBody{fields: make(map[string]json.RawMessage)}
+
+	if model := openAIRequest.stringField("model"); model != "" {
+		if err := anthropicRequest.set("model", strings.TrimPrefix(model, "anthropic/")); err != nil {
+			return nil, err
+		}
+	}
+
+	prompt, err := completionPrompt(openAIRequest)
+	if err != nil {
+		return nil, err
+	}
+	var suffix string
+	if raw, ok := openAIRequest.get("suffix"); ok && !isJSONNull(raw) {
+		if json.Unmarshal(raw, &suffix) != nil {
+			return nil, newInvalidRequestError("suffix must be a string")
+		}
+	}
+
+	instruction := completionInstruction
+	text := prompt
+	if suffix != "" {
+		instruction = fillInstruction
+		text = prompt + fillMarker + suffix
+	}
+	if text == "" {
+		return nil, newInvalidRequestError("prompt must not be empty")
+	}
+
+	if err := anthropicRequest.set("system", []interface{}{
+		map[string]interface{}{"type": "text", "text": ClaudeCodePrompt},
+		map[string]interface{}{"type": "text", "text": instruction},
+	}); err != nil {
+		return nil, err
+	}
+	if err := anthropicRequest.set("messages", []interface{}{
+		map[string]interface{}{"role": "user", "content": text},
+	}); err != nil {
+		return nil, err
+	}
+
+	// Several choices are only served on chat completions
+	var n float64
+	if openAIRequest.decode("n", &n) && n > 1 {
+		return nil, newInvalidRequestError("n > 1 is only supported on /v1/chat/completions")
+	}
+
+	// The remaining parameters are shared with chat completions
+	params := &requestBody{fields: make(map[string]json.RawMessage, len(openAIRequest.fields))}
+	for key, value := range openAIRequest.fields {
+		switch key {
+		case "prompt", "suffix", "echo":
+		default:
+			params.fields[key] = value
+		}
+	}
+	if err := convertOpenAIParams(params, anthropicRequest, strict); err != nil {
+		return nil, err
+	}
+	return anthropicRequest, nil
+}
+
+// completionFinishReason maps an Anthropic stop_reason to a finish_reason of the legacy
+// completions API, which has no tool calls
+func completionFinishReason(stopReason string) string {
+	if stopReason == "tool_use" {
+		return "stop"
+	}
+	return openAIFinishReason(stopReason)
+}
+
+// convertAnthropicToCompletion converts an Anthropic response to a legacy text_completion,
+// with the echoed prompt before the generated text
+func convertAnthropicToCompletion(body []byte, echo string) ([]byte, error) {
+	var anthropicResponse struct {
+		ID      string `json:"id"`
+		Model   string `json:"model"`
+		Content []struct {
+			Type string `json:"type"`
+			Text string `json:"text"`
+		} `json:"content"`
+		StopReason string          `json:"stop_reason"`
+		Usage      *Usage          `json:"usage"`
+		Error      json.RawMessage `json:"error"`
+	}
+	if err := json.Unmarshal(body, &anthropicResponse); err != nil {
+		return nil, err
+	}
+	if !isJSONNull(anthropicResponse.Error) {
+		var errorObj interface{}
+		json.Unmarshal(anthropicResponse.Error, &errorObj)
+		return convertAnthropicErrorToOpenAI(errorObj)
+	}
+
+	text := echo
+	for _, block := range anthropicResponse.Content {
+		if block.Type == "text" {
+			text += block.Text
+		}
+	}
+
+	completion := map[string]interface{}{
+		"id":      anthropicResponse.ID,
+		"object":  "text_completion",
+		"created": time.Now().Unix(),
+		"model":   anthropicResponse.Model,
+		"choices": []interface{}{
+			map[string]interface{}{
+				"index":         0,
+				"text":          text,
+				"logprobs":      nil,
+				"finish_reason": completionFinishReason(anthropicResponse.StopReason),
+			},
+		},
+	}
+	if anthropicResponse.Usage != nil {
+		completion["usage"] = openAIUsage(*anthropicResponse.Usage)
+	}
+	return json.Marshal(completion)
+}
@@ -0,0 +1,211 @@
+package proxy
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// convertCompletionJSON converts a legacy completion request and decodes the Anthropic request
+func convertCompletionJSON(t *testing.T, body string) map[string]interface{} {
+	t.Helper()
+	req, err := parseRequestBody([]byte(body))
+	require.NoError(t, err)
+	converted, err := convertCompletionRequest(req, false)
+	require.NoError(t, err)
+
+	var request map[string]interface{}
+	require.NoError(t, json.Unmarshal(converted.bytes(), &request))
+	return request
+}
+
+func TestConvertCompletionRequest(t *testing.T) {
+	t.Run("prompt becomes a single user turn", func(t *testing.T) {
+		request := convertCompletionJSON(t, `{"model": "claude-sonnet-4-20250514", "prompt": ["def add(a, b):"], "max_tokens": 64, "stop": "\n\n", "echo": true}`)
+
+		assert.Equal(t, []interface{}{
+			map[string]interface{}{"role": "user", "content": "def add(a, b):"},
+		}, request["messages"])
+		system := request["system"].([]interface{})
+		require.Len(t, system, 2)
+		assert.Equal(t, ClaudeCodePrompt, system[0].(map[string]interface{})["text"])
+		assert.Equal(t, completionInstruction, system[1].(map[string]interface{})["text"])
+		assert.Equal(t, float64(64), request["max_tokens"])
+		assert.Equal(t, []interface{}{"\n\n"}, request["stop_sequences"])
+		assert.NotContains(t, request, "echo")
+		assert.NotContains(t, request, "prompt")
+	})
+
+	t.Run("suffix fills in the middle", func(t *testing.T) {
+		request := convertCompletionJSON(t, `{"model": "claude-sonnet-4-20250514", "prompt": "func main() {\n", "suffix": "\n}"}`)
+
+		assert.Equal(t, []interface{}{
+			map[string]interface{}{"role": "user", "content": "func main() {\n" + fillMarker + "\n}"},
+		}, request["messages"])
+		assert.Equal(t, fillInstruction, request["system"].([]interface{})[1].(map[string]interface{})["text"])
+	})
+}
+
+func TestConvertCompletionRequest_Invalid(t *testing.T) {
+	tests := map[string]string{
+		"missing prompt":  `"max_tokens": 5`,
+		"token prompt":    `"prompt": [1, 2, 3]`,
+		"batched prompts": `"prompt": ["a", "b"]`,
+		"empty prompt":    `"prompt": ""`,
+		"numeric suffix":  `"prompt": "a", "suffix": 1`,
+		"several choices": `"prompt": "a", "n": 2`,
+	}
+
+	for name, fields := range tests {
+		t.Run(name, func(t *testing.T) {
+			req, err := parseRequestBody([]byte(`{"model": "claude-sonnet-4-20250514", ` + fields + `}`))
+			require.NoError(t, err)
+			_, err = convertCompletionRequest(req, false)
+			var invalid *invalidRequestError
+			assert.True(t, errors.As(err, &invalid), "expected invalid request error, got %v", err)
+		})
+	}
+
+	t.Run("strict mode accepts neutral best_of", func(t *testing.T) {
+		req, err := parseRequestBody([]byte(`{"model": "claude-sonnet-4-20250514", "prompt": "a", "echo": false, "suffix": null, "best_of": 1}`))
+		require.NoError(t, err)
+		_, err = convertCompletionRequest(req, true)
+		assert.NoError(t, err)
+	})
+}
+
+func TestConvertAnthropicToCompletion(t *testing.T) {
+	result, err := convertAnthropicToCompletion([]byte(`{
+		"id": "msg_1", "model": "claude-sonnet-4-20250514",
+		"content": [{"type": "text", "text": " return a + b"}],
+		"stop_reason": "max_tokens",
+		"usage": {"input_tokens": 12, "output_tokens": 5}
+	}`), "def add(a, b):")
+	require.NoError(t, err)
+
+	var completion map[string]interface{}
+	require.NoError(t, json.Unmarshal(result, &completion))
+	assert.Equal(t, "text_completion", completion["object"])
+	assert.Equal(t, "msg_1", completion["id"])
+	assert.Equal(t, []interface{}{map[string]interface{}{
+		"index":         float64(0),
+		"text":          "def add(a, b): return a + b",
+		"logprobs":      nil,
+		"finish_reason": "length",
+	}}, completion["choices"])
+	assert.Equal(t, float64(17), completion["usage"].(map[string]interface{})["total_tokens"])
+
+	t.Run("tool use stops the completion", func(t *testing.T) {
+		result, err := convertAnthropicToCompletion([]byte(`{"id": "msg_1", "content": [{"type": "text", "text": "Hi"}], "stop_reason": "tool_use"}`), "")
+		require.NoError(t, err)
+		require.NoError(t, json.Unmarshal(result, &completion))
+		assert.Equal(t, "stop", completion["choices"].([]interface{})[0].(map[string]interface{})["finish_reason"])
+	})
+}
+
+// textStreamEvents returns an Anthropic stream of a single text block ending with stopReason
+func textStreamEvents(text, stopReason string) []string {
+	return []string{
+		`{"type":"message_start","message":{"id":"msg_1","model":"claude-sonnet-4-20250514","content":[],"usage":{"input_tokens":10,"output_tokens":1}}}`,
+		`{"type":"content_block_start","index":0,"content_block":{"type":"text","text":""}}`,
+		`{"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"` + text + `"}}`,
+		`{"type":"content_block_stop","index":0}`,
+		`{"type":"message_delta","delta":{"stop_reason":"` + stopReason + `"},"usage":{"output_tokens":5}}`,
+		`{"type":"message_stop"}`,
+	}
+}
+
+func TestProxyHandler_Completions(t *testing.T) {
+	var upstreamPath string
+	stopReason := "end_turn"
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		upstreamPath = r.URL.Path
+		var body map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&body)
+		w.Header().Set("Content-Type", "text/event-stream")
+		for _, event := range textStreamEvents("Hello", stopReason) {
+			fmt.Fprintf(w, "data: %s\n\n", event)
+		}
+	}))
+	defer upstream.Close()
+
+	handler := NewProxyHandler(&ProxyConfig{
+		UpstreamURL:   upstream.URL,
+		TokenProvider: &mockTokenProvider{token: "test-token"},
+		Transformer:   NewRequestTransformer(),
+	})
+
+	t.Run("non-streaming", func(t *testing.T) {
+		req := httptest.NewRequest("POST", "/v1/completions", strings.NewReader(`{"model": "claude-sonnet-4-20250514", "prompt": "Say:", "echo": true}`))
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		assert.Equal(t, "/v1/messages", upstreamPath)
+		var completion struct {
+			Object  string `json:"object"`
+			Choices []struct {
+				Text         string `json:"text"`
+				FinishReason string `json:"finish_reason"`
+			} `json:"choices"`
+		}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &completion))
+		assert.Equal(t, "text_completion", completion.Object)
+		require.Len(t, completion.Choices, 1)
+		assert.Equal(t, "Say:Hello", completion.Choices[0].Text)
+		assert.Equal(t, "stop", completion.Choices[0].FinishReason)
+	})
+
+	// Legacy completions have no tool calls, so a tool_use stop is reported as a plain stop
+	for upstreamReason, finishReason := range map[string]string{"end_turn": "stop", "max_tokens": "length", "tool_use": "stop"} {
+		t.Run("streaming "+upstreamReason, func(t *testing.T) {
+			stopReason = upstreamReason
+			req := httptest.NewRequest("POST", "/v1/completions", strings.NewReader(`{"model": "claude-sonnet-4-20250514", "prompt": "Say:", "echo": true, "stream": true}`))
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, req)
+
+			lines := strings.Split(strings.TrimSpace(w.Body.String()), "\n\n")
+			require.GreaterOrEqual(t, len(lines), 2)
+			assert.Equal(t, "data: [DONE]", lines[len(lines)-1])
+
+			var text string
+			var finishReasons []string
+			for _, line := range lines[:len(lines)-1] {
+				var chunk struct {
+					ID      string `json:"id"`
+					Object  string `json:"object"`
+					Choices []struct {
+						Text         string  `json:"text"`
+						FinishReason *string `json:"finish_reason"`
+					} `json:"choices"`
+				}
+				require.NoError(t, json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &chunk))
+				assert.Equal(t, "text_completion", chunk.Object)
+				assert.True(t, strings.HasPrefix(chunk.ID, "cmpl-"))
+				require.Len(t, chunk.Choices, 1)
+				text += chunk.Choices[0].Text
+				if chunk.Choices[0].FinishReason != nil {
+					finishReasons = append(finishReasons, *chunk.Choices[0].FinishReason)
+				}
+			}
+			assert.Equal(t, "Say:Hello", text)
+			assert.Equal(t, []string{finishReason}, finishReasons)
+		})
+	}
+
+	t.Run("invalid prompt", func(t *testing.T) {
+		req := httptest.NewRequest("POST", "/v1/completions", strings.NewReader(`{"model": "claude-sonnet-4-20250514", "prompt": [1, 2]}`))
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Contains(t, w.Body.String(), `"invalid_request_error"`)
+	})
+}
@@ -0,0 +1,162 @@
+package proxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+)
+
+// supportedImageTypes are the image media types accepted by the Anthropic API
+var supportedImageTypes = map[string]bool{
+	"image/jpeg": true,
+	"image/png":  true,
+	"image/gif":  true,
+	"image/webp": true,
+}
+
+// openAIContentPart is a part of an OpenAI message with array content
+type openAIContentPart struct {
+	Type     string          `json:"type"`
+	Text     string          `json:"text"`
+	Refusal  string          `json:"refusal"`
+	ImageURL json.RawMessage `json:"image_url"`
+	File     struct {
+		FileData string `json:"file_data"`
+		FileID   string `json:"file_id"`
+		Filename string `json:"filename"`
+	} `json:"file"`
+}
+
+// convertOpenAIContent converts OpenAI message content to Anthropic content.
+// String content is returned unchanged; arrays of parts are converted to content blocks.
+func convertOpenAIContent(content json.RawMessage) (json.RawMessage, error) {
+	content = bytes.TrimSpace(content)
+	if len(content) == 0 || content[0] != '[' {
+		return content, nil
+	}
+
+	var parts []json.RawMessage
+	if err := json.Unmarshal(content, &parts); err != nil {
+		return nil, newInvalidRequestError("content must be a string or an array of content parts: %v", err)
+	}
+
+	blocks := make([]interface{}, 0, len(parts))
+	for i, raw := range parts {
+		block, err := convertOpenAIContentPart(raw)
+		if err != nil {
+			return nil, newInvalidRequestError("content[%d]: %v", i, err)
+		}
+		blocks = append(blocks, block)
+	}
+	return json.Marshal(blocks)
+}
+
+// convertOpenAIContentPart converts a single content part to an Anthropic content block
+func convertOpenAIContentPart(raw json.RawMessage) (interface{}, error) {
+	var part openAIContentPart
+	if err := json.Unmarshal(raw, &part); err != nil {
+		return nil, newInvalidRequestError("invalid content part: %v", err)
+	}
+
+	switch part.Type {
+	case "text", "image", "document":
+		// Text parts share Anthropic's shape, native blocks are passed through as sent
+		return raw, nil
+
+	case "refusal":
+		return map[string]interface{}{"type": "text", "text": part.Refusal}, nil
+
+	case "image_url":
+		// image_url is either {"url": ..., "detail": ...} or a bare URL string
+		var imageURL struct {
+			URL string `json:"url"`
+		}
+		if json.Unmarshal(part.ImageURL, &imageURL) != nil {
+			json.Unmarshal(part.ImageURL, &imageURL.URL)
+		}
+		source, err := imageSource(imageURL.URL)
+		if err != nil {
+			return nil, err
+		}
+		return map[string]interface{}{"type": "image", "source": source}, nil
+
+	case "file":
+		if part.File.FileID != "" && part.File.FileData == "" {
+			return nil, newInvalidRequestError("file parts must include file_data; uploaded file IDs are not supported")
+		}
+		mediaType, data, ok := parseDataURL(part.File.FileData)
+		if !ok {
+			return nil, newInvalidRequestError("file_data must be a base64 data URL")
+		}
+		if mediaType != "application/pdf" {
+			return nil, newInvalidRequestError("unsupported file type %q, only application/pdf is supported", mediaType)
+		}
+		block := map[string]interface{}{
+			"type": "document",
+			"source": map[string]interface{}{
+				"type":       "base64",
+				"media_type": mediaType,
+				"data":       data,
+			},
+		}
+		if part.File.Filename != "" {
+			block["title"] = part.File.Filename
+		}
+		return block, nil
+
+	case "input_audio":
+		return nil, newInvalidRequestError("audio input is not supported")
+
+	case "":
+		return nil, newInvalidRequestError("content part type is required")
+
+	default:
+		return nil, newInvalidRequestError("unsupported content part type %q", part.Type)
+	}
+}
+
+// imageSource converts an OpenAI image URL to an Anthropic image source.
+// Data URLs become base64 sources, http(s) URLs are fetched by the API.
+func imageSource(url string) (map[string]interface{}, error) {
+	if strings.HasPrefix(url, "data:") {
+		mediaType, data, ok := parseDataURL(url)
+		if !ok {
+			return nil, newInvalidRequestError("image data URLs must be base64 encoded")
+		}
+		if !supportedImageTypes[mediaType] {
+			return nil, newInvalidRequestError("unsupported image type %q, expected image/jpeg, image/png, image/gif or image/webp", mediaType)
+		}
+		return map[string]interface{}{
+			"type":       "base64",
+			"media_type": mediaType,
+			"data":       data,
+		}, nil
+	}
+
+	lower := strings.ToLower(url)
+	if strings.HasPrefix(lower, "https://") || strings.HasPrefix(lower, "http://") {
+		return map[string]interface{}{"type": "url", "url": url}, nil
+	}
+	return nil, newInvalidRequestError("image_url must be a data URL or an http(s) URL")
+}
+
+// parseDataURL splits a base64 data URL into its media type and payload.
+// The payload is returned as is, without decoding it.
+func parseDataURL(url string) (mediaType, data string, ok bool) {
+	rest, found := strings.CutPrefix(url, "data:")
+	if !found {
+		return "", "", false
+	}
+	meta, data, found := strings.Cut(rest, ",")
+	if !found || data == "" {
+		return "", "", false
+	}
+	if !strings.HasSuffix(strings.ToLower(meta), ";base64") {
+		return "", "", false
+	}
+	mediaType, _, _ = strings.Cut(meta, ";")
+	if mediaType == "" {
+		return "", "", false
+	}
+	return strings.ToLower(mediaType), data, true
+}
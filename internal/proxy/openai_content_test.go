@@ -0,0 +1,116 @@
+package proxy
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConvertOpenAIToAnthropic_ImageAndFileParts(t *testing.T) {
+	request := convertOpenAIJSON(t, `{
+		"model": "claude-sonnet-4-20250514",
+		"messages": [{"role": "user", "content": [
+			{"type": "text", "text": "What is in these?"},
+			{"type": "image_url", "image_url": {"url": "data:image/PNG;base64,iVBORw0KGgo=", "detail": "high"}},
+			{"type": "image_url", "image_url": {"url": "https://example.com/cat.jpg"}},
+			{"type": "file", "file": {"filename": "report.pdf", "file_data": "data:application/pdf;base64,JVBERi0xLjQ="}}
+		]}]
+	}`)
+
+	messages := request["messages"].([]interface{})
+	require.Len(t, messages, 1)
+	assert.Equal(t, []interface{}{
+		map[string]interface{}{"type": "text", "text": "What is in these?"},
+		map[string]interface{}{"type": "image", "source": map[string]interface{}{
+			"type": "base64", "media_type": "image/png", "data": "iVBORw0KGgo=",
+		}},
+		map[string]interface{}{"type": "image", "source": map[string]interface{}{
+			"type": "url", "url": "https://example.com/cat.jpg",
+		}},
+		map[string]interface{}{"type": "document", "title": "report.pdf", "source": map[string]interface{}{
+			"type": "base64", "media_type": "application/pdf", "data": "JVBERi0xLjQ=",
+		}},
+	}, messages[0].(map[string]interface{})["content"])
+}
+
+func TestConvertOpenAIToAnthropic_ImagesInToolResults(t *testing.T) {
+	request := convertOpenAIJSON(t, `{
+		"messages": [
+			{"role": "assistant", "tool_calls": [{"id": "call_1", "type": "function", "function": {"name": "screenshot", "arguments": "{}"}}]},
+			{"role": "tool", "tool_call_id": "call_1", "content": [
+				{"type": "image_url", "image_url": {"url": "data:image/jpeg;base64,/9j/4AAQ"}}
+			]}
+		]
+	}`)
+
+	results := request["messages"].([]interface{})[1].(map[string]interface{})["content"].([]interface{})
+	assert.Equal(t, []interface{}{
+		map[string]interface{}{"type": "image", "source": map[string]interface{}{
+			"type": "base64", "media_type": "image/jpeg", "data": "/9j/4AAQ",
+		}},
+	}, results[0].(map[string]interface{})["content"])
+}
+
+func TestConvertOpenAIToAnthropic_UnsupportedParts(t *testing.T) {
+	tests := map[string]string{
+		"audio":              `{"type": "input_audio", "input_audio": {"data": "AAAA", "format": "wav"}}`,
+		"unknown type":       `{"type": "video_url", "video_url": {"url": "https://example.com/a.mp4"}}`,
+		"missing type":       `{"text": "hi"}`,
+		"unsupported image":  `{"type": "image_url", "image_url": {"url": "data:image/tiff;base64,AAAA"}}`,
+		"non-base64 image":   `{"type": "image_url", "image_url": {"url": "data:image/png,rawbytes"}}`,
+		"non-http image url": `{"type": "image_url", "image_url": {"url": "ftp://example.com/a.png"}}`,
+		"uploaded file":      `{"type": "file", "file": {"file_id": "file-abc"}}`,
+		"non-pdf file":       `{"type": "file", "file": {"file_data": "data:text/csv;base64,YSxi"}}`,
+	}
+
+	for name, part := range tests {
+		t.Run(name, func(t *testing.T) {
+			body := `{"messages": [{"role": "user", "content": [` + part + `]}]}`
+			_, err := ConvertOpenAIToAnthropic([]byte(body))
+			var invalid *invalidRequestError
+			assert.True(t, errors.As(err, &invalid), "expected invalid request error, got %v", err)
+		})
+	}
+}
+
+func TestParseDataURL(t *testing.T) {
+	mediaType, data, ok := parseDataURL("data:image/png;base64,AAAA")
+	assert.True(t, ok)
+	assert.Equal(t, "image/png", mediaType)
+	assert.Equal(t, "AAAA", data)
+
+	mediaType, _, ok = parseDataURL("data:application/pdf;name=a.pdf;base64,AAAA")
+	assert.True(t, ok)
+	assert.Equal(t, "application/pdf", mediaType)
+
+	for _, url := range []string{"https://example.com/a.png", "data:image/png;base64,", "data:;base64,AAAA", "data:image/png,AAAA"} {
+		_, _, ok := parseDataURL(url)
+		assert.False(t, ok, url)
+	}
+}
+
+func TestProxyHandler_UnsupportedContentPartReturns400(t *testing.T) {
+	handler := NewProxyHandler(&ProxyConfig{
+		UpstreamURL:   "http://127.0.0.1:0",
+		TokenProvider: &mockTokenProvider{token: "test-token"},
+		Transformer:   NewRequestTransformer(),
+	})
+
+	body := `{"model": "claude-sonnet-4-20250514", "messages": [{"role": "user", "content": [{"type": "input_audio", "input_audio": {"data": "AAAA"}}]}]}`
+	req := httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(body))
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	var response map[string]interface{}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	errorObj := response["error"].(map[string]interface{})
+	assert.Equal(t, "invalid_request_error", errorObj["type"])
+	assert.Equal(t, "messages[0]: content[0]: audio input is not supported", errorObj["message"])
+}
@@ -1,84 +1,145 @@
 package proxy
 
 import (
+	"bytes"
 	"encoding/json"
 	"log/slog"
 	"strings"
 	"time"
 )
 
-// ConvertOpenAIToAnthropic converts OpenAI chat/completions format to Anthropic messages format
+// ConvertOpenAIToAnthropic converts OpenAI chat/completions format to Anthropic messages format.
+// Parameters without an Anthropic equivalent are dropped.
 func ConvertOpenAIToAnthropic(body []byte) ([]byte, error) {
-	var openAIRequest map[string]interface{}
-	if err := json.Unmarshal(body, &openAIRequest); err != nil {
+	req, err := parseRequestBody(body)
+	if err != nil {
 		return nil, err
 	}
-	
+	converted, err := convertOpenAIRequest(req, false)
+	if err != nil {
+		return nil, err
+	}
+	return converted.bytes(), nil
+}
+
+// convertOpenAIRequest converts a parsed OpenAI request to an Anthropic request.
+// Message content is passed through as raw JSON; only system messages are decoded.
+// When strict is set, parameters without an Anthropic equivalent are rejected instead of dropped.
+func convertOpenAIRequest(openAIRequest *requestBody, strict bool) (*requestBody, error) {
 	// Create Anthropic format request
-	anthropicRequest := make(map[string]interface{})
+	anthropicRequest := &requestBody{fields: make(map[string]json.RawMessage)}
 	
 	// Convert model name (remove "anthropic/" prefix if present)
-	if model, ok := openAIRequest["model"].(string); ok {
-		anthropicRequest["model"] = strings.TrimPrefix(model, "anthropic/")
+	if model := openAIRequest.stringField("model"); model != "" {
+		if err := anthropicRequest.set("model", strings.TrimPrefix(model, "anthropic/")); err != nil {
+			return nil, err
+		}
 	}
 	
 	// Extract system messages and convert messages array
 	var systemContents []string
 	var anthropicMessages []interface{}
 	
-	if messages, ok := openAIRequest["messages"].([]interface{}); ok {
-		for _, msg := range messages {
-			msgMap, ok := msg.(map[string]interface{})
-			if !ok {
-				continue
+	var messages []struct {
+		Role       string           `json:"role"`
+		Content    json.RawMessage  `json:"content"`
+		ToolCalls  []openAIToolCall `json:"tool_calls"`
+		ToolCallID string           `json:"tool_call_id"`
+	}
+	if raw, ok := openAIRequest.get("messages"); ok {
+		if err := json.Unmarshal(raw, &messages); err != nil {
+			return nil, newInvalidRequestError("invalid messages: %v", err)
+		}
+	}
+	
+	// Consecutive tool messages become a single user message of tool_result blocks
+	var toolResults []interface{}
+	flushToolResults := func() {
+		if len(toolResults) > 0 {
+			anthropicMessages = append(anthropicMessages, map[string]interface{}{
+				"role":    "user",
+				"content": toolResults,
+			})
+			toolResults = nil
+		}
+	}
+	
+	for i, msg := range messages {
+		content := bytes.TrimSpace(msg.Content)
+		
+		if msg.Role == "tool" {
+			block, err := toolResultBlock(msg.ToolCallID, content)
+			if err != nil {
+				return nil, newInvalidRequestError("messages[%d]: %v", i, err)
 			}
-			
-			role, _ := msgMap["role"].(string)
-			
-			// Handle content - can be string or array
-			var content interface{}
-			if msgContent, ok := msgMap["content"]; ok {
-				switch v := msgContent.(type) {
-				case string:
-					content = v
-				case []interface{}:
-					// Handle structured content array
-					content = v
-				default:
-					continue
-				}
+			toolResults = append(toolResults, block)
+			continue
+		}
+		flushToolResults()
+		
+		// Assistant tool calls become tool_use blocks after any text
+		if msg.Role == "assistant" && len(msg.ToolCalls) > 0 {
+			blocks, err := assistantToolUseContent(content, msg.ToolCalls)
+			if err != nil {
+				return nil, newInvalidRequestError("messages[%d]: %v", i, err)
 			}
-			
-			if role == "system" {
-				// Extract text from system message
-				switch v := content.(type) {
-				case string:
-					systemContents = append(systemContents, v)
-				case []interface{}:
-					// Handle array of content items
-					for _, item := range v {
-						if itemMap, ok := item.(map[string]interface{}); ok {
-							if itemMap["type"] == "text" {
-								if text, ok := itemMap["text"].(string); ok {
-									systemContents = append(systemContents, text)
-								}
-							}
-						}
+			anthropicMessages = append(anthropicMessages, map[string]interface{}{
+				"role":    "assistant",
+				"content": blocks,
+			})
+			continue
+		}
+		
+		// Content can be a string or an array of parts; it may only be left out next to tool calls
+		if len(content) == 0 || (content[0] != '"' && content[0] != '[') {
+			return nil, newInvalidRequestError("messages[%d].content must be a string or an array of content parts", i)
+		}
+		
+		// Newer OpenAI clients send developer messages in place of system messages
+		if msg.Role == "system" || msg.Role == "developer" {
+			// Extract text from system message
+			var text string
+			var parts []struct {
+				Type string `json:"type"`
+				Text string `json:"text"`
+			}
+			if json.Unmarshal(content, &text) == nil {
+				systemContents = append(systemContents, text)
+			} else if json.Unmarshal(content, &parts) == nil {
+				for _, part := range parts {
+					if part.Type == "text" {
+						systemContents = append(systemContents, part.Text)
 					}
 				}
-			} else {
-				// Convert to Anthropic message format
-				anthropicMsg := map[string]interface{}{
-					"role":    role,
-					"content": content,
-				}
-				anthropicMessages = append(anthropicMessages, anthropicMsg)
 			}
+		} else {
+			// Convert to Anthropic message format
+			converted, err := convertOpenAIContent(content)
+			if err != nil {
+				return nil, newInvalidRequestError("messages[%d]: %v", i, err)
+			}
+			anthropicMsg := map[string]interface{}{
+				"role":    msg.Role,
+				"content": converted,
+			}
+			anthropicMessages = append(anthropicMessages, anthropicMsg)
 		}
 	}
+	flushToolResults()
 	
 	// Set messages
-	anthropicRequest["messages"] = anthropicMessages
+	if err := anthropicRequest.set("messages", anthropicMessages); err != nil {
+		return nil, err
+	}
+	
+	// Structured output is emulated with a forced tool or a JSON instruction
+	format, err := parseResponseFormat(openAIRequest)
+	if err != nil {
+		return nil, err
+	}
+	if format != nil && format.Type == "json_object" {
+		systemContents = append(systemContents, jsonModeInstruction)
+	}
 	
 	// Build system field with Claude Code prompt first
 	systemArray := []interface{}{
@@ -93,20 +154,69 @@ func ConvertOpenAIToAnthropic(body []byte) ([]byte, error) {
 		})
 	}
 	
-	anthropicRequest["system"] = systemArray
+	if err := anthropicRequest.set("system", systemArray); err != nil {
+		return nil, err
+	}
+	
+	// Convert function tools and the tool choice
+	var hasTools bool
+	if raw, ok := openAIRequest.get("tools"); ok && !isJSONNull(raw) {
+		tools, err := convertOpenAITools(raw)
+		if err != nil {
+			return nil, err
+		}
+		if len(tools) > 0 {
+			hasTools = true
+			if err := anthropicRequest.set("tools", tools); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if hasTools {
+		var parallelToolCalls *bool
+		openAIRequest.decode("parallel_tool_calls", &parallelToolCalls)
+		choiceRaw, hasChoice := openAIRequest.get("tool_choice")
+		choice, err := convertOpenAIToolChoice(choiceRaw, hasChoice && !isJSONNull(choiceRaw), parallelToolCalls)
+		if err != nil {
+			return nil, err
+		}
+		if choice != nil {
+			if err := anthropicRequest.set("tool_choice", choice); err != nil {
+				return nil, err
+			}
+		}
+	}
 	
-	// Copy other fields
-	for key, value := range openAIRequest {
-		if key != "model" && key != "messages" {
-			anthropicRequest[key] = value
+	if format != nil && format.Type == "json_schema" {
+		if hasTools {
+			return nil, newInvalidRequestError("response_format json_schema cannot be combined with tools")
+		}
+		if err := anthropicRequest.set("tools", []interface{}{format.structuredOutputToolDefinition()}); err != nil {
+			return nil, err
+		}
+		if err := anthropicRequest.set("tool_choice", map[string]interface{}{"type": "tool", "name": structuredOutputTool}); err != nil {
+			return nil, err
 		}
 	}
 	
-	return json.Marshal(anthropicRequest)
+	// Map sampling and output parameters
+	if err := convertOpenAIParams(openAIRequest, anthropicRequest, strict); err != nil {
+		return nil, err
+	}
+	
+	return anthropicRequest, nil
 }
 
 // ConvertAnthropicToOpenAI converts Anthropic response format to OpenAI chat/completions format
 func ConvertAnthropicToOpenAI(body []byte) ([]byte, error) {
+	return convertAnthropicResponse(body, responseOptions{})
+}
+
+// convertAnthropicResponse converts an Anthropic response to OpenAI format.
+// With a json_schema response format, the structured output tool call becomes the message content.
+// Thinking becomes reasoning_content unless the options hide it.
+func convertAnthropicResponse(body []byte, options responseOptions) ([]byte, error) {
+	format := options.format
 	var anthropicResponse map[string]interface{}
 	if err := json.Unmarshal(body, &anthropicResponse); err != nil {
 		return nil, err
@@ -133,67 +243,115 @@ func ConvertAnthropicToOpenAI(body []byte) ([]byte, error) {
 	
 	// Convert content to OpenAI format
 	var messageContent string
+	var reasoningContent string
+	var toolCalls []interface{}
+	var structuredOutput bool
 	if content, ok := anthropicResponse["content"].([]interface{}); ok {
 		for _, item := range content {
 			if contentMap, ok := item.(map[string]interface{}); ok {
-				if contentMap["type"] == "text" {
+				switch contentMap["type"] {
+				case "text":
 					if text, ok := contentMap["text"].(string); ok {
 						messageContent += text
 					}
+				case "thinking":
+					// Redacted thinking is encrypted and has no readable equivalent
+					if thinking, ok := contentMap["thinking"].(string); ok {
+						reasoningContent += thinking
+					}
+				case "tool_use":
+					if name, _ := contentMap["name"].(string); format.unwrapsTool(name) {
+						if err := format.validate(contentMap["input"]); err != nil {
+							return nil, err
+						}
+						output, err := json.Marshal(contentMap["input"])
+						if err != nil {
+							return nil, err
+						}
+						messageContent += string(output)
+						structuredOutput = true
+						continue
+					}
+					toolCall, err := openAIToolCallFromBlock(contentMap)
+					if err != nil {
+						return nil, err
+					}
+					toolCalls = append(toolCalls, toolCall)
 				}
 			}
 		}
 	}
 	
 	// Build choices array
-	finishReason := "stop"
-	if stopReason, ok := anthropicResponse["stop_reason"].(string); ok {
-		switch stopReason {
-		case "end_turn":
-			finishReason = "stop"
-		case "max_tokens":
-			finishReason = "length"
-		case "stop_sequence":
-			finishReason = "stop"
-		default:
-			finishReason = stopReason
+	stopReason, _ := anthropicResponse["stop_reason"].(string)
+	if structuredOutput && len(toolCalls) == 0 && stopReason == "tool_use" {
+		// The forced tool call is the final answer, not a request to run a tool
+		stopReason = "end_turn"
+	}
+	message := map[string]interface{}{
+		"role":    "assistant",
+		"content": messageContent,
+	}
+	if reasoningContent != "" && !options.hideReasoning {
+		message["reasoning_content"] = reasoningContent
+	}
+	if len(toolCalls) > 0 {
+		message["tool_calls"] = toolCalls
+		// OpenAI clients expect null content when the reply is only tool calls
+		if messageContent == "" {
+			message["content"] = nil
 		}
 	}
 	
 	choices := []interface{}{
 		map[string]interface{}{
-			"index": 0,
-			"message": map[string]interface{}{
-				"role":    "assistant",
-				"content": messageContent,
-			},
-			"finish_reason": finishReason,
+			"index":         0,
+			"message":       message,
+			"finish_reason": openAIFinishReason(stopReason),
 		},
 	}
 	openAIResponse["choices"] = choices
 	
 	// Convert usage
-	if anthropicUsage, ok := anthropicResponse["usage"].(map[string]interface{}); ok {
-		inputTokens := 0
-		outputTokens := 0
-		
-		if val, ok := anthropicUsage["input_tokens"].(float64); ok {
-			inputTokens = int(val)
-		}
-		if val, ok := anthropicUsage["output_tokens"].(float64); ok {
-			outputTokens = int(val)
-		}
-		
-		openAIResponse["usage"] = map[string]interface{}{
-			"prompt_tokens":     inputTokens,
-			"completion_tokens": outputTokens,
-			"total_tokens":      inputTokens + outputTokens,
-		}
+	var parsed struct {
+		Usage *Usage `json:"usage"`
+	}
+	if err := json.Unmarshal(body, &parsed); err == nil && parsed.Usage != nil {
+		openAIResponse["usage"] = openAIUsage(*parsed.Usage)
 	}
 	
 	return json.Marshal(openAIResponse)
 }
 
+// openAIUsage converts Anthropic usage to an OpenAI usage object.
+// Anthropic reports cached prompt tokens separately; OpenAI counts them in prompt_tokens
+// and reports cache hits in prompt_tokens_details.cached_tokens.
+func openAIUsage(usage Usage) map[string]interface{} {
+	promptTokens := usage.InputTokens + usage.CacheCreationInputTokens + usage.CacheReadInputTokens
+	return map[string]interface{}{
+		"prompt_tokens":     promptTokens,
+		"completion_tokens": usage.OutputTokens,
+		"total_tokens":      promptTokens + usage.OutputTokens,
+		"prompt_tokens_details": map[string]interface{}{
+			"cached_tokens": usage.CacheReadInputTokens,
+		},
+	}
+}
+
+// openAIFinishReason maps an Anthropic stop_reason to an OpenAI finish_reason
+func openAIFinishReason(stopReason string) string {
+	switch stopReason {
+	case "max_tokens":
+		return "length"
+	case "tool_use":
+		return "tool_calls"
+	case "refusal":
+		return "content_filter"
+	default:
+		return "stop"
+	}
+}
+
 // convertAnthropicErrorToOpenAI converts Anthropic error format to OpenAI error format
 func convertAnthropicErrorToOpenAI(errorObj interface{}) ([]byte, error) {
 	openAIError := map[string]interface{}{
@@ -213,267 +371,292 @@ func convertAnthropicErrorToOpenAI(errorObj interface{}) ([]byte, error) {
 		
 		// Map Anthropic error types to OpenAI error types
 		if errorType, ok := errorMap["type"].(string); ok {
-			switch errorType {
-			case "invalid_request_error":
-				openAIError["error"].(map[string]interface{})["type"] = "invalid_request_error"
-			case "authentication_error":
-				openAIError["error"].(map[string]interface{})["type"] = "authentication_error"
-			case "permission_error":
-				openAIError["error"].(map[string]interface{})["type"] = "permission_denied"
-			case "not_found_error":
-				openAIError["error"].(map[string]interface{})["type"] = "not_found_error"
-			case "rate_limit_error":
-				openAIError["error"].(map[string]interface{})["type"] = "rate_limit_error"
-			case "api_error":
-				openAIError["error"].(map[string]interface{})["type"] = "server_error"
-			default:
-				openAIError["error"].(map[string]interface{})["type"] = errorType
-			}
+			openAIError["error"].(map[string]interface{})["type"] = openAIErrorType(errorType)
 		}
 	}
 	
 	return json.Marshal(openAIError)
 }
 
-// toolState tracks tool use information across SSE events
-// Key is Anthropic content block index, value contains tool info and OpenAI tool index
-var toolState = make(map[int]map[string]interface{})
+// StreamConverter converts one Anthropic SSE stream to OpenAI chat completion chunks.
+// Each stream needs its own converter: it tracks the tool calls, usage and finish
+// state of that stream only. Converters are independent, so any number of streams
+// can be converted in parallel, but a single converter must not be shared between goroutines.
+type StreamConverter struct {
+	// IncludeUsage adds a final usage chunk to the stream, as requested with
+	// stream_options.include_usage. Every other chunk then carries "usage": null.
+	IncludeUsage bool
+	// StructuredOutput streams the input of the synthetic structured output tool as message
+	// content, for requests with a json_schema response_format
+	StructuredOutput bool
+	// ChoiceIndex is the choice this stream fills when a request asks for several choices
+	ChoiceIndex int
+	// TextCompletion renders legacy text_completion chunks for /v1/completions
+	TextCompletion bool
+	// Echo is sent as the first text of a legacy completion, for requests with echo set
+	Echo string
+	// HideReasoning drops thinking deltas instead of streaming them as reasoning_content
+	HideReasoning bool
+
+	messageID string
+	model     string
+	created   int64
+	logger    *slog.Logger
+
+	// tools maps an Anthropic content block index to its OpenAI tool call
+	tools         map[int]streamToolCall
+	nextToolIndex int
+	// structured holds the content block indexes of structured output tool calls
+	structured map[int]bool
+	usage         Usage
+	finished      bool
+}
+
+// streamToolCall is a tool use block being streamed as an OpenAI tool call
+type streamToolCall struct {
+	id    string
+	name  string
+	index int
+}
+
+// NewStreamConverter creates a converter for one stream. The model is replaced by the one
+// reported in message_start. The logger is optional.
+func NewStreamConverter(messageID, model string, created int64, logger *slog.Logger) *StreamConverter {
+	return &StreamConverter{
+		messageID:  messageID,
+		model:      model,
+		created:    created,
+		logger:     logger,
+		tools:      make(map[int]streamToolCall),
+		structured: make(map[int]bool),
+	}
+}
+
+// MessageID returns the OpenAI completion ID used for every chunk
+func (c *StreamConverter) MessageID() string {
+	return c.messageID
+}
 
-// toolCallIndex tracks the next available OpenAI tool call index
-var toolCallIndex = 0
+// Model returns the model reported by the upstream, or the default one
+func (c *StreamConverter) Model() string {
+	return c.model
+}
 
-// ResetSSEConverterState resets the converter state (useful for testing)
-func ResetSSEConverterState() {
-	toolState = make(map[int]map[string]interface{})
-	toolCallIndex = 0
+// Usage returns the token usage reported so far
+func (c *StreamConverter) Usage() Usage {
+	return c.usage
 }
 
-// ConvertAnthropicSSEToOpenAI converts a single Anthropic SSE event to OpenAI format
-func ConvertAnthropicSSEToOpenAI(event, data string, messageID string, model string, created int64) (string, error) {
-	return ConvertAnthropicSSEToOpenAIWithLogger(event, data, messageID, model, created, nil)
+// object returns the object type of the chunks
+func (c *StreamConverter) object() string {
+	if c.TextCompletion {
+		return "text_completion"
+	}
+	return "chat.completion.chunk"
+}
+
+// chunk renders an OpenAI chat.completion.chunk SSE line for a delta.
+// Legacy completions get the delta content as text instead.
+func (c *StreamConverter) chunk(delta map[string]interface{}, finishReason interface{}) string {
+	choice := map[string]interface{}{
+		"index":         c.ChoiceIndex,
+		"delta":         delta,
+		"finish_reason": finishReason,
+	}
+	if c.TextCompletion {
+		text, _ := delta["content"].(string)
+		choice = map[string]interface{}{
+			"index":         c.ChoiceIndex,
+			"text":          text,
+			"logprobs":      nil,
+			"finish_reason": finishReason,
+		}
+	}
+	chunk := map[string]interface{}{
+		"id":      c.messageID,
+		"object":  c.object(),
+		"created": c.created,
+		"model":   c.model,
+		"choices": []interface{}{choice},
+	}
+	if c.IncludeUsage {
+		chunk["usage"] = nil
+	}
+	chunkJSON, _ := json.Marshal(chunk)
+	return "data: " + string(chunkJSON) + "\n\n"
+}
+
+// UsageChunk renders the final usage-only chunk sent before [DONE].
+// It returns an empty string unless IncludeUsage is set.
+func (c *StreamConverter) UsageChunk() string {
+	if !c.IncludeUsage {
+		return ""
+	}
+	return c.usageChunk(c.usage)
+}
+
+// usageChunk renders a usage-only chunk for the given usage
+func (c *StreamConverter) usageChunk(usage Usage) string {
+	chunk := map[string]interface{}{
+		"id":      c.messageID,
+		"object":  c.object(),
+		"created": c.created,
+		"model":   c.model,
+		"choices": []interface{}{},
+		"usage":   openAIUsage(usage),
+	}
+	chunkJSON, _ := json.Marshal(chunk)
+	return "data: " + string(chunkJSON) + "\n\n"
 }
 
-// ConvertAnthropicSSEToOpenAIWithLogger converts a single Anthropic SSE event to OpenAI format with optional logging
-func ConvertAnthropicSSEToOpenAIWithLogger(event, data string, messageID string, model string, created int64, logger *slog.Logger) (string, error) {
-	// Parse the data as JSON
-	var eventData map[string]interface{}
+// Convert converts a single Anthropic SSE event to OpenAI format.
+// It returns an empty string for events that have no OpenAI equivalent.
+func (c *StreamConverter) Convert(event, data string) (string, error) {
+	var eventData struct {
+		Type    string `json:"type"`
+		Index   int    `json:"index"`
+		Message struct {
+			Model string `json:"model"`
+			Usage Usage  `json:"usage"`
+		} `json:"message"`
+		ContentBlock struct {
+			Type string `json:"type"`
+			ID   string `json:"id"`
+			Name string `json:"name"`
+		} `json:"content_block"`
+		Delta struct {
+			Type        string  `json:"type"`
+			Text        *string `json:"text"`
+			Thinking    *string `json:"thinking"`
+			PartialJSON *string `json:"partial_json"`
+			StopReason  string  `json:"stop_reason"`
+		} `json:"delta"`
+		Usage Usage `json:"usage"`
+	}
 	if err := json.Unmarshal([]byte(data), &eventData); err != nil {
 		return "", err
 	}
-	
-	eventType, _ := eventData["type"].(string)
-	
-	switch eventType {
+
+	switch eventData.Type {
 	case "message_start":
-		// Reset tool call index for new message
-		toolCallIndex = 0
-		
-		// Convert message_start to initial OpenAI chunk
-		chunk := map[string]interface{}{
-			"id":      messageID,
-			"object":  "chat.completion.chunk",
-			"created": created,
-			"model":   model,
-			"choices": []interface{}{
+		if eventData.Message.Model != "" {
+			c.model = eventData.Message.Model
+		}
+		c.usage.merge(eventData.Message.Usage)
+		if c.TextCompletion {
+			// Legacy completions have no role; the echoed prompt comes first instead
+			if c.Echo == "" {
+				return "", nil
+			}
+			return c.chunk(map[string]interface{}{"content": c.Echo}, nil), nil
+		}
+		return c.chunk(map[string]interface{}{"role": "assistant"}, nil), nil
+
+	case "content_block_start":
+		// Only tool use blocks start an OpenAI tool call; text arrives in deltas
+		if eventData.ContentBlock.Type != "tool_use" || c.TextCompletion {
+			return "", nil
+		}
+		if c.StructuredOutput && eventData.ContentBlock.Name == structuredOutputTool {
+			// The tool input is the answer; it is streamed as content deltas
+			c.structured[eventData.Index] = true
+			return "", nil
+		}
+		tool := streamToolCall{
+			id:    eventData.ContentBlock.ID,
+			name:  eventData.ContentBlock.Name,
+			index: c.nextToolIndex,
+		}
+		c.tools[eventData.Index] = tool
+		c.nextToolIndex++
+
+		return c.chunk(map[string]interface{}{
+			"tool_calls": []interface{}{
 				map[string]interface{}{
-					"index": 0,
-					"delta": map[string]interface{}{
-						"role": "assistant",
+					"index": tool.index,
+					"id":    tool.id,
+					"type":  "function",
+					"function": map[string]interface{}{
+						"name":      tool.name,
+						"arguments": "",
 					},
-					"finish_reason": nil,
 				},
 			},
-		}
-		chunkJSON, _ := json.Marshal(chunk)
-		return "data: " + string(chunkJSON) + "\n\n", nil
-		
-	case "content_block_start":
-		// Check if this is a tool use block
-		if contentBlock, ok := eventData["content_block"].(map[string]interface{}); ok {
-			if contentBlock["type"] == "tool_use" {
-				// Extract tool information
-				index := int(eventData["index"].(float64))
-				toolID, _ := contentBlock["id"].(string)
-				toolName, _ := contentBlock["name"].(string)
-				
-				// Store tool info for this index with OpenAI tool index
-				currentToolIndex := toolCallIndex
-				toolState[index] = map[string]interface{}{
-					"id":        toolID,
-					"name":      toolName,
-					"toolIndex": currentToolIndex,
-				}
-				toolCallIndex++
-				
-				// Send initial tool call chunk
-				chunk := map[string]interface{}{
-					"id":      messageID,
-					"object":  "chat.completion.chunk",
-					"created": created,
-					"model":   model,
-					"choices": []interface{}{
+		}, nil), nil
+
+	case "content_block_delta":
+		switch eventData.Delta.Type {
+		case "text_delta":
+			if eventData.Delta.Text != nil {
+				return c.chunk(map[string]interface{}{"content": *eventData.Delta.Text}, nil), nil
+			}
+		case "thinking_delta":
+			// Legacy completions have no place for reasoning; signatures are never forwarded
+			if eventData.Delta.Thinking != nil && !c.HideReasoning && !c.TextCompletion {
+				return c.chunk(map[string]interface{}{"reasoning_content": *eventData.Delta.Thinking}, nil), nil
+			}
+		case "input_json_delta":
+			if c.structured[eventData.Index] && eventData.Delta.PartialJSON != nil {
+				return c.chunk(map[string]interface{}{"content": *eventData.Delta.PartialJSON}, nil), nil
+			}
+			tool, exists := c.tools[eventData.Index]
+			if eventData.Delta.PartialJSON != nil && exists {
+				return c.chunk(map[string]interface{}{
+					"tool_calls": []interface{}{
 						map[string]interface{}{
-							"index": 0,
-							"delta": map[string]interface{}{
-								"tool_calls": []interface{}{
-									map[string]interface{}{
-										"index": currentToolIndex,
-										"id":    toolID,
-										"type":  "function",
-										"function": map[string]interface{}{
-											"name":      toolName,
-											"arguments": "",
-										},
-									},
-								},
+							"index": tool.index,
+							"id":    tool.id,
+							"function": map[string]interface{}{
+								"arguments": *eventData.Delta.PartialJSON,
 							},
-							"finish_reason": nil,
 						},
 					},
-				}
-				chunkJSON, _ := json.Marshal(chunk)
-				return "data: " + string(chunkJSON) + "\n\n", nil
+				}, nil), nil
 			}
 		}
-		// For non-tool blocks, return empty to skip
-		return "", nil
-		
+
 	case "content_block_stop":
-		// Clear tool state for the completed block if it was a tool block
-		if eventData["index"] != nil {
-			index := int(eventData["index"].(float64))
-			if _, exists := toolState[index]; exists {
-				delete(toolState, index)
-				if logger != nil {
-					logger.Debug("completed tool use block", "index", index)
-				}
-			}
+		if _, exists := c.tools[eventData.Index]; exists && c.logger != nil {
+			c.logger.Debug("completed tool use block", "index", eventData.Index)
 		}
 		// No output for content_block_stop
 		return "", nil
-		
-	case "content_block_delta":
-		// Convert content delta to OpenAI chunk
-		if delta, ok := eventData["delta"].(map[string]interface{}); ok {
-			if delta["type"] == "text_delta" {
-				if text, ok := delta["text"].(string); ok {
-					chunk := map[string]interface{}{
-						"id":      messageID,
-						"object":  "chat.completion.chunk",
-						"created": created,
-						"model":   model,
-						"choices": []interface{}{
-							map[string]interface{}{
-								"index": 0,
-								"delta": map[string]interface{}{
-									"content": text,
-								},
-								"finish_reason": nil,
-							},
-						},
-					}
-					chunkJSON, _ := json.Marshal(chunk)
-					return "data: " + string(chunkJSON) + "\n\n", nil
-				}
-			} else if delta["type"] == "input_json_delta" {
-				// Handle tool use deltas
-				if partialJSON, ok := delta["partial_json"].(string); ok {
-					// Get the content block index
-					blockIndex := int(eventData["index"].(float64))
-					
-					// Look up the tool info for this block
-					if toolInfo, exists := toolState[blockIndex]; exists {
-						toolIndex := toolInfo["toolIndex"].(int)
-						toolID := toolInfo["id"].(string)
-						
-						// Create tool delta chunk with tool ID
-						chunk := map[string]interface{}{
-							"id":      messageID,
-							"object":  "chat.completion.chunk",
-							"created": created,
-							"model":   model,
-							"choices": []interface{}{
-								map[string]interface{}{
-									"index": 0,
-									"delta": map[string]interface{}{
-										"tool_calls": []interface{}{
-											map[string]interface{}{
-												"index": toolIndex,
-												"id":    toolID,
-												"function": map[string]interface{}{
-													"arguments": partialJSON,
-												},
-											},
-										},
-									},
-									"finish_reason": nil,
-								},
-							},
-						}
-						chunkJSON, _ := json.Marshal(chunk)
-						return "data: " + string(chunkJSON) + "\n\n", nil
-					}
-				}
+
+	case "message_delta":
+		c.usage.merge(eventData.Usage)
+		// Send the finish reason as soon as the upstream reports it
+		if eventData.Delta.StopReason != "" && !c.finished {
+			c.finished = true
+			stopReason := eventData.Delta.StopReason
+			if stopReason == "tool_use" && len(c.structured) > 0 && len(c.tools) == 0 {
+				// The forced structured output call is the final answer
+				stopReason = "end_turn"
 			}
+			if c.TextCompletion {
+				return c.chunk(map[string]interface{}{}, completionFinishReason(stopReason)), nil
+			}
+			return c.chunk(map[string]interface{}{}, openAIFinishReason(stopReason)), nil
 		}
-		
+
 	case "message_stop":
-		// Send final chunk with finish_reason
+		// Streams without a stop reason still need a final chunk.
 		// Note: [DONE] marker should be sent separately by the stream handler
-		chunk := map[string]interface{}{
-			"id":      messageID,
-			"object":  "chat.completion.chunk",
-			"created": created,
-			"model":   model,
-			"choices": []interface{}{
-				map[string]interface{}{
-					"index":         0,
-					"delta":         map[string]interface{}{},
-					"finish_reason": "stop",
-				},
-			},
-		}
-		chunkJSON, _ := json.Marshal(chunk)
-		return "data: " + string(chunkJSON) + "\n\n", nil
-		
-	case "message_delta":
-		// Handle stop reasons from message_delta
-		if delta, ok := eventData["delta"].(map[string]interface{}); ok {
-			if stopReason, ok := delta["stop_reason"].(string); ok {
-				finishReason := "stop"
-				if stopReason == "max_tokens" {
-					finishReason = "length"
-				}
-				
-				chunk := map[string]interface{}{
-					"id":      messageID,
-					"object":  "chat.completion.chunk",
-					"created": created,
-					"model":   model,
-					"choices": []interface{}{
-						map[string]interface{}{
-							"index":         0,
-							"delta":         map[string]interface{}{},
-							"finish_reason": finishReason,
-						},
-					},
-				}
-				chunkJSON, _ := json.Marshal(chunk)
-				return "data: " + string(chunkJSON) + "\n\n", nil
-			}
+		if !c.finished {
+			c.finished = true
+			return c.chunk(map[string]interface{}{}, "stop"), nil
 		}
-		
+
 	default:
 		// Log unhandled event types for debugging
-		if logger != nil {
-			logger.Debug("unhandled SSE event type",
+		if c.logger != nil {
+			c.logger.Debug("unhandled SSE event type",
 				"event", event,
-				"type", eventType,
+				"type", eventData.Type,
 				"data", data,
 			)
 		}
 	}
-	
+
 	// Skip other event types
 	return "", nil
-}
\ No newline at end of file
+}
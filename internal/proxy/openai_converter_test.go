@@ -178,6 +178,29 @@ func TestConvertOpenAIToAnthropic(t *testing.T) {
 		assert.Equal(t, "user", messages[0].(map[string]interface{})["role"])
 	})
 	
+	t.Run("should fold developer messages into the system prompt", func(t *testing.T) {
+		requestBody := []byte(`{"model": "claude-sonnet-4-20250514", "messages": [
+			{"role": "system", "content": "You are a helpful assistant."},
+			{"role": "developer", "content": [{"type": "text", "text": "Answer in French."}]},
+			{"role": "user", "content": "Hello"}
+		]}`)
+		
+		result, err := ConvertOpenAIToAnthropic(requestBody)
+		require.NoError(t, err)
+		
+		var anthropicRequest map[string]interface{}
+		require.NoError(t, json.Unmarshal(result, &anthropicRequest))
+		assert.Equal(t, []interface{}{
+			map[string]interface{}{"type": "text", "text": ClaudeCodePrompt},
+			map[string]interface{}{"type": "text", "text": "You are a helpful assistant."},
+			map[string]interface{}{"type": "text", "text": "Answer in French."},
+		}, anthropicRequest["system"])
+		
+		messages := anthropicRequest["messages"].([]interface{})
+		require.Len(t, messages, 1)
+		assert.Equal(t, "user", messages[0].(map[string]interface{})["role"])
+	})
+	
 	t.Run("should handle complex content format from Cursor", func(t *testing.T) {
 		// Arrange - mimicking Cursor's actual request format
 		openAIRequest := map[string]interface{}{
@@ -265,8 +288,18 @@ func TestConvertOpenAIToAnthropic(t *testing.T) {
 		assistantMsg := messages[1].(map[string]interface{})
 		assert.Equal(t, "assistant", assistantMsg["role"])
 		
-		// Check tools are preserved
-		assert.Equal(t, openAIRequest["tools"], anthropicRequest["tools"])
+		// Check tools are converted to Anthropic format
+		expectedTools := []interface{}{
+			map[string]interface{}{
+				"name":        "str_replace_editor",
+				"description": "Replace text in a file",
+				"input_schema": map[string]interface{}{
+					"type":       "object",
+					"properties": map[string]interface{}{},
+				},
+			},
+		}
+		assert.Equal(t, expectedTools, anthropicRequest["tools"])
 	})
 }
 
@@ -365,6 +398,7 @@ func TestConvertAnthropicSSEToOpenAI(t *testing.T) {
 	messageID := "chatcmpl-test123"
 	model := "claude-3-opus-20240229"
 	created := int64(1719331200)
+	conv := NewStreamConverter(messageID, model, created, nil)
 	
 	t.Run("should convert message_start event", func(t *testing.T) {
 		// Arrange
@@ -372,7 +406,7 @@ func TestConvertAnthropicSSEToOpenAI(t *testing.T) {
 		data := `{"type":"message_start","message":{"id":"msg_123","type":"message","role":"assistant","model":"claude-3-opus-20240229","content":[],"stop_reason":null}}`
 		
 		// Act
-		result, err := ConvertAnthropicSSEToOpenAI(event, data, messageID, model, created)
+		result, err := conv.Convert(event, data)
 		
 		// Assert
 		require.NoError(t, err)
@@ -388,7 +422,7 @@ func TestConvertAnthropicSSEToOpenAI(t *testing.T) {
 		data := `{"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"Hello world"}}`
 		
 		// Act
-		result, err := ConvertAnthropicSSEToOpenAI(event, data, messageID, model, created)
+		result, err := conv.Convert(event, data)
 		
 		// Assert
 		require.NoError(t, err)
@@ -403,7 +437,7 @@ func TestConvertAnthropicSSEToOpenAI(t *testing.T) {
 		data := `{"type":"message_stop"}`
 		
 		// Act
-		result, err := ConvertAnthropicSSEToOpenAI(event, data, messageID, model, created)
+		result, err := conv.Convert(event, data)
 		
 		// Assert
 		require.NoError(t, err)
@@ -414,11 +448,12 @@ func TestConvertAnthropicSSEToOpenAI(t *testing.T) {
 	
 	t.Run("should convert message_delta with stop reason", func(t *testing.T) {
 		// Arrange
+		conv := NewStreamConverter(messageID, model, created, nil)
 		event := "message_delta"
 		data := `{"type":"message_delta","delta":{"stop_reason":"max_tokens"}}`
 		
 		// Act
-		result, err := ConvertAnthropicSSEToOpenAI(event, data, messageID, model, created)
+		result, err := conv.Convert(event, data)
 		
 		// Assert
 		require.NoError(t, err)
@@ -432,7 +467,7 @@ func TestConvertAnthropicSSEToOpenAI(t *testing.T) {
 		data := `{"type":"ping"}`
 		
 		// Act
-		result, err := ConvertAnthropicSSEToOpenAI(event, data, messageID, model, created)
+		result, err := conv.Convert(event, data)
 		
 		// Assert
 		require.NoError(t, err)
@@ -440,13 +475,13 @@ func TestConvertAnthropicSSEToOpenAI(t *testing.T) {
 	})
 	
 	t.Run("should convert input_json_delta events to OpenAI tool format", func(t *testing.T) {
-		// Reset state
-		ResetSSEConverterState()
+		// Fresh converter for a new stream
+		conv := NewStreamConverter(messageID, model, created, nil)
 		
 		// First set up a tool
 		startEvent := "content_block_start"
 		startData := `{"type":"content_block_start","index":1,"content_block":{"type":"tool_use","id":"toolu_123","name":"get_weather"}}`
-		_, err := ConvertAnthropicSSEToOpenAI(startEvent, startData, messageID, model, created)
+		_, err := conv.Convert(startEvent, startData)
 		require.NoError(t, err)
 		
 		// Arrange
@@ -454,7 +489,7 @@ func TestConvertAnthropicSSEToOpenAI(t *testing.T) {
 		data := `{"type":"content_block_delta","index":1,"delta":{"type":"input_json_delta","partial_json":"{\"location\": \"San Fra"}}`
 		
 		// Act
-		result, err := ConvertAnthropicSSEToOpenAI(event, data, messageID, model, created)
+		result, err := conv.Convert(event, data)
 		
 		// Assert
 		require.NoError(t, err)
@@ -465,15 +500,15 @@ func TestConvertAnthropicSSEToOpenAI(t *testing.T) {
 	})
 	
 	t.Run("should handle content_block_start for tool_use", func(t *testing.T) {
-		// Reset state
-		ResetSSEConverterState()
+		// Fresh converter for a new stream
+		conv := NewStreamConverter(messageID, model, created, nil)
 		
 		// Arrange
 		event := "content_block_start"
 		data := `{"type":"content_block_start","index":1,"content_block":{"type":"tool_use","id":"toolu_123","name":"get_weather"}}`
 		
 		// Act
-		result, err := ConvertAnthropicSSEToOpenAI(event, data, messageID, model, created)
+		result, err := conv.Convert(event, data)
 		
 		// Assert
 		require.NoError(t, err)
@@ -485,13 +520,13 @@ func TestConvertAnthropicSSEToOpenAI(t *testing.T) {
 	})
 	
 	t.Run("should handle empty tool input gracefully", func(t *testing.T) {
-		// Reset state
-		ResetSSEConverterState()
+		// Fresh converter for a new stream
+		conv := NewStreamConverter(messageID, model, created, nil)
 		
 		// First set up a tool
 		startEvent := "content_block_start"
 		startData := `{"type":"content_block_start","index":1,"content_block":{"type":"tool_use","id":"toolu_empty","name":"test_tool"}}`
-		_, err := ConvertAnthropicSSEToOpenAI(startEvent, startData, messageID, model, created)
+		_, err := conv.Convert(startEvent, startData)
 		require.NoError(t, err)
 		
 		// Arrange
@@ -499,7 +534,7 @@ func TestConvertAnthropicSSEToOpenAI(t *testing.T) {
 		data := `{"type":"content_block_delta","index":1,"delta":{"type":"input_json_delta","partial_json":""}}`
 		
 		// Act
-		result, err := ConvertAnthropicSSEToOpenAI(event, data, messageID, model, created)
+		result, err := conv.Convert(event, data)
 		
 		// Assert
 		require.NoError(t, err)
@@ -508,8 +543,8 @@ func TestConvertAnthropicSSEToOpenAI(t *testing.T) {
 	})
 	
 	t.Run("should handle multiple tool deltas in sequence", func(t *testing.T) {
-		// Reset state
-		ResetSSEConverterState()
+		// Fresh converter for a new stream
+		conv := NewStreamConverter(messageID, model, created, nil)
 		
 		// Arrange - simulating a sequence of tool use events
 		events := []struct {
@@ -532,7 +567,7 @@ func TestConvertAnthropicSSEToOpenAI(t *testing.T) {
 		
 		// Act & Assert - each event should produce valid output
 		for _, tc := range events {
-			result, err := ConvertAnthropicSSEToOpenAI(tc.event, tc.data, messageID, model, created)
+			result, err := conv.Convert(tc.event, tc.data)
 			require.NoError(t, err)
 			assert.NotEmpty(t, result)
 			assert.Contains(t, result, "data: ")
@@ -540,15 +575,15 @@ func TestConvertAnthropicSSEToOpenAI(t *testing.T) {
 	})
 	
 	t.Run("should include tool ID in input_json_delta events", func(t *testing.T) {
-		// Reset state
-		ResetSSEConverterState()
+		// Fresh converter for a new stream
+		conv := NewStreamConverter(messageID, model, created, nil)
 		
 		// Arrange - first set up a tool
 		startEvent := "content_block_start"
 		startData := `{"type":"content_block_start","index":1,"content_block":{"type":"tool_use","id":"toolu_789","name":"search"}}`
 		
 		// Start the tool
-		_, err := ConvertAnthropicSSEToOpenAI(startEvent, startData, messageID, model, created)
+		_, err := conv.Convert(startEvent, startData)
 		require.NoError(t, err)
 		
 		// Now send a delta
@@ -556,7 +591,7 @@ func TestConvertAnthropicSSEToOpenAI(t *testing.T) {
 		deltaData := `{"type":"content_block_delta","index":1,"delta":{"type":"input_json_delta","partial_json":"{\"query\": \"test\""}}`
 		
 		// Act
-		result, err := ConvertAnthropicSSEToOpenAI(deltaEvent, deltaData, messageID, model, created)
+		result, err := conv.Convert(deltaEvent, deltaData)
 		
 		// Assert - the delta should include the tool ID
 		require.NoError(t, err)
@@ -566,8 +601,8 @@ func TestConvertAnthropicSSEToOpenAI(t *testing.T) {
 	})
 	
 	t.Run("should handle multiple tools with correct indices", func(t *testing.T) {
-		// Reset state
-		ResetSSEConverterState()
+		// Fresh converter for a new stream
+		conv := NewStreamConverter(messageID, model, created, nil)
 		
 		// Arrange - simulate multiple tools
 		events := []struct {
@@ -594,7 +629,7 @@ func TestConvertAnthropicSSEToOpenAI(t *testing.T) {
 		
 		// Act & Assert
 		for _, tc := range events {
-			result, err := ConvertAnthropicSSEToOpenAI(tc.event, tc.data, messageID, model, created)
+			result, err := conv.Convert(tc.event, tc.data)
 			require.NoError(t, err)
 			
 			if tc.wantToolIdx >= 0 {
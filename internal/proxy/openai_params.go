@@ -0,0 +1,279 @@
+package proxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"math"
+	"sort"
+	"strings"
+)
+
+// anthropicPassthroughParams are Messages API parameters accepted as is on the OpenAI endpoint
+var anthropicPassthroughParams = map[string]bool{
+	"stream":         true,
+	"top_k":          true,
+	"stop_sequences": true,
+	"thinking":       true,
+}
+
+// unsupportedOpenAIParams are OpenAI parameters without a Messages API equivalent.
+// They are dropped in lenient mode and rejected in strict mode, unless they hold the
+// neutral value listed here (compact JSON), which does not change the result.
+var unsupportedOpenAIParams = map[string]string{
+	"seed":               ``,
+	"presence_penalty":   `0`,
+	"frequency_penalty":  `0`,
+	"logit_bias":         `{}`,
+	"logprobs":           `false`,
+	"top_logprobs":       `0`,
+	"service_tier":       `"auto"`,
+	"store":              `false`,
+	"metadata":           `{}`,
+	"modalities":         `["text"]`,
+	"audio":              ``,
+	"prediction":         ``,
+	"web_search_options": ``,
+	"functions":          ``,
+	"function_call":      ``,
+	"best_of":            `1`,
+}
+
+// reasoningBudgets maps an OpenAI reasoning_effort to an extended thinking budget in tokens.
+// "none" disables thinking.
+var reasoningBudgets = map[string]int64{
+	"none":    0,
+	"minimal": 1024,
+	"low":     2048,
+	"medium":  8192,
+	"high":    16384,
+}
+
+// minThinkingBudget is the smallest thinking budget the Messages API accepts
+const minThinkingBudget = 1024
+
+// defaultMaxTokens is used when an OpenAI request sets no output limit,
+// since the Messages API requires max_tokens
+const defaultMaxTokens = 8192
+
+// legacyModelMaxTokens lists model prefixes whose output limit is below defaultMaxTokens
+var legacyModelMaxTokens = map[string]int64{
+	"claude-3-haiku":  4096,
+	"claude-3-sonnet": 4096,
+	"claude-3-opus":   4096,
+	"claude-2":        4096,
+	"claude-instant":  4096,
+}
+
+// maxTokensForModel returns the default max_tokens for a model
+func maxTokensForModel(model string) int64 {
+	for prefix, limit := range legacyModelMaxTokens {
+		if strings.HasPrefix(model, prefix) {
+			return limit
+		}
+	}
+	return defaultMaxTokens
+}
+
+// convertOpenAIParams maps the sampling and output parameters of an OpenAI request onto
+// an Anthropic request. Parameters without an equivalent are dropped, or rejected when strict.
+func convertOpenAIParams(openAIRequest, anthropicRequest *requestBody, strict bool) error {
+	keys := make([]string, 0, len(openAIRequest.fields))
+	for key := range openAIRequest.fields {
+		keys = append(keys, key)
+	}
+	// Sorted so the same request always reports the same error
+	sort.Strings(keys)
+
+	var thinkingBudget int64
+	for _, key := range keys {
+		value := openAIRequest.fields[key]
+		if isJSONNull(value) {
+			continue
+		}
+
+		switch key {
+		case "model", "messages", "tools", "tool_choice", "parallel_tool_calls", "stream_options",
+			"max_tokens", "max_completion_tokens", "response_format":
+			// Converted elsewhere
+			continue
+
+		case "n":
+			// Several choices are served by fanning out upstream calls
+			var n float64
+			if json.Unmarshal(value, &n) != nil || n < 1 || n > maxChoices || n != math.Trunc(n) {
+				return newInvalidRequestError("n must be an integer between 1 and %d", maxChoices)
+			}
+
+		case "reasoning_effort":
+			var effort string
+			json.Unmarshal(value, &effort)
+			budget, ok := reasoningBudgets[effort]
+			if !ok {
+				return newInvalidRequestError("reasoning_effort must be one of none, minimal, low, medium or high")
+			}
+			// An explicit thinking configuration takes precedence
+			if thinking, ok := openAIRequest.get("thinking"); !ok || isJSONNull(thinking) {
+				thinkingBudget = budget
+			}
+
+		case "stop":
+			sequences, err := stopSequences(value)
+			if err != nil {
+				return err
+			}
+			if len(sequences) > 0 {
+				if err := anthropicRequest.set("stop_sequences", sequences); err != nil {
+					return err
+				}
+			}
+
+		case "user":
+			var user string
+			if json.Unmarshal(value, &user) != nil {
+				return newInvalidRequestError("user must be a string")
+			}
+			if user != "" {
+				if err := anthropicRequest.set("metadata", map[string]string{"user_id": user}); err != nil {
+					return err
+				}
+			}
+
+		case "temperature", "top_p":
+			// OpenAI accepts temperatures up to 2, Anthropic only up to 1
+			var number float64
+			if json.Unmarshal(value, &number) != nil {
+				return newInvalidRequestError("%s must be a number", key)
+			}
+			if err := anthropicRequest.set(key, math.Min(math.Max(number, 0), 1)); err != nil {
+				return err
+			}
+
+		default:
+			if anthropicPassthroughParams[key] {
+				anthropicRequest.setRaw(key, value)
+				continue
+			}
+			neutral, known := unsupportedOpenAIParams[key]
+			if !strict {
+				continue
+			}
+			if !known {
+				return newInvalidRequestError("unknown parameter %q", key)
+			}
+			if !isNeutralParam(value, neutral) {
+				return newInvalidRequestError("parameter %q is not supported by the Anthropic Messages API", key)
+			}
+		}
+	}
+
+	maxTokens, err := openAIMaxTokens(openAIRequest)
+	if err != nil {
+		return err
+	}
+	if thinkingBudget > 0 {
+		if err := checkThinkingCompatible(anthropicRequest); err != nil {
+			return err
+		}
+		if maxTokens == 0 {
+			// Without a limit, thinking comes on top of the usual output allowance
+			maxTokens = maxTokensForModel(anthropicRequest.stringField("model")) + thinkingBudget
+		} else if thinkingBudget >= maxTokens {
+			// OpenAI counts reasoning against max_completion_tokens, so the budget is capped
+			// to leave half of the limit for the answer
+			thinkingBudget = maxTokens / 2
+			if thinkingBudget < minThinkingBudget {
+				return newInvalidRequestError("max_completion_tokens must be at least %d to use reasoning_effort", 2*minThinkingBudget)
+			}
+		}
+		if err := anthropicRequest.set("thinking", map[string]interface{}{
+			"type":          "enabled",
+			"budget_tokens": thinkingBudget,
+		}); err != nil {
+			return err
+		}
+	}
+	if maxTokens == 0 {
+		maxTokens = maxTokensForModel(anthropicRequest.stringField("model"))
+	}
+	return anthropicRequest.set("max_tokens", maxTokens)
+}
+
+// checkThinkingCompatible rejects a request the Messages API would refuse once thinking is
+// enabled: thinking cannot be combined with forced tool use or modified sampling.
+func checkThinkingCompatible(anthropicRequest *requestBody) error {
+	var choice struct {
+		Type string `json:"type"`
+		Name string `json:"name"`
+	}
+	anthropicRequest.decode("tool_choice", &choice)
+	switch {
+	case choice.Type == "tool" && choice.Name == structuredOutputTool:
+		return newInvalidRequestError("reasoning_effort cannot be combined with response_format json_schema")
+	case choice.Type == "any" || choice.Type == "tool":
+		return newInvalidRequestError("reasoning_effort cannot be combined with tool_choice required or a named function")
+	}
+
+	var temperature, topP float64
+	if anthropicRequest.decode("temperature", &temperature) && temperature != 1 {
+		return newInvalidRequestError("reasoning_effort requires temperature to be 1 or unset")
+	}
+	// top_p may be lowered to 0.95 with thinking
+	if anthropicRequest.decode("top_p", &topP) && topP < 0.95 {
+		return newInvalidRequestError("reasoning_effort requires top_p to be at least 0.95 or unset")
+	}
+	if anthropicRequest.has("top_k") {
+		return newInvalidRequestError("reasoning_effort cannot be combined with top_k")
+	}
+	return nil
+}
+
+// openAIMaxTokens returns the requested output limit, preferring max_completion_tokens
+// over the deprecated max_tokens. It returns 0 when neither is set.
+func openAIMaxTokens(openAIRequest *requestBody) (int64, error) {
+	for _, key := range []string{"max_completion_tokens", "max_tokens"} {
+		value, ok := openAIRequest.get(key)
+		if !ok || isJSONNull(value) {
+			continue
+		}
+		var maxTokens float64
+		if json.Unmarshal(value, &maxTokens) != nil || maxTokens < 1 || maxTokens != math.Trunc(maxTokens) {
+			return 0, newInvalidRequestError("%s must be a positive integer", key)
+		}
+		return int64(maxTokens), nil
+	}
+	return 0, nil
+}
+
+// stopSequences converts an OpenAI stop value, a string or an array of strings, to stop_sequences
+func stopSequences(value json.RawMessage) ([]string, error) {
+	var single string
+	if json.Unmarshal(value, &single) == nil {
+		value = json.RawMessage(`[` + string(value) + `]`)
+	}
+
+	var sequences []string
+	if json.Unmarshal(value, &sequences) != nil {
+		return nil, newInvalidRequestError("stop must be a string or an array of strings")
+	}
+
+	// Anthropic rejects empty stop sequences
+	nonEmpty := sequences[:0]
+	for _, sequence := range sequences {
+		if sequence != "" {
+			nonEmpty = append(nonEmpty, sequence)
+		}
+	}
+	return nonEmpty, nil
+}
+
+// isNeutralParam reports whether a parameter value equals its neutral setting
+func isNeutralParam(value json.RawMessage, neutral string) bool {
+	if neutral == "" {
+		return false
+	}
+	var compact bytes.Buffer
+	if json.Compact(&compact, value) != nil {
+		return false
+	}
+	return compact.String() == neutral
+}
@@ -0,0 +1,131 @@
+package proxy
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConvertOpenAIToAnthropic_ParameterMapping(t *testing.T) {
+	request := convertOpenAIJSON(t, `{
+		"model": "claude-sonnet-4-20250514",
+		"messages": [{"role": "user", "content": "Hi"}],
+		"stop": ["END", "", "STOP"],
+		"max_completion_tokens": 300,
+		"max_tokens": 100,
+		"user": "user-42",
+		"temperature": 1.6,
+		"top_p": -0.5,
+		"top_k": 40,
+		"stream": true,
+		"stream_options": {"include_usage": true},
+		"n": 1,
+		"seed": 7,
+		"presence_penalty": 0.5,
+		"logit_bias": {"50256": -100},
+		"response_format": {"type": "text"},
+		"some_vendor_field": true
+	}`)
+
+	assert.Equal(t, []interface{}{"END", "STOP"}, request["stop_sequences"])
+	assert.Equal(t, float64(300), request["max_tokens"])
+	assert.Equal(t, map[string]interface{}{"user_id": "user-42"}, request["metadata"])
+	assert.Equal(t, float64(1), request["temperature"])
+	assert.Equal(t, float64(0), request["top_p"])
+	assert.Equal(t, float64(40), request["top_k"])
+	assert.Equal(t, true, request["stream"])
+
+	for _, key := range []string{"stop", "max_completion_tokens", "user", "stream_options", "n", "seed",
+		"presence_penalty", "logit_bias", "response_format", "some_vendor_field"} {
+		assert.NotContains(t, request, key)
+	}
+}
+
+func TestConvertOpenAIToAnthropic_StopString(t *testing.T) {
+	request := convertOpenAIJSON(t, `{"model": "claude-sonnet-4-20250514", "messages": [], "stop": "\n\n"}`)
+	assert.Equal(t, []interface{}{"\n\n"}, request["stop_sequences"])
+}
+
+func TestConvertOpenAIToAnthropic_DefaultMaxTokens(t *testing.T) {
+	tests := []struct {
+		model     string
+		maxTokens float64
+	}{
+		{"claude-sonnet-4-20250514", 8192},
+		{"claude-3-5-haiku-20241022", 8192},
+		{"anthropic/claude-3-haiku-20240307", 4096},
+		{"claude-3-opus-20240229", 4096},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.model, func(t *testing.T) {
+			request := convertOpenAIJSON(t, `{"model": "`+tt.model+`", "messages": []}`)
+			assert.Equal(t, tt.maxTokens, request["max_tokens"])
+		})
+	}
+}
+
+func TestConvertOpenAIToAnthropic_InvalidParameters(t *testing.T) {
+	tests := map[string]string{
+		"zero max_tokens":       `"max_tokens": 0`,
+		"fractional max_tokens": `"max_completion_tokens": 10.5`,
+		"string temperature":    `"temperature": "hot"`,
+		"numeric user":          `"user": 42`,
+		"object stop":           `"stop": {"text": "END"}`,
+		"zero n":                `"n": 0`,
+		"too many choices":      `"n": 17`,
+	}
+
+	for name, field := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := ConvertOpenAIToAnthropic([]byte(`{"model": "claude-sonnet-4-20250514", "messages": [], ` + field + `}`))
+			var invalid *invalidRequestError
+			assert.True(t, errors.As(err, &invalid), "expected invalid request error, got %v", err)
+		})
+	}
+}
+
+func TestConvertOpenAIRequest_StrictMode(t *testing.T) {
+	convert := func(fields string) error {
+		req, err := parseRequestBody([]byte(`{"model": "claude-sonnet-4-20250514", "messages": []` + fields + `}`))
+		require.NoError(t, err)
+		_, err = convertOpenAIRequest(req, true)
+		return err
+	}
+
+	// Mapped parameters and neutral values of unsupported ones are accepted
+	assert.NoError(t, convert(`, "stop": "END", "user": "u", "temperature": 2, "n": 2, "presence_penalty": 0, "logprobs": false, "response_format": {"type": "text"}, "seed": null`))
+
+	for _, fields := range []string{`, "seed": 7`, `, "logit_bias": {"1": 5}`, `, "frequency_penalty": 0.1`, `, "vendor_field": 1`} {
+		err := convert(fields)
+		var invalid *invalidRequestError
+		require.True(t, errors.As(err, &invalid), fields)
+		assert.Contains(t, err.Error(), "parameter", fields)
+	}
+}
+
+func TestProxyHandler_StrictOpenAIParams(t *testing.T) {
+	handler := NewProxyHandler(&ProxyConfig{
+		UpstreamURL:   "http://127.0.0.1:0",
+		TokenProvider: &mockTokenProvider{token: "test-token"},
+		Transformer:   NewRequestTransformerWithConfig(TransformerConfig{StrictOpenAIParams: true}),
+	})
+
+	body := `{"model": "claude-sonnet-4-20250514", "messages": [{"role": "user", "content": "Hi"}], "seed": 7}`
+	req := httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(body))
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	var response map[string]interface{}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	errorObj := response["error"].(map[string]interface{})
+	assert.Equal(t, "invalid_request_error", errorObj["type"])
+	assert.Equal(t, `parameter "seed" is not supported by the Anthropic Messages API`, errorObj["message"])
+}
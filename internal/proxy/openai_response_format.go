@@ -0,0 +1,252 @@
+package proxy
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+)
+
+// structuredOutputTool is the name of the synthetic tool that carries json_schema output.
+// Claude is forced to call it, and its input is returned to the client as the message content.
+const structuredOutputTool = "structured_output"
+
+// jsonModeInstruction is added to the system prompt for response_format json_object
+const jsonModeInstruction = "Respond only with a single valid JSON object. Do not wrap it in markdown code fences and do not add any text before or after it."
+
+// responseFormat is the structured output mode requested with response_format
+type responseFormat struct {
+	Type        string // "json_schema" or "json_object"
+	Name        string
+	Description string
+	Schema      json.RawMessage
+	Strict      bool
+}
+
+// parseResponseFormat reads response_format from an OpenAI request.
+// It returns nil for plain text responses.
+func parseResponseFormat(req *requestBody) (*responseFormat, error) {
+	raw, ok := req.get("response_format")
+	if !ok || isJSONNull(raw) {
+		return nil, nil
+	}
+
+	var format struct {
+		Type       string `json:"type"`
+		JSONSchema *struct {
+			Name        string          `json:"name"`
+			Description string          `json:"description"`
+			Schema      json.RawMessage `json:"schema"`
+			Strict      bool            `json:"strict"`
+		} `json:"json_schema"`
+	}
+	if err := json.Unmarshal(raw, &format); err != nil {
+		return nil, newInvalidRequestError("invalid response_format: %v", err)
+	}
+
+	switch format.Type {
+	case "text":
+		return nil, nil
+	case "json_object":
+		return &responseFormat{Type: format.Type}, nil
+	case "json_schema":
+		if format.JSONSchema == nil || format.JSONSchema.Name == "" {
+			return nil, newInvalidRequestError("response_format json_schema requires json_schema.name")
+		}
+		schema := format.JSONSchema.Schema
+		if isJSONNull(schema) {
+			schema = emptyInputSchema
+		}
+		var object map[string]interface{}
+		if json.Unmarshal(schema, &object) != nil {
+			return nil, newInvalidRequestError("response_format json_schema.schema must be a JSON object")
+		}
+		// Tool input is always an object, so other root types cannot be emulated
+		if rootType, ok := object["type"]; ok && rootType != "object" {
+			return nil, newInvalidRequestError("response_format json_schema.schema must describe an object")
+		}
+		return &responseFormat{
+			Type:        format.Type,
+			Name:        format.JSONSchema.Name,
+			Description: format.JSONSchema.Description,
+			Schema:      schema,
+			Strict:      format.JSONSchema.Strict,
+		}, nil
+	default:
+		return nil, newInvalidRequestError("unsupported response_format type %q, expected \"text\", \"json_object\" or \"json_schema\"", format.Type)
+	}
+}
+
+// structuredOutputToolDefinition builds the forced tool for a json_schema response format
+func (f *responseFormat) structuredOutputToolDefinition() map[string]interface{} {
+	description := fmt.Sprintf("Respond with the %s object. Always call this tool to give your final answer.", f.Name)
+	if f.Description != "" {
+		description += " " + f.Description
+	}
+	return map[string]interface{}{
+		"name":         structuredOutputTool,
+		"description":  description,
+		"input_schema": f.Schema,
+	}
+}
+
+// unwrapsTool reports whether a tool_use block carries structured output for this format
+func (f *responseFormat) unwrapsTool(name string) bool {
+	return f != nil && f.Type == "json_schema" && name == structuredOutputTool
+}
+
+// structuredOutputError reports structured output that does not match the requested schema
+type structuredOutputError struct {
+	err error
+}
+
+func (e *structuredOutputError) Error() string {
+	return "structured output does not match the response_format schema: " + e.err.Error()
+}
+
+// validate checks structured output against the schema when the client asked for strict output
+func (f *responseFormat) validate(output interface{}) error {
+	if f == nil || !f.Strict {
+		return nil
+	}
+	var schema interface{}
+	if err := json.Unmarshal(f.Schema, &schema); err != nil {
+		return &structuredOutputError{err: err}
+	}
+	if err := validateJSONSchema(schema, output, "$"); err != nil {
+		return &structuredOutputError{err: err}
+	}
+	return nil
+}
+
+// validateJSONSchema checks a decoded JSON value against the commonly used subset of
+// JSON Schema: type, enum, const, properties, required, additionalProperties, items and anyOf.
+// Keywords outside that subset are ignored.
+func validateJSONSchema(schema, value interface{}, path string) error {
+	s, ok := schema.(map[string]interface{})
+	if !ok {
+		// true, false or an invalid schema; only false rejects anything
+		if schema == false {
+			return fmt.Errorf("%s is not allowed", path)
+		}
+		return nil
+	}
+
+	if types, ok := s["type"]; ok && !matchesSchemaType(types, value) {
+		return fmt.Errorf("%s must be of type %v", path, types)
+	}
+	if enum, ok := s["enum"].([]interface{}); ok {
+		found := false
+		for _, allowed := range enum {
+			if reflect.DeepEqual(allowed, value) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return fmt.Errorf("%s must be one of %v", path, enum)
+		}
+	}
+	if constant, ok := s["const"]; ok && !reflect.DeepEqual(constant, value) {
+		return fmt.Errorf("%s must be %v", path, constant)
+	}
+	if anyOf, ok := s["anyOf"].([]interface{}); ok {
+		matched := false
+		for _, option := range anyOf {
+			if validateJSONSchema(option, value, path) == nil {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return fmt.Errorf("%s does not match any allowed schema", path)
+		}
+	}
+
+	switch v := value.(type) {
+	case map[string]interface{}:
+		properties, _ := s["properties"].(map[string]interface{})
+		if required, ok := s["required"].([]interface{}); ok {
+			for _, name := range required {
+				if key, ok := name.(string); ok {
+					if _, present := v[key]; !present {
+						return fmt.Errorf("%s.%s is required", path, key)
+					}
+				}
+			}
+		}
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			if propertySchema, ok := properties[key]; ok {
+				if err := validateJSONSchema(propertySchema, v[key], path+"."+key); err != nil {
+					return err
+				}
+			} else if additional, ok := s["additionalProperties"]; ok {
+				if err := validateJSONSchema(additional, v[key], path+"."+key); err != nil {
+					return err
+				}
+			}
+		}
+	case []interface{}:
+		if items, ok := s["items"]; ok {
+			for i, item := range v {
+				if err := validateJSONSchema(items, item, fmt.Sprintf("%s[%d]", path, i)); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// matchesSchemaType reports whether a decoded JSON value has one of the schema types
+func matchesSchemaType(types, value interface{}) bool {
+	var names []string
+	switch t := types.(type) {
+	case string:
+		names = []string{t}
+	case []interface{}:
+		for _, name := range t {
+			if s, ok := name.(string); ok {
+				names = append(names, s)
+			}
+		}
+	default:
+		return true
+	}
+
+	for _, name := range names {
+		switch v := value.(type) {
+		case nil:
+			if name == "null" {
+				return true
+			}
+		case bool:
+			if name == "boolean" {
+				return true
+			}
+		case float64:
+			if name == "number" || (name == "integer" && v == math.Trunc(v)) {
+				return true
+			}
+		case string:
+			if name == "string" {
+				return true
+			}
+		case []interface{}:
+			if name == "array" {
+				return true
+			}
+		case map[string]interface{}:
+			if name == "object" {
+				return true
+			}
+		}
+	}
+	return false
+}
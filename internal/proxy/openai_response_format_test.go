@@ -0,0 +1,236 @@
+package proxy
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const personSchemaFormat = `{"type": "json_schema", "json_schema": {"name": "person", "strict": true, "schema": {
+	"type": "object",
+	"properties": {"name": {"type": "string"}, "age": {"type": "integer"}},
+	"required": ["name", "age"],
+	"additionalProperties": false
+}}}`
+
+func TestConvertOpenAIToAnthropic_JSONSchemaFormat(t *testing.T) {
+	request := convertOpenAIJSON(t, `{
+		"model": "claude-sonnet-4-20250514",
+		"messages": [{"role": "user", "content": "Alice is 30"}],
+		"response_format": `+personSchemaFormat+`
+	}`)
+
+	tools := request["tools"].([]interface{})
+	require.Len(t, tools, 1)
+	tool := tools[0].(map[string]interface{})
+	assert.Equal(t, structuredOutputTool, tool["name"])
+	assert.Contains(t, tool["description"], "person")
+	assert.Equal(t, []interface{}{"name", "age"}, tool["input_schema"].(map[string]interface{})["required"])
+	assert.Equal(t, map[string]interface{}{"type": "tool", "name": structuredOutputTool}, request["tool_choice"])
+	assert.NotContains(t, request, "response_format")
+}
+
+func TestConvertOpenAIToAnthropic_JSONObjectFormat(t *testing.T) {
+	request := convertOpenAIJSON(t, `{
+		"model": "claude-sonnet-4-20250514",
+		"messages": [{"role": "system", "content": "Extract data."}, {"role": "user", "content": "Alice is 30"}],
+		"response_format": {"type": "json_object"}
+	}`)
+
+	system := request["system"].([]interface{})
+	require.Len(t, system, 3)
+	assert.Equal(t, "Extract data.", system[1].(map[string]interface{})["text"])
+	assert.Equal(t, jsonModeInstruction, system[2].(map[string]interface{})["text"])
+	assert.NotContains(t, request, "tools")
+	assert.NotContains(t, request, "response_format")
+}
+
+func TestConvertOpenAIToAnthropic_InvalidResponseFormat(t *testing.T) {
+	tests := map[string]string{
+		"unknown type":      `"response_format": {"type": "xml"}`,
+		"missing name":      `"response_format": {"type": "json_schema", "json_schema": {"schema": {"type": "object"}}}`,
+		"non-object schema": `"response_format": {"type": "json_schema", "json_schema": {"name": "list", "schema": {"type": "array"}}}`,
+		"combined with tools": `"response_format": ` + personSchemaFormat +
+			`, "tools": [{"type": "function", "function": {"name": "f"}}]`,
+	}
+
+	for name, field := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := ConvertOpenAIToAnthropic([]byte(`{"model": "claude-sonnet-4-20250514", "messages": [], ` + field + `}`))
+			var invalid *invalidRequestError
+			assert.True(t, errors.As(err, &invalid), "expected invalid request error, got %v", err)
+		})
+	}
+}
+
+func structuredFormat(t *testing.T) *responseFormat {
+	t.Helper()
+	req, err := parseRequestBody([]byte(`{"response_format": ` + personSchemaFormat + `}`))
+	require.NoError(t, err)
+	format, err := parseResponseFormat(req)
+	require.NoError(t, err)
+	require.NotNil(t, format)
+	return format
+}
+
+func TestConvertAnthropicResponse_UnwrapsStructuredOutput(t *testing.T) {
+	body := []byte(`{
+		"id": "msg_1",
+		"content": [{"type": "tool_use", "id": "toolu_1", "name": "structured_output", "input": {"name": "Alice", "age": 30}}],
+		"stop_reason": "tool_use"
+	}`)
+
+	result, err := convertAnthropicResponse(body, responseOptions{format: structuredFormat(t)})
+	require.NoError(t, err)
+
+	var response map[string]interface{}
+	require.NoError(t, json.Unmarshal(result, &response))
+	choice := response["choices"].([]interface{})[0].(map[string]interface{})
+	assert.Equal(t, "stop", choice["finish_reason"])
+	message := choice["message"].(map[string]interface{})
+	assert.JSONEq(t, `{"name": "Alice", "age": 30}`, message["content"].(string))
+	assert.NotContains(t, message, "tool_calls")
+
+	// Without the response format the same block is an ordinary tool call
+	result, err = ConvertAnthropicToOpenAI(body)
+	require.NoError(t, err)
+	assert.Contains(t, string(result), `"tool_calls"`)
+}
+
+func TestConvertAnthropicResponse_ValidatesStrictSchema(t *testing.T) {
+	body := []byte(`{"content": [{"type": "tool_use", "id": "toolu_1", "name": "structured_output", "input": {"name": "Alice", "age": "thirty"}}], "stop_reason": "tool_use"}`)
+
+	_, err := convertAnthropicResponse(body, responseOptions{format: structuredFormat(t)})
+	var invalid *structuredOutputError
+	require.True(t, errors.As(err, &invalid))
+	assert.Contains(t, err.Error(), "$.age must be of type integer")
+}
+
+func TestValidateJSONSchema(t *testing.T) {
+	schema := map[string]interface{}{
+		"type":     "object",
+		"required": []interface{}{"tags"},
+		"properties": map[string]interface{}{
+			"tags":   map[string]interface{}{"type": "array", "items": map[string]interface{}{"type": "string"}},
+			"status": map[string]interface{}{"enum": []interface{}{"open", "closed"}},
+			"score":  map[string]interface{}{"anyOf": []interface{}{map[string]interface{}{"type": "number"}, map[string]interface{}{"type": "null"}}},
+		},
+		"additionalProperties": false,
+	}
+
+	tests := []struct {
+		value string
+		valid bool
+	}{
+		{`{"tags": ["a", "b"], "status": "open", "score": 1.5}`, true},
+		{`{"tags": [], "score": null}`, true},
+		{`{"status": "open"}`, false},
+		{`{"tags": ["a", 1]}`, false},
+		{`{"tags": [], "status": "pending"}`, false},
+		{`{"tags": [], "score": "high"}`, false},
+		{`{"tags": [], "extra": true}`, false},
+		{`[]`, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			var value interface{}
+			require.NoError(t, json.Unmarshal([]byte(tt.value), &value))
+			err := validateJSONSchema(schema, value, "$")
+			if tt.valid {
+				assert.NoError(t, err)
+			} else {
+				assert.Error(t, err)
+			}
+		})
+	}
+}
+
+func TestStreamConverter_StructuredOutput(t *testing.T) {
+	converter := NewStreamConverter("chatcmpl-1", "default", 1719331200, nil)
+	converter.StructuredOutput = true
+
+	events := []string{
+		`{"type":"message_start","message":{"model":"claude-sonnet-4-20250514","usage":{"input_tokens":5}}}`,
+		`{"type":"content_block_start","index":0,"content_block":{"type":"tool_use","id":"toolu_1","name":"structured_output","input":{}}}`,
+		`{"type":"content_block_delta","index":0,"delta":{"type":"input_json_delta","partial_json":"{\"name\": \"Al"}}`,
+		`{"type":"content_block_delta","index":0,"delta":{"type":"input_json_delta","partial_json":"ice\", \"age\": 30}"}}`,
+		`{"type":"content_block_stop","index":0}`,
+		`{"type":"message_delta","delta":{"stop_reason":"tool_use"},"usage":{"output_tokens":12}}`,
+		`{"type":"message_stop"}`,
+	}
+
+	var content strings.Builder
+	var finishReasons []string
+	for _, event := range events {
+		out, err := converter.Convert("", event)
+		require.NoError(t, err)
+		if out == "" {
+			continue
+		}
+		assert.NotContains(t, out, "tool_calls")
+
+		var chunk struct {
+			Choices []struct {
+				Delta struct {
+					Content string `json:"content"`
+				} `json:"delta"`
+				FinishReason *string `json:"finish_reason"`
+			} `json:"choices"`
+		}
+		require.NoError(t, json.Unmarshal([]byte(strings.TrimPrefix(strings.TrimSpace(out), "data: ")), &chunk))
+		content.WriteString(chunk.Choices[0].Delta.Content)
+		if chunk.Choices[0].FinishReason != nil {
+			finishReasons = append(finishReasons, *chunk.Choices[0].FinishReason)
+		}
+	}
+
+	assert.JSONEq(t, `{"name": "Alice", "age": 30}`, content.String())
+	assert.Equal(t, []string{"stop"}, finishReasons)
+}
+
+func TestProxyHandler_StructuredOutput(t *testing.T) {
+	var upstreamBody map[string]interface{}
+	output := `{"name": "Alice", "age": 30}`
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&upstreamBody)
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"id":"msg_1","content":[{"type":"tool_use","id":"toolu_1","name":"structured_output","input":%s}],"stop_reason":"tool_use","usage":{"input_tokens":5,"output_tokens":9}}`, output)
+	}))
+	defer upstream.Close()
+
+	handler := NewProxyHandler(&ProxyConfig{
+		UpstreamURL:   upstream.URL,
+		TokenProvider: &mockTokenProvider{token: "test-token"},
+		Transformer:   NewRequestTransformer(),
+	})
+
+	serve := func() *httptest.ResponseRecorder {
+		body := `{"model": "claude-sonnet-4-20250514", "messages": [{"role": "user", "content": "Alice is 30"}], "response_format": ` + personSchemaFormat + `}`
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(body)))
+		return w
+	}
+
+	w := serve()
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, map[string]interface{}{"type": "tool", "name": structuredOutputTool}, upstreamBody["tool_choice"])
+
+	var response map[string]interface{}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	message := response["choices"].([]interface{})[0].(map[string]interface{})["message"].(map[string]interface{})
+	assert.JSONEq(t, output, message["content"].(string))
+
+	// Output that breaks a strict schema is reported instead of returned
+	output = `{"name": "Alice"}`
+	w = serve()
+	assert.Equal(t, http.StatusBadGateway, w.Code)
+	assert.Contains(t, w.Body.String(), "$.age is required")
+}
@@ -0,0 +1,570 @@
+package proxy
+
+import (
+	"encoding/json"
+	"math"
+	"strings"
+)
+
+// responsesInputItem is an item of the input array of a Responses API request
+type responsesInputItem struct {
+	Type      string          `json:"type"`
+	Role      string          `json:"role"`
+	Content   json.RawMessage `json:"content"`
+	CallID    string          `json:"call_id"`
+	Name      string          `json:"name"`
+	Arguments string          `json:"arguments"`
+	Output    json.RawMessage `json:"output"`
+}
+
+// responsesContentPart is a part of the content of a Responses API input message
+type responsesContentPart struct {
+	Type     string `json:"type"`
+	Text     string `json:"text"`
+	Refusal  string `json:"refusal"`
+	ImageURL string `json:"image_url"`
+	FileID   string `json:"file_id"`
+	FileData string `json:"file_data"`
+	Filename string `json:"filename"`
+}
+
+// anthropicMessage is a Messages API message with its content as blocks
+type anthropicMessage struct {
+	Role    string        `json:"role"`
+	Content []interface{} `json:"content"`
+}
+
+// responsesConversation collects the messages and system instructions of a Responses API
+// request. Consecutive items of the same role are merged into one message, so assistant
+// text and function calls, or several function call outputs, end up together as in Anthropic.
+type responsesConversation struct {
+	messages []anthropicMessage
+	system   []string
+}
+
+// add appends content blocks to the conversation
+func (c *responsesConversation) add(role string, blocks ...interface{}) {
+	if len(blocks) == 0 {
+		return
+	}
+	if n := len(c.messages); n > 0 && c.messages[n-1].Role == role {
+		last := &c.messages[n-1]
+		// Copy on append so the stored history this conversation started from is never modified
+		last.Content = append(last.Content[:len(last.Content):len(last.Content)], blocks...)
+		return
+	}
+	c.messages = append(c.messages, anthropicMessage{Role: role, Content: blocks})
+}
+
+// addInput adds the input of a request: a string, or an array of messages, function calls
+// and function call outputs
+func (c *responsesConversation) addInput(raw json.RawMessage) error {
+	var text string
+	if json.Unmarshal(raw, &text) == nil {
+		if text != "" {
+			c.add("user", map[string]interface{}{"type": "text", "text": text})
+		}
+		return nil
+	}
+
+	var items []responsesInputItem
+	if err := json.Unmarshal(raw, &items); err != nil {
+		return newInvalidRequestError("input must be a string or an array of input items: %v", err)
+	}
+	for i, item := range items {
+		if err := c.addItem(item); err != nil {
+			return newInvalidRequestError("input[%d]: %v", i, err)
+		}
+	}
+	return nil
+}
+
+// addItem adds a single input item
+func (c *responsesConversation) addItem(item responsesInputItem) error {
+	switch item.Type {
+	case "message", "":
+		switch item.Role {
+		case "system", "developer":
+			blocks, err := convertResponsesContent(item.Content)
+			if err != nil {
+				return err
+			}
+			for _, block := range blocks {
+				if text, ok := block.(map[string]interface{})["text"].(string); ok {
+					c.system = append(c.system, text)
+				}
+			}
+		case "user", "assistant":
+			blocks, err := convertResponsesContent(item.Content)
+			if err != nil {
+				return err
+			}
+			c.add(item.Role, blocks...)
+		default:
+			return newInvalidRequestError("unsupported role %q", item.Role)
+		}
+
+	case "function_call":
+		if item.CallID == "" || item.Name == "" {
+			return newInvalidRequestError("function_call items require call_id and name")
+		}
+		input, ok := toolUseInput(item.Arguments)
+		if !ok {
+			return newInvalidRequestError("function_call arguments must be a JSON object")
+		}
+		c.add("assistant", map[string]interface{}{
+			"type":  "tool_use",
+			"id":    item.CallID,
+			"name":  item.Name,
+			"input": input,
+		})
+
+	case "function_call_output":
+		if item.CallID == "" {
+			return newInvalidRequestError("function_call_output items require call_id")
+		}
+		block := map[string]interface{}{
+			"type":        "tool_result",
+			"tool_use_id": item.CallID,
+		}
+		var output string
+		if json.Unmarshal(item.Output, &output) == nil {
+			block["content"] = output
+		} else if !isJSONNull(item.Output) {
+			content, err := convertResponsesContent(item.Output)
+			if err != nil {
+				return err
+			}
+			block["content"] = content
+		}
+		c.add("user", block)
+
+	case "reasoning":
+		// Reasoning items of OpenAI models cannot be replayed to Claude
+		return nil
+
+	default:
+		return newInvalidRequestError("unsupported input item type %q", item.Type)
+	}
+	return nil
+}
+
+// convertResponsesContent converts message content, a string or an array of input parts,
+// to Anthropic content blocks
+func convertResponsesContent(raw json.RawMessage) ([]interface{}, error) {
+	var text string
+	if json.Unmarshal(raw, &text) == nil {
+		if text == "" {
+			return nil, nil
+		}
+		return []interface{}{map[string]interface{}{"type": "text", "text": text}}, nil
+	}
+
+	var parts []responsesContentPart
+	if err := json.Unmarshal(raw, &parts); err != nil {
+		return nil, newInvalidRequestError("content must be a string or an array of content parts: %v", err)
+	}
+
+	blocks := make([]interface{}, 0, len(parts))
+	for i, part := range parts {
+		switch part.Type {
+		case "input_text", "output_text":
+			blocks = append(blocks, map[string]interface{}{"type": "text", "text": part.Text})
+		case "refusal":
+			blocks = append(blocks, map[string]interface{}{"type": "text", "text": part.Refusal})
+		case "input_image":
+			if part.ImageURL == "" {
+				return nil, newInvalidRequestError("content[%d]: input_image parts must include image_url; uploaded file IDs are not supported", i)
+			}
+			source, err := imageSource(part.ImageURL)
+			if err != nil {
+				return nil, newInvalidRequestError("content[%d]: %v", i, err)
+			}
+			blocks = append(blocks, map[string]interface{}{"type": "image", "source": source})
+		case "input_file":
+			// Same handling as file parts on chat completions
+			filePart, err := json.Marshal(map[string]interface{}{
+				"type": "file",
+				"file": map[string]string{"file_data": part.FileData, "file_id": part.FileID, "filename": part.Filename},
+			})
+			if err != nil {
+				return nil, err
+			}
+			block, err := convertOpenAIContentPart(filePart)
+			if err != nil {
+				return nil, newInvalidRequestError("content[%d]: %v", i, err)
+			}
+			blocks = append(blocks, block)
+		default:
+			return nil, newInvalidRequestError("content[%d]: unsupported content part type %q", i, part.Type)
+		}
+	}
+	return blocks, nil
+}
+
+// convertResponsesRequest converts a Responses API request to an Anthropic request.
+// The input continues history, the conversation of the previous response if any. The full
+// conversation is returned too, so it can be stored together with the reply.
+func convertResponsesRequest(req *requestBody, history []anthropicMessage) (*requestBody, []anthropicMessage, error) {
+	anthropicRequest := &requestBody{fields: make(map[string]json.RawMessage)}
+
+	model := strings.TrimPrefix(req.stringField("model"), "anthropic/")
+	if model != "" {
+		if err := anthropicRequest.set("model", model); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	conversation := &responsesConversation{messages: append([]anthropicMessage(nil), history...)}
+	if raw, ok := req.get("input"); ok && !isJSONNull(raw) {
+		if err := conversation.addInput(raw); err != nil {
+			return nil, nil, err
+		}
+	}
+	if len(conversation.messages) == 0 {
+		return nil, nil, newInvalidRequestError("input is required")
+	}
+	if err := anthropicRequest.set("messages", conversation.messages); err != nil {
+		return nil, nil, err
+	}
+
+	// Instructions apply to this request only and are not carried over by previous_response_id
+	var system []interface{}
+	if raw, ok := req.get("instructions"); ok && !isJSONNull(raw) {
+		var instructions string
+		if json.Unmarshal(raw, &instructions) != nil {
+			return nil, nil, newInvalidRequestError("instructions must be a string")
+		}
+		if instructions != "" {
+			system = append(system, map[string]interface{}{"type": "text", "text": instructions})
+		}
+	}
+	for _, text := range conversation.system {
+		system = append(system, map[string]interface{}{"type": "text", "text": text})
+	}
+	if len(system) > 0 {
+		if err := anthropicRequest.set("system", system); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	// Function tools and the tool choice
+	if raw, ok := req.get("tools"); ok && !isJSONNull(raw) {
+		tools, err := convertResponsesTools(raw)
+		if err != nil {
+			return nil, nil, err
+		}
+		if len(tools) > 0 {
+			if err := anthropicRequest.set("tools", tools); err != nil {
+				return nil, nil, err
+			}
+			var parallelToolCalls *bool
+			req.decode("parallel_tool_calls", &parallelToolCalls)
+			choiceRaw, hasChoice := req.get("tool_choice")
+			choice, err := convertResponsesToolChoice(choiceRaw, hasChoice && !isJSONNull(choiceRaw), parallelToolCalls)
+			if err != nil {
+				return nil, nil, err
+			}
+			if choice != nil {
+				if err := anthropicRequest.set("tool_choice", choice); err != nil {
+					return nil, nil, err
+				}
+			}
+		}
+	}
+
+	var text struct {
+		Format struct {
+			Type string `json:"type"`
+		} `json:"format"`
+	}
+	if req.decode("text", &text) && text.Format.Type != "" && text.Format.Type != "text" {
+		return nil, nil, newInvalidRequestError("text.format %q is not supported on /v1/responses", text.Format.Type)
+	}
+
+	if err := convertResponsesParams(req, anthropicRequest, model); err != nil {
+		return nil, nil, err
+	}
+	return anthropicRequest, conversation.messages, nil
+}
+
+// convertResponsesParams maps the sampling and output parameters of a Responses API request.
+// Parameters without an Anthropic equivalent are ignored.
+func convertResponsesParams(req, anthropicRequest *requestBody, model string) error {
+	maxTokens := maxTokensForModel(model)
+	if raw, ok := req.get("max_output_tokens"); ok && !isJSONNull(raw) {
+		var value float64
+		if json.Unmarshal(raw, &value) != nil || value < 1 || value != math.Trunc(value) {
+			return newInvalidRequestError("max_output_tokens must be a positive integer")
+		}
+		maxTokens = int64(value)
+	}
+	if err := anthropicRequest.set("max_tokens", maxTokens); err != nil {
+		return err
+	}
+
+	for _, key := range []string{"temperature", "top_p"} {
+		raw, ok := req.get(key)
+		if !ok || isJSONNull(raw) {
+			continue
+		}
+		// OpenAI accepts temperatures up to 2, Anthropic only up to 1
+		var number float64
+		if json.Unmarshal(raw, &number) != nil {
+			return newInvalidRequestError("%s must be a number", key)
+		}
+		if err := anthropicRequest.set(key, math.Min(math.Max(number, 0), 1)); err != nil {
+			return err
+		}
+	}
+
+	if user := req.stringField("user"); user != "" {
+		if err := anthropicRequest.set("metadata", map[string]string{"user_id": user}); err != nil {
+			return err
+		}
+	}
+	if req.boolField("stream") {
+		return anthropicRequest.set("stream", true)
+	}
+	return nil
+}
+
+// convertResponsesTools converts Responses API function tools, which are declared without
+// the function wrapper used by chat completions, to Anthropic tools
+func convertResponsesTools(raw json.RawMessage) ([]interface{}, error) {
+	var tools []struct {
+		Type        string          `json:"type"`
+		Name        string          `json:"name"`
+		Description string          `json:"description"`
+		Parameters  json.RawMessage `json:"parameters"`
+	}
+	if err := json.Unmarshal(raw, &tools); err != nil {
+		return nil, newInvalidRequestError("tools must be an array of function tools: %v", err)
+	}
+
+	chatTools := make([]openAITool, len(tools))
+	for i, tool := range tools {
+		chatTools[i].Type = tool.Type
+		chatTools[i].Function.Name = tool.Name
+		chatTools[i].Function.Description = tool.Description
+		chatTools[i].Function.Parameters = tool.Parameters
+	}
+	wrapped, err := json.Marshal(chatTools)
+	if err != nil {
+		return nil, err
+	}
+	return convertOpenAITools(wrapped)
+}
+
+// convertResponsesToolChoice converts a Responses API tool_choice, where a named function is
+// {"type": "function", "name": ...}, to an Anthropic tool_choice
+func convertResponsesToolChoice(raw json.RawMessage, hasChoice bool, parallelToolCalls *bool) (map[string]interface{}, error) {
+	var named struct {
+		Type string `json:"type"`
+		Name string `json:"name"`
+	}
+	if hasChoice && json.Unmarshal(raw, &named) == nil && named.Type == "function" && named.Name != "" {
+		raw, _ = json.Marshal(map[string]interface{}{
+			"type":     "function",
+			"function": map[string]string{"name": named.Name},
+		})
+	}
+	return convertOpenAIToolChoice(raw, hasChoice, parallelToolCalls)
+}
+
+// responsesEchoFields are request fields repeated in every Response object, with their defaults
+var responsesEchoFields = map[string]json.RawMessage{
+	"instructions":         json.RawMessage(`null`),
+	"max_output_tokens":    json.RawMessage(`null`),
+	"metadata":             json.RawMessage(`{}`),
+	"parallel_tool_calls":  json.RawMessage(`true`),
+	"previous_response_id": json.RawMessage(`null`),
+	"temperature":          json.RawMessage(`null`),
+	"tool_choice":          json.RawMessage(`"auto"`),
+	"tools":                json.RawMessage(`[]`),
+	"top_p":                json.RawMessage(`null`),
+}
+
+// responsesContext is the state of one Responses API request shared by its Response objects
+type responsesContext struct {
+	id        string
+	createdAt int64
+	model     string
+	store     bool
+	echo      map[string]json.RawMessage
+}
+
+// newResponsesContext reads the fields a Response object echoes from its request
+func newResponsesContext(req *requestBody, id string, createdAt int64) *responsesContext {
+	c := &responsesContext{
+		id:        id,
+		createdAt: createdAt,
+		model:     req.stringField("model"),
+		// Responses are stored unless the client opts out
+		store: true,
+		echo:  make(map[string]json.RawMessage, len(responsesEchoFields)),
+	}
+	req.decode("store", &c.store)
+	for key, value := range responsesEchoFields {
+		if raw, ok := req.get(key); ok && !isJSONNull(raw) {
+			value = raw
+		}
+		c.echo[key] = value
+	}
+	return c
+}
+
+// response builds a Response object. Usage is omitted while the response is in progress.
+func (c *responsesContext) response(status string, output []map[string]interface{}, usage *Usage) map[string]interface{} {
+	response := map[string]interface{}{
+		"id":                 c.id,
+		"object":             "response",
+		"created_at":         c.createdAt,
+		"status":             status,
+		"error":              nil,
+		"incomplete_details": nil,
+		"model":              c.model,
+		"output":             output,
+		"store":              c.store,
+		"usage":              nil,
+	}
+	for key, value := range c.echo {
+		response[key] = value
+	}
+	if usage != nil {
+		response["usage"] = responsesUsage(*usage)
+	}
+	return response
+}
+
+// finish completes a Response object for the Anthropic stop reason
+func (c *responsesContext) finish(output []map[string]interface{}, stopReason string, usage Usage) map[string]interface{} {
+	switch stopReason {
+	case "max_tokens":
+		response := c.response("incomplete", output, &usage)
+		response["incomplete_details"] = map[string]interface{}{"reason": "max_output_tokens"}
+		return response
+	case "refusal":
+		response := c.response("incomplete", output, &usage)
+		response["incomplete_details"] = map[string]interface{}{"reason": "content_filter"}
+		return response
+	default:
+		return c.response("completed", output, &usage)
+	}
+}
+
+// responsesUsage converts Anthropic usage to a Responses API usage object
+func responsesUsage(usage Usage) map[string]interface{} {
+	inputTokens := usage.InputTokens + usage.CacheCreationInputTokens + usage.CacheReadInputTokens
+	return map[string]interface{}{
+		"input_tokens": inputTokens,
+		"input_tokens_details": map[string]interface{}{
+			"cached_tokens": usage.CacheReadInputTokens,
+		},
+		"output_tokens": usage.OutputTokens,
+		"output_tokens_details": map[string]interface{}{
+			"reasoning_tokens": 0,
+		},
+		"total_tokens": inputTokens + usage.OutputTokens,
+	}
+}
+
+// responsesMessageItem builds an assistant message output item with a single text part
+func responsesMessageItem(id, status, text string) map[string]interface{} {
+	content := []interface{}{}
+	if status == "completed" {
+		content = append(content, responsesTextPart(text))
+	}
+	return map[string]interface{}{
+		"type":    "message",
+		"id":      id,
+		"status":  status,
+		"role":    "assistant",
+		"content": content,
+	}
+}
+
+// responsesTextPart builds an output_text content part
+func responsesTextPart(text string) map[string]interface{} {
+	return map[string]interface{}{
+		"type":        "output_text",
+		"text":        text,
+		"annotations": []interface{}{},
+	}
+}
+
+// responsesFunctionCallItem builds a function_call output item
+func responsesFunctionCallItem(id, status, callID, name, arguments string) map[string]interface{} {
+	return map[string]interface{}{
+		"type":      "function_call",
+		"id":        id,
+		"status":    status,
+		"call_id":   callID,
+		"name":      name,
+		"arguments": arguments,
+	}
+}
+
+// convertAnthropicToResponse converts an Anthropic message to a Response object
+func convertAnthropicToResponse(body []byte, c *responsesContext) (map[string]interface{}, error) {
+	var message struct {
+		Model      string                   `json:"model"`
+		Content    []map[string]interface{} `json:"content"`
+		StopReason string                   `json:"stop_reason"`
+		Usage      Usage                    `json:"usage"`
+	}
+	if err := json.Unmarshal(body, &message); err != nil {
+		return nil, err
+	}
+	if message.Model != "" {
+		c.model = message.Model
+	}
+
+	output := []map[string]interface{}{}
+	for _, block := range message.Content {
+		switch block["type"] {
+		case "text":
+			text, _ := block["text"].(string)
+			output = append(output, responsesMessageItem("msg_"+generateRandomID(), "completed", text))
+		case "tool_use":
+			call, err := openAIToolCallFromBlock(block)
+			if err != nil {
+				return nil, err
+			}
+			function := call["function"].(map[string]interface{})
+			output = append(output, responsesFunctionCallItem("fc_"+generateRandomID(), "completed",
+				call["id"].(string), function["name"].(string), function["arguments"].(string)))
+		}
+	}
+	return c.finish(output, message.StopReason, message.Usage), nil
+}
+
+// assistantMessageFromOutput rebuilds the Anthropic assistant message of a response from its
+// output items, so a later previous_response_id can continue the conversation
+func assistantMessageFromOutput(output []map[string]interface{}) (anthropicMessage, bool) {
+	message := anthropicMessage{Role: "assistant"}
+	for _, item := range output {
+		switch item["type"] {
+		case "message":
+			content, _ := item["content"].([]interface{})
+			for _, part := range content {
+				if text, _ := part.(map[string]interface{})["text"].(string); text != "" {
+					message.Content = append(message.Content, map[string]interface{}{"type": "text", "text": text})
+				}
+			}
+		case "function_call":
+			arguments, _ := item["arguments"].(string)
+			input, ok := toolUseInput(arguments)
+			if !ok {
+				input = json.RawMessage("{}")
+			}
+			message.Content = append(message.Content, map[string]interface{}{
+				"type":  "tool_use",
+				"id":    item["call_id"],
+				"name":  item["name"],
+				"input": input,
+			})
+		}
+	}
+	return message, len(message.Content) > 0
+}
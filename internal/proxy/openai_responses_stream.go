@@ -0,0 +1,234 @@
+package proxy
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// responsesStreamItem is an output item being streamed, keyed by its Anthropic block index
+type responsesStreamItem struct {
+	outputIndex int
+	itemType    string // "message" or "function_call"
+	id          string
+	callID      string
+	name        string
+	content     strings.Builder // text or function arguments
+}
+
+// item renders the output item in its current state
+func (i *responsesStreamItem) item(status string) map[string]interface{} {
+	if i.itemType == "function_call" {
+		return responsesFunctionCallItem(i.id, status, i.callID, i.name, i.content.String())
+	}
+	return responsesMessageItem(i.id, status, i.content.String())
+}
+
+// responsesStreamConverter converts an Anthropic stream to Responses API semantic events.
+// Each stream needs its own converter, as it tracks the output items of one response.
+type responsesStreamConverter struct {
+	request    *responsesContext
+	sequence   int
+	items      map[int]*responsesStreamItem
+	output     []map[string]interface{}
+	stopReason string
+	usage      Usage
+	final      map[string]interface{}
+}
+
+// newResponsesStreamConverter creates a converter for one streamed response
+func newResponsesStreamConverter(request *responsesContext) *responsesStreamConverter {
+	return &responsesStreamConverter{
+		request: request,
+		items:   make(map[int]*responsesStreamItem),
+	}
+}
+
+// event renders a semantic event with the next sequence number
+func (c *responsesStreamConverter) event(eventType string, fields map[string]interface{}) string {
+	fields["type"] = eventType
+	fields["sequence_number"] = c.sequence
+	c.sequence++
+	data, err := json.Marshal(fields)
+	if err != nil {
+		return ""
+	}
+	return fmt.Sprintf("event: %s\ndata: %s\n\n", eventType, data)
+}
+
+// Start renders the events announcing the response before any upstream event arrives
+func (c *responsesStreamConverter) Start() string {
+	inProgress := c.request.response("in_progress", []map[string]interface{}{}, nil)
+	return c.event("response.created", map[string]interface{}{"response": inProgress}) +
+		c.event("response.in_progress", map[string]interface{}{"response": inProgress})
+}
+
+// Response returns the final Response object, or nil until the stream has finished
+func (c *responsesStreamConverter) Response() map[string]interface{} {
+	return c.final
+}
+
+// Convert converts one Anthropic SSE event to the matching Responses API events
+func (c *responsesStreamConverter) Convert(eventType, data string) (string, error) {
+	var event struct {
+		Type         string `json:"type"`
+		Index        int    `json:"index"`
+		ContentBlock struct {
+			Type string `json:"type"`
+			ID   string `json:"id"`
+			Name string `json:"name"`
+		} `json:"content_block"`
+		Delta struct {
+			Type        string `json:"type"`
+			Text        string `json:"text"`
+			PartialJSON string `json:"partial_json"`
+			StopReason  string `json:"stop_reason"`
+		} `json:"delta"`
+		Message struct {
+			Model string `json:"model"`
+			Usage Usage  `json:"usage"`
+		} `json:"message"`
+		Usage Usage `json:"usage"`
+		Error struct {
+			Type    string `json:"type"`
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	if err := json.Unmarshal([]byte(data), &event); err != nil {
+		return "", err
+	}
+	if event.Type != "" {
+		eventType = event.Type
+	}
+
+	switch eventType {
+	case "message_start":
+		if event.Message.Model != "" {
+			c.request.model = event.Message.Model
+		}
+		c.usage.merge(event.Message.Usage)
+		return "", nil
+
+	case "content_block_start":
+		item := &responsesStreamItem{outputIndex: len(c.output)}
+		switch event.ContentBlock.Type {
+		case "text":
+			item.itemType = "message"
+			item.id = "msg_" + generateRandomID()
+		case "tool_use":
+			item.itemType = "function_call"
+			item.id = "fc_" + generateRandomID()
+			item.callID = event.ContentBlock.ID
+			item.name = event.ContentBlock.Name
+		default:
+			// Thinking and other blocks have no Responses API output item
+			return "", nil
+		}
+		c.items[event.Index] = item
+		c.output = append(c.output, nil)
+
+		out := c.event("response.output_item.added", map[string]interface{}{
+			"output_index": item.outputIndex,
+			"item":         item.item("in_progress"),
+		})
+		if item.itemType == "message" {
+			out += c.event("response.content_part.added", map[string]interface{}{
+				"item_id":       item.id,
+				"output_index":  item.outputIndex,
+				"content_index": 0,
+				"part":          responsesTextPart(""),
+			})
+		}
+		return out, nil
+
+	case "content_block_delta":
+		item, ok := c.items[event.Index]
+		if !ok {
+			return "", nil
+		}
+		switch event.Delta.Type {
+		case "text_delta":
+			item.content.WriteString(event.Delta.Text)
+			return c.event("response.output_text.delta", map[string]interface{}{
+				"item_id":       item.id,
+				"output_index":  item.outputIndex,
+				"content_index": 0,
+				"delta":         event.Delta.Text,
+			}), nil
+		case "input_json_delta":
+			item.content.WriteString(event.Delta.PartialJSON)
+			return c.event("response.function_call_arguments.delta", map[string]interface{}{
+				"item_id":      item.id,
+				"output_index": item.outputIndex,
+				"delta":        event.Delta.PartialJSON,
+			}), nil
+		}
+		return "", nil
+
+	case "content_block_stop":
+		item, ok := c.items[event.Index]
+		if !ok {
+			return "", nil
+		}
+		delete(c.items, event.Index)
+		done := item.item("completed")
+		c.output[item.outputIndex] = done
+
+		var out string
+		if item.itemType == "message" {
+			out = c.event("response.output_text.done", map[string]interface{}{
+				"item_id":       item.id,
+				"output_index":  item.outputIndex,
+				"content_index": 0,
+				"text":          item.content.String(),
+			}) + c.event("response.content_part.done", map[string]interface{}{
+				"item_id":       item.id,
+				"output_index":  item.outputIndex,
+				"content_index": 0,
+				"part":          responsesTextPart(item.content.String()),
+			})
+		} else {
+			out = c.event("response.function_call_arguments.done", map[string]interface{}{
+				"item_id":      item.id,
+				"output_index": item.outputIndex,
+				"arguments":    item.content.String(),
+			})
+		}
+		return out + c.event("response.output_item.done", map[string]interface{}{
+			"output_index": item.outputIndex,
+			"item":         done,
+		}), nil
+
+	case "message_delta":
+		if event.Delta.StopReason != "" {
+			c.stopReason = event.Delta.StopReason
+		}
+		c.usage.merge(event.Usage)
+		return "", nil
+
+	case "message_stop":
+		// Items the upstream never finished are left out of the final response
+		output := make([]map[string]interface{}, 0, len(c.output))
+		for _, item := range c.output {
+			if item != nil {
+				output = append(output, item)
+			}
+		}
+		c.final = c.request.finish(output, c.stopReason, c.usage)
+		eventName := "response.completed"
+		if c.final["status"] == "incomplete" {
+			eventName = "response.incomplete"
+		}
+		return c.event(eventName, map[string]interface{}{"response": c.final}), nil
+
+	case "error":
+		failed := c.request.response("failed", []map[string]interface{}{}, nil)
+		failed["error"] = map[string]interface{}{
+			"code":    openAIErrorType(event.Error.Type),
+			"message": event.Error.Message,
+		}
+		return c.event("response.failed", map[string]interface{}{"response": failed}), nil
+	}
+
+	return "", nil
+}
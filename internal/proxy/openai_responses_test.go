@@ -0,0 +1,182 @@
+package proxy
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// convertResponsesJSON converts a Responses API request and decodes the Anthropic request
+func convertResponsesJSON(t *testing.T, body string, history []anthropicMessage) map[string]interface{} {
+	t.Helper()
+	req, err := parseRequestBody([]byte(body))
+	require.NoError(t, err)
+	converted, _, err := convertResponsesRequest(req, history)
+	require.NoError(t, err)
+
+	var request map[string]interface{}
+	require.NoError(t, json.Unmarshal(converted.bytes(), &request))
+	return request
+}
+
+func TestConvertResponsesRequest(t *testing.T) {
+	t.Run("string input and instructions", func(t *testing.T) {
+		request := convertResponsesJSON(t, `{"model": "anthropic/claude-sonnet-4-20250514", "instructions": "Be brief", "input": "Hi", "max_output_tokens": 100, "temperature": 1.5}`, nil)
+
+		assert.Equal(t, "claude-sonnet-4-20250514", request["model"])
+		assert.Equal(t, []interface{}{map[string]interface{}{"type": "text", "text": "Be brief"}}, request["system"])
+		assert.Equal(t, []interface{}{
+			map[string]interface{}{"role": "user", "content": []interface{}{map[string]interface{}{"type": "text", "text": "Hi"}}},
+		}, request["messages"])
+		assert.Equal(t, float64(100), request["max_tokens"])
+		assert.Equal(t, float64(1), request["temperature"])
+	})
+
+	t.Run("function calls and outputs", func(t *testing.T) {
+		request := convertResponsesJSON(t, `{"model": "claude-sonnet-4-20250514", "input": [
+			{"role": "developer", "content": "Use tools"},
+			{"role": "user", "content": [{"type": "input_text", "text": "Weather?"}, {"type": "input_image", "image_url": "https://example.com/a.png"}]},
+			{"type": "message", "role": "assistant", "content": [{"type": "output_text", "text": "Checking"}]},
+			{"type": "function_call", "call_id": "call_1", "name": "weather", "arguments": "{\"city\":\"Paris\"}"},
+			{"type": "function_call", "call_id": "call_2", "name": "weather", "arguments": ""},
+			{"type": "function_call_output", "call_id": "call_1", "output": "sunny"},
+			{"type": "function_call_output", "call_id": "call_2", "output": [{"type": "input_text", "text": "rain"}]},
+			{"type": "reasoning", "summary": []}
+		]}`, nil)
+
+		assert.Equal(t, []interface{}{map[string]interface{}{"type": "text", "text": "Use tools"}}, request["system"])
+		messages := request["messages"].([]interface{})
+		require.Len(t, messages, 3)
+
+		user := messages[0].(map[string]interface{})["content"].([]interface{})
+		require.Len(t, user, 2)
+		assert.Equal(t, map[string]interface{}{"type": "url", "url": "https://example.com/a.png"}, user[1].(map[string]interface{})["source"])
+
+		// Text and both function calls form one assistant message
+		assistant := messages[1].(map[string]interface{})
+		assert.Equal(t, "assistant", assistant["role"])
+		assert.Equal(t, []interface{}{
+			map[string]interface{}{"type": "text", "text": "Checking"},
+			map[string]interface{}{"type": "tool_use", "id": "call_1", "name": "weather", "input": map[string]interface{}{"city": "Paris"}},
+			map[string]interface{}{"type": "tool_use", "id": "call_2", "name": "weather", "input": map[string]interface{}{}},
+		}, assistant["content"])
+
+		// Both outputs form one user message of tool results
+		results := messages[2].(map[string]interface{})
+		assert.Equal(t, "user", results["role"])
+		assert.Equal(t, []interface{}{
+			map[string]interface{}{"type": "tool_result", "tool_use_id": "call_1", "content": "sunny"},
+			map[string]interface{}{"type": "tool_result", "tool_use_id": "call_2", "content": []interface{}{map[string]interface{}{"type": "text", "text": "rain"}}},
+		}, results["content"])
+	})
+
+	t.Run("tools and tool choice", func(t *testing.T) {
+		request := convertResponsesJSON(t, `{"model": "claude-sonnet-4-20250514", "input": "Hi",
+			"tools": [{"type": "function", "name": "weather", "description": "Get weather", "parameters": {"type": "object", "properties": {"city": {"type": "string"}}}}],
+			"tool_choice": {"type": "function", "name": "weather"}, "parallel_tool_calls": false}`, nil)
+
+		assert.Equal(t, []interface{}{map[string]interface{}{
+			"name":         "weather",
+			"description":  "Get weather",
+			"input_schema": map[string]interface{}{"type": "object", "properties": map[string]interface{}{"city": map[string]interface{}{"type": "string"}}},
+		}}, request["tools"])
+		assert.Equal(t, map[string]interface{}{"type": "tool", "name": "weather", "disable_parallel_tool_use": true}, request["tool_choice"])
+	})
+
+	t.Run("continues history without modifying it", func(t *testing.T) {
+		history := []anthropicMessage{
+			{Role: "user", Content: []interface{}{map[string]interface{}{"type": "text", "text": "Hi"}}},
+			{Role: "assistant", Content: []interface{}{map[string]interface{}{"type": "tool_use", "id": "call_1", "name": "weather", "input": map[string]interface{}{}}}},
+		}
+		request := convertResponsesJSON(t, `{"model": "claude-sonnet-4-20250514", "input": [{"type": "function_call_output", "call_id": "call_1", "output": "sunny"}]}`, history)
+
+		messages := request["messages"].([]interface{})
+		require.Len(t, messages, 3)
+		assert.Equal(t, "user", messages[2].(map[string]interface{})["role"])
+		assert.Len(t, history[1].Content, 1)
+		assert.Nil(t, request["system"])
+	})
+}
+
+func TestConvertResponsesRequest_Invalid(t *testing.T) {
+	tests := map[string]string{
+		"missing input":       `"instructions": "x"`,
+		"unknown item":        `"input": [{"type": "item_reference", "id": "msg_1"}]`,
+		"unknown role":        `"input": [{"role": "tool", "content": "x"}]`,
+		"non-object args":     `"input": [{"type": "function_call", "call_id": "c", "name": "f", "arguments": "[1]"}]`,
+		"output without id":   `"input": [{"type": "function_call_output", "output": "x"}]`,
+		"uploaded image":      `"input": [{"role": "user", "content": [{"type": "input_image", "file_id": "file_1"}]}]`,
+		"hosted tool":         `"input": "Hi", "tools": [{"type": "web_search"}]`,
+		"json schema format":  `"input": "Hi", "text": {"format": {"type": "json_schema"}}`,
+		"zero output tokens":  `"input": "Hi", "max_output_tokens": 0`,
+		"numeric instruction": `"input": "Hi", "instructions": 1`,
+	}
+
+	for name, fields := range tests {
+		t.Run(name, func(t *testing.T) {
+			req, err := parseRequestBody([]byte(`{"model": "claude-sonnet-4-20250514", ` + fields + `}`))
+			require.NoError(t, err)
+			_, _, err = convertResponsesRequest(req, nil)
+			var invalid *invalidRequestError
+			assert.True(t, errors.As(err, &invalid), "expected invalid request error, got %v", err)
+		})
+	}
+}
+
+func TestConvertAnthropicToResponse(t *testing.T) {
+	req, err := parseRequestBody([]byte(`{"model": "claude-sonnet-4-20250514", "input": "Hi", "instructions": "Be brief", "max_output_tokens": 50}`))
+	require.NoError(t, err)
+	responseContext := newResponsesContext(req, "resp_1", 1700000000)
+
+	response, err := convertAnthropicToResponse([]byte(`{
+		"model": "claude-sonnet-4-20250514",
+		"content": [
+			{"type": "text", "text": "Let me check"},
+			{"type": "tool_use", "id": "toolu_1", "name": "weather", "input": {"city": "Paris"}}
+		],
+		"stop_reason": "tool_use",
+		"usage": {"input_tokens": 10, "cache_read_input_tokens": 5, "output_tokens": 7}
+	}`), responseContext)
+	require.NoError(t, err)
+
+	assert.Equal(t, "resp_1", response["id"])
+	assert.Equal(t, "response", response["object"])
+	assert.Equal(t, "completed", response["status"])
+	assert.Equal(t, true, response["store"])
+	assert.JSONEq(t, `"Be brief"`, string(response["instructions"].(json.RawMessage)))
+
+	output := response["output"].([]map[string]interface{})
+	require.Len(t, output, 2)
+	assert.Equal(t, "message", output[0]["type"])
+	assert.Equal(t, "Let me check", output[0]["content"].([]interface{})[0].(map[string]interface{})["text"])
+	assert.Equal(t, "function_call", output[1]["type"])
+	assert.Equal(t, "toolu_1", output[1]["call_id"])
+	assert.Equal(t, `{"city":"Paris"}`, output[1]["arguments"])
+	assert.True(t, strings.HasPrefix(output[1]["id"].(string), "fc_"))
+
+	usage := response["usage"].(map[string]interface{})
+	assert.Equal(t, int64(15), usage["input_tokens"])
+	assert.Equal(t, int64(22), usage["total_tokens"])
+
+	// The reply is replayed as an assistant message when the conversation continues
+	reply, ok := assistantMessageFromOutput(output)
+	require.True(t, ok)
+	assert.Equal(t, "assistant", reply.Role)
+	require.Len(t, reply.Content, 2)
+	assert.Equal(t, "toolu_1", reply.Content[1].(map[string]interface{})["id"])
+}
+
+func TestConvertAnthropicToResponse_Incomplete(t *testing.T) {
+	req, err := parseRequestBody([]byte(`{"model": "claude-sonnet-4-20250514", "input": "Hi"}`))
+	require.NoError(t, err)
+
+	response, err := convertAnthropicToResponse([]byte(`{"content": [{"type": "text", "text": "Trunc"}], "stop_reason": "max_tokens"}`),
+		newResponsesContext(req, "resp_1", 0))
+	require.NoError(t, err)
+	assert.Equal(t, "incomplete", response["status"])
+	assert.Equal(t, map[string]interface{}{"reason": "max_output_tokens"}, response["incomplete_details"])
+}
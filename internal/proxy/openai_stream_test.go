@@ -0,0 +1,303 @@
+package proxy
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// toolStreamEvents returns an Anthropic stream with one text block and the given number of tool calls
+func toolStreamEvents(stream, tools int) []string {
+	events := []string{
+		fmt.Sprintf(`{"type":"message_start","message":{"id":"msg_%d","model":"claude-model-%d","content":[],"usage":{"input_tokens":%d,"output_tokens":1}}}`, stream, stream, 10+stream),
+		`{"type":"content_block_start","index":0,"content_block":{"type":"text","text":""}}`,
+		fmt.Sprintf(`{"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"stream %d"}}`, stream),
+		`{"type":"content_block_stop","index":0}`,
+	}
+	for i := 1; i <= tools; i++ {
+		events = append(events,
+			fmt.Sprintf(`{"type":"content_block_start","index":%d,"content_block":{"type":"tool_use","id":"toolu_%d_%d","name":"tool_%d"}}`, i, stream, i, i),
+			fmt.Sprintf(`{"type":"content_block_delta","index":%d,"delta":{"type":"input_json_delta","partial_json":"{\"stream\":%d}"}}`, i, stream),
+			fmt.Sprintf(`{"type":"content_block_stop","index":%d}`, i),
+		)
+	}
+	return append(events,
+		`{"type":"message_delta","delta":{"stop_reason":"tool_use"},"usage":{"output_tokens":25}}`,
+		`{"type":"message_stop"}`,
+	)
+}
+
+// openAIToolCallChunk is the part of an OpenAI chunk the stream tests inspect
+type openAIToolCallChunk struct {
+	ID      string `json:"id"`
+	Model   string `json:"model"`
+	Choices []struct {
+		Delta struct {
+			ToolCalls []struct {
+				Index    int    `json:"index"`
+				ID       string `json:"id"`
+				Function struct {
+					Arguments string `json:"arguments"`
+				} `json:"function"`
+			} `json:"tool_calls"`
+		} `json:"delta"`
+		FinishReason *string `json:"finish_reason"`
+	} `json:"choices"`
+}
+
+// checkToolChunks verifies that every tool call chunk belongs to the given stream
+// and that tool indexes count up from zero
+func checkToolChunks(t *testing.T, stream int, chunks []openAIToolCallChunk) {
+	t.Helper()
+	seen := 0
+	finishes := 0
+	for _, chunk := range chunks {
+		require.Len(t, chunk.Choices, 1)
+		if chunk.Choices[0].FinishReason != nil {
+			finishes++
+			assert.Equal(t, "tool_calls", *chunk.Choices[0].FinishReason)
+		}
+		for _, call := range chunk.Choices[0].Delta.ToolCalls {
+			// Start chunks have empty arguments, deltas carry the streamed input
+			tool := call.Index + 1
+			assert.Equal(t, fmt.Sprintf("toolu_%d_%d", stream, tool), call.ID)
+			if call.Function.Arguments != "" {
+				assert.Equal(t, fmt.Sprintf(`{"stream":%d}`, stream), call.Function.Arguments)
+				seen++
+			}
+		}
+	}
+	assert.Equal(t, 3, seen)
+	assert.Equal(t, 1, finishes)
+}
+
+func TestStreamConverter_ConcurrentStreams(t *testing.T) {
+	const streams = 50
+
+	var wg sync.WaitGroup
+	for stream := 0; stream < streams; stream++ {
+		wg.Add(1)
+		go func(stream int) {
+			defer wg.Done()
+			converter := NewStreamConverter(fmt.Sprintf("chatcmpl-%d", stream), "default", 1719331200, nil)
+
+			var chunks []openAIToolCallChunk
+			for _, event := range toolStreamEvents(stream, 3) {
+				out, err := converter.Convert("", event)
+				require.NoError(t, err)
+				if out == "" {
+					continue
+				}
+				var chunk openAIToolCallChunk
+				require.NoError(t, json.Unmarshal([]byte(strings.TrimPrefix(strings.TrimSpace(out), "data: ")), &chunk))
+				assert.Equal(t, fmt.Sprintf("chatcmpl-%d", stream), chunk.ID)
+				chunks = append(chunks, chunk)
+			}
+
+			checkToolChunks(t, stream, chunks)
+			assert.Equal(t, fmt.Sprintf("claude-model-%d", stream), converter.Model())
+			assert.Equal(t, Usage{InputTokens: int64(10 + stream), OutputTokens: 25}, converter.Usage())
+		}(stream)
+	}
+	wg.Wait()
+}
+
+func TestProxyHandler_ConcurrentOpenAIStreams(t *testing.T) {
+	const streams = 20
+
+	// Every upstream stream waits until all requests are in flight so their events interleave
+	var started sync.WaitGroup
+	started.Add(streams)
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Messages []struct {
+				Content string `json:"content"`
+			} `json:"messages"`
+		}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+		var stream int
+		fmt.Sscanf(body.Messages[0].Content, "stream %d", &stream)
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.WriteHeader(http.StatusOK)
+		w.(http.Flusher).Flush()
+		started.Done()
+		started.Wait()
+
+		for _, event := range toolStreamEvents(stream, 3) {
+			fmt.Fprintf(w, "data: %s\n\n", event)
+			w.(http.Flusher).Flush()
+		}
+	}))
+	defer upstream.Close()
+
+	handler := NewProxyHandler(&ProxyConfig{
+		UpstreamURL:   upstream.URL,
+		TokenProvider: &mockTokenProvider{token: "test-token"},
+		Transformer:   NewRequestTransformer(),
+	})
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	var wg sync.WaitGroup
+	for stream := 0; stream < streams; stream++ {
+		wg.Add(1)
+		go func(stream int) {
+			defer wg.Done()
+			body := fmt.Sprintf(`{"model":"claude-sonnet-4-20250514","stream":true,"messages":[{"role":"user","content":"stream %d"}]}`, stream)
+			resp, err := http.Post(server.URL+"/v1/chat/completions", "application/json", strings.NewReader(body))
+			require.NoError(t, err)
+			defer resp.Body.Close()
+
+			var chunks []openAIToolCallChunk
+			scanner := bufio.NewScanner(resp.Body)
+			for scanner.Scan() {
+				data, ok := strings.CutPrefix(scanner.Text(), "data: ")
+				if !ok || data == "[DONE]" {
+					continue
+				}
+				var chunk openAIToolCallChunk
+				require.NoError(t, json.Unmarshal([]byte(data), &chunk))
+				chunks = append(chunks, chunk)
+			}
+			require.NoError(t, scanner.Err())
+			checkToolChunks(t, stream, chunks)
+		}(stream)
+	}
+	wg.Wait()
+}
+
+func TestStreamConverter_IncludeUsage(t *testing.T) {
+	events := []string{
+		`{"type":"message_start","message":{"model":"claude-sonnet-4-20250514","usage":{"input_tokens":12,"cache_creation_input_tokens":100,"cache_read_input_tokens":300,"output_tokens":1}}}`,
+		`{"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"Hi"}}`,
+		`{"type":"message_delta","delta":{"stop_reason":"end_turn"},"usage":{"output_tokens":40}}`,
+		`{"type":"message_stop"}`,
+	}
+
+	t.Run("without include_usage", func(t *testing.T) {
+		converter := NewStreamConverter("chatcmpl-1", "default", 1719331200, nil)
+		for _, event := range events {
+			out, err := converter.Convert("", event)
+			require.NoError(t, err)
+			assert.NotContains(t, out, `"usage"`)
+		}
+		assert.Empty(t, converter.UsageChunk())
+		assert.Equal(t, Usage{InputTokens: 12, OutputTokens: 40, CacheCreationInputTokens: 100, CacheReadInputTokens: 300}, converter.Usage())
+	})
+
+	t.Run("with include_usage", func(t *testing.T) {
+		converter := NewStreamConverter("chatcmpl-1", "default", 1719331200, nil)
+		converter.IncludeUsage = true
+		for _, event := range events {
+			out, err := converter.Convert("", event)
+			require.NoError(t, err)
+			if out != "" {
+				assert.Contains(t, out, `"usage":null`)
+			}
+		}
+
+		var chunk map[string]interface{}
+		data := strings.TrimPrefix(strings.TrimSpace(converter.UsageChunk()), "data: ")
+		require.NoError(t, json.Unmarshal([]byte(data), &chunk))
+		assert.Equal(t, []interface{}{}, chunk["choices"])
+		assert.Equal(t, "claude-sonnet-4-20250514", chunk["model"])
+		assert.Equal(t, map[string]interface{}{
+			"prompt_tokens":         float64(412),
+			"completion_tokens":     float64(40),
+			"total_tokens":          float64(452),
+			"prompt_tokens_details": map[string]interface{}{"cached_tokens": float64(300)},
+		}, chunk["usage"])
+	})
+}
+
+func TestProxyHandler_StreamIncludeUsage(t *testing.T) {
+	var upstreamBody map[string]interface{}
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&upstreamBody)
+		w.Header().Set("Content-Type", "text/event-stream")
+		for _, event := range toolStreamEvents(1, 0) {
+			fmt.Fprintf(w, "data: %s\n\n", event)
+		}
+	}))
+	defer upstream.Close()
+
+	handler := NewProxyHandler(&ProxyConfig{
+		UpstreamURL:   upstream.URL,
+		TokenProvider: &mockTokenProvider{token: "test-token"},
+		Transformer:   NewRequestTransformer(),
+	})
+
+	body := `{"model":"claude-sonnet-4-20250514","stream":true,"stream_options":{"include_usage":true},"messages":[{"role":"user","content":"Hi"}]}`
+	req := httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(body))
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	// stream_options is an OpenAI parameter and must not reach the Anthropic API
+	assert.NotContains(t, upstreamBody, "stream_options")
+
+	lines := strings.Split(strings.TrimSpace(w.Body.String()), "\n\n")
+	require.GreaterOrEqual(t, len(lines), 2)
+	assert.Equal(t, "data: [DONE]", lines[len(lines)-1])
+
+	var usageChunk map[string]interface{}
+	require.NoError(t, json.Unmarshal([]byte(strings.TrimPrefix(lines[len(lines)-2], "data: ")), &usageChunk))
+	assert.Empty(t, usageChunk["choices"])
+	usage := usageChunk["usage"].(map[string]interface{})
+	assert.Equal(t, float64(11), usage["prompt_tokens"])
+	assert.Equal(t, float64(25), usage["completion_tokens"])
+	assert.Equal(t, float64(36), usage["total_tokens"])
+}
+
+func TestConvertAnthropicToOpenAI_CachedTokens(t *testing.T) {
+	result, err := ConvertAnthropicToOpenAI([]byte(`{
+		"content": [{"type": "text", "text": "Hi"}],
+		"stop_reason": "end_turn",
+		"usage": {"input_tokens": 5, "cache_creation_input_tokens": 20, "cache_read_input_tokens": 1000, "output_tokens": 7}
+	}`))
+	require.NoError(t, err)
+
+	var response map[string]interface{}
+	require.NoError(t, json.Unmarshal(result, &response))
+	assert.Equal(t, map[string]interface{}{
+		"prompt_tokens":         float64(1025),
+		"completion_tokens":     float64(7),
+		"total_tokens":          float64(1032),
+		"prompt_tokens_details": map[string]interface{}{"cached_tokens": float64(1000)},
+	}, response["usage"])
+}
+
+func TestProxyHandler_NonStreamingUsageFromSSE(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		for _, event := range toolStreamEvents(3, 0) {
+			fmt.Fprintf(w, "data: %s\n\n", event)
+		}
+	}))
+	defer upstream.Close()
+
+	handler := NewProxyHandler(&ProxyConfig{
+		UpstreamURL:   upstream.URL,
+		TokenProvider: &mockTokenProvider{token: "test-token"},
+		Transformer:   NewRequestTransformer(),
+	})
+
+	body := `{"model":"claude-sonnet-4-20250514","messages":[{"role":"user","content":"Hi"}]}`
+	req := httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(body))
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	var response map[string]interface{}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	usage := response["usage"].(map[string]interface{})
+	assert.Equal(t, float64(13), usage["prompt_tokens"])
+	assert.Equal(t, float64(25), usage["completion_tokens"])
+}
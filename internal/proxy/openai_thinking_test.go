@@ -0,0 +1,223 @@
+package proxy
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// thinkingStreamEvents returns an Anthropic stream with a thinking, a redacted thinking and a text block
+func thinkingStreamEvents() []string {
+	return []string{
+		`{"type":"message_start","message":{"id":"msg_t","model":"claude-sonnet-4-20250514","content":[],"usage":{"input_tokens":10,"output_tokens":1}}}`,
+		`{"type":"content_block_start","index":0,"content_block":{"type":"thinking","thinking":"","signature":""}}`,
+		`{"type":"content_block_delta","index":0,"delta":{"type":"thinking_delta","thinking":"Let me "}}`,
+		`{"type":"content_block_delta","index":0,"delta":{"type":"thinking_delta","thinking":"think."}}`,
+		`{"type":"content_block_delta","index":0,"delta":{"type":"signature_delta","signature":"sig-123"}}`,
+		`{"type":"content_block_stop","index":0}`,
+		`{"type":"content_block_start","index":1,"content_block":{"type":"redacted_thinking","data":"encrypted"}}`,
+		`{"type":"content_block_stop","index":1}`,
+		`{"type":"content_block_start","index":2,"content_block":{"type":"text","text":""}}`,
+		`{"type":"content_block_delta","index":2,"delta":{"type":"text_delta","text":"Answer"}}`,
+		`{"type":"content_block_stop","index":2}`,
+		`{"type":"message_delta","delta":{"stop_reason":"end_turn"},"usage":{"output_tokens":30}}`,
+		`{"type":"message_stop"}`,
+	}
+}
+
+func TestConvertOpenAIToAnthropic_ReasoningEffort(t *testing.T) {
+	weatherTool := `"tools": [{"type": "function", "function": {"name": "get_weather", "parameters": {"type": "object"}}}]`
+	tests := []struct {
+		name      string
+		fields    string
+		thinking  interface{}
+		maxTokens float64
+	}{
+		{
+			name:      "budget on top of the default limit",
+			fields:    `"reasoning_effort": "medium"`,
+			thinking:  map[string]interface{}{"type": "enabled", "budget_tokens": float64(8192)},
+			maxTokens: 16384,
+		},
+		{
+			name:      "budget within the requested limit",
+			fields:    `"reasoning_effort": "low", "max_completion_tokens": 4096`,
+			thinking:  map[string]interface{}{"type": "enabled", "budget_tokens": float64(2048)},
+			maxTokens: 4096,
+		},
+		{
+			name:      "budget capped to half of a small limit",
+			fields:    `"reasoning_effort": "high", "max_tokens": 6000`,
+			thinking:  map[string]interface{}{"type": "enabled", "budget_tokens": float64(3000)},
+			maxTokens: 6000,
+		},
+		{
+			name:      "none disables thinking",
+			fields:    `"reasoning_effort": "none"`,
+			maxTokens: 8192,
+		},
+		{
+			name:      "explicit thinking wins",
+			fields:    `"reasoning_effort": "high", "thinking": {"type": "enabled", "budget_tokens": 1024}`,
+			thinking:  map[string]interface{}{"type": "enabled", "budget_tokens": float64(1024)},
+			maxTokens: 8192,
+		},
+		{
+			name:      "temperature 1 and a high top_p are allowed",
+			fields:    `"reasoning_effort": "low", "temperature": 1, "top_p": 0.95`,
+			thinking:  map[string]interface{}{"type": "enabled", "budget_tokens": float64(2048)},
+			maxTokens: 10240,
+		},
+		{
+			name:      "tool_choice auto is allowed",
+			fields:    `"reasoning_effort": "low", ` + weatherTool + `, "tool_choice": "auto"`,
+			thinking:  map[string]interface{}{"type": "enabled", "budget_tokens": float64(2048)},
+			maxTokens: 10240,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			request := convertOpenAIJSON(t, `{"model": "claude-sonnet-4-20250514", "messages": [], `+tt.fields+`}`)
+			assert.Equal(t, tt.thinking, request["thinking"])
+			assert.Equal(t, tt.maxTokens, request["max_tokens"])
+			assert.NotContains(t, request, "reasoning_effort")
+		})
+	}
+
+	rejected := []string{
+		`"reasoning_effort": "extreme"`,
+		`"reasoning_effort": 3`,
+		`"reasoning_effort": "low", "max_tokens": 2000`,
+		// The Messages API refuses thinking with forced tool use or modified sampling
+		`"reasoning_effort": "low", "response_format": {"type": "json_schema", "json_schema": {"name": "answer", "schema": {"type": "object"}}}`,
+		`"reasoning_effort": "low", ` + weatherTool + `, "tool_choice": "required"`,
+		`"reasoning_effort": "low", ` + weatherTool + `, "tool_choice": {"type": "function", "function": {"name": "get_weather"}}`,
+		`"reasoning_effort": "low", "temperature": 0.7`,
+		`"reasoning_effort": "low", "top_p": 0.5`,
+		`"reasoning_effort": "low", "top_k": 40`,
+	}
+	for _, fields := range rejected {
+		_, err := ConvertOpenAIToAnthropic([]byte(`{"model": "claude-sonnet-4-20250514", "messages": [], ` + fields + `}`))
+		var invalid *invalidRequestError
+		assert.True(t, errors.As(err, &invalid), "expected invalid request error for %s, got %v", fields, err)
+	}
+}
+
+func TestConvertAnthropicToOpenAI_ReasoningContent(t *testing.T) {
+	body := []byte(`{
+		"id": "msg_t", "model": "claude-sonnet-4-20250514", "stop_reason": "end_turn",
+		"content": [
+			{"type": "thinking", "thinking": "Let me think.", "signature": "sig-123"},
+			{"type": "redacted_thinking", "data": "encrypted"},
+			{"type": "text", "text": "Answer"}
+		]
+	}`)
+
+	result, err := convertAnthropicResponse(body, responseOptions{})
+	require.NoError(t, err)
+	var response struct {
+		Choices []struct {
+			Message map[string]interface{} `json:"message"`
+		} `json:"choices"`
+	}
+	require.NoError(t, json.Unmarshal(result, &response))
+	assert.Equal(t, map[string]interface{}{
+		"role":              "assistant",
+		"content":           "Answer",
+		"reasoning_content": "Let me think.",
+	}, response.Choices[0].Message)
+
+	result, err = convertAnthropicResponse(body, responseOptions{hideReasoning: true})
+	require.NoError(t, err)
+	assert.NotContains(t, string(result), "reasoning_content")
+}
+
+func TestStreamConverter_ReasoningContent(t *testing.T) {
+	convert := func(hide bool) (reasoning, content string) {
+		converter := NewStreamConverter("chatcmpl-1", "claude", 0, nil)
+		converter.HideReasoning = hide
+		for _, event := range thinkingStreamEvents() {
+			chunk, err := converter.Convert("", event)
+			require.NoError(t, err)
+			if chunk == "" {
+				continue
+			}
+			var parsed struct {
+				Choices []struct {
+					Delta map[string]interface{} `json:"delta"`
+				} `json:"choices"`
+			}
+			require.NoError(t, json.Unmarshal([]byte(strings.TrimPrefix(strings.TrimSpace(chunk), "data: ")), &parsed))
+			delta := parsed.Choices[0].Delta
+			assert.NotContains(t, delta, "signature")
+			if text, ok := delta["reasoning_content"].(string); ok {
+				reasoning += text
+			}
+			if text, ok := delta["content"].(string); ok {
+				content += text
+			}
+		}
+		return reasoning, content
+	}
+
+	reasoning, content := convert(false)
+	assert.Equal(t, "Let me think.", reasoning)
+	assert.Equal(t, "Answer", content)
+
+	reasoning, content = convert(true)
+	assert.Empty(t, reasoning)
+	assert.Equal(t, "Answer", content)
+}
+
+func TestProxyHandler_ThinkingFromSSE(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		for _, event := range thinkingStreamEvents() {
+			fmt.Fprintf(w, "data: %s\n\n", event)
+		}
+	}))
+	defer upstream.Close()
+
+	serve := func(transformer *RequestTransformer, path string) map[string]interface{} {
+		handler := NewProxyHandler(&ProxyConfig{
+			UpstreamURL:   upstream.URL,
+			TokenProvider: &mockTokenProvider{token: "test-token"},
+			Transformer:   transformer,
+		})
+		body := `{"model": "claude-sonnet-4-20250514", "max_tokens": 2048, "thinking": {"type": "enabled", "budget_tokens": 1024}, "messages": [{"role": "user", "content": "Hi"}]}`
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest("POST", path, strings.NewReader(body)))
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+		var response map[string]interface{}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		return response
+	}
+
+	t.Run("native blocks keep their signatures", func(t *testing.T) {
+		response := serve(NewRequestTransformer(), "/v1/messages")
+		assert.Equal(t, []interface{}{
+			map[string]interface{}{"type": "thinking", "thinking": "Let me think.", "signature": "sig-123"},
+			map[string]interface{}{"type": "redacted_thinking", "data": "encrypted"},
+			map[string]interface{}{"type": "text", "text": "Answer"},
+		}, response["content"])
+	})
+
+	t.Run("openai reasoning can be hidden", func(t *testing.T) {
+		message := serve(NewRequestTransformer(), "/v1/chat/completions")["choices"].([]interface{})[0].(map[string]interface{})["message"]
+		assert.Equal(t, "Let me think.", message.(map[string]interface{})["reasoning_content"])
+
+		hidden := NewRequestTransformerWithConfig(TransformerConfig{HideReasoning: true})
+		message = serve(hidden, "/v1/chat/completions")["choices"].([]interface{})[0].(map[string]interface{})["message"]
+		assert.NotContains(t, message, "reasoning_content")
+		assert.Equal(t, "Answer", message.(map[string]interface{})["content"])
+	})
+}
@@ -0,0 +1,209 @@
+package proxy
+
+import (
+	"bytes"
+	"encoding/json"
+)
+
+// openAITool is a tool definition in an OpenAI chat completions request
+type openAITool struct {
+	Type     string `json:"type"`
+	Function struct {
+		Name        string          `json:"name"`
+		Description string          `json:"description,omitempty"`
+		Parameters  json.RawMessage `json:"parameters,omitempty"`
+	} `json:"function"`
+}
+
+// openAIToolCall is a function call made by the assistant in an OpenAI message
+type openAIToolCall struct {
+	ID       string `json:"id"`
+	Type     string `json:"type"`
+	Function struct {
+		Name      string `json:"name"`
+		Arguments string `json:"arguments"`
+	} `json:"function"`
+}
+
+// emptyInputSchema is used for functions declared without parameters
+var emptyInputSchema = json.RawMessage(`{"type":"object","properties":{}}`)
+
+// convertOpenAITools converts OpenAI function tools to Anthropic tools
+func convertOpenAITools(raw json.RawMessage) ([]interface{}, error) {
+	var tools []openAITool
+	if err := json.Unmarshal(raw, &tools); err != nil {
+		return nil, newInvalidRequestError("tools must be an array of function tools: %v", err)
+	}
+
+	anthropicTools := make([]interface{}, 0, len(tools))
+	for i, tool := range tools {
+		if tool.Type != "function" {
+			return nil, newInvalidRequestError("tools[%d]: unsupported tool type %q, only \"function\" is supported", i, tool.Type)
+		}
+		if tool.Function.Name == "" {
+			return nil, newInvalidRequestError("tools[%d]: function name is required", i)
+		}
+
+		schema := tool.Function.Parameters
+		if isJSONNull(schema) {
+			schema = emptyInputSchema
+		}
+
+		anthropicTool := map[string]interface{}{
+			"name":         tool.Function.Name,
+			"input_schema": schema,
+		}
+		if tool.Function.Description != "" {
+			anthropicTool["description"] = tool.Function.Description
+		}
+		anthropicTools = append(anthropicTools, anthropicTool)
+	}
+	return anthropicTools, nil
+}
+
+// convertOpenAIToolChoice converts an OpenAI tool_choice and parallel_tool_calls setting
+// to an Anthropic tool_choice. It returns nil when neither is set.
+func convertOpenAIToolChoice(raw json.RawMessage, hasChoice bool, parallelToolCalls *bool) (map[string]interface{}, error) {
+	choice := map[string]interface{}{"type": "auto"}
+
+	if hasChoice {
+		var mode string
+		var named struct {
+			Type     string `json:"type"`
+			Function struct {
+				Name string `json:"name"`
+			} `json:"function"`
+		}
+		switch {
+		case json.Unmarshal(raw, &mode) == nil:
+			switch mode {
+			case "auto":
+			case "none":
+				choice["type"] = "none"
+			case "required":
+				choice["type"] = "any"
+			default:
+				return nil, newInvalidRequestError("unsupported tool_choice %q, expected \"auto\", \"none\", \"required\" or a named function", mode)
+			}
+		case json.Unmarshal(raw, &named) == nil && named.Type == "function" && named.Function.Name != "":
+			choice["type"] = "tool"
+			choice["name"] = named.Function.Name
+		default:
+			return nil, newInvalidRequestError("tool_choice must be a string or {\"type\": \"function\", \"function\": {\"name\": ...}}")
+		}
+	} else if parallelToolCalls == nil {
+		return nil, nil
+	}
+
+	// Anthropic has no parallel setting when tools are disabled
+	if parallelToolCalls != nil && !*parallelToolCalls && choice["type"] != "none" {
+		choice["disable_parallel_tool_use"] = true
+	}
+	return choice, nil
+}
+
+// assistantToolUseContent builds the content blocks of an assistant message with tool calls
+func assistantToolUseContent(content json.RawMessage, toolCalls []openAIToolCall) ([]interface{}, error) {
+	var blocks []interface{}
+
+	// Keep any text the assistant produced before calling tools
+	var text string
+	var parts []json.RawMessage
+	if json.Unmarshal(content, &text) == nil {
+		if text != "" {
+			blocks = append(blocks, map[string]interface{}{"type": "text", "text": text})
+		}
+	} else if json.Unmarshal(content, &parts) == nil {
+		for i, part := range parts {
+			block, err := convertOpenAIContentPart(part)
+			if err != nil {
+				return nil, newInvalidRequestError("content[%d]: %v", i, err)
+			}
+			blocks = append(blocks, block)
+		}
+	}
+
+	for i, call := range toolCalls {
+		if call.ID == "" || call.Function.Name == "" {
+			return nil, newInvalidRequestError("tool_calls[%d]: id and function name are required", i)
+		}
+
+		input, ok := toolUseInput(call.Function.Arguments)
+		if !ok {
+			return nil, newInvalidRequestError("tool_calls[%d]: function arguments must be a JSON object", i)
+		}
+
+		blocks = append(blocks, map[string]interface{}{
+			"type":  "tool_use",
+			"id":    call.ID,
+			"name":  call.Function.Name,
+			"input": input,
+		})
+	}
+	return blocks, nil
+}
+
+// toolUseInput converts JSON-encoded function arguments to the input of a tool_use block.
+// Empty arguments become an empty object; anything but a JSON object is rejected.
+func toolUseInput(arguments string) (json.RawMessage, bool) {
+	input := json.RawMessage(bytes.TrimSpace([]byte(arguments)))
+	if len(input) == 0 {
+		return json.RawMessage("{}"), true
+	}
+	var object map[string]json.RawMessage
+	if json.Unmarshal(input, &object) != nil || object == nil {
+		return nil, false
+	}
+	return input, true
+}
+
+// toolResultBlock converts an OpenAI tool message to an Anthropic tool_result block
+func toolResultBlock(toolCallID string, content json.RawMessage) (map[string]interface{}, error) {
+	if toolCallID == "" {
+		return nil, newInvalidRequestError("tool messages require tool_call_id")
+	}
+	block := map[string]interface{}{
+		"type":        "tool_result",
+		"tool_use_id": toolCallID,
+	}
+	// String content and arrays of text and image parts are both valid tool_result content
+	if !isJSONNull(content) {
+		converted, err := convertOpenAIContent(content)
+		if err != nil {
+			return nil, err
+		}
+		block["content"] = converted
+	}
+	return block, nil
+}
+
+// isJSONNull reports whether a raw value is missing or null
+func isJSONNull(raw json.RawMessage) bool {
+	trimmed := bytes.TrimSpace(raw)
+	return len(trimmed) == 0 || bytes.Equal(trimmed, []byte("null"))
+}
+
+// openAIToolCallFromBlock converts an Anthropic tool_use block to an OpenAI tool call.
+// OpenAI clients expect the arguments as a JSON-encoded string.
+func openAIToolCallFromBlock(block map[string]interface{}) (map[string]interface{}, error) {
+	id, _ := block["id"].(string)
+	name, _ := block["name"].(string)
+
+	input := block["input"]
+	if input == nil {
+		input = map[string]interface{}{}
+	}
+	arguments, err := json.Marshal(input)
+	if err != nil {
+		return nil, err
+	}
+
+	return map[string]interface{}{
+		"id":   id,
+		"type": "function",
+		"function": map[string]interface{}{
+			"name":      name,
+			"arguments": string(arguments),
+		},
+	}, nil
+}
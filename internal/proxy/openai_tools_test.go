@@ -0,0 +1,309 @@
+package proxy
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func convertOpenAIJSON(t *testing.T, body string) map[string]interface{} {
+	t.Helper()
+	result, err := ConvertOpenAIToAnthropic([]byte(body))
+	require.NoError(t, err)
+
+	var anthropicRequest map[string]interface{}
+	require.NoError(t, json.Unmarshal(result, &anthropicRequest))
+	return anthropicRequest
+}
+
+func TestConvertOpenAIToAnthropic_Tools(t *testing.T) {
+	request := convertOpenAIJSON(t, `{
+		"model": "claude-sonnet-4-20250514",
+		"messages": [{"role": "user", "content": "What's the weather in Paris?"}],
+		"tools": [{
+			"type": "function",
+			"function": {
+				"name": "get_weather",
+				"description": "Get the current weather",
+				"parameters": {"type": "object", "properties": {"city": {"type": "string"}}, "required": ["city"]}
+			}
+		}],
+		"tool_choice": "required",
+		"parallel_tool_calls": false
+	}`)
+
+	assert.Equal(t, []interface{}{
+		map[string]interface{}{
+			"name":        "get_weather",
+			"description": "Get the current weather",
+			"input_schema": map[string]interface{}{
+				"type":       "object",
+				"properties": map[string]interface{}{"city": map[string]interface{}{"type": "string"}},
+				"required":   []interface{}{"city"},
+			},
+		},
+	}, request["tools"])
+	assert.Equal(t, map[string]interface{}{"type": "any", "disable_parallel_tool_use": true}, request["tool_choice"])
+	assert.NotContains(t, request, "parallel_tool_calls")
+}
+
+func TestConvertOpenAIToolChoice(t *testing.T) {
+	disabled := false
+	enabled := true
+
+	tests := []struct {
+		name     string
+		choice   string
+		parallel *bool
+		expected map[string]interface{}
+	}{
+		{"not set", "", nil, nil},
+		{"auto", `"auto"`, nil, map[string]interface{}{"type": "auto"}},
+		{"none", `"none"`, nil, map[string]interface{}{"type": "none"}},
+		{"required", `"required"`, nil, map[string]interface{}{"type": "any"}},
+		{"named function", `{"type": "function", "function": {"name": "get_weather"}}`, nil, map[string]interface{}{"type": "tool", "name": "get_weather"}},
+		{"parallel disabled without choice", "", &disabled, map[string]interface{}{"type": "auto", "disable_parallel_tool_use": true}},
+		{"parallel enabled without choice", "", &enabled, map[string]interface{}{"type": "auto"}},
+		{"parallel disabled with none", `"none"`, &disabled, map[string]interface{}{"type": "none"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			choice, err := convertOpenAIToolChoice(json.RawMessage(tt.choice), tt.choice != "", tt.parallel)
+			require.NoError(t, err)
+			if tt.expected == nil {
+				assert.Nil(t, choice)
+			} else {
+				assert.Equal(t, tt.expected, choice)
+			}
+		})
+	}
+
+	t.Run("rejects unknown values", func(t *testing.T) {
+		for _, choice := range []string{`"sometimes"`, `{"type": "function"}`, `42`} {
+			_, err := convertOpenAIToolChoice(json.RawMessage(choice), true, nil)
+			var invalid *invalidRequestError
+			assert.True(t, errors.As(err, &invalid), choice)
+		}
+	})
+}
+
+func TestConvertOpenAIToAnthropic_ToolConversation(t *testing.T) {
+	request := convertOpenAIJSON(t, `{
+		"model": "claude-sonnet-4-20250514",
+		"messages": [
+			{"role": "user", "content": "Weather in Paris and Rome?"},
+			{"role": "assistant", "content": "Let me check.", "tool_calls": [
+				{"id": "call_1", "type": "function", "function": {"name": "get_weather", "arguments": "{\"city\":\"Paris\"}"}},
+				{"id": "call_2", "type": "function", "function": {"name": "get_weather", "arguments": "{\"city\":\"Rome\"}"}}
+			]},
+			{"role": "tool", "tool_call_id": "call_1", "content": "18C and sunny"},
+			{"role": "tool", "tool_call_id": "call_2", "content": [{"type": "text", "text": "22C"}]},
+			{"role": "assistant", "content": null, "tool_calls": [
+				{"id": "call_3", "type": "function", "function": {"name": "get_time", "arguments": ""}}
+			]},
+			{"role": "tool", "tool_call_id": "call_3", "content": "12:00"},
+			{"role": "user", "content": "Thanks"}
+		],
+		"tools": [
+			{"type": "function", "function": {"name": "get_weather", "parameters": {"type": "object"}}},
+			{"type": "function", "function": {"name": "get_time"}}
+		]
+	}`)
+
+	messages := request["messages"].([]interface{})
+	require.Len(t, messages, 6)
+
+	assistant := messages[1].(map[string]interface{})
+	assert.Equal(t, "assistant", assistant["role"])
+	assert.Equal(t, []interface{}{
+		map[string]interface{}{"type": "text", "text": "Let me check."},
+		map[string]interface{}{"type": "tool_use", "id": "call_1", "name": "get_weather", "input": map[string]interface{}{"city": "Paris"}},
+		map[string]interface{}{"type": "tool_use", "id": "call_2", "name": "get_weather", "input": map[string]interface{}{"city": "Rome"}},
+	}, assistant["content"])
+
+	// Consecutive tool messages are merged into one user message
+	results := messages[2].(map[string]interface{})
+	assert.Equal(t, "user", results["role"])
+	assert.Equal(t, []interface{}{
+		map[string]interface{}{"type": "tool_result", "tool_use_id": "call_1", "content": "18C and sunny"},
+		map[string]interface{}{"type": "tool_result", "tool_use_id": "call_2", "content": []interface{}{
+			map[string]interface{}{"type": "text", "text": "22C"},
+		}},
+	}, results["content"])
+
+	// Assistant messages without text only carry tool_use blocks, empty arguments become {}
+	assert.Equal(t, []interface{}{
+		map[string]interface{}{"type": "tool_use", "id": "call_3", "name": "get_time", "input": map[string]interface{}{}},
+	}, messages[3].(map[string]interface{})["content"])
+
+	assert.Equal(t, "user", messages[4].(map[string]interface{})["role"])
+	assert.Equal(t, "Thanks", messages[5].(map[string]interface{})["content"])
+
+	// No tool_choice is sent unless the client asked for one
+	assert.NotContains(t, request, "tool_choice")
+}
+
+func TestConvertOpenAIToAnthropic_InvalidTools(t *testing.T) {
+	tests := map[string]string{
+		"non-function tool":    `{"messages": [], "tools": [{"type": "retrieval"}]}`,
+		"tool without name":    `{"messages": [], "tools": [{"type": "function", "function": {}}]}`,
+		"non-object arguments": `{"messages": [{"role": "assistant", "tool_calls": [{"id": "c", "type": "function", "function": {"name": "f", "arguments": "[1]"}}]}]}`,
+		"malformed arguments":  `{"messages": [{"role": "assistant", "tool_calls": [{"id": "c", "type": "function", "function": {"name": "f", "arguments": "{"}}]}]}`,
+		"tool without call id": `{"messages": [{"role": "tool", "content": "x"}]}`,
+		"unknown tool_choice":  `{"messages": [], "tools": [{"type": "function", "function": {"name": "f"}}], "tool_choice": "always"}`,
+		"malformed tool_calls": `{"messages": [{"role": "assistant", "tool_calls": "nope"}]}`,
+		"numeric content":      `{"messages": [{"role": "user", "content": 42}]}`,
+		"object content":       `{"messages": [{"role": "user", "content": {"text": "Hi"}}]}`,
+		"null content":         `{"messages": [{"role": "assistant", "content": null}]}`,
+		"missing content":      `{"messages": [{"role": "user"}]}`,
+	}
+
+	for name, body := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := ConvertOpenAIToAnthropic([]byte(body))
+			var invalid *invalidRequestError
+			assert.True(t, errors.As(err, &invalid), "expected invalid request error, got %v", err)
+		})
+	}
+}
+
+func TestProxyHandler_InvalidToolsReturn400(t *testing.T) {
+	handler := NewProxyHandler(&ProxyConfig{
+		UpstreamURL:   "http://127.0.0.1:0",
+		TokenProvider: &mockTokenProvider{token: "test-token"},
+		Transformer:   NewRequestTransformer(),
+	})
+
+	body := `{"model": "claude-sonnet-4-20250514", "messages": [{"role": "tool", "content": "x"}]}`
+	req := httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(body))
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	var response map[string]interface{}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	errorObj := response["error"].(map[string]interface{})
+	assert.Equal(t, "invalid_request_error", errorObj["type"])
+	assert.Contains(t, errorObj["message"], "tool_call_id")
+}
+
+func TestConvertAnthropicToOpenAI_ToolCalls(t *testing.T) {
+	t.Run("tool calls only", func(t *testing.T) {
+		result, err := ConvertAnthropicToOpenAI([]byte(`{
+			"id": "msg_1",
+			"model": "claude-sonnet-4-20250514",
+			"content": [
+				{"type": "tool_use", "id": "toolu_1", "name": "get_weather", "input": {"city": "Paris"}},
+				{"type": "tool_use", "id": "toolu_2", "name": "get_time", "input": {}}
+			],
+			"stop_reason": "tool_use"
+		}`))
+		require.NoError(t, err)
+
+		var response map[string]interface{}
+		require.NoError(t, json.Unmarshal(result, &response))
+		choice := response["choices"].([]interface{})[0].(map[string]interface{})
+		assert.Equal(t, "tool_calls", choice["finish_reason"])
+
+		message := choice["message"].(map[string]interface{})
+		assert.Contains(t, message, "content")
+		assert.Nil(t, message["content"])
+		assert.Equal(t, []interface{}{
+			map[string]interface{}{
+				"id":       "toolu_1",
+				"type":     "function",
+				"function": map[string]interface{}{"name": "get_weather", "arguments": `{"city":"Paris"}`},
+			},
+			map[string]interface{}{
+				"id":       "toolu_2",
+				"type":     "function",
+				"function": map[string]interface{}{"name": "get_time", "arguments": `{}`},
+			},
+		}, message["tool_calls"])
+	})
+
+	t.Run("text and tool calls", func(t *testing.T) {
+		result, err := ConvertAnthropicToOpenAI([]byte(`{
+			"content": [
+				{"type": "text", "text": "Let me check."},
+				{"type": "tool_use", "id": "toolu_1", "name": "get_weather", "input": {"city": "Paris"}}
+			],
+			"stop_reason": "tool_use"
+		}`))
+		require.NoError(t, err)
+
+		var response map[string]interface{}
+		require.NoError(t, json.Unmarshal(result, &response))
+		message := response["choices"].([]interface{})[0].(map[string]interface{})["message"].(map[string]interface{})
+		assert.Equal(t, "Let me check.", message["content"])
+		assert.Len(t, message["tool_calls"], 1)
+	})
+}
+
+func TestOpenAIFinishReason(t *testing.T) {
+	assert.Equal(t, "stop", openAIFinishReason("end_turn"))
+	assert.Equal(t, "stop", openAIFinishReason("stop_sequence"))
+	assert.Equal(t, "length", openAIFinishReason("max_tokens"))
+	assert.Equal(t, "tool_calls", openAIFinishReason("tool_use"))
+	assert.Equal(t, "content_filter", openAIFinishReason("refusal"))
+	assert.Equal(t, "stop", openAIFinishReason(""))
+}
+
+func TestProxyHandler_NonStreamingToolCallsFromSSE(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		events := []string{
+			`{"type":"message_start","message":{"id":"msg_1","model":"claude-sonnet-4-20250514","role":"assistant","content":[],"usage":{"input_tokens":10,"output_tokens":0}}}`,
+			`{"type":"content_block_start","index":0,"content_block":{"type":"text","text":""}}`,
+			`{"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"Checking "}}`,
+			`{"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"both."}}`,
+			`{"type":"content_block_stop","index":0}`,
+			`{"type":"content_block_start","index":1,"content_block":{"type":"tool_use","id":"toolu_1","name":"get_weather","input":{}}}`,
+			`{"type":"content_block_delta","index":1,"delta":{"type":"input_json_delta","partial_json":"{\"city\":"}}`,
+			`{"type":"content_block_delta","index":1,"delta":{"type":"input_json_delta","partial_json":"\"Paris\"}"}}`,
+			`{"type":"content_block_stop","index":1}`,
+			`{"type":"content_block_start","index":2,"content_block":{"type":"tool_use","id":"toolu_2","name":"get_time","input":{}}}`,
+			`{"type":"content_block_stop","index":2}`,
+			`{"type":"message_delta","delta":{"stop_reason":"tool_use","stop_sequence":null},"usage":{"output_tokens":30}}`,
+			`{"type":"message_stop"}`,
+		}
+		for _, event := range events {
+			w.Write([]byte("data: " + event + "\n\n"))
+		}
+	}))
+	defer upstream.Close()
+
+	handler := NewProxyHandler(&ProxyConfig{
+		UpstreamURL:   upstream.URL,
+		TokenProvider: &mockTokenProvider{token: "test-token"},
+		Transformer:   NewRequestTransformer(),
+	})
+
+	body := `{"model": "claude-sonnet-4-20250514", "messages": [{"role": "user", "content": "Weather and time in Paris?"}]}`
+	req := httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(body))
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	require.Equal(t, http.StatusOK, w.Code)
+	var response map[string]interface{}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+
+	choice := response["choices"].([]interface{})[0].(map[string]interface{})
+	assert.Equal(t, "tool_calls", choice["finish_reason"])
+
+	message := choice["message"].(map[string]interface{})
+	assert.Equal(t, "Checking both.", message["content"])
+	toolCalls := message["tool_calls"].([]interface{})
+	require.Len(t, toolCalls, 2)
+	assert.Equal(t, map[string]interface{}{"name": "get_weather", "arguments": `{"city":"Paris"}`},
+		toolCalls[0].(map[string]interface{})["function"])
+	assert.Equal(t, map[string]interface{}{"name": "get_time", "arguments": `{}`},
+		toolCalls[1].(map[string]interface{})["function"])
+}
@@ -0,0 +1,296 @@
+package proxy
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ml0-1337/claude-gate/internal/auth"
+)
+
+// Proxy authentication errors
+var (
+	errMissingCredentials = errors.New("missing proxy authentication token")
+	errInvalidCredentials = errors.New("invalid proxy authentication token")
+)
+
+// keyCheckInterval is how often a proxy without keys checks the registry for a first key
+const keyCheckInterval = 5 * time.Second
+
+// KeyLookup resolves per-client virtual API keys
+type KeyLookup interface {
+	// Lookup returns the key matching a presented secret
+	Lookup(secret string) (*auth.ProxyKey, error)
+
+	// Count returns the number of keys ever issued
+	Count() (int, error)
+}
+
+// ClientIdentity describes the authenticated caller of a proxy request
+type ClientIdentity struct {
+	Name  string
+	Key   *auth.ProxyKey // nil for the shared token or when authentication is disabled
+	usage *keyUsage
+}
+
+// identityKey is the context key for the client identity
+type identityKey struct{}
+
+// WithClientIdentity attaches a client identity to the context
+func WithClientIdentity(ctx context.Context, identity *ClientIdentity) context.Context {
+	return context.WithValue(ctx, identityKey{}, identity)
+}
+
+// ClientIdentityFromContext returns the client identity attached to the context, if any
+func ClientIdentityFromContext(ctx context.Context) *ClientIdentity {
+	identity, _ := ctx.Value(identityKey{}).(*ClientIdentity)
+	return identity
+}
+
+// AllowsModel checks the key's model scope; the shared token may use any model
+func (c *ClientIdentity) AllowsModel(model string) bool {
+	if c == nil || c.Key == nil {
+		return true
+	}
+	return c.Key.AllowsModel(model)
+}
+
+// RecordUsage adds the tokens of a completed response to the key's daily quota
+func (c *ClientIdentity) RecordUsage(usage Usage) {
+	if c == nil || c.usage == nil {
+		return
+	}
+	c.usage.addTokens(usage.Total())
+}
+
+// ProxyAuth validates client credentials presented to the proxy itself.
+// It is independent from the OAuth token that is injected for the upstream API.
+// Clients authenticate with the shared token or with a virtual key from the key registry.
+type ProxyAuth struct {
+	tokenHash [sha256.Size]byte
+	hasToken  bool
+	keys      KeyLookup
+
+	// keysIssued caches whether the registry has ever issued a key. Revoked keys stay in
+	// the registry, so once set it never needs checking again.
+	keysMu      sync.Mutex
+	keysIssued  bool
+	keysChecked time.Time
+
+	usageMu sync.Mutex
+	usage   map[string]*keyUsage
+}
+
+// NewProxyAuth creates a proxy authenticator. An empty token disables authentication.
+func NewProxyAuth(token string) *ProxyAuth {
+	return NewProxyAuthWithKeys(token, nil)
+}
+
+// NewProxyAuthWithKeys creates a proxy authenticator that also accepts virtual keys.
+// Authentication is enabled when a shared token is set or any key has been issued.
+func NewProxyAuthWithKeys(token string, keys KeyLookup) *ProxyAuth {
+	a := &ProxyAuth{
+		keys:  keys,
+		usage: make(map[string]*keyUsage),
+	}
+	if token != "" {
+		a.tokenHash = sha256.Sum256([]byte(token))
+		a.hasToken = true
+	}
+	return a
+}
+
+// Enabled reports whether clients must authenticate
+func (a *ProxyAuth) Enabled() bool {
+	if a == nil {
+		return false
+	}
+	if a.hasToken {
+		return true
+	}
+	if a.keys != nil {
+		return a.hasKeys(time.Now())
+	}
+	return false
+}
+
+// hasKeys reports whether any key has been issued, reading the registry at most once per
+// keyCheckInterval rather than on every request
+func (a *ProxyAuth) hasKeys(now time.Time) bool {
+	a.keysMu.Lock()
+	defer a.keysMu.Unlock()
+
+	if a.keysIssued || (!a.keysChecked.IsZero() && now.Sub(a.keysChecked) < keyCheckInterval) {
+		return a.keysIssued
+	}
+	count, err := a.keys.Count()
+	if err != nil {
+		// Fail closed if the registry cannot be read, and read it again next time
+		return true
+	}
+	a.keysIssued = count > 0
+	a.keysChecked = now
+	return a.keysIssued
+}
+
+// Status returns the authentication state as reported by /health and /
+func (a *ProxyAuth) Status() string {
+	if a.Enabled() {
+		return "enabled"
+	}
+	return "disabled"
+}
+
+// Identify resolves the caller of a request without recording any usage
+func (a *ProxyAuth) Identify(r *http.Request) (*ClientIdentity, error) {
+	if !a.Enabled() {
+		return &ClientIdentity{Name: "anonymous"}, nil
+	}
+
+	presented := extractClientToken(r)
+	if presented == "" {
+		return nil, errMissingCredentials
+	}
+
+	if a.hasToken {
+		// Compare fixed-size digests so neither content nor length leaks through timing
+		presentedHash := sha256.Sum256([]byte(presented))
+		if subtle.ConstantTimeCompare(presentedHash[:], a.tokenHash[:]) == 1 {
+			return &ClientIdentity{Name: "shared"}, nil
+		}
+	}
+
+	if a.keys != nil {
+		key, err := a.keys.Lookup(presented)
+		if err == nil {
+			return &ClientIdentity{
+				Name:  key.Name,
+				Key:   key,
+				usage: a.usageFor(key.ID),
+			}, nil
+		}
+		if errors.Is(err, auth.ErrProxyKeyRevoked) || errors.Is(err, auth.ErrProxyKeyExpired) {
+			return nil, err
+		}
+	}
+
+	return nil, errInvalidCredentials
+}
+
+// Authenticate checks the request credentials
+func (a *ProxyAuth) Authenticate(r *http.Request) bool {
+	_, err := a.Identify(r)
+	return err == nil
+}
+
+// Middleware wraps a handler, rejects unauthenticated or out-of-scope requests
+// and attaches the client identity to the request context
+func (a *ProxyAuth) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// CORS preflight requests never carry credentials
+		if r.Method == "OPTIONS" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		identity, err := a.Identify(r)
+		if err != nil {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="claude-gate"`)
+			writeAPIError(w, r.URL.Path, http.StatusUnauthorized, "authentication_error", err.Error())
+			return
+		}
+
+		if identity.Key != nil {
+			if !identity.Key.AllowsEndpoint(r.URL.Path) {
+				writeAPIError(w, r.URL.Path, http.StatusForbidden, "permission_error",
+					fmt.Sprintf("key %q is not allowed to call %s", identity.Name, r.URL.Path))
+				return
+			}
+			if err := identity.usage.admit(identity.Key, time.Now()); err != nil {
+				writeAPIError(w, r.URL.Path, http.StatusTooManyRequests, "rate_limit_error", err.Error())
+				return
+			}
+		}
+
+		next.ServeHTTP(w, r.WithContext(WithClientIdentity(r.Context(), identity)))
+	})
+}
+
+// usageFor returns the daily usage counters of a key
+func (a *ProxyAuth) usageFor(keyID string) *keyUsage {
+	a.usageMu.Lock()
+	defer a.usageMu.Unlock()
+
+	usage, ok := a.usage[keyID]
+	if !ok {
+		usage = &keyUsage{}
+		a.usage[keyID] = usage
+	}
+	return usage
+}
+
+// keyUsage tracks the requests and tokens a key consumed during the current UTC day.
+// Counters live in memory and start over when the proxy restarts.
+type keyUsage struct {
+	mu       sync.Mutex
+	day      string
+	requests int64
+	tokens   int64
+}
+
+// admit checks the daily quotas of a key and counts the request
+func (u *keyUsage) admit(key *auth.ProxyKey, now time.Time) error {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	u.rollover(now)
+	if key.DailyRequestQuota > 0 && u.requests >= key.DailyRequestQuota {
+		return fmt.Errorf("daily request quota of %d exceeded for key %q", key.DailyRequestQuota, key.Name)
+	}
+	if key.DailyTokenQuota > 0 && u.tokens >= key.DailyTokenQuota {
+		return fmt.Errorf("daily token quota of %d exceeded for key %q", key.DailyTokenQuota, key.Name)
+	}
+	u.requests++
+	return nil
+}
+
+// addTokens records tokens consumed by a response
+func (u *keyUsage) addTokens(tokens int64) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	u.rollover(time.Now())
+	u.tokens += tokens
+}
+
+// rollover resets the counters when the UTC day changes
+func (u *keyUsage) rollover(now time.Time) {
+	day := now.UTC().Format("2006-01-02")
+	if u.day != day {
+		u.day = day
+		u.requests = 0
+		u.tokens = 0
+	}
+}
+
+// extractClientToken returns the credential from the Authorization, x-api-key or api-key header
+func extractClientToken(r *http.Request) string {
+	if authz := r.Header.Get("Authorization"); authz != "" {
+		if len(authz) > 7 && strings.EqualFold(authz[:7], "bearer ") {
+			return strings.TrimSpace(authz[7:])
+		}
+	}
+	if key := r.Header.Get("x-api-key"); key != "" {
+		return strings.TrimSpace(key)
+	}
+	if key := r.Header.Get("api-key"); key != "" {
+		return strings.TrimSpace(key)
+	}
+	return ""
+}
@@ -0,0 +1,304 @@
+package proxy
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ml0-1337/claude-gate/internal/auth"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProxyAuth_Authenticate(t *testing.T) {
+	proxyAuth := NewProxyAuth("secret-token")
+
+	tests := []struct {
+		name    string
+		header  string
+		value   string
+		allowed bool
+	}{
+		{"bearer token", "Authorization", "Bearer secret-token", true},
+		{"lowercase bearer scheme", "Authorization", "bearer secret-token", true},
+		{"x-api-key header", "x-api-key", "secret-token", true},
+		{"api-key header", "api-key", "secret-token", true},
+		{"wrong bearer token", "Authorization", "Bearer wrong-token", false},
+		{"token prefix only", "Authorization", "Bearer secret", false},
+		{"basic scheme", "Authorization", "Basic secret-token", false},
+		{"no credentials", "", "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", "/v1/messages", nil)
+			if tt.header != "" {
+				req.Header.Set(tt.header, tt.value)
+			}
+			assert.Equal(t, tt.allowed, proxyAuth.Authenticate(req))
+		})
+	}
+}
+
+func TestProxyAuth_Disabled(t *testing.T) {
+	t.Run("empty token disables authentication", func(t *testing.T) {
+		proxyAuth := NewProxyAuth("")
+		assert.False(t, proxyAuth.Enabled())
+		assert.Equal(t, "disabled", proxyAuth.Status())
+		assert.True(t, proxyAuth.Authenticate(httptest.NewRequest("POST", "/v1/messages", nil)))
+	})
+
+	t.Run("nil authenticator allows everything", func(t *testing.T) {
+		var proxyAuth *ProxyAuth
+		assert.False(t, proxyAuth.Enabled())
+		assert.Equal(t, "disabled", proxyAuth.Status())
+		assert.True(t, proxyAuth.Authenticate(httptest.NewRequest("POST", "/v1/messages", nil)))
+	})
+}
+
+func TestProxyAuth_Middleware(t *testing.T) {
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	handler := NewProxyAuth("secret-token").Middleware(next)
+
+	t.Run("rejects Anthropic route with Anthropic error", func(t *testing.T) {
+		req := httptest.NewRequest("POST", "/v1/messages", nil)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+		assert.NotEmpty(t, w.Header().Get("WWW-Authenticate"))
+
+		var response map[string]interface{}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		assert.Equal(t, "error", response["type"])
+		errorObj := response["error"].(map[string]interface{})
+		assert.Equal(t, "authentication_error", errorObj["type"])
+	})
+
+	t.Run("rejects OpenAI route with OpenAI error", func(t *testing.T) {
+		req := httptest.NewRequest("POST", "/v1/chat/completions", nil)
+		req.Header.Set("Authorization", "Bearer wrong")
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+		var response map[string]interface{}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		assert.NotContains(t, response, "type")
+		errorObj := response["error"].(map[string]interface{})
+		assert.Equal(t, "authentication_error", errorObj["type"])
+		assert.Contains(t, errorObj, "param")
+		assert.Contains(t, errorObj, "code")
+	})
+
+	t.Run("allows authenticated request", func(t *testing.T) {
+		req := httptest.NewRequest("POST", "/v1/messages", nil)
+		req.Header.Set("x-api-key", "secret-token")
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+	})
+
+	t.Run("allows CORS preflight without credentials", func(t *testing.T) {
+		req := httptest.NewRequest("OPTIONS", "/v1/messages", nil)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+	})
+}
+
+func TestCreateMuxWithAuth_ProtectsV1Routes(t *testing.T) {
+	proxyHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	mockStorage := new(mockStorage)
+	mockStorage.On("Get", "anthropic").Return(nil, nil)
+
+	proxyAuth := NewProxyAuth("secret-token")
+	mux := CreateMuxWithAuth(proxyHandler, NewHealthHandlerWithAuth(mockStorage, proxyAuth), proxyAuth)
+
+	for _, path := range []string{"/v1/messages", "/v1/chat/completions", "/v1/models"} {
+		t.Run(path, func(t *testing.T) {
+			req := httptest.NewRequest("GET", path, nil)
+			w := httptest.NewRecorder()
+			mux.ServeHTTP(w, req)
+			assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+			req = httptest.NewRequest("GET", path, nil)
+			req.Header.Set("Authorization", "Bearer secret-token")
+			w = httptest.NewRecorder()
+			mux.ServeHTTP(w, req)
+			assert.Equal(t, http.StatusOK, w.Code)
+		})
+	}
+
+	t.Run("health and root stay public and report auth state", func(t *testing.T) {
+		for _, path := range []string{"/health", "/"} {
+			req := httptest.NewRequest("GET", path, nil)
+			w := httptest.NewRecorder()
+			mux.ServeHTTP(w, req)
+			require.Equal(t, http.StatusOK, w.Code)
+
+			var response map[string]interface{}
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+			assert.Equal(t, "enabled", response["proxy_auth"])
+		}
+	})
+}
+
+func TestProxyAuth_VirtualKeys(t *testing.T) {
+	registry := auth.NewKeyRegistry(filepath.Join(t.TempDir(), "keys.json"))
+	proxyAuth := NewProxyAuthWithKeys("", registry)
+
+	t.Run("disabled until a key is issued", func(t *testing.T) {
+		assert.False(t, proxyAuth.Enabled())
+	})
+
+	secret, key, err := registry.Create("laptop", auth.ProxyKeyOptions{
+		AllowedEndpoints:  []string{"/v1/messages"},
+		DailyRequestQuota: 2,
+	})
+	require.NoError(t, err)
+	// The registry is checked for a first key once keyCheckInterval has passed
+	assert.False(t, proxyAuth.Enabled())
+	proxyAuth.keysChecked = proxyAuth.keysChecked.Add(-keyCheckInterval)
+
+	var seen *ClientIdentity
+	handler := proxyAuth.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen = ClientIdentityFromContext(r.Context())
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	t.Run("enabled once a key exists", func(t *testing.T) {
+		assert.True(t, proxyAuth.Enabled())
+		req := httptest.NewRequest("POST", "/v1/messages", nil)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+	})
+
+	t.Run("attaches key identity to the context", func(t *testing.T) {
+		req := httptest.NewRequest("POST", "/v1/messages", nil)
+		req.Header.Set("x-api-key", secret)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+
+		require.Equal(t, http.StatusOK, w.Code)
+		require.NotNil(t, seen)
+		assert.Equal(t, "laptop", seen.Name)
+		assert.Equal(t, key.ID, seen.Key.ID)
+	})
+
+	t.Run("rejects endpoints outside the key scope", func(t *testing.T) {
+		req := httptest.NewRequest("POST", "/v1/chat/completions", nil)
+		req.Header.Set("Authorization", "Bearer "+secret)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusForbidden, w.Code)
+		assert.Contains(t, w.Body.String(), "permission_denied")
+	})
+
+	t.Run("enforces the daily request quota", func(t *testing.T) {
+		req := httptest.NewRequest("POST", "/v1/messages", nil)
+		req.Header.Set("x-api-key", secret)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusOK, w.Code)
+
+		w = httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusTooManyRequests, w.Code)
+		assert.Contains(t, w.Body.String(), "rate_limit_error")
+	})
+
+	t.Run("revoked keys are rejected", func(t *testing.T) {
+		require.NoError(t, registry.Revoke("laptop"))
+		req := httptest.NewRequest("POST", "/v1/messages", nil)
+		req.Header.Set("x-api-key", secret)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+		assert.Contains(t, w.Body.String(), "revoked")
+	})
+}
+
+func TestProxyAuth_SharedTokenAndKeys(t *testing.T) {
+	registry := auth.NewKeyRegistry(filepath.Join(t.TempDir(), "keys.json"))
+	secret, _, err := registry.Create("ci", auth.ProxyKeyOptions{})
+	require.NoError(t, err)
+
+	proxyAuth := NewProxyAuthWithKeys("shared-token", registry)
+
+	req := httptest.NewRequest("POST", "/v1/messages", nil)
+	req.Header.Set("Authorization", "Bearer shared-token")
+	identity, err := proxyAuth.Identify(req)
+	require.NoError(t, err)
+	assert.Equal(t, "shared", identity.Name)
+	assert.Nil(t, identity.Key)
+
+	req = httptest.NewRequest("POST", "/v1/messages", nil)
+	req.Header.Set("Authorization", "Bearer "+secret)
+	identity, err = proxyAuth.Identify(req)
+	require.NoError(t, err)
+	assert.Equal(t, "ci", identity.Name)
+}
+
+// countingKeys counts how often the key registry is asked for its size
+type countingKeys struct {
+	KeyLookup
+	counts int
+}
+
+func (k *countingKeys) Count() (int, error) {
+	k.counts++
+	return k.KeyLookup.Count()
+}
+
+func TestProxyAuth_CachesKeyCount(t *testing.T) {
+	registry := auth.NewKeyRegistry(filepath.Join(t.TempDir(), "keys.json"))
+	keys := &countingKeys{KeyLookup: registry}
+	proxyAuth := NewProxyAuthWithKeys("", keys)
+
+	// Without keys the registry is read again once the check interval has passed
+	for i := 0; i < 10; i++ {
+		assert.False(t, proxyAuth.Enabled())
+	}
+	assert.Equal(t, 1, keys.counts)
+	assert.False(t, proxyAuth.hasKeys(time.Now().Add(keyCheckInterval)))
+	assert.Equal(t, 2, keys.counts)
+
+	// Once a key has been issued, authentication stays on without reading the registry
+	_, _, err := registry.Create("laptop", auth.ProxyKeyOptions{})
+	require.NoError(t, err)
+	assert.True(t, proxyAuth.hasKeys(time.Now().Add(2*keyCheckInterval)))
+	for i := 0; i < 10; i++ {
+		assert.True(t, proxyAuth.Enabled())
+	}
+	assert.Equal(t, 3, keys.counts)
+}
+
+func TestKeyUsage_TokenQuota(t *testing.T) {
+	key := &auth.ProxyKey{Name: "laptop", DailyTokenQuota: 100}
+	usage := &keyUsage{}
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	require.NoError(t, usage.admit(key, now))
+	usage.rollover(now)
+	usage.tokens = 150
+
+	assert.Error(t, usage.admit(key, now))
+
+	// Counters reset on the next UTC day
+	assert.NoError(t, usage.admit(key, now.Add(24*time.Hour)))
+}
@@ -0,0 +1,283 @@
+package proxy
+
+import (
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// rateLimitSweepInterval is how often idle client buckets are discarded
+const rateLimitSweepInterval = time.Minute
+
+// RateLimitConfig configures per-client rate limiting.
+// Every limit applies separately to each client IP and each proxy key.
+type RateLimitConfig struct {
+	RequestsPerMinute     int // Requests per minute (0 = unlimited)
+	InputTokensPerMinute  int // Input token budget per minute, read from response usage (0 = unlimited)
+	OutputTokensPerMinute int // Output token budget per minute, read from response usage (0 = unlimited)
+}
+
+// tokenBucket refills continuously up to its capacity.
+// Token budgets may go negative because usage is only known after a response completes.
+type tokenBucket struct {
+	capacity float64
+	tokens   float64
+	rate     float64 // tokens per second
+	last     time.Time
+}
+
+// newTokenBucket creates a full bucket refilled at perMinute tokens per minute
+func newTokenBucket(perMinute int, now time.Time) *tokenBucket {
+	if perMinute <= 0 {
+		return nil
+	}
+	return &tokenBucket{
+		capacity: float64(perMinute),
+		tokens:   float64(perMinute),
+		rate:     float64(perMinute) / 60,
+		last:     now,
+	}
+}
+
+// refill adds the tokens accumulated since the last update
+func (b *tokenBucket) refill(now time.Time) {
+	if elapsed := now.Sub(b.last).Seconds(); elapsed > 0 {
+		b.tokens = math.Min(b.capacity, b.tokens+elapsed*b.rate)
+		b.last = now
+	}
+}
+
+// wait returns how long until n tokens are available
+func (b *tokenBucket) wait(n float64, now time.Time) time.Duration {
+	b.refill(now)
+	if b.tokens >= n {
+		return 0
+	}
+	return time.Duration((n - b.tokens) / b.rate * float64(time.Second))
+}
+
+// full reports whether the bucket has refilled completely
+func (b *tokenBucket) full(now time.Time) bool {
+	b.refill(now)
+	return b.tokens >= b.capacity
+}
+
+// resetAt returns when the bucket will be full again
+func (b *tokenBucket) resetAt(now time.Time) time.Time {
+	b.refill(now)
+	return now.Add(time.Duration((b.capacity - b.tokens) / b.rate * float64(time.Second)))
+}
+
+// remaining returns the whole tokens currently available
+func (b *tokenBucket) remaining() int {
+	if b.tokens < 0 {
+		return 0
+	}
+	return int(b.tokens)
+}
+
+// clientBuckets holds the buckets of one client IP or proxy key
+type clientBuckets struct {
+	requests     *tokenBucket
+	inputTokens  *tokenBucket
+	outputTokens *tokenBucket
+}
+
+// each calls fn for every configured bucket with the name used in rate limit headers
+func (c *clientBuckets) each(fn func(name string, b *tokenBucket)) {
+	if c.requests != nil {
+		fn("requests", c.requests)
+	}
+	if c.inputTokens != nil {
+		fn("input-tokens", c.inputTokens)
+	}
+	if c.outputTokens != nil {
+		fn("output-tokens", c.outputTokens)
+	}
+}
+
+// idle reports whether the client has no pending state and can be forgotten
+func (c *clientBuckets) idle(now time.Time) bool {
+	idle := true
+	c.each(func(_ string, b *tokenBucket) {
+		if !b.full(now) {
+			idle = false
+		}
+	})
+	return idle
+}
+
+// rateLimitDenial describes why a request was rejected
+type rateLimitDenial struct {
+	subject    string
+	bucket     string
+	retryAfter time.Duration
+	buckets    *clientBuckets
+	now        time.Time
+}
+
+// writeHeaders sets retry-after and anthropic-ratelimit-* headers for the limited client
+func (d *rateLimitDenial) writeHeaders(h http.Header) {
+	h.Set("retry-after", strconv.Itoa(int(math.Ceil(d.retryAfter.Seconds()))))
+	d.buckets.each(func(name string, b *tokenBucket) {
+		prefix := "anthropic-ratelimit-" + name
+		h.Set(prefix+"-limit", strconv.Itoa(int(b.capacity)))
+		h.Set(prefix+"-remaining", strconv.Itoa(b.remaining()))
+		h.Set(prefix+"-reset", b.resetAt(d.now).UTC().Format(time.RFC3339))
+	})
+}
+
+// RateLimiter enforces token-bucket limits per client IP and per proxy key
+type RateLimiter struct {
+	config RateLimitConfig
+
+	mu        sync.Mutex
+	clients   map[string]*clientBuckets
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+// NewRateLimiter creates a rate limiter. It returns nil, which allows everything,
+// when the config is nil or sets no limits.
+func NewRateLimiter(config *RateLimitConfig) *RateLimiter {
+	if config == nil || (config.RequestsPerMinute <= 0 && config.InputTokensPerMinute <= 0 && config.OutputTokensPerMinute <= 0) {
+		return nil
+	}
+	return &RateLimiter{
+		config:  *config,
+		clients: make(map[string]*clientBuckets),
+		now:     time.Now,
+	}
+}
+
+// Middleware rejects requests from clients over their limits with 429.
+// It must run inside the proxy authentication middleware to see the client identity.
+func (l *RateLimiter) Middleware(next http.Handler) http.Handler {
+	if l == nil {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// CORS preflight requests never reach the upstream API
+		if r.Method == "OPTIONS" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		subjects := rateLimitSubjects(r)
+		if denial := l.admit(subjects); denial != nil {
+			denial.writeHeaders(w.Header())
+			writeAPIError(w, r.URL.Path, http.StatusTooManyRequests, "rate_limit_error",
+				fmt.Sprintf("rate limit exceeded for %s (%s), retry after %s",
+					denial.subject, denial.bucket, denial.retryAfter.Round(time.Second)))
+			return
+		}
+
+		// Debit token budgets once the response reports its usage
+		if l.config.InputTokensPerMinute > 0 || l.config.OutputTokensPerMinute > 0 {
+			r = r.WithContext(WithUsageObserver(r.Context(), func(usage Usage) {
+				l.recordUsage(subjects, usage)
+			}))
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// admit checks every bucket of every subject and takes one request only if all allow it
+func (l *RateLimiter) admit(subjects []string) *rateLimitDenial {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	l.sweep(now)
+
+	var denial *rateLimitDenial
+	for _, subject := range subjects {
+		buckets := l.bucketsFor(subject, now)
+		buckets.each(func(name string, b *tokenBucket) {
+			if wait := b.wait(1, now); wait > 0 && (denial == nil || wait > denial.retryAfter) {
+				denial = &rateLimitDenial{
+					subject:    subject,
+					bucket:     name,
+					retryAfter: wait,
+					buckets:    buckets,
+					now:        now,
+				}
+			}
+		})
+	}
+	if denial != nil {
+		return denial
+	}
+
+	for _, subject := range subjects {
+		if b := l.clients[subject].requests; b != nil {
+			b.tokens--
+		}
+	}
+	return nil
+}
+
+// recordUsage debits the token budgets of every subject
+func (l *RateLimiter) recordUsage(subjects []string, usage Usage) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	for _, subject := range subjects {
+		buckets := l.bucketsFor(subject, now)
+		if b := buckets.inputTokens; b != nil {
+			b.refill(now)
+			b.tokens -= float64(usage.InputTokens + usage.CacheCreationInputTokens)
+		}
+		if b := buckets.outputTokens; b != nil {
+			b.refill(now)
+			b.tokens -= float64(usage.OutputTokens)
+		}
+	}
+}
+
+// bucketsFor returns the buckets of a subject, creating them on first use
+func (l *RateLimiter) bucketsFor(subject string, now time.Time) *clientBuckets {
+	buckets, ok := l.clients[subject]
+	if !ok {
+		buckets = &clientBuckets{
+			requests:     newTokenBucket(l.config.RequestsPerMinute, now),
+			inputTokens:  newTokenBucket(l.config.InputTokensPerMinute, now),
+			outputTokens: newTokenBucket(l.config.OutputTokensPerMinute, now),
+		}
+		l.clients[subject] = buckets
+	}
+	return buckets
+}
+
+// sweep forgets clients whose buckets have refilled completely
+func (l *RateLimiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < rateLimitSweepInterval {
+		return
+	}
+	l.lastSweep = now
+	for subject, buckets := range l.clients {
+		if buckets.idle(now) {
+			delete(l.clients, subject)
+		}
+	}
+}
+
+// rateLimitSubjects returns the limit keys of a request: its client IP and, if any, its proxy key.
+// The IP is taken from the connection; forwarding headers are not trusted.
+func rateLimitSubjects(r *http.Request) []string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	subjects := []string{"ip:" + host}
+	if identity := ClientIdentityFromContext(r.Context()); identity != nil && identity.Key != nil {
+		subjects = append(subjects, "key:"+identity.Key.ID)
+	}
+	return subjects
+}
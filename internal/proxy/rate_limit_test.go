@@ -0,0 +1,179 @@
+package proxy
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ml0-1337/claude-gate/internal/auth"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeClock is a controllable time source for rate limiter tests
+type fakeClock struct {
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time { return c.now }
+
+func newTestRateLimiter(t *testing.T, config RateLimitConfig) (*RateLimiter, *fakeClock) {
+	limiter := NewRateLimiter(&config)
+	require.NotNil(t, limiter)
+	clock := &fakeClock{now: time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)}
+	limiter.now = clock.Now
+	return limiter, clock
+}
+
+func TestNewRateLimiter_Disabled(t *testing.T) {
+	assert.Nil(t, NewRateLimiter(nil))
+	assert.Nil(t, NewRateLimiter(&RateLimitConfig{}))
+
+	// A nil limiter passes requests through
+	var limiter *RateLimiter
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	w := httptest.NewRecorder()
+	limiter.Middleware(next).ServeHTTP(w, httptest.NewRequest("POST", "/v1/messages", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+}
+
+func TestRateLimiter_RequestsPerClientIP(t *testing.T) {
+	limiter, clock := newTestRateLimiter(t, RateLimitConfig{RequestsPerMinute: 2})
+	handler := limiter.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	send := func(path, remoteAddr string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", path, nil)
+		req.RemoteAddr = remoteAddr
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w
+	}
+
+	assert.Equal(t, http.StatusOK, send("/v1/messages", "10.0.0.1:1000").Code)
+	assert.Equal(t, http.StatusOK, send("/v1/messages", "10.0.0.1:1001").Code)
+
+	t.Run("rejects with Anthropic error and rate limit headers", func(t *testing.T) {
+		w := send("/v1/messages", "10.0.0.1:1002")
+		require.Equal(t, http.StatusTooManyRequests, w.Code)
+
+		assert.Equal(t, "30", w.Header().Get("retry-after"))
+		assert.Equal(t, "2", w.Header().Get("anthropic-ratelimit-requests-limit"))
+		assert.Equal(t, "0", w.Header().Get("anthropic-ratelimit-requests-remaining"))
+		assert.Equal(t, clock.now.Add(time.Minute).Format(time.RFC3339), w.Header().Get("anthropic-ratelimit-requests-reset"))
+
+		var response map[string]interface{}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		assert.Equal(t, "error", response["type"])
+		assert.Equal(t, "rate_limit_error", response["error"].(map[string]interface{})["type"])
+	})
+
+	t.Run("rejects OpenAI routes with OpenAI error", func(t *testing.T) {
+		w := send("/v1/chat/completions", "10.0.0.1:1003")
+		require.Equal(t, http.StatusTooManyRequests, w.Code)
+
+		var response map[string]interface{}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		assert.NotContains(t, response, "type")
+		assert.Contains(t, response["error"], "message")
+	})
+
+	t.Run("other clients are not affected", func(t *testing.T) {
+		assert.Equal(t, http.StatusOK, send("/v1/messages", "10.0.0.2:1000").Code)
+	})
+
+	t.Run("bucket refills over time", func(t *testing.T) {
+		clock.now = clock.now.Add(30 * time.Second)
+		assert.Equal(t, http.StatusOK, send("/v1/messages", "10.0.0.1:1004").Code)
+		assert.Equal(t, http.StatusTooManyRequests, send("/v1/messages", "10.0.0.1:1005").Code)
+	})
+}
+
+func TestRateLimiter_PerProxyKey(t *testing.T) {
+	registry := auth.NewKeyRegistry(filepath.Join(t.TempDir(), "keys.json"))
+	laptop, _, err := registry.Create("laptop", auth.ProxyKeyOptions{})
+	require.NoError(t, err)
+	ci, _, err := registry.Create("ci", auth.ProxyKeyOptions{})
+	require.NoError(t, err)
+
+	limiter, _ := newTestRateLimiter(t, RateLimitConfig{RequestsPerMinute: 1})
+	handler := NewProxyAuthWithKeys("", registry).Middleware(limiter.Middleware(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusOK)
+		})))
+
+	send := func(secret, remoteAddr string) int {
+		req := httptest.NewRequest("POST", "/v1/messages", nil)
+		req.RemoteAddr = remoteAddr
+		req.Header.Set("x-api-key", secret)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	assert.Equal(t, http.StatusOK, send(laptop, "10.0.0.1:1000"))
+	// Same key from another address is still limited by the key bucket
+	assert.Equal(t, http.StatusTooManyRequests, send(laptop, "10.0.0.2:1000"))
+	// Another key from a fresh address has its own bucket
+	assert.Equal(t, http.StatusOK, send(ci, "10.0.0.3:1000"))
+}
+
+func TestRateLimiter_TokenBudget(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"id":"msg_1","content":[],"usage":{"input_tokens":900,"output_tokens":150}}`))
+	}))
+	defer upstream.Close()
+
+	limiter, clock := newTestRateLimiter(t, RateLimitConfig{
+		InputTokensPerMinute:  1000,
+		OutputTokensPerMinute: 100,
+	})
+	handler := limiter.Middleware(NewProxyHandler(&ProxyConfig{
+		UpstreamURL:   upstream.URL,
+		TokenProvider: &mockTokenProvider{token: "test-token"},
+		Transformer:   NewRequestTransformer(),
+	}))
+
+	send := func() *httptest.ResponseRecorder {
+		body := `{"model":"claude-3-5-haiku-20241022","messages":[{"role":"user","content":"Hello"}]}`
+		req := httptest.NewRequest("POST", "/v1/messages", strings.NewReader(body))
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w
+	}
+
+	require.Equal(t, http.StatusOK, send().Code)
+
+	// 150 output tokens overdrew the budget of 100
+	w := send()
+	require.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, "100", w.Header().Get("anthropic-ratelimit-output-tokens-limit"))
+	assert.Equal(t, "0", w.Header().Get("anthropic-ratelimit-output-tokens-remaining"))
+	assert.Equal(t, "100", w.Header().Get("anthropic-ratelimit-input-tokens-remaining"))
+	assert.Empty(t, w.Header().Get("anthropic-ratelimit-requests-limit"))
+	assert.Contains(t, w.Body.String(), "output-tokens")
+
+	// The debt of 50 tokens plus one more is repaid after 31 seconds
+	clock.now = clock.now.Add(31 * time.Second)
+	assert.Equal(t, http.StatusOK, send().Code)
+}
+
+func TestRateLimiter_SweepsIdleClients(t *testing.T) {
+	limiter, clock := newTestRateLimiter(t, RateLimitConfig{RequestsPerMinute: 10})
+
+	require.Nil(t, limiter.admit([]string{"ip:10.0.0.1"}))
+	assert.Len(t, limiter.clients, 1)
+
+	clock.now = clock.now.Add(2 * time.Minute)
+	require.Nil(t, limiter.admit([]string{"ip:10.0.0.2"}))
+	assert.Len(t, limiter.clients, 1)
+	assert.Contains(t, limiter.clients, "ip:10.0.0.2")
+}
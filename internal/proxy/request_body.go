@@ -0,0 +1,166 @@
+package proxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+)
+
+// defaultMaxRequestSize is used when ProxyConfig.MaxRequestSize is not set
+const defaultMaxRequestSize = 10 * 1024 * 1024 // 10MB
+
+// errRequestTooLarge reports a request body over the configured size limit
+type errRequestTooLarge struct {
+	limit int64
+}
+
+func (e *errRequestTooLarge) Error() string {
+	return fmt.Sprintf("request body exceeds the maximum size of %d bytes", e.limit)
+}
+
+// readRequestBody reads at most limit bytes of the request body.
+// The buffer is sized from Content-Length up front so large prompts are not copied while growing.
+func readRequestBody(r *http.Request, limit int64) ([]byte, error) {
+	if r.Body == nil {
+		return nil, nil
+	}
+	defer r.Body.Close()
+
+	if r.ContentLength > limit {
+		return nil, &errRequestTooLarge{limit: limit}
+	}
+
+	var buf bytes.Buffer
+	if r.ContentLength > 0 {
+		buf.Grow(int(r.ContentLength))
+	}
+	// Read one byte past the limit to detect bodies without a Content-Length that are too large
+	n, err := buf.ReadFrom(io.LimitReader(r.Body, limit+1))
+	if err != nil {
+		return nil, err
+	}
+	if n > limit {
+		return nil, &errRequestTooLarge{limit: limit}
+	}
+	return buf.Bytes(), nil
+}
+
+// requestBody is a JSON object decoded one level deep.
+// Nested values such as messages stay raw, so large prompts with base64 images
+// are parsed once and copied through verbatim instead of being decoded and re-encoded.
+type requestBody struct {
+	raw      []byte
+	fields   map[string]json.RawMessage
+	modified bool
+}
+
+// parseRequestBody parses a request body that must be a JSON object
+func parseRequestBody(body []byte) (*requestBody, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(body, &fields); err != nil {
+		return nil, err
+	}
+	if fields == nil {
+		return nil, errors.New("request body is not a JSON object")
+	}
+	return &requestBody{raw: body, fields: fields}, nil
+}
+
+// has reports whether a field is present
+func (b *requestBody) has(key string) bool {
+	if b == nil {
+		return false
+	}
+	_, ok := b.fields[key]
+	return ok
+}
+
+// get returns the raw JSON of a field
+func (b *requestBody) get(key string) (json.RawMessage, bool) {
+	if b == nil {
+		return nil, false
+	}
+	value, ok := b.fields[key]
+	return value, ok
+}
+
+// decode unmarshals a field into v and reports whether it was present and valid
+func (b *requestBody) decode(key string, v interface{}) bool {
+	value, ok := b.get(key)
+	if !ok {
+		return false
+	}
+	return json.Unmarshal(value, v) == nil
+}
+
+// stringField returns a string field, or "" if it is missing or not a string
+func (b *requestBody) stringField(key string) string {
+	var s string
+	b.decode(key, &s)
+	return s
+}
+
+// boolField returns a boolean field, or false if it is missing or not a boolean
+func (b *requestBody) boolField(key string) bool {
+	var v bool
+	b.decode(key, &v)
+	return v
+}
+
+// set encodes and stores a field
+func (b *requestBody) set(key string, value interface{}) error {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Errorf("failed to encode %s: %w", key, err)
+	}
+	b.setRaw(key, data)
+	return nil
+}
+
+// setRaw stores already encoded JSON in a field
+func (b *requestBody) setRaw(key string, value json.RawMessage) {
+	b.fields[key] = value
+	b.modified = true
+}
+
+// delete removes a field
+func (b *requestBody) delete(key string) {
+	if _, ok := b.fields[key]; ok {
+		delete(b.fields, key)
+		b.modified = true
+	}
+}
+
+// bytes returns the encoded body. An unmodified body is returned exactly as received.
+func (b *requestBody) bytes() []byte {
+	if !b.modified && b.raw != nil {
+		return b.raw
+	}
+
+	keys := make([]string, 0, len(b.fields))
+	size := 2
+	for key, value := range b.fields {
+		keys = append(keys, key)
+		size += len(key) + len(value) + 4
+	}
+	sort.Strings(keys)
+
+	var buf bytes.Buffer
+	buf.Grow(size)
+	buf.WriteByte('{')
+	for i, key := range keys {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		name, _ := json.Marshal(key)
+		buf.Write(name)
+		buf.WriteByte(':')
+		buf.Write(b.fields[key])
+	}
+	buf.WriteByte('}')
+	return buf.Bytes()
+}
@@ -0,0 +1,99 @@
+package proxy
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadRequestBody(t *testing.T) {
+	t.Run("reads body within limit", func(t *testing.T) {
+		req := httptest.NewRequest("POST", "/v1/messages", strings.NewReader(`{"model":"x"}`))
+		body, err := readRequestBody(req, 64)
+		require.NoError(t, err)
+		assert.Equal(t, `{"model":"x"}`, string(body))
+	})
+
+	t.Run("body exactly at limit is accepted", func(t *testing.T) {
+		req := httptest.NewRequest("POST", "/v1/messages", strings.NewReader("12345"))
+		body, err := readRequestBody(req, 5)
+		require.NoError(t, err)
+		assert.Len(t, body, 5)
+	})
+
+	t.Run("rejects declared content length over limit", func(t *testing.T) {
+		req := httptest.NewRequest("POST", "/v1/messages", strings.NewReader(strings.Repeat("a", 100)))
+		_, err := readRequestBody(req, 10)
+
+		var tooLarge *errRequestTooLarge
+		require.True(t, errors.As(err, &tooLarge))
+		assert.Equal(t, int64(10), tooLarge.limit)
+	})
+
+	t.Run("rejects chunked body over limit", func(t *testing.T) {
+		req := httptest.NewRequest("POST", "/v1/messages", io.NopCloser(strings.NewReader(strings.Repeat("a", 100))))
+		req.ContentLength = -1
+		_, err := readRequestBody(req, 10)
+
+		var tooLarge *errRequestTooLarge
+		assert.True(t, errors.As(err, &tooLarge))
+	})
+}
+
+func TestRequestBody(t *testing.T) {
+	t.Run("unmodified body is returned verbatim", func(t *testing.T) {
+		raw := []byte(`{ "model" : "claude-3-5-haiku-20241022", "stream": true }`)
+		req, err := parseRequestBody(raw)
+		require.NoError(t, err)
+
+		assert.Equal(t, "claude-3-5-haiku-20241022", req.stringField("model"))
+		assert.True(t, req.boolField("stream"))
+		assert.Equal(t, raw, req.bytes())
+	})
+
+	t.Run("nested values are copied through untouched", func(t *testing.T) {
+		raw := []byte(`{"model":"a","messages":[{"role":"user","content":[{"type":"image","source":{"data":"aGVsbG8="}}]}]}`)
+		req, err := parseRequestBody(raw)
+		require.NoError(t, err)
+
+		require.NoError(t, req.set("model", "b"))
+		req.delete("missing")
+
+		assert.JSONEq(t, `{"model":"b","messages":[{"role":"user","content":[{"type":"image","source":{"data":"aGVsbG8="}}]}]}`, string(req.bytes()))
+		assert.Contains(t, string(req.bytes()), `"messages":[{"role":"user","content":[{"type":"image","source":{"data":"aGVsbG8="}}]}]`)
+	})
+
+	t.Run("wrong types read as zero values", func(t *testing.T) {
+		req, err := parseRequestBody([]byte(`{"model":42,"stream":"yes"}`))
+		require.NoError(t, err)
+		assert.Empty(t, req.stringField("model"))
+		assert.False(t, req.boolField("stream"))
+	})
+
+	t.Run("nil body reads as empty", func(t *testing.T) {
+		var req *requestBody
+		assert.False(t, req.has("model"))
+		assert.Empty(t, req.stringField("model"))
+		assert.False(t, req.boolField("stream"))
+	})
+
+	t.Run("rejects non-object bodies", func(t *testing.T) {
+		for _, body := range []string{`[]`, `null`, `"text"`, `not json`} {
+			_, err := parseRequestBody([]byte(body))
+			assert.Error(t, err, body)
+		}
+	})
+
+	t.Run("encoded output is valid JSON", func(t *testing.T) {
+		req, err := parseRequestBody([]byte(`{"a":1}`))
+		require.NoError(t, err)
+		require.NoError(t, req.set("quote\"key", "v"))
+		assert.True(t, json.Valid(req.bytes()))
+	})
+}
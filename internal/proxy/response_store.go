@@ -0,0 +1,107 @@
+package proxy
+
+import (
+	"encoding/json"
+	"sync"
+	"time"
+)
+
+const (
+	// defaultMaxStoredResponses caps the responses kept for previous_response_id
+	defaultMaxStoredResponses = 1000
+	// defaultStoredResponseTTL is how long a stored response can be continued or retrieved
+	defaultStoredResponseTTL = 24 * time.Hour
+)
+
+// storedResponse is a /v1/responses result kept in memory
+type storedResponse struct {
+	owner    string
+	response json.RawMessage    // The Response object, returned by GET /v1/responses/{id}
+	messages []anthropicMessage // The conversation up to and including this response
+	expires  time.Time
+}
+
+// ResponseStore keeps the conversations of stored /v1/responses results so that
+// previous_response_id continues them without the client resending history.
+// Responses are only visible to the client that created them and are lost on restart.
+type ResponseStore struct {
+	maxResponses int
+	ttl          time.Duration
+
+	mu        sync.Mutex
+	responses map[string]*storedResponse
+	now       func() time.Time
+}
+
+// NewResponseStore creates an in-memory response store. When it is full, the response
+// closest to expiring is dropped to make room.
+func NewResponseStore(maxResponses int, ttl time.Duration) *ResponseStore {
+	if maxResponses <= 0 {
+		maxResponses = defaultMaxStoredResponses
+	}
+	if ttl <= 0 {
+		ttl = defaultStoredResponseTTL
+	}
+	return &ResponseStore{
+		maxResponses: maxResponses,
+		ttl:          ttl,
+		responses:    make(map[string]*storedResponse),
+		now:          time.Now,
+	}
+}
+
+// save stores a response and the conversation it completes
+func (s *ResponseStore) save(id, owner string, response json.RawMessage, messages []anthropicMessage) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	s.sweep(now)
+	if len(s.responses) >= s.maxResponses {
+		var oldest string
+		for key, stored := range s.responses {
+			if oldest == "" || stored.expires.Before(s.responses[oldest].expires) {
+				oldest = key
+			}
+		}
+		delete(s.responses, oldest)
+	}
+	s.responses[id] = &storedResponse{
+		owner:    owner,
+		response: response,
+		messages: messages,
+		expires:  now.Add(s.ttl),
+	}
+}
+
+// load returns a stored response of the given client
+func (s *ResponseStore) load(id, owner string) (*storedResponse, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored, ok := s.responses[id]
+	if !ok || stored.owner != owner || !s.now().Before(stored.expires) {
+		return nil, false
+	}
+	return stored, true
+}
+
+// delete removes a stored response of the given client
+func (s *ResponseStore) delete(id, owner string) bool {
+	if _, ok := s.load(id, owner); !ok {
+		return false
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.responses, id)
+	return true
+}
+
+// sweep drops expired responses; the caller must hold the lock
+func (s *ResponseStore) sweep(now time.Time) {
+	for key, stored := range s.responses {
+		if !now.Before(stored.expires) {
+			delete(s.responses, key)
+		}
+	}
+}
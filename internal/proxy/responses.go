@@ -0,0 +1,243 @@
+package proxy
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// responseOwner returns the client a stored response belongs to
+func responseOwner(identity *ClientIdentity) string {
+	if identity == nil {
+		return ""
+	}
+	if identity.Key != nil {
+		return "key:" + identity.Key.ID
+	}
+	return identity.Name
+}
+
+// serveResponses answers a Responses API request with an Anthropic Messages call.
+// The conversation of a previous_response_id is restored from the response store,
+// and the result is stored for later turns unless the client sets store to false.
+func (h *ProxyHandler) serveResponses(w http.ResponseWriter, r *http.Request, req *requestBody, token string, identity *ClientIdentity, clientName string) {
+	const path = "/v1/responses"
+
+	if r.Method != http.MethodPost {
+		writeAPIError(w, path, http.StatusMethodNotAllowed, "invalid_request_error", "/v1/responses only supports POST")
+		return
+	}
+	if req == nil {
+		writeAPIError(w, path, http.StatusBadRequest, "invalid_request_error", "request body must be a JSON object")
+		return
+	}
+	owner := responseOwner(identity)
+
+	var history []anthropicMessage
+	if previousID := req.stringField("previous_response_id"); previousID != "" {
+		stored, ok := h.config.ResponseStore.load(previousID, owner)
+		if !ok {
+			writeAPIError(w, path, http.StatusNotFound, "invalid_request_error",
+				fmt.Sprintf("previous response %q not found", previousID))
+			return
+		}
+		history = stored.messages
+	}
+
+	// The converted request gets the same system prompt and model alias handling as /v1/messages
+	var body []byte
+	converted, conversation, err := convertResponsesRequest(req, history)
+	if err == nil {
+		body, err = h.config.Transformer.transformRequest(converted, "/v1/messages")
+	}
+	if err != nil {
+		var invalid *invalidRequestError
+		if errors.As(err, &invalid) {
+			writeAPIError(w, path, http.StatusBadRequest, "invalid_request_error", invalid.Error())
+			return
+		}
+		writeAPIError(w, path, http.StatusInternalServerError, "api_error", "Failed to transform request: "+err.Error())
+		return
+	}
+
+	upstreamURL, err := url.Parse(h.config.UpstreamURL)
+	if err != nil {
+		writeAPIError(w, path, http.StatusInternalServerError, "api_error", "Invalid upstream URL: "+err.Error())
+		return
+	}
+	upstreamURL.Path = "/v1/messages"
+
+	resp, attempts, err := h.sendUpstream(r.Context(), path, upstreamRequest{
+		method: http.MethodPost,
+		url:    upstreamURL.String(),
+		header: h.config.Transformer.InjectHeaders(r.Header, token),
+		body:   body,
+	})
+	h.setAttemptsHeader(w, path, attempts)
+	if err != nil {
+		h.logger.Error("upstream request failed", "error", err, "attempts", attempts)
+		writeAPIError(w, path, http.StatusBadGateway, "api_error", "Upstream request failed: "+err.Error())
+		return
+	}
+	h.observeUsage(r, resp, identity, clientName)
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		h.writeUpstreamError(w, resp)
+		return
+	}
+
+	responseContext := newResponsesContext(req, "resp_"+generateRandomID(), time.Now().Unix())
+	var response map[string]interface{}
+	if req.boolField("stream") {
+		response = h.streamResponses(w, resp, responseContext)
+	} else {
+		response = h.writeResponse(w, resp, responseContext)
+	}
+
+	// Failed and interrupted responses cannot be continued
+	if response == nil || !responseContext.store || response["status"] == "failed" {
+		return
+	}
+	encoded, err := json.Marshal(response)
+	if err != nil {
+		h.logger.Error("failed to encode response for storage", "error", err)
+		return
+	}
+	output, _ := response["output"].([]map[string]interface{})
+	if reply, ok := assistantMessageFromOutput(output); ok {
+		conversation = append(conversation, reply)
+	}
+	h.config.ResponseStore.save(responseContext.id, owner, encoded, conversation)
+	h.logger.Debug("stored response", "id", responseContext.id, "messages", len(conversation))
+}
+
+// writeResponse converts a complete upstream reply to a Response object and writes it.
+// It returns the Response object, or nil if the reply could not be converted.
+func (h *ProxyHandler) writeResponse(w http.ResponseWriter, resp *http.Response, responseContext *responsesContext) map[string]interface{} {
+	const path = "/v1/responses"
+
+	var body []byte
+	var err error
+	if strings.Contains(resp.Header.Get("Content-Type"), "text/event-stream") {
+		body, err = h.convertSSEToJSON(resp)
+	} else {
+		body, err = io.ReadAll(resp.Body)
+	}
+	if h.writeStreamError(w, path, err) {
+		return nil
+	}
+	if err != nil {
+		writeAPIError(w, path, http.StatusBadGateway, "api_error", "Failed to read upstream response: "+err.Error())
+		return nil
+	}
+
+	response, err := convertAnthropicToResponse(body, responseContext)
+	if err != nil {
+		writeAPIError(w, path, http.StatusBadGateway, "api_error", "Failed to convert upstream response: "+err.Error())
+		return nil
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+	return response
+}
+
+// streamResponses converts an upstream stream to Responses API semantic events.
+// It returns the final Response object, or nil if the stream did not finish.
+func (h *ProxyHandler) streamResponses(w http.ResponseWriter, resp *http.Response, responseContext *responsesContext) map[string]interface{} {
+	flusher, _ := w.(http.Flusher)
+	flush := func() {
+		if flusher != nil {
+			flusher.Flush()
+		}
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("X-Accel-Buffering", "no") // Disable nginx buffering
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "close") // Close connection after SSE stream
+	w.WriteHeader(http.StatusOK)
+
+	converter := newResponsesStreamConverter(responseContext)
+	if _, err := io.WriteString(w, converter.Start()); err != nil {
+		h.logger.Error("failed to write response events", "error", err)
+		return nil
+	}
+	flush()
+
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxSSEEventSize)
+	var currentEvent string
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.HasPrefix(line, "event: ") {
+			currentEvent = strings.TrimPrefix(line, "event: ")
+			continue
+		}
+		if !strings.HasPrefix(line, "data: ") {
+			continue
+		}
+		converted, err := converter.Convert(currentEvent, strings.TrimPrefix(line, "data: "))
+		if err != nil {
+			h.logger.Error("failed to convert SSE event", "event", currentEvent, "error", err)
+			continue
+		}
+		if converted == "" {
+			continue
+		}
+		if _, err := io.WriteString(w, converted); err != nil {
+			h.logger.Error("failed to write response events", "error", err)
+			return nil
+		}
+		flush()
+	}
+	if err := scanner.Err(); err != nil {
+		h.logger.Error("scanner error during SSE streaming", "error", err)
+		return nil
+	}
+	return converter.Response()
+}
+
+// serveStoredResponse retrieves or deletes a stored response: GET and DELETE /v1/responses/{id}
+func (h *ProxyHandler) serveStoredResponse(w http.ResponseWriter, r *http.Request, identity *ClientIdentity) {
+	path := r.URL.Path
+	id := strings.TrimPrefix(path, "/v1/responses/")
+	if id == "" || strings.Contains(id, "/") {
+		writeAPIError(w, path, http.StatusNotFound, "invalid_request_error", "unknown endpoint "+path)
+		return
+	}
+	owner := responseOwner(identity)
+
+	switch r.Method {
+	case http.MethodGet:
+		stored, ok := h.config.ResponseStore.load(id, owner)
+		if !ok {
+			writeAPIError(w, path, http.StatusNotFound, "invalid_request_error", fmt.Sprintf("response %q not found", id))
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(stored.response)
+
+	case http.MethodDelete:
+		if !h.config.ResponseStore.delete(id, owner) {
+			writeAPIError(w, path, http.StatusNotFound, "invalid_request_error", fmt.Sprintf("response %q not found", id))
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"id":      id,
+			"object":  "response",
+			"deleted": true,
+		})
+
+	default:
+		writeAPIError(w, path, http.StatusMethodNotAllowed, "invalid_request_error", "stored responses support GET and DELETE")
+	}
+}
@@ -0,0 +1,267 @@
+package proxy
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// responsesUpstream fakes the Messages API for /v1/responses tests and records the requests
+type responsesUpstream struct {
+	mu       sync.Mutex
+	requests []map[string]interface{}
+	// events replaces the default stream of a text block and a tool call
+	events []string
+}
+
+func (u *responsesUpstream) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var body map[string]interface{}
+	json.NewDecoder(r.Body).Decode(&body)
+	u.mu.Lock()
+	u.requests = append(u.requests, body)
+	u.mu.Unlock()
+
+	if body["stream"] == true {
+		w.Header().Set("Content-Type", "text/event-stream")
+		events := u.events
+		if events == nil {
+			events = toolStreamEvents(1, 1)
+		}
+		for _, event := range events {
+			fmt.Fprintf(w, "data: %s\n\n", event)
+		}
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write([]byte(`{"id": "msg_1", "model": "claude-sonnet-4-20250514", "content": [{"type": "text", "text": "Hello there"}],
+		"stop_reason": "end_turn", "usage": {"input_tokens": 10, "output_tokens": 3}}`))
+}
+
+// lastRequest returns the most recent upstream request
+func (u *responsesUpstream) lastRequest() map[string]interface{} {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	return u.requests[len(u.requests)-1]
+}
+
+// newResponsesHandler returns a proxy handler backed by a fake Messages API
+func newResponsesHandler(t *testing.T) (*ProxyHandler, *responsesUpstream) {
+	t.Helper()
+	upstream := &responsesUpstream{}
+	server := httptest.NewServer(upstream)
+	t.Cleanup(server.Close)
+
+	return NewProxyHandler(&ProxyConfig{
+		UpstreamURL:   server.URL,
+		TokenProvider: &mockTokenProvider{token: "test-token"},
+		Transformer:   NewRequestTransformer(),
+	}), upstream
+}
+
+// serveResponsesRequest sends a request to the handler as the given client
+func serveResponsesRequest(handler http.Handler, method, path, body string, identity *ClientIdentity) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	if identity != nil {
+		req = req.WithContext(WithClientIdentity(req.Context(), identity))
+	}
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	return w
+}
+
+func TestProxyHandler_Responses(t *testing.T) {
+	handler, upstream := newResponsesHandler(t)
+
+	w := serveResponsesRequest(handler, "POST", "/v1/responses",
+		`{"model": "claude-sonnet-4-20250514", "instructions": "Be brief", "input": "Hi"}`, nil)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	var response struct {
+		ID     string `json:"id"`
+		Object string `json:"object"`
+		Status string `json:"status"`
+		Output []struct {
+			Type    string `json:"type"`
+			Content []struct {
+				Type string `json:"type"`
+				Text string `json:"text"`
+			} `json:"content"`
+		} `json:"output"`
+		Usage struct {
+			InputTokens  int `json:"input_tokens"`
+			OutputTokens int `json:"output_tokens"`
+		} `json:"usage"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.True(t, strings.HasPrefix(response.ID, "resp_"))
+	assert.Equal(t, "response", response.Object)
+	assert.Equal(t, "completed", response.Status)
+	require.Len(t, response.Output, 1)
+	assert.Equal(t, "output_text", response.Output[0].Content[0].Type)
+	assert.Equal(t, "Hello there", response.Output[0].Content[0].Text)
+	assert.Equal(t, 10, response.Usage.InputTokens)
+
+	// The upstream request is a Messages request with the Claude Code prompt first
+	request := upstream.lastRequest()
+	system := request["system"].([]interface{})
+	require.Len(t, system, 2)
+	assert.Equal(t, ClaudeCodePrompt, system[0].(map[string]interface{})["text"])
+	assert.Equal(t, "Be brief", system[1].(map[string]interface{})["text"])
+	assert.NotContains(t, request, "input")
+
+	t.Run("previous_response_id continues the stored conversation", func(t *testing.T) {
+		w := serveResponsesRequest(handler, "POST", "/v1/responses",
+			`{"model": "claude-sonnet-4-20250514", "previous_response_id": "`+response.ID+`", "input": "And you?"}`, nil)
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+		messages := upstream.lastRequest()["messages"].([]interface{})
+		require.Len(t, messages, 3)
+		assert.Equal(t, "assistant", messages[1].(map[string]interface{})["role"])
+		assert.Equal(t, []interface{}{map[string]interface{}{"type": "text", "text": "Hello there"}}, messages[1].(map[string]interface{})["content"])
+		// Instructions are not carried over
+		assert.Equal(t, ClaudeCodePrompt, upstream.lastRequest()["system"])
+	})
+
+	t.Run("stored responses can be retrieved and deleted", func(t *testing.T) {
+		w := serveResponsesRequest(handler, "GET", "/v1/responses/"+response.ID, "", nil)
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.Contains(t, w.Body.String(), response.ID)
+
+		w = serveResponsesRequest(handler, "DELETE", "/v1/responses/"+response.ID, "", nil)
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.JSONEq(t, `{"id": "`+response.ID+`", "object": "response", "deleted": true}`, w.Body.String())
+
+		w = serveResponsesRequest(handler, "POST", "/v1/responses",
+			`{"model": "claude-sonnet-4-20250514", "previous_response_id": "`+response.ID+`", "input": "Again"}`, nil)
+		assert.Equal(t, http.StatusNotFound, w.Code)
+		assert.Contains(t, w.Body.String(), `"invalid_request_error"`)
+	})
+}
+
+func TestProxyHandler_ResponsesStore(t *testing.T) {
+	handler, _ := newResponsesHandler(t)
+	alice := &ClientIdentity{Name: "alice"}
+	bob := &ClientIdentity{Name: "bob"}
+
+	var created struct {
+		ID string `json:"id"`
+	}
+	w := serveResponsesRequest(handler, "POST", "/v1/responses", `{"model": "claude-sonnet-4-20250514", "input": "Hi"}`, alice)
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &created))
+
+	// Other clients cannot see or continue the response
+	assert.Equal(t, http.StatusNotFound, serveResponsesRequest(handler, "GET", "/v1/responses/"+created.ID, "", bob).Code)
+	assert.Equal(t, http.StatusNotFound, serveResponsesRequest(handler, "POST", "/v1/responses",
+		`{"model": "claude-sonnet-4-20250514", "previous_response_id": "`+created.ID+`", "input": "Hi"}`, bob).Code)
+	assert.Equal(t, http.StatusOK, serveResponsesRequest(handler, "GET", "/v1/responses/"+created.ID, "", alice).Code)
+
+	// store: false keeps nothing
+	w = serveResponsesRequest(handler, "POST", "/v1/responses", `{"model": "claude-sonnet-4-20250514", "input": "Hi", "store": false}`, alice)
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &created))
+	assert.Equal(t, http.StatusNotFound, serveResponsesRequest(handler, "GET", "/v1/responses/"+created.ID, "", alice).Code)
+}
+
+func TestProxyHandler_ResponsesStream(t *testing.T) {
+	handler, upstream := newResponsesHandler(t)
+
+	w := serveResponsesRequest(handler, "POST", "/v1/responses",
+		`{"model": "claude-sonnet-4-20250514", "input": "Hi", "stream": true, "tools": [{"type": "function", "name": "tool_1"}]}`, nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "text/event-stream", w.Header().Get("Content-Type"))
+	assert.Equal(t, true, upstream.lastRequest()["stream"])
+
+	var types []string
+	var text, arguments string
+	var completed map[string]interface{}
+	for i, block := range strings.Split(strings.TrimSpace(w.Body.String()), "\n\n") {
+		lines := strings.SplitN(block, "\n", 2)
+		require.Len(t, lines, 2)
+		var event map[string]interface{}
+		require.NoError(t, json.Unmarshal([]byte(strings.TrimPrefix(lines[1], "data: ")), &event))
+		assert.Equal(t, "event: "+event["type"].(string), lines[0])
+		assert.Equal(t, float64(i), event["sequence_number"])
+
+		types = append(types, event["type"].(string))
+		switch event["type"] {
+		case "response.output_text.delta":
+			text += event["delta"].(string)
+		case "response.function_call_arguments.delta":
+			arguments += event["delta"].(string)
+		case "response.completed":
+			completed = event["response"].(map[string]interface{})
+		}
+	}
+
+	assert.Equal(t, []string{
+		"response.created",
+		"response.in_progress",
+		"response.output_item.added",
+		"response.content_part.added",
+		"response.output_text.delta",
+		"response.output_text.done",
+		"response.content_part.done",
+		"response.output_item.done",
+		"response.output_item.added",
+		"response.function_call_arguments.delta",
+		"response.function_call_arguments.done",
+		"response.output_item.done",
+		"response.completed",
+	}, types)
+	assert.Equal(t, "stream 1", text)
+	assert.Equal(t, `{"stream":1}`, arguments)
+
+	require.NotNil(t, completed)
+	assert.Equal(t, "completed", completed["status"])
+	output := completed["output"].([]interface{})
+	require.Len(t, output, 2)
+	assert.Equal(t, "toolu_1_1", output[1].(map[string]interface{})["call_id"])
+	assert.Equal(t, float64(25), completed["usage"].(map[string]interface{})["output_tokens"])
+
+	// The streamed reply is stored, so the function call can be answered in the next turn
+	w = serveResponsesRequest(handler, "POST", "/v1/responses", `{"model": "claude-sonnet-4-20250514", "previous_response_id": "`+completed["id"].(string)+`",
+		"input": [{"type": "function_call_output", "call_id": "toolu_1_1", "output": "done"}]}`, nil)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	messages := upstream.lastRequest()["messages"].([]interface{})
+	require.Len(t, messages, 3)
+	reply := messages[1].(map[string]interface{})["content"].([]interface{})
+	assert.Equal(t, map[string]interface{}{"type": "tool_use", "id": "toolu_1_1", "name": "tool_1", "input": map[string]interface{}{"stream": float64(1)}}, reply[1])
+}
+
+func TestProxyHandler_ResponsesStreamLargeEvent(t *testing.T) {
+	handler, upstream := newResponsesHandler(t)
+	large := strings.Repeat("a", 128*1024)
+	upstream.events = []string{
+		`{"type":"message_start","message":{"id":"msg_1","model":"claude-sonnet-4-20250514","content":[],"usage":{"input_tokens":10,"output_tokens":1}}}`,
+		`{"type":"content_block_start","index":0,"content_block":{"type":"text","text":""}}`,
+		`{"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"` + large + `"}}`,
+		`{"type":"content_block_stop","index":0}`,
+		`{"type":"message_delta","delta":{"stop_reason":"end_turn"},"usage":{"output_tokens":25}}`,
+		`{"type":"message_stop"}`,
+	}
+
+	w := serveResponsesRequest(handler, "POST", "/v1/responses", `{"model": "claude-sonnet-4-20250514", "input": "Hi", "stream": true}`, nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"delta":"`+large+`"`)
+	assert.Contains(t, w.Body.String(), "event: response.completed")
+}
+
+func TestProxyHandler_ResponsesErrors(t *testing.T) {
+	handler, _ := newResponsesHandler(t)
+
+	w := serveResponsesRequest(handler, "POST", "/v1/responses", `{"model": "claude-sonnet-4-20250514"}`, nil)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), `"invalid_request_error"`)
+
+	w = serveResponsesRequest(handler, "GET", "/v1/responses", "", nil)
+	assert.Equal(t, http.StatusMethodNotAllowed, w.Code)
+
+	w = serveResponsesRequest(handler, "GET", "/v1/responses/resp_missing", "", nil)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
@@ -0,0 +1,224 @@
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"math"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// upstreamAttemptsHeader reports how many upstream requests were sent for a client request
+const upstreamAttemptsHeader = "X-Claude-Gate-Attempts"
+
+// RetryPolicy controls how a failed upstream request is retried. Requests are only retried
+// before anything has been sent to the client: after connection errors and 429, 5xx and
+// 529 responses, unless the upstream answers with x-should-retry: false. A Retry-After
+// header replaces the computed backoff and is only bounded by MaxElapsed.
+type RetryPolicy struct {
+	MaxAttempts    int           // Attempts including the first one (1 or less disables retries)
+	InitialBackoff time.Duration // Delay before the first retry, doubled for each further retry
+	MaxBackoff     time.Duration // Upper bound of a single computed delay (0 = no limit)
+	MaxElapsed     time.Duration // Time budget for all attempts and delays (0 = no limit)
+}
+
+// RetryConfig configures upstream retries, with optional policies for specific routes
+type RetryConfig struct {
+	Default RetryPolicy
+	Routes  map[string]RetryPolicy // Policies keyed by client path, such as /v1/chat/completions
+}
+
+// policy returns the retry policy of a client path. Without a config, requests are sent once.
+func (c *RetryConfig) policy(path string) RetryPolicy {
+	if c == nil {
+		return RetryPolicy{MaxAttempts: 1}
+	}
+	if policy, ok := c.Routes[path]; ok {
+		return policy
+	}
+	return c.Default
+}
+
+// backoff returns the delay before the given retry (1 for the first).
+// Half of the delay is random so that clients failing together do not retry together.
+func (p RetryPolicy) backoff(retry int) time.Duration {
+	delay := p.InitialBackoff
+	for i := 1; i < retry && delay < math.MaxInt64/2; i++ {
+		if p.MaxBackoff > 0 && delay >= p.MaxBackoff {
+			break
+		}
+		delay *= 2
+	}
+	if p.MaxBackoff > 0 && delay > p.MaxBackoff {
+		delay = p.MaxBackoff
+	}
+	if delay <= 0 {
+		return 0
+	}
+	return delay/2 + time.Duration(rand.Int63n(int64(delay/2)+1))
+}
+
+// retryableStatus reports whether an upstream status is worth another attempt
+func retryableStatus(status int) bool {
+	switch status {
+	case http.StatusTooManyRequests, http.StatusInternalServerError, http.StatusBadGateway,
+		http.StatusServiceUnavailable, http.StatusGatewayTimeout, 529:
+		return true
+	}
+	return false
+}
+
+// retryAfter returns the delay requested by a retry-after header, in seconds or as an HTTP date
+func retryAfter(header http.Header, now time.Time) (time.Duration, bool) {
+	value := strings.TrimSpace(header.Get("Retry-After"))
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.ParseFloat(value, 64); err == nil && seconds >= 0 {
+		return time.Duration(seconds * float64(time.Second)), true
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		if delay := date.Sub(now); delay > 0 {
+			return delay, true
+		}
+		return 0, true
+	}
+	return 0, false
+}
+
+// upstreamRequest is an upstream call that can be sent more than once
+type upstreamRequest struct {
+	method string
+	url    string
+	header http.Header
+	body   []byte
+}
+
+// sendUpstream sends a request upstream, retrying transient failures under the retry policy
+// of the client path. It returns the last response or error and the number of attempts made.
+// Nothing is written to the client here, so every retry happens before the first byte is sent.
+// A request rejected with authentication_error is replayed once with a freshly refreshed token.
+func (h *ProxyHandler) sendUpstream(ctx context.Context, path string, req upstreamRequest) (*http.Response, int, error) {
+	resp, attempts, err := h.sendWithRetries(ctx, path, req)
+	if err != nil || !isAuthenticationError(resp) {
+		return resp, attempts, err
+	}
+
+	rejected := strings.TrimPrefix(req.header.Get("Authorization"), "Bearer ")
+	token, refreshErr := h.config.TokenProvider.ForceRefresh(rejected)
+	if refreshErr != nil {
+		h.logger.Error("upstream rejected the OAuth token and it could not be refreshed", "path", path, "error", refreshErr)
+		return resp, attempts, nil
+	}
+	h.logger.Warn("upstream rejected the OAuth token, replaying with a refreshed token", "path", path)
+	resp.Body.Close()
+
+	req.header = req.header.Clone()
+	req.header.Set("Authorization", "Bearer "+token)
+	resp, replayed, err := h.sendWithRetries(ctx, path, req)
+	if err == nil && isAuthenticationError(resp) {
+		// The request has failed for good; refreshing again would only rotate the refresh token
+		h.config.TokenProvider.ReportRejected(token)
+		h.logger.Error("upstream rejected the refreshed OAuth token", "path", path)
+	}
+	return resp, attempts + replayed, err
+}
+
+// isAuthenticationError reports whether the upstream rejected the credentials of a request.
+// The body is read to check the error type and then restored for the caller.
+func isAuthenticationError(resp *http.Response) bool {
+	if resp.StatusCode != http.StatusUnauthorized {
+		return false
+	}
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	resp.Body.Close()
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+
+	var envelope struct {
+		Error struct {
+			Type string `json:"type"`
+		} `json:"error"`
+	}
+	if json.Unmarshal(body, &envelope) != nil {
+		return false
+	}
+	return envelope.Error.Type == "authentication_error"
+}
+
+// sendWithRetries sends a request until it succeeds, fails for good or the policy gives up
+func (h *ProxyHandler) sendWithRetries(ctx context.Context, path string, req upstreamRequest) (*http.Response, int, error) {
+	policy := h.config.Retry.policy(path)
+	start := time.Now()
+
+	for attempt := 1; ; attempt++ {
+		upstreamReq, err := http.NewRequestWithContext(ctx, req.method, req.url, bytes.NewReader(req.body))
+		if err != nil {
+			return nil, attempt, err
+		}
+		upstreamReq.Header = req.header.Clone()
+
+		resp, err := h.httpClient.Do(upstreamReq)
+		if !shouldRetry(ctx, resp, err) || attempt >= policy.MaxAttempts {
+			return resp, attempt, err
+		}
+
+		delay := policy.backoff(attempt)
+		if resp != nil {
+			if requested, ok := retryAfter(resp.Header, time.Now()); ok {
+				delay = requested
+			}
+		}
+		if policy.MaxElapsed > 0 && time.Since(start)+delay > policy.MaxElapsed {
+			h.logger.Warn("upstream retry budget exhausted", "path", path, "attempts", attempt, "elapsed", time.Since(start))
+			return resp, attempt, err
+		}
+
+		if resp != nil {
+			h.logger.Warn("retrying upstream request", "path", path, "attempt", attempt, "status", resp.StatusCode, "delay", delay)
+			// Drain a little of the body so the connection can be reused
+			io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+			resp.Body.Close()
+		} else {
+			h.logger.Warn("retrying upstream request", "path", path, "attempt", attempt, "error", err, "delay", delay)
+		}
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, attempt, ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// shouldRetry reports whether an upstream result is a transient failure.
+// The upstream can override the decision with the x-should-retry header.
+func shouldRetry(ctx context.Context, resp *http.Response, err error) bool {
+	if err != nil {
+		// A cancelled client request is not an upstream failure
+		return ctx.Err() == nil
+	}
+	if resp.StatusCode < http.StatusBadRequest {
+		return false
+	}
+	switch resp.Header.Get("X-Should-Retry") {
+	case "true":
+		return true
+	case "false":
+		return false
+	}
+	return retryableStatus(resp.StatusCode)
+}
+
+// setAttemptsHeader reports the number of upstream attempts to the client when retries are enabled
+func (h *ProxyHandler) setAttemptsHeader(w http.ResponseWriter, path string, attempts int) {
+	if h.config.Retry.policy(path).MaxAttempts > 1 && attempts > 0 {
+		w.Header().Set(upstreamAttemptsHeader, strconv.Itoa(attempts))
+	}
+}
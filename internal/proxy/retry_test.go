@@ -0,0 +1,305 @@
+package proxy
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fastRetries retries quickly so that tests do not wait
+var fastRetries = RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Millisecond, MaxBackoff: 5 * time.Millisecond, MaxElapsed: time.Second}
+
+// flakyUpstream fails the first requests with the given responses, then answers normally
+func flakyUpstream(t *testing.T, failures ...func(w http.ResponseWriter)) (*httptest.Server, *int32) {
+	t.Helper()
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		call := int(atomic.AddInt32(&calls, 1))
+		if call <= len(failures) {
+			failures[call-1](w)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		if strings.Contains(string(body), `"stream":true`) {
+			w.Header().Set("Content-Type", "text/event-stream")
+			for _, event := range toolStreamEvents(1, 0) {
+				fmt.Fprintf(w, "data: %s\n\n", event)
+			}
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"id": "msg_1", "model": "claude-sonnet-4-20250514", "content": [{"type": "text", "text": "ok"}], "stop_reason": "end_turn"}`))
+	}))
+	t.Cleanup(server.Close)
+	return server, &calls
+}
+
+// failWith answers with an Anthropic error and the given headers
+func failWith(status int, errorType string, headers ...string) func(w http.ResponseWriter) {
+	return func(w http.ResponseWriter) {
+		for i := 0; i+1 < len(headers); i += 2 {
+			w.Header().Set(headers[i], headers[i+1])
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		fmt.Fprintf(w, `{"type": "error", "error": {"type": %q, "message": "try again"}}`, errorType)
+	}
+}
+
+// dropConnection closes the connection without a response
+func dropConnection(w http.ResponseWriter) {
+	conn, _, err := w.(http.Hijacker).Hijack()
+	if err == nil {
+		conn.Close()
+	}
+}
+
+// serveWithRetry sends a request through a proxy handler with the given retry config
+func serveWithRetry(upstream *httptest.Server, retry *RetryConfig, path, body string) *httptest.ResponseRecorder {
+	handler := NewProxyHandler(&ProxyConfig{
+		UpstreamURL:   upstream.URL,
+		TokenProvider: &mockTokenProvider{token: "test-token"},
+		Transformer:   NewRequestTransformer(),
+		Retry:         retry,
+	})
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("POST", path, strings.NewReader(body)))
+	return w
+}
+
+// refreshingTokenProvider hands out token until it is rejected, then refreshed
+type refreshingTokenProvider struct {
+	token     string
+	refreshed string
+	rejected  []string
+	reported  []string
+	relogin   error
+}
+
+func (p *refreshingTokenProvider) GetAccessToken() (string, error) {
+	return p.token, nil
+}
+
+func (p *refreshingTokenProvider) ForceRefresh(rejected string) (string, error) {
+	p.rejected = append(p.rejected, rejected)
+	if rejected == p.refreshed {
+		p.relogin = errors.New("re-login required")
+		return "", p.relogin
+	}
+	p.token = p.refreshed
+	return p.token, nil
+}
+
+func (p *refreshingTokenProvider) ReportRejected(token string) {
+	p.reported = append(p.reported, token)
+	p.relogin = errors.New("re-login required")
+}
+
+func (p *refreshingTokenProvider) ReloginRequired() error {
+	return p.relogin
+}
+
+const retryRequestBody = `{"model": "claude-sonnet-4-20250514", "max_tokens": 10, "messages": [{"role": "user", "content": "Hi"}]}`
+
+func TestProxyHandler_Retry(t *testing.T) {
+	retry := &RetryConfig{Default: fastRetries}
+
+	t.Run("transient failures are retried", func(t *testing.T) {
+		upstream, calls := flakyUpstream(t, failWith(529, "overloaded_error"), dropConnection)
+		w := serveWithRetry(upstream, retry, "/v1/messages", retryRequestBody)
+
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		assert.Contains(t, w.Body.String(), `"ok"`)
+		assert.Equal(t, int32(3), atomic.LoadInt32(calls))
+		assert.Equal(t, "3", w.Header().Get(upstreamAttemptsHeader))
+	})
+
+	t.Run("gives up after the last attempt", func(t *testing.T) {
+		fail := failWith(http.StatusServiceUnavailable, "api_error")
+		upstream, calls := flakyUpstream(t, fail, fail, fail)
+		w := serveWithRetry(upstream, retry, "/v1/messages", retryRequestBody)
+
+		assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+		assert.Equal(t, int32(3), atomic.LoadInt32(calls))
+		assert.Equal(t, "3", w.Header().Get(upstreamAttemptsHeader))
+	})
+
+	t.Run("streams start after a retry", func(t *testing.T) {
+		upstream, calls := flakyUpstream(t, failWith(http.StatusTooManyRequests, "rate_limit_error", "Retry-After", "0"))
+		w := serveWithRetry(upstream, retry, "/v1/chat/completions",
+			`{"model": "claude-sonnet-4-20250514", "stream": true, "messages": [{"role": "user", "content": "Hi"}]}`)
+
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, int32(2), atomic.LoadInt32(calls))
+		assert.Contains(t, w.Body.String(), `"stream 1"`)
+		assert.True(t, strings.HasSuffix(w.Body.String(), "data: [DONE]\n\n"))
+	})
+
+	t.Run("client errors are not retried", func(t *testing.T) {
+		upstream, calls := flakyUpstream(t, failWith(http.StatusBadRequest, "invalid_request_error"))
+		w := serveWithRetry(upstream, retry, "/v1/messages", retryRequestBody)
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Equal(t, int32(1), atomic.LoadInt32(calls))
+	})
+
+	t.Run("x-should-retry false is respected", func(t *testing.T) {
+		upstream, calls := flakyUpstream(t, failWith(http.StatusInternalServerError, "api_error", "X-Should-Retry", "false"))
+		w := serveWithRetry(upstream, retry, "/v1/messages", retryRequestBody)
+
+		assert.Equal(t, http.StatusInternalServerError, w.Code)
+		assert.Equal(t, int32(1), atomic.LoadInt32(calls))
+	})
+
+	t.Run("retry-after beyond the budget returns the failure", func(t *testing.T) {
+		upstream, calls := flakyUpstream(t, failWith(529, "overloaded_error", "Retry-After", "30"))
+		w := serveWithRetry(upstream, retry, "/v1/messages", retryRequestBody)
+
+		assert.Equal(t, 529, w.Code)
+		assert.Equal(t, "30", w.Header().Get("Retry-After"))
+		assert.Equal(t, int32(1), atomic.LoadInt32(calls))
+	})
+
+	t.Run("routes can disable retries", func(t *testing.T) {
+		perRoute := &RetryConfig{Default: fastRetries, Routes: map[string]RetryPolicy{"/v1/chat/completions": {MaxAttempts: 1}}}
+		upstream, calls := flakyUpstream(t, failWith(529, "overloaded_error"))
+		w := serveWithRetry(upstream, perRoute, "/v1/chat/completions", retryRequestBody)
+
+		assert.Equal(t, 529, w.Code)
+		assert.Equal(t, int32(1), atomic.LoadInt32(calls))
+		assert.Empty(t, w.Header().Get(upstreamAttemptsHeader))
+	})
+
+	t.Run("without a config requests are sent once", func(t *testing.T) {
+		upstream, calls := flakyUpstream(t, failWith(529, "overloaded_error"))
+		w := serveWithRetry(upstream, nil, "/v1/messages", retryRequestBody)
+
+		assert.Equal(t, 529, w.Code)
+		assert.Equal(t, int32(1), atomic.LoadInt32(calls))
+	})
+}
+
+func TestProxyHandler_RefreshOnAuthenticationError(t *testing.T) {
+	// serve sends a request to an upstream that accepts only the given token
+	serve := func(t *testing.T, tokens *refreshingTokenProvider, accepted, path string) (*httptest.ResponseRecorder, int32) {
+		body := retryRequestBody
+		if path == "/v1/responses" {
+			body = `{"model": "claude-sonnet-4-20250514", "input": "Hi"}`
+		}
+		var calls int32
+		upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt32(&calls, 1)
+			if r.Header.Get("Authorization") != "Bearer "+accepted {
+				failWith(http.StatusUnauthorized, "authentication_error")(w)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(`{"id": "msg_1", "model": "claude-sonnet-4-20250514", "content": [{"type": "text", "text": "ok"}], "stop_reason": "end_turn"}`))
+		}))
+		defer upstream.Close()
+
+		handler := NewProxyHandler(&ProxyConfig{
+			UpstreamURL:   upstream.URL,
+			TokenProvider: tokens,
+			Transformer:   NewRequestTransformer(),
+		})
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest("POST", path, strings.NewReader(body)))
+		return w, atomic.LoadInt32(&calls)
+	}
+
+	t.Run("replays once with a refreshed token", func(t *testing.T) {
+		for _, path := range []string{"/v1/messages", "/v1/chat/completions", "/v1/responses"} {
+			tokens := &refreshingTokenProvider{token: "revoked", refreshed: "fresh"}
+			w, calls := serve(t, tokens, "fresh", path)
+
+			require.Equal(t, http.StatusOK, w.Code, "%s: %s", path, w.Body.String())
+			assert.Equal(t, int32(2), calls, path)
+			assert.Equal(t, []string{"revoked"}, tokens.rejected, path)
+			assert.NoError(t, tokens.ReloginRequired(), path)
+		}
+	})
+
+	t.Run("a rejected refreshed token requires a new login", func(t *testing.T) {
+		tokens := &refreshingTokenProvider{token: "revoked", refreshed: "also-revoked"}
+		w, calls := serve(t, tokens, "fresh", "/v1/messages")
+
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+		assert.Contains(t, w.Body.String(), "authentication_error")
+		assert.Equal(t, int32(2), calls)
+		// The refreshed token is only reported, not refreshed again
+		assert.Equal(t, []string{"revoked"}, tokens.rejected)
+		assert.Equal(t, []string{"also-revoked"}, tokens.reported)
+		assert.Error(t, tokens.ReloginRequired())
+	})
+
+	t.Run("other client errors are not replayed", func(t *testing.T) {
+		tokens := &refreshingTokenProvider{token: "revoked", refreshed: "fresh"}
+		upstream, calls := flakyUpstream(t, failWith(http.StatusUnauthorized, "permission_error"))
+		handler := NewProxyHandler(&ProxyConfig{
+			UpstreamURL:   upstream.URL,
+			TokenProvider: tokens,
+			Transformer:   NewRequestTransformer(),
+		})
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest("POST", "/v1/messages", strings.NewReader(retryRequestBody)))
+
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+		assert.Contains(t, w.Body.String(), "permission_error")
+		assert.Equal(t, int32(1), atomic.LoadInt32(calls))
+		assert.Empty(t, tokens.rejected)
+	})
+}
+
+func TestRetryPolicy_Backoff(t *testing.T) {
+	policy := RetryPolicy{InitialBackoff: 100 * time.Millisecond, MaxBackoff: time.Second}
+	bounds := []time.Duration{100 * time.Millisecond, 200 * time.Millisecond, 400 * time.Millisecond, 800 * time.Millisecond, time.Second, time.Second}
+
+	for retry, bound := range bounds {
+		for i := 0; i < 20; i++ {
+			delay := policy.backoff(retry + 1)
+			assert.GreaterOrEqual(t, delay, bound/2, "retry %d", retry+1)
+			assert.LessOrEqual(t, delay, bound, "retry %d", retry+1)
+		}
+	}
+
+	// Without a cap the delay keeps doubling without overflowing
+	assert.Positive(t, RetryPolicy{InitialBackoff: time.Second}.backoff(80))
+
+	// A negative backoff retries right away instead of panicking
+	assert.Zero(t, RetryPolicy{InitialBackoff: -time.Second}.backoff(1))
+	assert.Zero(t, RetryPolicy{MaxBackoff: -time.Second}.backoff(3))
+}
+
+func TestRetryAfter(t *testing.T) {
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		value string
+		delay time.Duration
+		ok    bool
+	}{
+		{"", 0, false},
+		{"2", 2 * time.Second, true},
+		{"0.5", 500 * time.Millisecond, true},
+		{now.Add(3 * time.Second).Format(http.TimeFormat), 3 * time.Second, true},
+		{now.Add(-time.Minute).Format(http.TimeFormat), 0, true},
+		{"soon", 0, false},
+	}
+
+	for _, tt := range tests {
+		header := http.Header{}
+		header.Set("Retry-After", tt.value)
+		delay, ok := retryAfter(header, now)
+		assert.Equal(t, tt.ok, ok, tt.value)
+		assert.Equal(t, tt.delay, delay, tt.value)
+	}
+}
@@ -3,13 +3,27 @@ package proxy
 import (
 	"encoding/json"
 	"net/http"
+	"time"
 	
 	"github.com/ml0-1337/claude-gate/internal/auth"
 )
 
 // HealthHandler handles health check requests
 type HealthHandler struct {
-	storage auth.StorageBackend
+	storage   auth.StorageBackend
+	proxyAuth *ProxyAuth
+	tokens    TokenProvider
+}
+
+// ReloginReporter is implemented by token providers that know when the stored login was revoked
+type ReloginReporter interface {
+	ReloginRequired() error
+}
+
+// RefreshReporter is implemented by token providers that report their token refreshes
+type RefreshReporter interface {
+	RefreshStatus() auth.RefreshStatus
+	Subscribe(listener func(auth.RefreshEvent))
 }
 
 // NewHealthHandler creates a new health handler
@@ -19,6 +33,24 @@ func NewHealthHandler(storage auth.StorageBackend) *HealthHandler {
 	}
 }
 
+// NewHealthHandlerWithAuth creates a health handler that reports the proxy authentication state
+func NewHealthHandlerWithAuth(storage auth.StorageBackend, proxyAuth *ProxyAuth) *HealthHandler {
+	return &HealthHandler{
+		storage:   storage,
+		proxyAuth: proxyAuth,
+	}
+}
+
+// NewHealthHandlerWithTokens creates a health handler that also reports when the token
+// provider can no longer refresh the stored login
+func NewHealthHandlerWithTokens(storage auth.StorageBackend, proxyAuth *ProxyAuth, tokens TokenProvider) *HealthHandler {
+	return &HealthHandler{
+		storage:   storage,
+		proxyAuth: proxyAuth,
+		tokens:    tokens,
+	}
+}
+
 func (h *HealthHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	// Check OAuth status
 	oauthStatus := "not_configured"
@@ -31,15 +63,50 @@ func (h *HealthHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	response := map[string]interface{}{
 		"status":       "healthy",
 		"oauth_status": oauthStatus,
-		"proxy_auth":   "disabled", // TODO: get from config
+		"proxy_auth":   h.proxyAuth.Status(),
+	}
+	
+	// A revoked login is stored but unusable until the user logs in again
+	if reporter, ok := h.tokens.(ReloginReporter); ok && oauthStatus == "ready" {
+		if err := reporter.ReloginRequired(); err != nil {
+			response["oauth_status"] = "relogin_required"
+			response["oauth_error"] = err.Error()
+		}
+	}
+	if reporter, ok := h.tokens.(RefreshReporter); ok {
+		response["token_refresh"] = refreshStatusFields(reporter.RefreshStatus())
 	}
 	
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(response)
 }
 
+// refreshStatusFields reports the token refresh status, leaving out what has not happened yet
+func refreshStatusFields(status auth.RefreshStatus) map[string]interface{} {
+	fields := map[string]interface{}{
+		"refreshes":            status.Refreshes,
+		"consecutive_failures": status.Failures,
+	}
+	for name, t := range map[string]time.Time{
+		"last_refresh": status.LastRefresh,
+		"next_refresh": status.NextRefresh,
+		"expires_at":   status.ExpiresAt,
+		"last_failure": status.LastFailure,
+	} {
+		if !t.IsZero() {
+			fields[name] = t.UTC().Format(time.RFC3339)
+		}
+	}
+	if status.LastError != "" {
+		fields["last_error"] = status.LastError
+	}
+	return fields
+}
+
 // RootHandler handles the root endpoint
-type RootHandler struct{}
+type RootHandler struct {
+	proxyAuth *ProxyAuth
+}
 
 func (h *RootHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	response := map[string]interface{}{
@@ -50,7 +117,7 @@ func (h *RootHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 			"anthropic_api": "/*",
 		},
 		"oauth_required": true,
-		"proxy_auth": "disabled", // TODO: get from config
+		"proxy_auth": h.proxyAuth.Status(),
 	}
 	
 	w.Header().Set("Content-Type", "application/json")
@@ -59,19 +126,38 @@ func (h *RootHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 
 // CreateMux creates the HTTP mux with all routes
 func CreateMux(proxyHandler http.Handler, healthHandler http.Handler) http.Handler {
+	return CreateMuxWithAuth(proxyHandler, healthHandler, nil)
+}
+
+// CreateMuxWithAuth creates the HTTP mux with all /v1 routes protected by proxy authentication
+func CreateMuxWithAuth(proxyHandler http.Handler, healthHandler http.Handler, proxyAuth *ProxyAuth) http.Handler {
+	return CreateMuxWithConfig(proxyHandler, healthHandler, MuxConfig{ProxyAuth: proxyAuth})
+}
+
+// MuxConfig holds the middleware applied to the /v1 routes
+type MuxConfig struct {
+	ProxyAuth   *ProxyAuth   // Client authentication (nil disables)
+	RateLimiter *RateLimiter // Per-client rate limiting of proxied requests (nil disables)
+	CORS        *CORS        // Cross-origin policy for browser clients (nil blocks all origins)
+}
+
+// CreateMuxWithConfig creates the HTTP mux with the configured middleware on the /v1 routes.
+// The CORS policy applies to every route so browsers cannot reach the proxy from disallowed origins.
+func CreateMuxWithConfig(proxyHandler http.Handler, healthHandler http.Handler, config MuxConfig) http.Handler {
 	mux := http.NewServeMux()
 	
 	// Health check endpoint
 	mux.Handle("/health", healthHandler)
 	
 	// Root endpoint
-	mux.Handle("/", &RootHandler{})
+	mux.Handle("/", &RootHandler{proxyAuth: config.ProxyAuth})
 	
 	// Models endpoint for OpenAI compatibility
-	mux.Handle("/v1/models", NewModelsHandler())
+	mux.Handle("/v1/models", config.ProxyAuth.Middleware(NewModelsHandler()))
 	
-	// All other paths go to the proxy
-	mux.Handle("/v1/", proxyHandler)
+	// All other paths go to the proxy; rate limits run after authentication to see the client key
+	proxied := config.ProxyAuth.Middleware(config.RateLimiter.Middleware(proxyHandler))
+	mux.Handle("/v1/", proxied)
 	
-	return mux
-}
\ No newline at end of file
+	return config.CORS.Middleware(mux)
+}
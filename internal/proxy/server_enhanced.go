@@ -19,15 +19,33 @@ type EnhancedProxyServer struct {
 func NewEnhancedProxyServer(config *ProxyConfig, address string, storage auth.StorageBackend) *EnhancedProxyServer {
 	// Create base proxy server components
 	handler := NewProxyHandler(config)
-	healthHandler := NewHealthHandler(storage)
+	proxyAuth := NewProxyAuthWithKeys(config.AuthToken, config.Keys)
+	healthHandler := NewHealthHandlerWithTokens(storage, proxyAuth, config.TokenProvider)
 	
 	// Create dashboard
 	dashboardModel := dashboard.New(fmt.Sprintf("http://%s", address))
 	
+	// Show token refreshes in the dashboard header
+	if reporter, ok := config.TokenProvider.(RefreshReporter); ok {
+		reporter.Subscribe(func(event auth.RefreshEvent) {
+			dashboardModel.SendTokenEvent(dashboard.TokenEvent{
+				LastRefresh: event.Status.LastRefresh,
+				NextRefresh: event.Status.NextRefresh,
+				Failures:    event.Status.Failures,
+				LastError:   event.Status.LastError,
+			})
+		})
+	}
+	
 	// Create middleware that logs to dashboard
 	middleware := &dashboardMiddleware{
-		handler:   CreateMux(handler, healthHandler),
+		handler: CreateMuxWithConfig(handler, healthHandler, MuxConfig{
+			ProxyAuth:   proxyAuth,
+			RateLimiter: NewRateLimiter(config.RateLimit),
+			CORS:        config.CORS,
+		}),
 		dashboard: dashboardModel,
+		proxyAuth: proxyAuth,
 	}
 	
 	// Create enhanced server
@@ -56,6 +74,7 @@ func (s *EnhancedProxyServer) GetDashboard() *dashboard.Model {
 type dashboardMiddleware struct {
 	handler   http.Handler
 	dashboard *dashboard.Model
+	proxyAuth *ProxyAuth
 }
 
 func (m *dashboardMiddleware) ServeHTTP(w http.ResponseWriter, r *http.Request) {
@@ -87,6 +106,13 @@ func (m *dashboardMiddleware) ServeHTTP(w http.ResponseWriter, r *http.Request)
 		Size:       rw.written,
 	}
 	
+	// Attribute the request to a proxy client when authentication is enabled
+	if m.proxyAuth.Enabled() {
+		if identity, err := m.proxyAuth.Identify(r); err == nil {
+			event.Client = identity.Name
+		}
+	}
+	
 	m.dashboard.SendEvent(event)
 }
 
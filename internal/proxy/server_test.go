@@ -5,6 +5,7 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
 	"github.com/ml0-1337/claude-gate/internal/auth"
 	"github.com/stretchr/testify/assert"
@@ -64,6 +65,18 @@ func (m *mockStorage) Name() string {
 	return args.String(0)
 }
 
+// reportingTokenProvider reports a fixed token refresh status
+type reportingTokenProvider struct {
+	mockTokenProvider
+	status auth.RefreshStatus
+}
+
+func (p *reportingTokenProvider) RefreshStatus() auth.RefreshStatus {
+	return p.status
+}
+
+func (p *reportingTokenProvider) Subscribe(listener func(auth.RefreshEvent)) {}
+
 // Test 6: HealthHandler should return 200 OK
 func TestHealthHandler_Returns200OK(t *testing.T) {
 	// Prediction: This test will pass - handler returns 200
@@ -147,6 +160,58 @@ func TestHealthHandler_ReturnsProperJSON(t *testing.T) {
 		// Should still be not_configured for non-OAuth tokens
 		assert.Equal(t, "not_configured", response["oauth_status"])
 	})
+	
+	t.Run("with revoked OAuth login", func(t *testing.T) {
+		mockStorage := new(mockStorage)
+		token := &auth.TokenInfo{Type: "oauth", AccessToken: "test"}
+		mockStorage.On("Get", "anthropic").Return(token, nil)
+		
+		tokens := &refreshingTokenProvider{token: "test", relogin: auth.ErrReloginRequired}
+		handler := NewHealthHandlerWithTokens(mockStorage, nil, tokens)
+		req := httptest.NewRequest("GET", "/health", nil)
+		w := httptest.NewRecorder()
+		
+		handler.ServeHTTP(w, req)
+		
+		var response map[string]interface{}
+		err := json.Unmarshal(w.Body.Bytes(), &response)
+		assert.NoError(t, err)
+		
+		assert.Equal(t, "relogin_required", response["oauth_status"])
+		assert.Contains(t, response["oauth_error"], "claude-gate auth login")
+	})
+	
+	t.Run("with token refresh status", func(t *testing.T) {
+		mockStorage := new(mockStorage)
+		token := &auth.TokenInfo{Type: "oauth", AccessToken: "test"}
+		mockStorage.On("Get", "anthropic").Return(token, nil)
+		
+		tokens := &reportingTokenProvider{status: auth.RefreshStatus{
+			LastRefresh: time.Date(2025, 1, 1, 9, 0, 0, 0, time.UTC),
+			NextRefresh: time.Date(2025, 1, 1, 16, 30, 0, 0, time.UTC),
+			Failures:    1,
+			LastError:   "token request failed with status 503",
+			Refreshes:   3,
+		}}
+		handler := NewHealthHandlerWithTokens(mockStorage, nil, tokens)
+		req := httptest.NewRequest("GET", "/health", nil)
+		w := httptest.NewRecorder()
+		
+		handler.ServeHTTP(w, req)
+		
+		var response map[string]interface{}
+		err := json.Unmarshal(w.Body.Bytes(), &response)
+		assert.NoError(t, err)
+		
+		assert.Equal(t, "ready", response["oauth_status"])
+		assert.Equal(t, map[string]interface{}{
+			"last_refresh":         "2025-01-01T09:00:00Z",
+			"next_refresh":         "2025-01-01T16:30:00Z",
+			"consecutive_failures": float64(1),
+			"last_error":           "token request failed with status 503",
+			"refreshes":            float64(3),
+		}, response["token_refresh"])
+	})
 }
 
 // Test 8: RootHandler should return 200 OK with JSON content type
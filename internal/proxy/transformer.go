@@ -19,62 +19,90 @@ var ModelAliases = map[string]string{
 	"claude-3-opus-latest":     "claude-3-opus-20240229",
 }
 
+// TransformerConfig configures request translation
+type TransformerConfig struct {
+	// StrictOpenAIParams rejects OpenAI parameters that have no Anthropic equivalent
+	// with a 400 instead of silently dropping them
+	StrictOpenAIParams bool
+	// HideReasoning leaves extended thinking out of OpenAI responses instead of
+	// returning it as reasoning_content
+	HideReasoning bool
+}
+
 // RequestTransformer handles request body and header transformations
-type RequestTransformer struct{}
+type RequestTransformer struct {
+	config TransformerConfig
+}
 
 // NewRequestTransformer creates a new request transformer
 func NewRequestTransformer() *RequestTransformer {
-	return &RequestTransformer{}
+	return NewRequestTransformerWithConfig(TransformerConfig{})
+}
+
+// NewRequestTransformerWithConfig creates a request transformer with the given configuration
+func NewRequestTransformerWithConfig(config TransformerConfig) *RequestTransformer {
+	return &RequestTransformer{config: config}
 }
 
 // TransformSystemPrompt modifies the system prompt to ensure Claude Code identification comes first
 func (t *RequestTransformer) TransformSystemPrompt(body []byte) ([]byte, error) {
-	var data map[string]interface{}
-	if err := json.Unmarshal(body, &data); err != nil {
+	req, err := parseRequestBody(body)
+	if err != nil {
 		return body, nil // Return original if not JSON
 	}
-	
-	// Check if request has a system prompt
-	systemRaw, hasSystem := data["system"]
+	if err := t.transformSystemPrompt(req); err != nil {
+		return nil, err
+	}
+	return req.bytes(), nil
+}
+
+// transformSystemPrompt puts the Claude Code identification first in a parsed request.
+// Only the system field is decoded; its existing blocks are kept as raw JSON.
+func (t *RequestTransformer) transformSystemPrompt(req *requestBody) error {
+	systemRaw, hasSystem := req.get("system")
 	if !hasSystem {
 		// No system prompt, inject Claude Code identification
-		data["system"] = ClaudeCodePrompt
-		return json.Marshal(data)
+		return req.set("system", ClaudeCodePrompt)
 	}
 	
-	switch system := systemRaw.(type) {
-	case string:
+	var system string
+	if json.Unmarshal(systemRaw, &system) == nil {
 		// Handle string system prompt
 		if system == ClaudeCodePrompt {
 			// Already correct, leave as-is
-			return body, nil
+			return nil
 		}
 		// Convert to array with Claude Code first
-		data["system"] = []interface{}{
+		return req.set("system", []interface{}{
 			map[string]interface{}{"type": "text", "text": ClaudeCodePrompt},
 			map[string]interface{}{"type": "text", "text": system},
+		})
+	}
+	
+	var blocks []json.RawMessage
+	if json.Unmarshal(systemRaw, &blocks) != nil {
+		// Leave other types for the upstream API to reject
+		return nil
+	}
+	
+	// Handle array system prompt
+	if len(blocks) > 0 {
+		// Check if first element has correct text
+		var first struct {
+			Text string `json:"text"`
 		}
-		
-	case []interface{}:
-		// Handle array system prompt
-		if len(system) > 0 {
-			// Check if first element has correct text
-			if first, ok := system[0].(map[string]interface{}); ok {
-				if text, ok := first["text"].(string); ok && text == ClaudeCodePrompt {
-					// Already has Claude Code first, return as-is
-					return body, nil
-				}
-			}
-		}
-		// Prepend Claude Code identification
-		newSystem := []interface{}{
-			map[string]interface{}{"type": "text", "text": ClaudeCodePrompt},
+		if json.Unmarshal(blocks[0], &first) == nil && first.Text == ClaudeCodePrompt {
+			// Already has Claude Code first, return as-is
+			return nil
 		}
-		data["system"] = append(newSystem, system...)
 	}
 	
-	// Re-marshal the modified data
-	return json.Marshal(data)
+	// Prepend Claude Code identification
+	prompt, err := json.Marshal(map[string]interface{}{"type": "text", "text": ClaudeCodePrompt})
+	if err != nil {
+		return err
+	}
+	return req.set("system", append([]json.RawMessage{prompt}, blocks...))
 }
 
 // MapModelAlias maps model aliases to their full names
@@ -87,45 +115,59 @@ func (t *RequestTransformer) MapModelAlias(model string) string {
 
 // TransformRequestBody applies all necessary transformations to the request body
 func (t *RequestTransformer) TransformRequestBody(body []byte, path string) ([]byte, error) {
+	req, err := parseRequestBody(body)
+	if err != nil {
+		if convertsToMessages(path) {
+			return nil, fmt.Errorf("failed to convert OpenAI format: %w", err)
+		}
+		return body, nil // Return original if not JSON
+	}
+	return t.transformRequest(req, path)
+}
+
+// transformRequest transforms an already parsed request body in place and encodes it once
+func (t *RequestTransformer) transformRequest(req *requestBody, path string) ([]byte, error) {
 	// Handle OpenAI chat completions endpoint
 	if path == "/v1/chat/completions" {
 		// Convert OpenAI format to Anthropic format
-		convertedBody, err := ConvertOpenAIToAnthropic(body)
+		converted, err := convertOpenAIRequest(req, t.config.StrictOpenAIParams)
 		if err != nil {
 			return nil, fmt.Errorf("failed to convert OpenAI format: %w", err)
 		}
 		
 		// Apply standard transformations to the converted body
-		return t.TransformRequestBody(convertedBody, "/v1/messages")
+		return t.transformRequest(converted, "/v1/messages")
 	}
 	
-	// Only transform messages endpoint
-	if path != "/v1/messages" {
-		return body, nil
+	// Handle legacy OpenAI completions endpoint
+	if path == "/v1/completions" {
+		converted, err := convertCompletionRequest(req, t.config.StrictOpenAIParams)
+		if err != nil {
+			return nil, fmt.Errorf("failed to convert OpenAI format: %w", err)
+		}
+		return t.transformRequest(converted, "/v1/messages")
 	}
 	
-	var data map[string]interface{}
-	if err := json.Unmarshal(body, &data); err != nil {
-		return body, nil // Return original if not JSON
+	// Only transform messages endpoint
+	if path != "/v1/messages" {
+		return req.bytes(), nil
 	}
 	
 	// Transform system prompt
-	modifiedBody, err := t.TransformSystemPrompt(body)
-	if err != nil {
+	if err := t.transformSystemPrompt(req); err != nil {
 		return nil, fmt.Errorf("failed to transform system prompt: %w", err)
 	}
 	
-	// Re-unmarshal to apply model mapping
-	if err := json.Unmarshal(modifiedBody, &data); err != nil {
-		return modifiedBody, nil
-	}
-	
 	// Map model alias if present
-	if model, ok := data["model"].(string); ok {
-		data["model"] = t.MapModelAlias(model)
+	if model := req.stringField("model"); model != "" {
+		if mapped := t.MapModelAlias(model); mapped != model {
+			if err := req.set("model", mapped); err != nil {
+				return nil, err
+			}
+		}
 	}
 	
-	return json.Marshal(data)
+	return req.bytes(), nil
 }
 
 // InjectHeaders creates new headers with OAuth authentication and strips problematic ones
@@ -179,11 +221,33 @@ func getHeader(headers map[string][]string, key string) string {
 	return ""
 }
 
+// convertsToMessages reports whether an OpenAI route is translated to the Messages API
+func convertsToMessages(path string) bool {
+	return path == "/v1/chat/completions" || path == "/v1/completions"
+}
+
+// responseOptions are the settings of the original request that shape its translated response
+type responseOptions struct {
+	format        *responseFormat // Structured output requested with response_format
+	includeUsage  bool            // Final usage chunk requested with stream_options.include_usage
+	echo          string          // Prompt repeated before a legacy completion, requested with echo
+	hideReasoning bool            // Thinking is left out of the reply, set from the transformer config
+}
+
 // TransformResponseBody transforms response body based on the endpoint
 func (t *RequestTransformer) TransformResponseBody(body []byte, path string) ([]byte, error) {
-	if path == "/v1/chat/completions" {
+	return t.transformResponse(body, path, responseOptions{})
+}
+
+// transformResponse transforms a response body according to the options of the original request
+func (t *RequestTransformer) transformResponse(body []byte, path string, options responseOptions) ([]byte, error) {
+	options.hideReasoning = t.config.HideReasoning
+	switch path {
+	case "/v1/chat/completions":
 		// Convert Anthropic response to OpenAI format
-		return ConvertAnthropicToOpenAI(body)
+		return convertAnthropicResponse(body, options)
+	case "/v1/completions":
+		return convertAnthropicToCompletion(body, options.echo)
 	}
 	return body, nil
 }
\ No newline at end of file
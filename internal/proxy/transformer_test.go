@@ -236,4 +236,43 @@ func TestHeaderInjection(t *testing.T) {
 		assert.Equal(t, "Bearer test-access-token", result.Get("Authorization"))
 		assert.Equal(t, "oauth-2025-04-20", result.Get("anthropic-beta"))
 	})
-}
\ No newline at end of file
+}
+
+func TestTransformRequestBody_PreservesContent(t *testing.T) {
+	transformer := NewRequestTransformer()
+	
+	t.Run("keeps system block fields and message content", func(t *testing.T) {
+		body := []byte(`{"model":"claude-3-5-haiku-latest","system":[{"type":"text","text":"Be brief","cache_control":{"type":"ephemeral"}}],"messages":[{"role":"user","content":[{"type":"image","source":{"type":"base64","media_type":"image/png","data":"iVBORw0KGgo="}}]}]}`)
+		
+		result, err := transformer.TransformRequestBody(body, "/v1/messages")
+		require.NoError(t, err)
+		
+		assert.JSONEq(t, `{
+			"model": "claude-3-5-haiku-20241022",
+			"system": [
+				{"type": "text", "text": "`+claudeCodePrompt+`"},
+				{"type": "text", "text": "Be brief", "cache_control": {"type": "ephemeral"}}
+			],
+			"messages": [{"role": "user", "content": [{"type": "image", "source": {"type": "base64", "media_type": "image/png", "data": "iVBORw0KGgo="}}]}]
+		}`, string(result))
+	})
+	
+	t.Run("returns body unchanged when nothing needs transforming", func(t *testing.T) {
+		body := []byte(`{"model": "claude-3-5-haiku-20241022", "system": "` + claudeCodePrompt + `"}`)
+		
+		result, err := transformer.TransformRequestBody(body, "/v1/messages")
+		require.NoError(t, err)
+		assert.Equal(t, body, result)
+	})
+	
+	t.Run("passes non-JSON bodies through", func(t *testing.T) {
+		body := []byte("not json")
+		
+		result, err := transformer.TransformRequestBody(body, "/v1/messages")
+		require.NoError(t, err)
+		assert.Equal(t, body, result)
+		
+		_, err = transformer.TransformRequestBody(body, "/v1/chat/completions")
+		assert.Error(t, err)
+	})
+}
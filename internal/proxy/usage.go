@@ -0,0 +1,176 @@
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"sync"
+)
+
+// maxUsageBufferSize caps how much of a non-streaming response is buffered to find its usage
+const maxUsageBufferSize = 16 * 1024 * 1024
+
+// Usage holds the token counts reported by the upstream API for one response
+type Usage struct {
+	InputTokens              int64 `json:"input_tokens"`
+	OutputTokens             int64 `json:"output_tokens"`
+	CacheCreationInputTokens int64 `json:"cache_creation_input_tokens"`
+	CacheReadInputTokens     int64 `json:"cache_read_input_tokens"`
+}
+
+// Total returns all tokens billed for the response
+func (u Usage) Total() int64 {
+	return u.InputTokens + u.OutputTokens + u.CacheCreationInputTokens + u.CacheReadInputTokens
+}
+
+// add sums the counts of another usage report into u
+func (u *Usage) add(other Usage) {
+	u.InputTokens += other.InputTokens
+	u.OutputTokens += other.OutputTokens
+	u.CacheCreationInputTokens += other.CacheCreationInputTokens
+	u.CacheReadInputTokens += other.CacheReadInputTokens
+}
+
+// merge overlays the non-zero counts of another usage report
+func (u *Usage) merge(other Usage) {
+	if other.InputTokens > 0 {
+		u.InputTokens = other.InputTokens
+	}
+	if other.OutputTokens > 0 {
+		u.OutputTokens = other.OutputTokens
+	}
+	if other.CacheCreationInputTokens > 0 {
+		u.CacheCreationInputTokens = other.CacheCreationInputTokens
+	}
+	if other.CacheReadInputTokens > 0 {
+		u.CacheReadInputTokens = other.CacheReadInputTokens
+	}
+}
+
+// usageObserversKey is the context key for the usage observers of a request
+type usageObserversKey struct{}
+
+// WithUsageObserver registers a callback that receives the token usage of the proxied response
+func WithUsageObserver(ctx context.Context, observer func(Usage)) context.Context {
+	observers := usageObserversFromContext(ctx)
+	// Copy so requests derived from the same parent context do not share observers
+	observers = append(observers[:len(observers):len(observers)], observer)
+	return context.WithValue(ctx, usageObserversKey{}, observers)
+}
+
+// usageObserversFromContext returns the usage observers registered on the context
+func usageObserversFromContext(ctx context.Context) []func(Usage) {
+	observers, _ := ctx.Value(usageObserversKey{}).([]func(Usage))
+	return observers
+}
+
+// usageReader wraps an upstream response body and extracts token usage while it is read.
+// SSE bodies are inspected line by line; JSON bodies are buffered and parsed on Close.
+type usageReader struct {
+	body     io.ReadCloser
+	sse      bool
+	buf      []byte
+	overflow bool
+	usage    Usage
+	onClose  func(Usage)
+	once     sync.Once
+}
+
+// newUsageReader creates a body wrapper that reports usage to onClose when the body is closed
+func newUsageReader(body io.ReadCloser, sse bool, onClose func(Usage)) *usageReader {
+	return &usageReader{
+		body:    body,
+		sse:     sse,
+		onClose: onClose,
+	}
+}
+
+// Read implements io.Reader
+func (r *usageReader) Read(p []byte) (int, error) {
+	n, err := r.body.Read(p)
+	if n > 0 {
+		r.observe(p[:n])
+	}
+	return n, err
+}
+
+// Close implements io.Closer and reports the collected usage once
+func (r *usageReader) Close() error {
+	err := r.body.Close()
+	r.once.Do(func() {
+		if r.sse {
+			// Process a trailing line without newline
+			if len(r.buf) > 0 {
+				r.observeLine(r.buf)
+				r.buf = nil
+			}
+		} else if !r.overflow {
+			var resp struct {
+				Usage Usage `json:"usage"`
+			}
+			if json.Unmarshal(r.buf, &resp) == nil {
+				r.usage = resp.Usage
+			}
+		}
+		if r.onClose != nil {
+			r.onClose(r.usage)
+		}
+	})
+	return err
+}
+
+// observe consumes a chunk of the body
+func (r *usageReader) observe(chunk []byte) {
+	if !r.sse {
+		if r.overflow {
+			return
+		}
+		if len(r.buf)+len(chunk) > maxUsageBufferSize {
+			r.overflow = true
+			r.buf = nil
+			return
+		}
+		r.buf = append(r.buf, chunk...)
+		return
+	}
+
+	r.buf = append(r.buf, chunk...)
+	for {
+		i := bytes.IndexByte(r.buf, '\n')
+		if i < 0 {
+			break
+		}
+		r.observeLine(r.buf[:i])
+		r.buf = r.buf[i+1:]
+	}
+	// Keep the partial line in a fresh slice so the consumed prefix can be collected
+	r.buf = append([]byte(nil), r.buf...)
+}
+
+// observeLine extracts usage from message_start and message_delta SSE data lines
+func (r *usageReader) observeLine(line []byte) {
+	line = bytes.TrimRight(line, "\r")
+	if !bytes.HasPrefix(line, []byte("data:")) || !bytes.Contains(line, []byte(`"usage"`)) {
+		return
+	}
+	data := bytes.TrimSpace(bytes.TrimPrefix(line, []byte("data:")))
+
+	var event struct {
+		Type    string `json:"type"`
+		Message struct {
+			Usage Usage `json:"usage"`
+		} `json:"message"`
+		Usage Usage `json:"usage"`
+	}
+	if err := json.Unmarshal(data, &event); err != nil {
+		return
+	}
+
+	switch event.Type {
+	case "message_start":
+		r.usage.merge(event.Message.Usage)
+	case "message_delta":
+		r.usage.merge(event.Usage)
+	}
+}
@@ -0,0 +1,91 @@
+package proxy
+
+import (
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// chunkedReader returns its content a few bytes at a time to exercise line splitting
+type chunkedReader struct {
+	data  string
+	chunk int
+}
+
+func (r *chunkedReader) Read(p []byte) (int, error) {
+	if r.data == "" {
+		return 0, io.EOF
+	}
+	n := r.chunk
+	if n > len(r.data) {
+		n = len(r.data)
+	}
+	if n > len(p) {
+		n = len(p)
+	}
+	copy(p, r.data[:n])
+	r.data = r.data[n:]
+	return n, nil
+}
+
+func (r *chunkedReader) Close() error { return nil }
+
+func TestUsageReader_SSE(t *testing.T) {
+	stream := "event: message_start\n" +
+		`data: {"type":"message_start","message":{"id":"msg_1","usage":{"input_tokens":25,"cache_read_input_tokens":5,"output_tokens":1}}}` + "\n\n" +
+		"event: content_block_delta\n" +
+		`data: {"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"usage is fine"}}` + "\n\n" +
+		"event: message_delta\n" +
+		`data: {"type":"message_delta","delta":{"stop_reason":"end_turn"},"usage":{"output_tokens":42}}` + "\n\n"
+
+	var reported Usage
+	reader := newUsageReader(&chunkedReader{data: stream, chunk: 7}, true, func(u Usage) {
+		reported = u
+	})
+
+	body, err := io.ReadAll(reader)
+	require.NoError(t, err)
+	assert.Equal(t, stream, string(body))
+	require.NoError(t, reader.Close())
+
+	assert.Equal(t, int64(25), reported.InputTokens)
+	assert.Equal(t, int64(42), reported.OutputTokens)
+	assert.Equal(t, int64(5), reported.CacheReadInputTokens)
+	assert.Equal(t, int64(72), reported.Total())
+}
+
+func TestUsageReader_JSON(t *testing.T) {
+	body := `{"id":"msg_1","content":[{"type":"text","text":"hi"}],"usage":{"input_tokens":10,"output_tokens":3}}`
+
+	calls := 0
+	var reported Usage
+	reader := newUsageReader(io.NopCloser(strings.NewReader(body)), false, func(u Usage) {
+		calls++
+		reported = u
+	})
+
+	_, err := io.ReadAll(reader)
+	require.NoError(t, err)
+	reader.Close()
+	reader.Close()
+
+	assert.Equal(t, 1, calls)
+	assert.Equal(t, int64(10), reported.InputTokens)
+	assert.Equal(t, int64(3), reported.OutputTokens)
+}
+
+func TestUsageReader_PartialRead(t *testing.T) {
+	// A body closed before it is fully read reports whatever was seen
+	var reported Usage
+	reader := newUsageReader(io.NopCloser(strings.NewReader(`{"usage":{"input_tokens":10`)), false, func(u Usage) {
+		reported = u
+	})
+
+	_, err := io.ReadAll(reader)
+	require.NoError(t, err)
+	require.NoError(t, reader.Close())
+	assert.Equal(t, Usage{}, reported)
+}
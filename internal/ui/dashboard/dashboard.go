@@ -2,6 +2,7 @@ package dashboard
 
 import (
 	"fmt"
+	"sort"
 	"strings"
 	"time"
 
@@ -28,13 +29,23 @@ type Model struct {
 	serverURL   string
 	startTime   time.Time
 	oauthStatus string
+	token       TokenEvent
 	
 	// UI state
 	showHelp     bool
 	selectedPane int // 0: stats, 1: requests
 	
-	// Update channel
+	// Update channels
 	eventChan chan RequestEvent
+	tokenChan chan TokenEvent
+}
+
+// TokenEvent reports the state of the background OAuth token refresh
+type TokenEvent struct {
+	LastRefresh time.Time
+	NextRefresh time.Time
+	Failures    int // Consecutive failed refreshes
+	LastError   string
 }
 
 // New creates a new dashboard model
@@ -46,6 +57,7 @@ func New(serverURL string) *Model {
 		startTime:   time.Now(),
 		oauthStatus: "Ready",
 		eventChan:   make(chan RequestEvent, 100),
+		tokenChan:   make(chan TokenEvent, 10),
 	}
 }
 
@@ -53,6 +65,7 @@ func New(serverURL string) *Model {
 func (m *Model) Init() tea.Cmd {
 	return tea.Batch(
 		m.listenForEvents(),
+		m.listenForTokenEvents(),
 		tickCmd(),
 	)
 }
@@ -101,11 +114,20 @@ func (m *Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		// Record the request
 		if !m.paused {
 			m.stats.RecordRequest(msg.StatusCode, msg.Duration)
+			m.stats.RecordClient(msg.Client)
 			m.requestLog.Add(msg)
 			m.viewport.SetContent(m.renderRequests())
 		}
 		// Continue listening for more events
 		cmds = append(cmds, m.listenForEvents())
+
+	case TokenEvent:
+		m.token = msg
+		m.oauthStatus = "Ready"
+		if msg.Failures > 0 {
+			m.oauthStatus = fmt.Sprintf("Refresh failing (%d)", msg.Failures)
+		}
+		cmds = append(cmds, m.listenForTokenEvents())
 	}
 
 	// Update viewport
@@ -164,6 +186,9 @@ func (m *Model) renderHeader() string {
 	
 	info := fmt.Sprintf("Server: %s | OAuth: %s | Uptime: %s",
 		m.serverURL, m.oauthStatus, uptime)
+	if refresh := formatTokenRefresh(m.token); refresh != "" {
+		info += " | " + refresh
+	}
 	
 	header := lipgloss.JoinHorizontal(
 		lipgloss.Left,
@@ -175,6 +200,21 @@ func (m *Model) renderHeader() string {
 	return header + "\n" + styles.DescriptionStyle.Render(info)
 }
 
+// formatTokenRefresh describes the last and next token refresh
+func formatTokenRefresh(token TokenEvent) string {
+	var parts []string
+	if !token.LastRefresh.IsZero() {
+		parts = append(parts, "refreshed "+token.LastRefresh.Format("15:04:05"))
+	}
+	if !token.NextRefresh.IsZero() {
+		parts = append(parts, "next "+token.NextRefresh.Format("15:04:05"))
+	}
+	if len(parts) == 0 {
+		return ""
+	}
+	return "Token: " + strings.Join(parts, ", ")
+}
+
 // renderStats renders the statistics panel
 func (m *Model) renderStats() string {
 	stats := m.stats.GetStats()
@@ -187,7 +227,35 @@ func (m *Model) renderStats() string {
 		m.createStatCard("Requests/sec", formatReqPerSecond(stats.ReqPerSecond), styles.InfoStyle),
 	}
 	
-	return lipgloss.JoinHorizontal(lipgloss.Left, cards...)
+	panel := lipgloss.JoinHorizontal(lipgloss.Left, cards...)
+	if clients := formatClientRequests(stats.ClientRequests); clients != "" {
+		panel += "\n" + styles.DescriptionStyle.Render("Clients: "+clients)
+	}
+	return panel
+}
+
+// formatClientRequests formats per-client request counts, busiest client first
+func formatClientRequests(counts map[string]int64) string {
+	if len(counts) == 0 {
+		return ""
+	}
+	
+	names := make([]string, 0, len(counts))
+	for name := range counts {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		if counts[names[i]] != counts[names[j]] {
+			return counts[names[i]] > counts[names[j]]
+		}
+		return names[i] < names[j]
+	})
+	
+	parts := make([]string, len(names))
+	for i, name := range names {
+		parts[i] = fmt.Sprintf("%s (%d)", name, counts[name])
+	}
+	return strings.Join(parts, " • ")
 }
 
 // createStatCard creates a single stat card
@@ -296,6 +364,13 @@ func (m *Model) listenForEvents() tea.Cmd {
 	}
 }
 
+// listenForTokenEvents listens for token refresh events
+func (m *Model) listenForTokenEvents() tea.Cmd {
+	return func() tea.Msg {
+		return <-m.tokenChan
+	}
+}
+
 // tickMsg is sent periodically to update the UI
 type tickMsg time.Time
 
@@ -345,4 +420,13 @@ func (m *Model) SendEvent(event RequestEvent) {
 	default:
 		// Channel full, drop event
 	}
-}
\ No newline at end of file
+}
+
+// SendTokenEvent sends a token refresh event to the dashboard
+func (m *Model) SendTokenEvent(event TokenEvent) {
+	select {
+	case m.tokenChan <- event:
+	default:
+		// Channel full, drop event
+	}
+}
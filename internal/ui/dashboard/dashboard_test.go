@@ -184,6 +184,26 @@ func TestModel_RenderHeader_Running(t *testing.T) {
 	assert.Contains(t, header, "Uptime: 5m")
 }
 
+func TestModel_TokenEvent(t *testing.T) {
+	model := New("http://localhost:8080")
+	
+	updatedModel, cmd := model.Update(TokenEvent{
+		LastRefresh: time.Date(2025, 1, 1, 9, 30, 0, 0, time.Local),
+		NextRefresh: time.Date(2025, 1, 1, 17, 0, 0, 0, time.Local),
+		Failures:    2,
+		LastError:   "token request failed with status 503",
+	})
+	model = updatedModel.(*Model)
+	assert.NotNil(t, cmd, "Should continue listening for token events")
+	
+	header := model.renderHeader()
+	assert.Contains(t, header, "OAuth: Refresh failing (2)")
+	assert.Contains(t, header, "Token: refreshed 09:30:00, next 17:00:00")
+	
+	updatedModel, _ = model.Update(TokenEvent{NextRefresh: time.Now()})
+	assert.Contains(t, updatedModel.(*Model).renderHeader(), "OAuth: Ready")
+}
+
 // Test 4: renderHeader() should show paused status when paused
 func TestModel_RenderHeader_Paused(t *testing.T) {
 	// Prediction: This test will pass - testing paused header
@@ -17,6 +17,7 @@ type RequestEvent struct {
 	Timestamp  time.Time
 	Error      string
 	Size       int64
+	Client     string // Name of the proxy key or token that made the request
 }
 
 // RequestLog maintains a ring buffer of recent requests
@@ -161,8 +162,12 @@ func FormatRequest(req RequestEvent) string {
 		path = path[:37] + "..."
 	}
 	
-	return fmt.Sprintf("%s %s %s %s %s %-40s",
+	line := fmt.Sprintf("%s %s %s %s %s %-40s",
 		timeStr, req.Method, statusStr, durStr, sizeStr, path)
+	if req.Client != "" {
+		line += " " + req.Client
+	}
+	return line
 }
 
 // formatBytes formats bytes into human readable format
@@ -365,6 +365,12 @@ func TestFormatRequest(t *testing.T) {
 		assert.Contains(t, formatted, longPath[:37])
 	})
 	
+	t.Run("client name", func(t *testing.T) {
+		req.Client = "laptop"
+		defer func() { req.Client = "" }()
+		assert.Contains(t, FormatRequest(req), "laptop")
+	})
+	
 	t.Run("different status codes", func(t *testing.T) {
 		testCases := []struct {
 			status   int
@@ -20,6 +20,9 @@ type RequestStats struct {
 	// Time buckets for rate calculation
 	recentRequests []time.Time
 	windowSize     time.Duration
+	
+	// Requests per proxy client
+	clientRequests map[string]int64
 }
 
 // NewRequestStats creates a new statistics tracker
@@ -27,6 +30,7 @@ func NewRequestStats() *RequestStats {
 	return &RequestStats{
 		recentRequests: make([]time.Time, 0, 1000),
 		windowSize:     time.Minute,
+		clientRequests: make(map[string]int64),
 		lastUpdate:     time.Now(),
 	}
 }
@@ -95,18 +99,36 @@ func (s *RequestStats) RecordRequest(statusCode int, duration time.Duration) {
 	s.lastUpdate = now
 }
 
+// RecordClient counts a request made by a named proxy client
+func (s *RequestStats) RecordClient(client string) {
+	if client == "" {
+		return
+	}
+	
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	
+	s.clientRequests[client]++
+}
+
 // GetStats returns current statistics
 func (s *RequestStats) GetStats() Stats {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 	
+	clients := make(map[string]int64, len(s.clientRequests))
+	for client, count := range s.clientRequests {
+		clients[client] = count
+	}
+	
 	return Stats{
-		TotalRequests: s.totalRequests,
-		SuccessCount:  s.successCount,
-		ErrorCount:    s.errorCount,
-		AvgDuration:   s.avgDuration,
-		ReqPerSecond:  s.reqPerSecond,
-		LastUpdate:    s.lastUpdate,
+		TotalRequests:  s.totalRequests,
+		SuccessCount:   s.successCount,
+		ErrorCount:     s.errorCount,
+		AvgDuration:    s.avgDuration,
+		ReqPerSecond:   s.reqPerSecond,
+		LastUpdate:     s.lastUpdate,
+		ClientRequests: clients,
 	}
 }
 
@@ -118,6 +140,9 @@ type Stats struct {
 	AvgDuration   time.Duration
 	ReqPerSecond  float64
 	LastUpdate    time.Time
+	
+	// ClientRequests counts requests per proxy client name
+	ClientRequests map[string]int64
 }
 
 // String returns a formatted string of the stats
@@ -169,4 +169,16 @@ func TestRequestStats_DebugZeroRate(t *testing.T) {
 	// This MUST not be zero
 	assert.NotEqual(t, 0.0, result.ReqPerSecond, 
 		"ReqPerSecond is 0.0! recentRequests length: %d", len(stats.recentRequests))
-}
\ No newline at end of file
+}
+
+func TestRequestStats_RecordClient(t *testing.T) {
+	stats := NewRequestStats()
+
+	stats.RecordClient("laptop")
+	stats.RecordClient("laptop")
+	stats.RecordClient("ci")
+	stats.RecordClient("")
+
+	result := stats.GetStats()
+	assert.Equal(t, map[string]int64{"laptop": 2, "ci": 1}, result.ClientRequests)
+}